@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	ApiConfigResponse struct {
+		Opts          config.Opts             `json:"opts"`
+		Subscriptions []ApiConfigSubscription `json:"subscriptions"`
+		Defaults      config.ConfigDefaults   `json:"defaults"`
+		Sources       []config.ConfigSource   `json:"sources"`
+		Queries       []config.ConfigQuery    `json:"queries"`
+		Disabled      []DisabledQuery         `json:"disabled"`
+		Cache         ApiConfigCache          `json:"cache"`
+	}
+
+	ApiConfigSubscription struct {
+		SubscriptionID string `json:"subscriptionID"`
+		DisplayName    string `json:"displayName"`
+		Cloud          string `json:"cloud,omitempty"`
+	}
+
+	ApiCacheEntry struct {
+		Key  string        `json:"key"`
+		Info ProbeCacheKey `json:"info"`
+		// Expires is empty for entries without expiration
+		Expires string `json:"expires,omitempty"`
+		Size    int    `json:"size"`
+	}
+
+	ApiCacheDeleteResponse struct {
+		Deleted int `json:"deleted"`
+	}
+
+	ApiConfigCache struct {
+		DefaultExpiration string `json:"defaultExpiration"`
+		CleanupInterval   string `json:"cleanupInterval"`
+		ItemCount         int    `json:"itemCount"`
+	}
+)
+
+// apiAuth protects api endpoints with the configured bearer token
+func apiAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if opts.Api.Token == "" {
+			http.Error(w, "api is disabled, set --api.token to enable", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(opts.Api.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeApiJson sends payload as json response
+func writeApiJson(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(payload); err != nil {
+		log.Error(err)
+	}
+}
+
+// handleApiConfig returns the effective runtime configuration
+func handleApiConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := ApiConfigResponse{
+		Opts:          opts.Redacted(),
+		Subscriptions: []ApiConfigSubscription{},
+		Defaults:      getConfig().Defaults,
+		Sources:       getConfig().GetSources(),
+		Queries:       getConfig().Queries,
+		Disabled:      getDisabledQueries(),
+		Cache: ApiConfigCache{
+			DefaultExpiration: MetricCacheDefaultExpiration.String(),
+			CleanupInterval:   MetricCacheCleanupInterval.String(),
+			ItemCount:         metricCache.ItemCount(),
+		},
+	}
+
+	for _, subscription := range AzureSubscriptions {
+		row := ApiConfigSubscription{}
+		if subscription.SubscriptionID != nil {
+			row.SubscriptionID = *subscription.SubscriptionID
+			row.Cloud = AzureSubscriptionClouds[strings.ToLower(*subscription.SubscriptionID)]
+		}
+		if subscription.DisplayName != nil {
+			row.DisplayName = *subscription.DisplayName
+		}
+		response.Subscriptions = append(response.Subscriptions, row)
+	}
+
+	writeApiJson(w, response)
+}
+
+// handleApiCache lists (GET) or invalidates (DELETE) cache entries, filtered by key, profile, module and query.
+// With /api/cache/{query} the query results and the probe results of all modules using the query
+// (directly or as dependency) are selected.
+func handleApiCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	matches := func(key string, info ProbeCacheKey) bool {
+		if v, ok := params["key"]; ok && v[0] != key {
+			return false
+		}
+		if v, ok := params["profile"]; ok && v[0] != info.Profile {
+			return false
+		}
+		if v, ok := params["module"]; ok && v[0] != info.Module {
+			return false
+		}
+		if v, ok := params["query"]; ok && v[0] != info.Query {
+			return false
+		}
+		return true
+	}
+
+	if queryName := strings.TrimPrefix(r.URL.Path, "/api/cache/"); queryName != r.URL.Path && queryName != "" {
+		queries := getConfig().GetDependentQueries(queryName)
+		if len(queries) == 0 {
+			http.Error(w, fmt.Sprintf("query \"%v\" not found", queryName), http.StatusNotFound)
+			return
+		}
+
+		queryMatches := cacheQueryMatcher(queries)
+		filterMatches := matches
+		matches = func(key string, info ProbeCacheKey) bool {
+			return queryMatches(info) && filterMatches(key, info)
+		}
+	}
+
+	entries := findCacheEntries(matches)
+
+	if r.Method == http.MethodDelete {
+		invalidateCacheEntries("api", entries)
+		log.Infof("api: invalidated %v cache entries", len(entries))
+		writeApiJson(w, ApiCacheDeleteResponse{Deleted: len(entries)})
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	writeApiJson(w, entries)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// caller of queries not triggered by an http request
+	AuditCallerCacheWarmup  = "cache-warmup"
+	AuditCallerCacheRefresh = "cache-refresh"
+	AuditCallerReadiness    = "readiness"
+	AuditCallerOtlpExport   = "otlp-export"
+	AuditCallerBridgeExport = "bridge-export"
+)
+
+type (
+	// AuditLogEntry is one ResourceGraph API call (one page of a query)
+	AuditLogEntry struct {
+		Time          time.Time         `json:"time"`
+		Module        string            `json:"module"`
+		Query         string            `json:"query"`
+		Cloud         string            `json:"cloud,omitempty"`
+		Params        map[string]string `json:"params,omitempty"`
+		Subscriptions []string          `json:"subscriptions"`
+		Skip          int32             `json:"skip"`
+		RowCount      int               `json:"rowCount"`
+		TotalRecords  int64             `json:"totalRecords"`
+		Duration      string            `json:"duration"`
+		Error         string            `json:"error,omitempty"`
+
+		// Azure identity used for the call and the client which triggered the probe
+		Identity string `json:"identity"`
+		Caller   string `json:"caller"`
+	}
+
+	// auditLog writes the entries as json lines to a file (or stdout)
+	auditLog struct {
+		writer io.Writer
+		mutex  sync.Mutex
+	}
+
+	auditResourceGraphClient struct {
+		client ResourceGraphClient
+	}
+)
+
+var (
+	auditLogger *auditLog
+)
+
+// initAuditLog opens the audit log if --audit.log is set, entries are appended to existing files
+func initAuditLog() error {
+	switch opts.Audit.Log {
+	case "":
+		return nil
+	case "-":
+		auditLogger = &auditLog{writer: os.Stdout}
+	default:
+		/*  #nosec G304 */
+		file, err := os.OpenFile(opts.Audit.Log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to open audit log \"%v\" for --audit.log: %w", opts.Audit.Log, err)
+		}
+		auditLogger = &auditLog{writer: file}
+	}
+
+	log.Infof("writing audit log of ResourceGraph API calls to %v", opts.Audit.Log)
+	return nil
+}
+
+// Write appends the entry as one json line
+func (a *auditLog) Write(entry AuditLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("unable to write audit log: %v", err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err := a.writer.Write(append(line, '\n')); err != nil {
+		logRateLimiter.Error(log.WithField("file", opts.Audit.Log), "unable to write audit log: "+err.Error())
+	}
+}
+
+func (c *auditResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	// streamed rows are counted while the response is decoded
+	rowCount := 0
+	if onRow := request.OnRow; onRow != nil {
+		request.OnRow = func(row interface{}) {
+			rowCount++
+			onRow(row)
+		}
+	}
+
+	startTime := time.Now()
+	result, err := c.client.Query(ctx, request)
+
+	entry := AuditLogEntry{
+		Time:          startTime,
+		Module:        request.Module,
+		Query:         request.QueryName,
+		Cloud:         request.Cloud,
+		Params:        request.Params,
+		Subscriptions: request.Subscriptions,
+		Skip:          request.Skip,
+		Duration:      time.Since(startTime).String(),
+		Identity:      getAzureRequestIdentity(request),
+		Caller:        request.Caller,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	rows, _ := getResourceGraphRows(result)
+	entry.RowCount = rowCount + len(rows)
+	if result.TotalRecords != nil {
+		entry.TotalRecords = *result.TotalRecords
+	}
+	auditLogger.Write(entry)
+
+	return result, err
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+const (
+	AzureArcApiVersion       = "2020-06-01"
+	AzureArcKeyFileMaxSize   = 4096
+	AzureArcTokenRefreshSkew = 5 * time.Minute
+	AzureArcRequestTimeout   = 30 * time.Second
+)
+
+type (
+	// azureArcTokenProvider implements the Azure Arc hybrid IMDS managed identity flow:
+	// the first request is answered with a challenge (path of a key file only readable by privileged users),
+	// the content of the key file is used as basic auth for the second request which returns the token
+	azureArcTokenProvider struct {
+		endpoint string
+		resource string
+		client   *http.Client
+
+		mutex     sync.Mutex
+		token     string
+		expiresOn time.Time
+	}
+
+	azureArcTokenResponse struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+)
+
+// isAzureArcEnvironment checks if the exporter runs on an Azure Arc-enabled server (set by the Arc agent)
+func isAzureArcEnvironment() bool {
+	return os.Getenv("IDENTITY_ENDPOINT") != "" && os.Getenv("IMDS_ENDPOINT") != ""
+}
+
+// newAzureArcAuthorizer creates an authorizer using the managed identity of the Arc-enabled server
+func newAzureArcAuthorizer(resource string) (autorest.Authorizer, error) {
+	provider := &azureArcTokenProvider{
+		endpoint: os.Getenv("IDENTITY_ENDPOINT"),
+		resource: resource,
+		client:   &http.Client{Timeout: AzureArcRequestTimeout},
+	}
+
+	if err := provider.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return autorest.NewBearerAuthorizer(provider), nil
+}
+
+// OAuthToken implements adal.OAuthTokenProvider
+func (p *azureArcTokenProvider) OAuthToken() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.token
+}
+
+// Expires returns the expiry of the current token
+func (p *azureArcTokenProvider) Expires() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.expiresOn
+}
+
+// EnsureFresh implements adal.Refresher
+func (p *azureArcTokenProvider) EnsureFresh() error {
+	return p.EnsureFreshWithContext(context.Background())
+}
+
+// Refresh implements adal.Refresher
+func (p *azureArcTokenProvider) Refresh() error {
+	return p.RefreshWithContext(context.Background())
+}
+
+// RefreshExchange implements adal.Refresher
+func (p *azureArcTokenProvider) RefreshExchange(resource string) error {
+	return p.RefreshExchangeWithContext(context.Background(), resource)
+}
+
+// EnsureFreshWithContext implements adal.RefresherWithContext
+func (p *azureArcTokenProvider) EnsureFreshWithContext(ctx context.Context) error {
+	p.mutex.Lock()
+	fresh := p.token != "" && time.Now().Add(AzureArcTokenRefreshSkew).Before(p.expiresOn)
+	p.mutex.Unlock()
+
+	if fresh {
+		return nil
+	}
+	return p.RefreshWithContext(ctx)
+}
+
+// RefreshWithContext implements adal.RefresherWithContext
+func (p *azureArcTokenProvider) RefreshWithContext(ctx context.Context) error {
+	return p.RefreshExchangeWithContext(ctx, p.resource)
+}
+
+// RefreshExchangeWithContext implements adal.RefresherWithContext
+func (p *azureArcTokenProvider) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	// challenge request
+	challengeResponse, err := p.request(ctx, resource, "")
+	if err != nil {
+		return err
+	}
+	challengeResponse.Body.Close() // nolint: errcheck
+
+	if challengeResponse.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("azure arc: expected challenge response (401), got %v", challengeResponse.Status)
+	}
+
+	secret, err := readAzureArcKeyFile(challengeResponse.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return err
+	}
+
+	// token request
+	tokenResponse, err := p.request(ctx, resource, secret)
+	if err != nil {
+		return err
+	}
+	defer tokenResponse.Body.Close() // nolint: errcheck
+
+	if tokenResponse.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(tokenResponse.Body)
+		return fmt.Errorf("azure arc: token request failed with %v: %s", tokenResponse.Status, body)
+	}
+
+	token := azureArcTokenResponse{}
+	if err := json.NewDecoder(tokenResponse.Body).Decode(&token); err != nil {
+		return fmt.Errorf("azure arc: unable to parse token response: %w", err)
+	}
+
+	expiresOn, err := token.expiresOn()
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.token = token.AccessToken
+	p.expiresOn = expiresOn
+	return nil
+}
+
+func (p *azureArcTokenProvider) request(ctx context.Context, resource, secret string) (*http.Response, error) {
+	requestUrl, err := url.Parse(p.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("azure arc: invalid identity endpoint \"%v\": %w", p.endpoint, err)
+	}
+
+	query := requestUrl.Query()
+	query.Set("api-version", AzureArcApiVersion)
+	query.Set("resource", resource)
+	requestUrl.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	if secret != "" {
+		req.Header.Set("Authorization", "Basic "+secret)
+	}
+
+	return p.client.Do(req)
+}
+
+func (t azureArcTokenResponse) expiresOn() (time.Time, error) {
+	if t.ExpiresOn != "" {
+		if seconds, err := strconv.ParseInt(t.ExpiresOn.String(), 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+	}
+
+	if t.ExpiresIn != "" {
+		if seconds, err := strconv.ParseInt(t.ExpiresIn.String(), 10, 64); err == nil {
+			return time.Now().Add(time.Duration(seconds) * time.Second), nil
+		}
+	}
+
+	return time.Time{}, errors.New("azure arc: token response without expiry")
+}
+
+// readAzureArcKeyFile reads the key file from the challenge header (Basic realm=<path>),
+// only files inside the Arc agent token directory are accepted
+func readAzureArcKeyFile(challenge string) (string, error) {
+	parts := strings.SplitN(challenge, "=", 2)
+	if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), "Basic realm") {
+		return "", fmt.Errorf("azure arc: invalid challenge header \"%v\"", challenge)
+	}
+	keyFile := filepath.Clean(parts[1])
+
+	if filepath.Dir(keyFile) != filepath.Clean(azureArcTokenDir()) || filepath.Ext(keyFile) != ".key" {
+		return "", fmt.Errorf("azure arc: key file \"%v\" is not a key file in the Arc agent token directory", keyFile)
+	}
+
+	stat, err := os.Stat(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("azure arc: unable to access key file (requires membership in group himds or Administrators): %w", err)
+	}
+	if stat.Size() > AzureArcKeyFileMaxSize {
+		return "", fmt.Errorf("azure arc: key file \"%v\" too large", keyFile)
+	}
+
+	content, err := ioutil.ReadFile(keyFile) // #nosec G304 path is restricted to the Arc agent token directory
+	if err != nil {
+		return "", fmt.Errorf("azure arc: unable to read key file (requires membership in group himds or Administrators): %w", err)
+	}
+
+	return string(content), nil
+}
+
+func azureArcTokenDir() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "AzureConnectedMachineAgent", "Tokens")
+	}
+	return "/var/opt/azcmagent/tokens"
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+// newAzureAuthorizer creates the authorizer of the cloud from the cloud credentials or from environment variables
+// (client secret, certificate, username/password or managed identity incl. Azure Arc) using the configured
+// authority host and IMDS endpoint, tokens are cached per scope (resource)
+func newAzureAuthorizer(cloud *AzureCloud) (autorest.Authorizer, error) {
+	return newAzureResourceAuthorizer(cloud, "")
+}
+
+// newAzureResourceAuthorizer creates the authorizer of the cloud for the resource (eg. storage),
+// an empty resource uses the resource manager endpoint of the cloud (or AZURE_AD_RESOURCE for the default cloud)
+func newAzureResourceAuthorizer(cloud *AzureCloud, resource string) (autorest.Authorizer, error) {
+	settings, err := auth.GetSettingsFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Environment = cloud.Environment
+	if resource != "" {
+		settings.Values[auth.Resource] = resource
+	} else if _, exists := os.LookupEnv(auth.Resource); !exists || cloud.Name != "" {
+		settings.Values[auth.Resource] = cloud.Environment.ResourceManagerEndpoint
+	}
+
+	if opts.Azure.AuthorityHost != "" && cloud.Name == "" {
+		log.Infof("using AAD authority host %v", opts.Azure.AuthorityHost)
+		settings.Environment.ActiveDirectoryEndpoint = ensureTrailingSlash(opts.Azure.AuthorityHost)
+	}
+
+	if cloud.Credentials != nil {
+		if err := applyAzureCredentials(&settings, cloud.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	authorizer, err := buildAzureAuthorizer(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheAzureAuthorizer(settings.Values[auth.Resource], authorizer), nil
+}
+
+// newAzureIdentityAuthorizer creates the authorizer of the cloud for an identity of the config (see identities),
+// tokens are cached per identity
+func newAzureIdentityAuthorizer(cloud *AzureCloud, name string, identity config.ConfigIdentity) (autorest.Authorizer, error) {
+	resource := cloud.Environment.ResourceManagerEndpoint
+	scope := resource + "#" + name
+
+	if identity.IsManagedIdentity() {
+		token, err := adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(opts.Azure.ImdsEndpoint, resource, identity.ManagedIdentityClientID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get oauth token from IMDS endpoint: %w", err)
+		}
+		return cacheAzureAuthorizer(scope, autorest.NewBearerAuthorizer(token)), nil
+	}
+
+	settings, err := auth.GetSettingsFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Environment = cloud.Environment
+	settings.Values[auth.Resource] = resource
+	if opts.Azure.AuthorityHost != "" && cloud.Name == "" {
+		settings.Environment.ActiveDirectoryEndpoint = ensureTrailingSlash(opts.Azure.AuthorityHost)
+	}
+
+	if err := applyAzureCredentials(&settings, &identity.ConfigCloudCredentials); err != nil {
+		return nil, err
+	}
+
+	authorizer, err := settings.GetAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheAzureAuthorizer(scope, authorizer), nil
+}
+
+// applyAzureCredentials replaces the credentials from environment variables with the service principal
+func applyAzureCredentials(settings *auth.EnvironmentSettings, credentials *config.ConfigCloudCredentials) error {
+	clientSecret := os.Getenv(credentials.ClientSecretEnv)
+	if clientSecret == "" {
+		return fmt.Errorf("client secret environment variable \"%v\" is empty", credentials.ClientSecretEnv)
+	}
+
+	settings.Values[auth.TenantID] = credentials.TenantID
+	settings.Values[auth.ClientID] = credentials.ClientID
+	settings.Values[auth.ClientSecret] = clientSecret
+	settings.Values[auth.CertificatePath] = ""
+	settings.Values[auth.Username] = ""
+	return nil
+}
+
+// buildAzureAuthorizer selects the authentication method
+func buildAzureAuthorizer(settings auth.EnvironmentSettings) (autorest.Authorizer, error) {
+	if !hasAzureCredentialSettings(settings) {
+		identitySelected := opts.Azure.Identity.ClientID != "" || opts.Azure.Identity.ResourceID != ""
+
+		if opts.Azure.ImdsEndpoint != "" || identitySelected {
+			return newAzureManagedIdentityAuthorizer(settings.Values[auth.Resource])
+		}
+
+		if isAzureArcEnvironment() {
+			log.Infof("using managed identity of Azure Arc-enabled server")
+			return newAzureArcAuthorizer(settings.Values[auth.Resource])
+		}
+	}
+
+	return settings.GetAuthorizer()
+}
+
+// newAzureManagedIdentityAuthorizer creates an authorizer for the system-assigned or the selected user-assigned
+// managed identity using the default or the configured IMDS endpoint
+func newAzureManagedIdentityAuthorizer(resource string) (autorest.Authorizer, error) {
+	var (
+		token *adal.ServicePrincipalToken
+		err   error
+	)
+
+	endpoint := opts.Azure.ImdsEndpoint
+	if endpoint == "" {
+		endpoint = "default"
+	}
+
+	switch {
+	case opts.Azure.Identity.ClientID != "":
+		log.Infof("using user-assigned managed identity with client id %v (IMDS endpoint: %v)", opts.Azure.Identity.ClientID, endpoint)
+		token, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(opts.Azure.ImdsEndpoint, resource, opts.Azure.Identity.ClientID)
+	case opts.Azure.Identity.ResourceID != "":
+		log.Infof("using user-assigned managed identity with resource id %v (IMDS endpoint: %v)", opts.Azure.Identity.ResourceID, endpoint)
+		token, err = adal.NewServicePrincipalTokenFromMSIWithIdentityResourceID(opts.Azure.ImdsEndpoint, resource, opts.Azure.Identity.ResourceID)
+	default:
+		log.Infof("using managed identity (IMDS endpoint: %v)", endpoint)
+		token, err = adal.NewServicePrincipalTokenFromMSI(opts.Azure.ImdsEndpoint, resource)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth token from IMDS endpoint: %w", err)
+	}
+
+	return autorest.NewBearerAuthorizer(token), nil
+}
+
+// hasAzureCredentialSettings checks if credentials (which take precedence over managed identity) are configured
+func hasAzureCredentialSettings(settings auth.EnvironmentSettings) bool {
+	return settings.Values[auth.ClientSecret] != "" ||
+		settings.Values[auth.CertificatePath] != "" ||
+		settings.Values[auth.Username] != ""
+}
+
+// getAzureRequestIdentity describes the identity used for the request (identity of the query or of the cloud)
+func getAzureRequestIdentity(request ResourceGraphRequest) string {
+	if request.Identity == "" || opts.Azure.Mock != "" || opts.Azure.Replay != "" {
+		return getAzureIdentity(getAzureCloud(request.Cloud))
+	}
+
+	identity, ok := getConfig().Identities[request.Identity]
+	switch {
+	case !ok:
+		return request.Identity
+	case identity.IsManagedIdentity():
+		return "managed-identity:" + identity.ManagedIdentityClientID
+	}
+	return "client:" + identity.ClientID
+}
+
+// getAzureIdentity describes the identity used for the cloud (client id or managed identity, mock and replay for offline modes)
+func getAzureIdentity(cloud *AzureCloud) string {
+	clientId := os.Getenv(auth.ClientID)
+	hasCredentials := os.Getenv(auth.ClientSecret) != "" || os.Getenv(auth.CertificatePath) != "" || os.Getenv(auth.Username) != ""
+
+	switch {
+	case opts.Azure.Mock != "":
+		return "mock"
+	case opts.Azure.Replay != "":
+		return "replay"
+	case cloud != nil && cloud.Credentials != nil:
+		return "client:" + cloud.Credentials.ClientID
+	case hasCredentials:
+		return "client:" + clientId
+	case opts.Azure.Identity.ClientID != "":
+		return "managed-identity:" + opts.Azure.Identity.ClientID
+	case opts.Azure.Identity.ResourceID != "":
+		return "managed-identity:" + opts.Azure.Identity.ResourceID
+	case clientId != "":
+		return "managed-identity:" + clientId
+	}
+	return "managed-identity"
+}
+
+func ensureTrailingSlash(val string) string {
+	if !strings.HasSuffix(val, "/") {
+		val += "/"
+	}
+	return val
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/subscriptions"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	AzureCloudLabel = "azureCloud"
+)
+
+type (
+	// AzureCloud is one Azure environment with its own credentials and subscriptions
+	AzureCloud struct {
+		// name of the cloud, empty for the default cloud (configured by flags)
+		Name        string
+		Environment azure.Environment
+		Credentials *config.ConfigCloudCredentials
+		Authorizer  autorest.Authorizer
+
+		// configured subscriptions (auto discovery if empty)
+		SubscriptionIDs []string
+	}
+
+	// AzureCloudSubscriptions are the subscriptions of a probe for one cloud
+	AzureCloudSubscriptions struct {
+		Cloud         *AzureCloud
+		Subscriptions []string
+	}
+)
+
+var (
+	AzureClouds []*AzureCloud
+
+	// Azure portal per environment (go-autorest only knows the classic management portal)
+	azurePortalUrls = map[string]string{
+		azure.PublicCloud.Name:       "https://portal.azure.com",
+		azure.USGovernmentCloud.Name: "https://portal.azure.us",
+		azure.ChinaCloud.Name:        "https://portal.azure.cn",
+		azure.GermanCloud.Name:       "https://portal.microsoftazure.de",
+	}
+
+	// cloud name per (lowercase) subscription id
+	AzureSubscriptionClouds = map[string]string{}
+)
+
+// initAzureClouds builds the clouds from the config (clouds) or from flags (single default cloud)
+func initAzureClouds() error {
+	AzureClouds = []*AzureCloud{}
+	AzureSubscriptionClouds = map[string]string{}
+
+	cloudConfigs := []config.ConfigCloud{}
+	if cfg := getConfig(); cfg != nil {
+		cloudConfigs = cfg.Clouds
+	}
+
+	if len(cloudConfigs) == 0 {
+		environment, err := azure.EnvironmentFromName(*opts.Azure.Environment)
+		if err != nil {
+			return err
+		}
+
+		AzureClouds = append(AzureClouds, &AzureCloud{
+			Environment:     environment,
+			SubscriptionIDs: opts.Azure.Subscription,
+		})
+		return nil
+	}
+
+	for _, cloudConfig := range cloudConfigs {
+		environment, err := azure.EnvironmentFromName(cloudConfig.Environment)
+		if err != nil {
+			return fmt.Errorf("cloud \"%v\": %w", cloudConfig.Name, err)
+		}
+
+		AzureClouds = append(AzureClouds, &AzureCloud{
+			Name:            cloudConfig.Name,
+			Environment:     environment,
+			Credentials:     cloudConfig.Credentials,
+			SubscriptionIDs: cloudConfig.Subscriptions,
+		})
+	}
+
+	return nil
+}
+
+// isMultiCloud checks if multiple clouds are configured (metrics get the azureCloud label)
+func isMultiCloud() bool {
+	return len(AzureClouds) > 0 && AzureClouds[0].Name != ""
+}
+
+// getAzureCloud returns the cloud by name, unknown names return the first (default) cloud
+func getAzureCloud(name string) *AzureCloud {
+	for _, cloud := range AzureClouds {
+		if cloud.Name == name {
+			return cloud
+		}
+	}
+
+	if len(AzureClouds) > 0 {
+		return AzureClouds[0]
+	}
+	return &AzureCloud{}
+}
+
+// PortalUrl returns the Azure portal url of the cloud (public portal for unknown environments)
+func (c *AzureCloud) PortalUrl() string {
+	if portalUrl, ok := azurePortalUrls[c.Environment.Name]; ok {
+		return portalUrl
+	}
+	return azurePortalUrls[azure.PublicCloud.Name]
+}
+
+// getSubscriptionPortalUrls returns the Azure portal url per (lowercase) subscription id if multiple clouds are configured
+func getSubscriptionPortalUrls() map[string]string {
+	ret := map[string]string{}
+	for subscriptionId, cloudName := range AzureSubscriptionClouds {
+		if cloud := getAzureCloud(cloudName); cloud.Name != "" {
+			ret[subscriptionId] = cloud.PortalUrl()
+		}
+	}
+	return ret
+}
+
+// groupSubscriptionsByCloud splits the subscription list into the clouds of the subscriptions,
+// unknown subscriptions (and empty subscription lists) are assigned to the first (default) cloud
+func groupSubscriptionsByCloud(subscriptionIds []string) []AzureCloudSubscriptions {
+	if len(subscriptionIds) == 0 {
+		return []AzureCloudSubscriptions{{Cloud: getAzureCloud("")}}
+	}
+
+	ret := []AzureCloudSubscriptions{}
+	index := map[*AzureCloud]int{}
+
+	for _, subscriptionId := range subscriptionIds {
+		cloud := getAzureCloud(AzureSubscriptionClouds[strings.ToLower(subscriptionId)])
+
+		i, exists := index[cloud]
+		if !exists {
+			i = len(ret)
+			index[cloud] = i
+			ret = append(ret, AzureCloudSubscriptions{Cloud: cloud})
+		}
+		ret[i].Subscriptions = append(ret[i].Subscriptions, subscriptionId)
+	}
+
+	return ret
+}
+
+// connect creates the authorizer of the cloud and fetches (or discovers) the subscriptions
+func (c *AzureCloud) connect(ctx context.Context) (subscriptionList []subscriptions.Subscription, errs []error) {
+	var err error
+	c.Authorizer, err = newAzureAuthorizer(c)
+	if err != nil {
+		return nil, []error{c.wrapError(fmt.Errorf("unable to setup Azure authorizer: %w", err))}
+	}
+
+	subscriptionsClient := subscriptions.NewClientWithBaseURI(c.Environment.ResourceManagerEndpoint)
+	decorateAzureAutoRest(&subscriptionsClient.Client, c.Authorizer)
+
+	if len(c.SubscriptionIDs) == 0 {
+		// auto lookup subscriptions (tenant level list, includes Azure Lighthouse delegated subscriptions)
+		listResult, err := subscriptionsClient.ListComplete(ctx)
+		if err != nil {
+			return nil, []error{c.wrapError(fmt.Errorf("unable to list Azure subscriptions: %w", err))}
+		}
+		for listResult.NotDone() {
+			subscriptionList = append(subscriptionList, listResult.Value())
+			if err := listResult.NextWithContext(ctx); err != nil {
+				return nil, []error{c.wrapError(fmt.Errorf("unable to list Azure subscriptions: %w", err))}
+			}
+		}
+
+		if len(subscriptionList) == 0 {
+			return nil, []error{c.wrapError(errors.New("no Azure Subscriptions found via auto detection, does this ServicePrincipal have read permissions to the subscriptions? (see check-permissions command)"))}
+		}
+	} else {
+		// fixed subscription list, inaccessible subscriptions are skipped (eg. revoked permissions)
+		for _, subId := range c.SubscriptionIDs {
+			result, err := subscriptionsClient.Get(ctx, subId)
+			if err != nil {
+				log.WithField("subscriptionID", subId).Warn(c.wrapError(fmt.Errorf("unable to fetch Azure subscription \"%v\", subscription is skipped: %w", subId, err)).Error())
+				prometheusSubscriptionAccessError.WithLabelValues(subId, c.Name).Set(1)
+				continue
+			}
+			prometheusSubscriptionAccessError.WithLabelValues(subId, c.Name).Set(0)
+			subscriptionList = append(subscriptionList, result)
+		}
+
+		if len(subscriptionList) == 0 {
+			return nil, []error{c.wrapError(errors.New("none of the configured Azure Subscriptions is accessible, does this ServicePrincipal have read permissions to the subscriptions? (see check-permissions command)"))}
+		}
+	}
+
+	for _, subscription := range subscriptionList {
+		if subscription.SubscriptionID != nil {
+			AzureSubscriptionClouds[strings.ToLower(*subscription.SubscriptionID)] = c.Name
+		}
+	}
+
+	return
+}
+
+func (c *AzureCloud) wrapError(err error) error {
+	if c.Name == "" {
+		return err
+	}
+	return fmt.Errorf("cloud \"%v\": %w", c.Name, err)
+}
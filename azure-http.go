@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+)
+
+var (
+	azureHttpClientInstance *http.Client
+	azureHttpClientOnce     sync.Once
+
+	azureHttpTLSVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// azureHttpClient returns the shared http client for all Azure SDK clients (built once from --azure.http.* flags)
+func azureHttpClient() *http.Client {
+	azureHttpClientOnce.Do(func() {
+		azureHttpClientInstance = newAzureHttpClient()
+	})
+	return azureHttpClientInstance
+}
+
+// newAzureHttpClient builds the http client, defaults are the same as the autorest default sender
+func newAzureHttpClient() *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     !opts.Azure.Http.DisableHTTP2,
+		MaxIdleConns:          opts.Azure.Http.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.Azure.Http.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.Azure.Http.MaxConnsPerHost,
+		IdleConnTimeout:       opts.Azure.Http.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion:    azureHttpTLSVersions[opts.Azure.Http.TLSMinVersion],
+			Renegotiation: tls.RenegotiateNever,
+		},
+	}
+
+	if opts.Azure.Http.DisableHTTP2 {
+		// non-nil empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:       jar,
+		Transport: transport,
+	}
+}
+
+// validateAzureHttpFlags checks the --azure.http.* flags
+func validateAzureHttpFlags() (errs []error) {
+	if opts.Azure.Http.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("--azure.http.max-idle-conns must not be negative"))
+	}
+
+	if opts.Azure.Http.MaxIdleConnsPerHost < 0 {
+		errs = append(errs, errors.New("--azure.http.max-idle-conns-per-host must not be negative"))
+	}
+
+	if opts.Azure.Http.MaxConnsPerHost < 0 {
+		errs = append(errs, errors.New("--azure.http.max-conns-per-host must not be negative"))
+	}
+
+	if opts.Azure.Http.IdleConnTimeout < 0 {
+		errs = append(errs, errors.New("--azure.http.idle-conn-timeout must not be negative"))
+	}
+
+	return
+}
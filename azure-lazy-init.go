@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrAzureNotReady = errors.New("Azure connection is not initialized yet")
+
+	// set if the Azure connection is initialized (subscriptions discovered), probes are rejected before
+	azureReady int32
+)
+
+// isAzureLazyInit checks if the Azure connection is initialized in background (--azure.lazy-init),
+// mock and replay mode don't need Azure access
+func isAzureLazyInit() bool {
+	return opts.Azure.LazyInit.Enable && opts.Azure.Mock == "" && opts.Azure.Replay == ""
+}
+
+func isAzureReady() bool {
+	return atomic.LoadInt32(&azureReady) == 1
+}
+
+func setAzureReady() {
+	atomic.StoreInt32(&azureReady, 1)
+}
+
+// startAzureLazyInit connects to Azure in background and retries until authentication and subscription discovery
+// succeed, the exporter is ready afterwards (cache warmup is started if enabled)
+func startAzureLazyInit() {
+	go func() {
+		for attempt := 1; ; attempt++ {
+			errs := connectAzureClouds()
+			if len(errs) == 0 && opts.Azure.Record != "" {
+				if err := recordSubscriptions(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if len(errs) == 0 {
+				setAzureReady()
+				log.Infof("Azure connection initialized after %v attempt(s), %v subscriptions found", attempt, len(AzureSubscriptions))
+				startCriticalQueries()
+				if opts.Cache.Warmup {
+					log.Infof("starting cache warmup")
+					startCacheWarmup()
+				}
+				if opts.Cache.Refresh.Enable {
+					log.Infof("starting background cache refresh")
+					startCacheRefresh()
+				}
+				if isOtlpExportEnabled() {
+					startOtlpExport()
+				}
+				if isBridgeExportEnabled() {
+					startBridgeExport()
+				}
+				return
+			}
+
+			for _, err := range errs {
+				log.WithField("attempt", attempt).Warnf("Azure init failed, retrying in %v: %v", opts.Azure.LazyInit.RetryInterval.String(), err)
+			}
+
+			select {
+			case <-time.After(opts.Azure.LazyInit.RetryInterval):
+			case <-lifecycleQuit:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/resources"
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/subscriptions"
+)
+
+const (
+	PermissionCheckOk = "ok"
+)
+
+type (
+	// permissionCheckResult is the result of all checks of one subscription
+	permissionCheckResult struct {
+		Cloud          string
+		SubscriptionID string
+		Name           string
+
+		// check results (ok or short error), hints explain failed checks
+		Subscription  string
+		Read          string
+		ResourceGraph string
+		Hints         []string
+	}
+)
+
+// checkPermissions checks the access of the identity to all target subscriptions (discovered or configured
+// by flags, cloud config, profiles and queries) and writes a report, returns an error if any check failed
+func checkPermissions(ctx context.Context, w io.Writer) error {
+	if opts.Azure.Mock != "" || opts.Azure.Replay != "" {
+		return errors.New("permission check is not available in mock and replay mode")
+	}
+
+	if err := initAzureClouds(); err != nil {
+		return err
+	}
+
+	configSubscriptions := getConfigSubscriptionIDs()
+
+	failed := 0
+	for _, cloud := range AzureClouds {
+		fmt.Fprintf(w, "cloud: %v (%v)\nidentity: %v\n\n", cloud.Environment.Name, cloud.Name, getAzureIdentity(cloud)) // nolint: errcheck
+
+		results, err := cloud.checkPermissions(ctx, configSubscriptions)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "ERROR: %v\n\n", err) // nolint: errcheck
+			continue
+		}
+
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "SUBSCRIPTION\tNAME\tSUBSCRIPTION ACCESS\tREAD\tRESOURCEGRAPH") // nolint: errcheck
+		for _, result := range results {
+			fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\n", result.SubscriptionID, result.Name, result.Subscription, result.Read, result.ResourceGraph) // nolint: errcheck
+		}
+		table.Flush()   // nolint: errcheck
+		fmt.Fprintln(w) // nolint: errcheck
+
+		for _, result := range results {
+			if len(result.Hints) == 0 {
+				continue
+			}
+			failed++
+			for _, hint := range result.Hints {
+				fmt.Fprintf(w, "%v: %v\n", result.SubscriptionID, hint) // nolint: errcheck
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("permission check failed for %v scope(s)", failed)
+	}
+
+	fmt.Fprintln(w, "all permission checks passed") // nolint: errcheck
+	return nil
+}
+
+// checkPermissions checks the subscriptions of the cloud (incl. subscriptions of the config without known cloud)
+func (c *AzureCloud) checkPermissions(ctx context.Context, configSubscriptions []string) ([]*permissionCheckResult, error) {
+	discovered, errs := c.connect(ctx)
+	if len(errs) > 0 && (c.Authorizer == nil || (len(discovered) == 0 && len(c.SubscriptionIDs) == 0)) {
+		return nil, fmt.Errorf("%w\nhint: assign the Reader role on the subscriptions (or a management group) to %v", errs[0], getAzureIdentity(c))
+	}
+
+	results := map[string]*permissionCheckResult{}
+	addResult := func(subscriptionId string) *permissionCheckResult {
+		subscriptionId = strings.ToLower(subscriptionId)
+		if _, exists := results[subscriptionId]; !exists {
+			results[subscriptionId] = &permissionCheckResult{Cloud: c.Name, SubscriptionID: subscriptionId}
+		}
+		return results[subscriptionId]
+	}
+
+	for _, subscriptionId := range c.SubscriptionIDs {
+		addResult(subscriptionId)
+	}
+	for _, subscription := range discovered {
+		if subscription.SubscriptionID != nil {
+			result := addResult(*subscription.SubscriptionID)
+			if subscription.DisplayName != nil {
+				result.Name = *subscription.DisplayName
+			}
+		}
+	}
+	for _, subscriptionId := range configSubscriptions {
+		if cloudName, known := AzureSubscriptionClouds[subscriptionId]; (known && cloudName == c.Name) || (!known && c == AzureClouds[0]) {
+			addResult(subscriptionId)
+		}
+	}
+
+	subscriptionsClient := subscriptions.NewClientWithBaseURI(c.Environment.ResourceManagerEndpoint)
+	decorateAzureAutoRest(&subscriptionsClient.Client, c.Authorizer)
+
+	subscriptionIds := []string{}
+	for subscriptionId, result := range results {
+		subscriptionIds = append(subscriptionIds, subscriptionId)
+
+		// subscription must be visible and enabled
+		subscription, err := subscriptionsClient.Get(ctx, subscriptionId)
+		switch {
+		case err != nil:
+			result.Subscription = "failed"
+			result.Hints = append(result.Hints, fmt.Sprintf("unable to fetch subscription: %v (hint: assign the Reader role on the subscription)", err))
+		case subscription.State != subscriptions.StateEnabled:
+			result.Subscription = strings.ToLower(string(subscription.State))
+			result.Hints = append(result.Hints, fmt.Sprintf("subscription is %v, queries return no resources", subscription.State))
+		default:
+			result.Subscription = PermissionCheckOk
+		}
+		if subscription.DisplayName != nil {
+			result.Name = *subscription.DisplayName
+		}
+
+		// read permission on subscription level (Reader role)
+		groupsClient := resources.NewGroupsClientWithBaseURI(c.Environment.ResourceManagerEndpoint, subscriptionId)
+		decorateAzureAutoRest(&groupsClient.Client, c.Authorizer)
+		top := int32(1)
+		if _, err := groupsClient.List(ctx, "", &top); err != nil {
+			result.Read = "failed"
+			result.Hints = append(result.Hints, fmt.Sprintf("unable to list resource groups: %v (hint: assign the Reader role on the subscription)", err))
+		} else {
+			result.Read = PermissionCheckOk
+		}
+	}
+	sort.Strings(subscriptionIds)
+
+	// ResourceGraph only returns subscriptions (and their resources) readable by the identity
+	visible, err := c.getResourceGraphSubscriptions(ctx, subscriptionIds)
+	for _, subscriptionId := range subscriptionIds {
+		result := results[subscriptionId]
+		switch {
+		case err != nil:
+			result.ResourceGraph = "failed"
+			result.Hints = append(result.Hints, fmt.Sprintf("ResourceGraph query failed: %v", err))
+		case !visible[subscriptionId]:
+			result.ResourceGraph = "not visible"
+			result.Hints = append(result.Hints, "subscription is not visible in ResourceGraph (hint: assign the Reader role on the subscription, new role assignments can take some minutes)")
+		default:
+			result.ResourceGraph = PermissionCheckOk
+		}
+	}
+
+	ret := []*permissionCheckResult{}
+	for _, subscriptionId := range subscriptionIds {
+		ret = append(ret, results[subscriptionId])
+	}
+	return ret, nil
+}
+
+// getResourceGraphSubscriptions returns the (lowercase) subscriptions visible in ResourceGraph
+func (c *AzureCloud) getResourceGraphSubscriptions(ctx context.Context, subscriptionIds []string) (map[string]bool, error) {
+	visible := map[string]bool{}
+	if len(subscriptionIds) == 0 {
+		return visible, nil
+	}
+
+	request := ResourceGraphRequest{
+		Module:        "check-permissions",
+		QueryName:     "subscriptions",
+		Cloud:         c.Name,
+		Params:        map[string]string{},
+		Query:         "ResourceContainers\n| where type =~ 'microsoft.resources/subscriptions'\n| project subscriptionId",
+		Subscriptions: subscriptionIds,
+		Caller:        "check-permissions",
+	}
+	_, err := executeResourceGraphQuery(ctx, newResourceGraphClient(), request, nil, func(row map[string]interface{}) {
+		if subscriptionId, ok := row["subscriptionId"].(string); ok {
+			visible[strings.ToLower(subscriptionId)] = true
+		}
+	})
+	return visible, err
+}
+
+// getConfigSubscriptionIDs returns the (lowercase) subscriptions used in profiles, defaults and queries of the config
+func getConfigSubscriptionIDs() []string {
+	cfg := getConfig()
+	if cfg == nil {
+		return nil
+	}
+
+	subscriptionIds := map[string]bool{}
+	for _, profile := range cfg.Profiles {
+		for _, subscriptionId := range profile.Subscriptions {
+			subscriptionIds[strings.ToLower(subscriptionId)] = true
+		}
+	}
+	for _, queryConfig := range cfg.Queries {
+		if queryConfig.Subscriptions != nil {
+			for _, subscriptionId := range *queryConfig.Subscriptions {
+				subscriptionIds[strings.ToLower(subscriptionId)] = true
+			}
+		}
+	}
+
+	ret := []string{}
+	for subscriptionId := range subscriptionIds {
+		ret = append(ret, subscriptionId)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	AzureTokenRefreshRetryInterval = 1 * time.Minute
+	AzureTokenRefreshMinInterval   = 30 * time.Second
+)
+
+type (
+	// azureTokenProvider is implemented by all token providers supporting refreshes (adal tokens and Azure Arc)
+	azureTokenProvider interface {
+		adal.OAuthTokenProvider
+		adal.RefresherWithContext
+	}
+
+	// azureCachedToken wraps a token provider, tracks token expiry and refreshes the token proactively before expiry
+	azureCachedToken struct {
+		scope    string
+		provider azureTokenProvider
+		logger   *log.Entry
+
+		mutex   sync.Mutex
+		expires time.Time
+	}
+)
+
+var (
+	azureTokenCache      = map[string]*azureCachedToken{}
+	azureTokenCacheMutex sync.Mutex
+)
+
+// cacheAzureAuthorizer returns an authorizer using the cached token of the scope,
+// authorizers not based on refreshable tokens are returned unchanged
+func cacheAzureAuthorizer(scope string, authorizer autorest.Authorizer) autorest.Authorizer {
+	azureTokenCacheMutex.Lock()
+	defer azureTokenCacheMutex.Unlock()
+
+	if cachedToken, exists := azureTokenCache[scope]; exists {
+		return autorest.NewBearerAuthorizer(cachedToken)
+	}
+
+	bearerAuthorizer, ok := authorizer.(*autorest.BearerAuthorizer)
+	if !ok {
+		return authorizer
+	}
+
+	provider, ok := bearerAuthorizer.TokenProvider().(azureTokenProvider)
+	if !ok {
+		return authorizer
+	}
+
+	if spt, ok := provider.(*adal.ServicePrincipalToken); ok {
+		// token requests share the tuned http client of the Azure SDK clients
+		spt.SetSender(azureHttpClient())
+	}
+
+	cachedToken := &azureCachedToken{
+		scope:    scope,
+		provider: provider,
+		logger:   log.WithField("scope", scope),
+	}
+	if cachedToken.updateExpiry() {
+		// initial token acquisition
+		prometheusAzureTokenRequests.WithLabelValues(scope).Inc()
+	}
+	azureTokenCache[scope] = cachedToken
+
+	if opts.Azure.Token.RefreshBefore > 0 {
+		go cachedToken.startProactiveRefresh()
+	}
+
+	return autorest.NewBearerAuthorizer(cachedToken)
+}
+
+// startProactiveRefresh refreshes the token before it expires so scrapes never wait for token acquisition
+func (t *azureCachedToken) startProactiveRefresh() {
+	for {
+		time.Sleep(t.nextRefresh())
+
+		t.logger.Debug("refreshing token proactively")
+		if err := t.RefreshWithContext(context.Background()); err != nil {
+			t.logger.Warnf("proactive token refresh failed, retrying in %v: %v", AzureTokenRefreshRetryInterval, err)
+			time.Sleep(AzureTokenRefreshRetryInterval)
+		}
+	}
+}
+
+// nextRefresh returns the wait duration until the next proactive refresh
+func (t *azureCachedToken) nextRefresh() time.Duration {
+	t.mutex.Lock()
+	expires := t.expires
+	t.mutex.Unlock()
+
+	if expires.IsZero() {
+		return AzureTokenRefreshRetryInterval
+	}
+
+	wait := time.Until(expires.Add(-opts.Azure.Token.RefreshBefore))
+	if wait < AzureTokenRefreshMinInterval {
+		wait = AzureTokenRefreshMinInterval
+	}
+	return wait
+}
+
+// updateExpiry reads the expiry of the current token and updates the expiry metric
+func (t *azureCachedToken) updateExpiry() bool {
+	var expires time.Time
+	switch provider := t.provider.(type) {
+	case *adal.ServicePrincipalToken:
+		if token := provider.Token(); token.AccessToken != "" {
+			expires = token.Expires()
+		}
+	case *azureArcTokenProvider:
+		expires = provider.Expires()
+	}
+
+	t.mutex.Lock()
+	changed := !expires.Equal(t.expires)
+	t.expires = expires
+	t.mutex.Unlock()
+
+	if !expires.IsZero() {
+		prometheusAzureTokenExpiry.WithLabelValues(t.scope).Set(float64(expires.Unix()))
+	}
+	return changed
+}
+
+// track records the result of a token operation
+func (t *azureCachedToken) track(err error) error {
+	if err != nil {
+		prometheusAzureTokenErrors.WithLabelValues(t.scope).Inc()
+		return err
+	}
+
+	if t.updateExpiry() {
+		prometheusAzureTokenRequests.WithLabelValues(t.scope).Inc()
+		t.logger.Debugf("acquired new token, expires %v", t.expires)
+	}
+	return nil
+}
+
+// OAuthToken implements adal.OAuthTokenProvider
+func (t *azureCachedToken) OAuthToken() string {
+	return t.provider.OAuthToken()
+}
+
+// EnsureFreshWithContext implements adal.RefresherWithContext
+func (t *azureCachedToken) EnsureFreshWithContext(ctx context.Context) error {
+	return t.track(t.provider.EnsureFreshWithContext(ctx))
+}
+
+// RefreshWithContext implements adal.RefresherWithContext
+func (t *azureCachedToken) RefreshWithContext(ctx context.Context) error {
+	return t.track(t.provider.RefreshWithContext(ctx))
+}
+
+// RefreshExchangeWithContext implements adal.RefresherWithContext
+func (t *azureCachedToken) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	return t.track(t.provider.RefreshExchangeWithContext(ctx, resource))
+}
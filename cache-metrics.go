@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// cacheEntriesCollector exports the current number of cache entries per module and query on every scrape
+	cacheEntriesCollector struct{}
+)
+
+var (
+	cacheEntriesDesc = prometheus.NewDesc(
+		"azure_resourcegraph_cache_entries",
+		"Azure ResourceGraph current number of cache entries per module and query (empty query for probe results)",
+		[]string{"module", "query"},
+		nil,
+	)
+)
+
+// initCacheMetrics counts the cache entries removed after expiry (deleted entries are counted as invalidations)
+func initCacheMetrics() {
+	metricCache.OnEvicted(func(key string, value interface{}) {
+		if entry, ok := value.(probeCacheEntry); ok && !entry.Expires.After(time.Now()) {
+			prometheusCacheExpired.With(prometheus.Labels{"module": entry.Key.Module, "query": entry.Key.Query}).Inc()
+		}
+	})
+}
+
+func (c *cacheEntriesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheEntriesDesc
+}
+
+func (c *cacheEntriesCollector) Collect(ch chan<- prometheus.Metric) {
+	if metricCache == nil {
+		return
+	}
+
+	type entryKey struct{ module, query string }
+	counts := map[entryKey]int{}
+	for _, item := range metricCache.Items() {
+		if entry, ok := item.Object.(probeCacheEntry); ok {
+			counts[entryKey{entry.Key.Module, entry.Key.Query}]++
+		}
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(count), key.module, key.query)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	// the interval of a module is doubled if the execution takes longer than this fraction of the interval
+	CacheRefreshSlowThreshold = 0.5
+	// the interval of a module is halved (down to the base interval) if the execution is faster than this fraction
+	CacheRefreshFastThreshold = 0.2
+	// max factor of the adapted interval compared to the base interval
+	CacheRefreshMaxIntervalFactor = 4
+	// check interval of the scheduler
+	CacheRefreshTick = 1 * time.Second
+)
+
+type (
+	// cacheRefreshModule is the schedule of one module in background collector mode
+	cacheRefreshModule struct {
+		module       string
+		baseInterval time.Duration
+		interval     time.Duration
+		nextRun      time.Time
+		running      bool
+	}
+)
+
+var (
+	cacheRefreshModules      = map[string]*cacheRefreshModule{}
+	cacheRefreshModulesMutex sync.Mutex
+
+	// config of the current schedules, the schedules are rebuilt after config reloads
+	cacheRefreshConfig *config.Config
+)
+
+// startCacheRefresh executes all modules of the default profile periodically in background (background collector mode).
+// The executions are spread over the interval (stable offset per module plus jitter) and the interval of a module
+// is increased if its execution takes too long compared to the interval.
+func startCacheRefresh() {
+	go func() {
+		ticker := time.NewTicker(CacheRefreshTick)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			for _, schedule := range updateCacheRefreshSchedule(now) {
+				go runCacheRefresh(schedule)
+			}
+		}
+	}()
+}
+
+// updateCacheRefreshSchedule syncs the schedules with the modules of the current config (after reloads) and returns the due modules
+func updateCacheRefreshSchedule(now time.Time) (due []*cacheRefreshModule) {
+	cacheRefreshModulesMutex.Lock()
+	defer cacheRefreshModulesMutex.Unlock()
+
+	if currentConfig := getConfig(); currentConfig != cacheRefreshConfig {
+		cacheRefreshConfig = currentConfig
+
+		schedules := map[string]*cacheRefreshModule{}
+		for _, module := range currentConfig.GetModules() {
+			probe, err := newProbe(module, opts.Config.Profile)
+			if err != nil {
+				if !errors.Is(err, ErrModuleNotEnabled) {
+					log.WithField("module", module).Warnf("cache refresh skipped: %v", err)
+				}
+				continue
+			}
+
+			interval := getCacheRefreshBaseInterval(probe)
+			if schedule, exists := cacheRefreshModules[module]; exists && schedule.baseInterval == interval {
+				schedules[module] = schedule
+				continue
+			}
+
+			schedules[module] = &cacheRefreshModule{
+				module:       module,
+				baseInterval: interval,
+				interval:     interval,
+				nextRun:      now.Add(cacheRefreshOffset(module, interval)),
+			}
+			prometheusCacheRefreshInterval.WithLabelValues(module).Set(interval.Seconds())
+		}
+
+		for module := range cacheRefreshModules {
+			if _, exists := schedules[module]; !exists {
+				prometheusCacheRefreshInterval.DeleteLabelValues(module)
+			}
+		}
+		cacheRefreshModules = schedules
+	}
+
+	for _, schedule := range cacheRefreshModules {
+		if !schedule.running && !now.Before(schedule.nextRun) {
+			schedule.running = true
+			due = append(due, schedule)
+		}
+	}
+
+	return
+}
+
+// runCacheRefresh executes the module, stores the result in the cache and schedules the next execution
+func runCacheRefresh(schedule *cacheRefreshModule) {
+	startTime := time.Now()
+	probe, err := newProbe(schedule.module, opts.Config.Profile)
+	if err == nil {
+		probe.Caller = AuditCallerCacheRefresh
+
+		var metricList kusto.MetricList
+		if metricList, err = probe.Execute(context.Background()); err == nil {
+			// keep the result until the next execution has finished
+			err = probe.StoreCache(metricList, schedule.interval*2)
+		}
+	}
+	duration := time.Since(startTime)
+
+	contextLogger := log.WithField("module", schedule.module)
+	if err != nil {
+		contextLogger.Warnf("cache refresh failed: %v", err)
+	}
+
+	cacheRefreshModulesMutex.Lock()
+	defer cacheRefreshModulesMutex.Unlock()
+
+	interval := schedule.interval
+	switch {
+	case duration.Seconds() > interval.Seconds()*CacheRefreshSlowThreshold && interval < schedule.baseInterval*CacheRefreshMaxIntervalFactor:
+		interval *= 2
+		contextLogger.Warnf("cache refresh took %v, increasing interval to %v", duration.String(), interval.String())
+	case duration.Seconds() < interval.Seconds()*CacheRefreshFastThreshold && interval > schedule.baseInterval:
+		interval /= 2
+		contextLogger.Infof("cache refresh took %v, decreasing interval to %v", duration.String(), interval.String())
+	}
+
+	schedule.interval = interval
+	schedule.nextRun = startTime.Add(cacheRefreshJitter(interval))
+	schedule.running = false
+
+	prometheusCacheRefreshInterval.WithLabelValues(schedule.module).Set(interval.Seconds())
+	prometheusCacheRefreshDuration.With(prometheus.Labels{"module": schedule.module}).Observe(duration.Seconds())
+}
+
+// getCacheRefreshBaseInterval returns the refresh interval of the probe (cache duration of the profile or --cache.warmup.ttl)
+func getCacheRefreshBaseInterval(probe *Probe) time.Duration {
+	if probe.CacheTime > 0 {
+		return probe.CacheTime
+	}
+	return opts.Cache.WarmupTtl
+}
+
+// cacheRefreshOffset returns a stable offset of the module within the interval so executions are spread evenly
+func cacheRefreshOffset(module string, interval time.Duration) time.Duration {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(module))
+	return time.Duration(float64(interval) * float64(hash.Sum32()) / float64(^uint32(0)))
+}
+
+// cacheRefreshJitter adds a random jitter (--cache.refresh.jitter) to the interval
+func cacheRefreshJitter(interval time.Duration) time.Duration {
+	jitter := float64(interval) * opts.Cache.Refresh.Jitter
+	/* #nosec G404 */
+	return interval + time.Duration((rand.Float64()*2-1)*jitter)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// startCacheWarmup executes all modules of the default profile in the background and stores the results in the cache
+func startCacheWarmup() {
+	modules := []string{}
+	moduleSeen := map[string]bool{}
+	for _, queryConfig := range getConfig().Queries {
+		if !moduleSeen[queryConfig.Module] {
+			moduleSeen[queryConfig.Module] = true
+			modules = append(modules, queryConfig.Module)
+		}
+	}
+
+	go func() {
+		startTime := time.Now()
+		for _, module := range modules {
+			warmupCache(module)
+		}
+		log.WithField("duration", time.Since(startTime).String()).Infof("cache warmup finished for %v modules", len(modules))
+	}()
+}
+
+func warmupCache(module string) {
+	probe, err := newProbe(module, opts.Config.Profile)
+	if err != nil {
+		if !errors.Is(err, ErrModuleNotEnabled) {
+			log.WithField("module", module).Warnf("cache warmup skipped: %v", err)
+		}
+		return
+	}
+	probe.Caller = AuditCallerCacheWarmup
+
+	ttl := opts.Cache.WarmupTtl
+	if probe.CacheTime > 0 {
+		ttl = probe.CacheTime
+	}
+
+	probe.Logger.Debug("starting cache warmup")
+	metricList, err := probe.Execute(context.Background())
+	if err != nil {
+		probe.Logger.Warnf("cache warmup failed: %v", err)
+		return
+	}
+
+	if err := probe.StoreCache(metricList, ttl); err != nil {
+		probe.Logger.Warnf("cache warmup failed: %v", err)
+	}
+}
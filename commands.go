@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	SchemaCommand struct{}
+
+	CheckPermissionsCommand struct{}
+
+	DiffCommand struct {
+		Url              string `long:"url"                required:"true"  description:"Url of the running instance (eg. http://exporter:8080)"`
+		Token            string `long:"token"              env:"DIFF_TOKEN" description:"Token for /api/config of the running instance (default: --api.token)"`
+		DetailedExitCode bool   `long:"detailed-exitcode"  description:"Return exit code 2 if metrics are changed"`
+	}
+)
+
+// initCommands registers the subcommands
+func initCommands() {
+	if _, err := argparser.AddCommand(
+		"schema",
+		"Print JSON Schema of the config file",
+		"Print the JSON Schema of the config file (for editor and CI validation of query files)",
+		&SchemaCommand{},
+	); err != nil {
+		panic(err)
+	}
+
+	if _, err := argparser.AddCommand(
+		"check-permissions",
+		"Check Azure permissions of the identity",
+		"Check the access of the configured identity (subscription, Reader and ResourceGraph) to all target subscriptions and print a report per subscription",
+		&CheckPermissionsCommand{},
+	); err != nil {
+		panic(err)
+	}
+
+	if _, err := argparser.AddCommand(
+		"diff",
+		"Show metric changes of the config compared to a running instance",
+		"Compare the metrics of the config (flags and config file) with the config of a running instance (via /api/config) and print the metrics which would be added, changed, renamed or removed",
+		&DiffCommand{},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// Execute prints the JSON Schema of the config file
+func (c *SchemaCommand) Execute(args []string) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(config.JsonSchema())
+}
+
+// Execute checks the permissions on all subscriptions of the flags and config (if set)
+func (c *CheckPermissionsCommand) Execute(args []string) error {
+	initGlobalMetrics()
+	initLogRateLimiter()
+
+	if isConfigSet() {
+		if errs := readConfig(); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+
+	return checkPermissions(context.Background(), os.Stdout)
+}
+
+// Execute prints the metric changes of the config compared to the running instance
+func (c *DiffCommand) Execute(args []string) error {
+	if !isConfigSet() {
+		return errors.New("no config set, use --config or --config.queries")
+	}
+
+	newConfig, errs := loadConfig()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	token := c.Token
+	if token == "" {
+		token = opts.Api.Token
+	}
+
+	runningQueries, err := fetchRunningConfigQueries(context.Background(), c.Url, token)
+	if err != nil {
+		return err
+	}
+
+	diff := buildConfigDiff(runningQueries, newConfig.Queries)
+	diff.Write(os.Stdout)
+
+	if c.DetailedExitCode && diff.HasChanges() {
+		os.Exit(ConfigDiffExitCodeChanges)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	ConfigDiffApiPath        = "/api/config"
+	ConfigDiffRequestTimeout = 30 * time.Second
+
+	// exit code of diff --detailed-exitcode if the metrics are changed
+	ConfigDiffExitCodeChanges = 2
+)
+
+type (
+	// configDiffMetric is a metric of a module with its label names (derived from the query config)
+	configDiffMetric struct {
+		Module  string
+		Name    string
+		Labels  []string
+		Queries []string
+	}
+
+	configDiffRename struct {
+		From configDiffMetric
+		To   configDiffMetric
+	}
+
+	configDiffLabelChange struct {
+		Metric        configDiffMetric
+		AddedLabels   []string
+		RemovedLabels []string
+	}
+
+	// configDiff contains the metric changes between the running and the new config
+	configDiff struct {
+		Added   []configDiffMetric
+		Removed []configDiffMetric
+		Renamed []configDiffRename
+		Changed []configDiffLabelChange
+	}
+
+	configDiffApiResponse struct {
+		Queries []config.ConfigQuery `json:"queries"`
+	}
+)
+
+// fetchRunningConfigQueries fetches the queries of the running instance from /api/config
+func fetchRunningConfigQueries(ctx context.Context, instanceUrl, token string) ([]config.ConfigQuery, error) {
+	apiUrl, err := url.Parse(instanceUrl)
+	if err != nil || (apiUrl.Scheme != "http" && apiUrl.Scheme != "https") || apiUrl.Host == "" {
+		return nil, fmt.Errorf("invalid url \"%v\", expected eg. http://exporter:8080", instanceUrl)
+	}
+	if !strings.HasSuffix(apiUrl.Path, ConfigDiffApiPath) {
+		apiUrl.Path = strings.TrimSuffix(apiUrl.Path, "/") + ConfigDiffApiPath
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ConfigDiffRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", UserAgent+gitTag)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // #nosec G307
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%v returned %v: %v", apiUrl.String(), resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	response := configDiffApiResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("unable to decode config of the running instance: %w", err)
+	}
+	if response.Queries == nil {
+		return nil, errors.New("config of the running instance contains no queries")
+	}
+	return response.Queries, nil
+}
+
+// buildConfigDiff compares the metrics of the running and the new queries, metrics which are removed from a query and
+// added to the same query (same name or query text) are reported as renamed
+func buildConfigDiff(runningQueries, newQueries []config.ConfigQuery) configDiff {
+	runningMetrics := collectConfigDiffMetrics(runningQueries)
+	newMetrics := collectConfigDiffMetrics(newQueries)
+
+	diff := configDiff{}
+	added := map[string]configDiffMetric{}
+	removed := map[string]configDiffMetric{}
+
+	for key, metric := range newMetrics {
+		previous, exists := runningMetrics[key]
+		if !exists {
+			added[key] = metric
+			continue
+		}
+
+		addedLabels, removedLabels := diffQuerySchemaColumns(previous.Labels, metric.Labels)
+		if len(addedLabels) > 0 || len(removedLabels) > 0 {
+			diff.Changed = append(diff.Changed, configDiffLabelChange{Metric: metric, AddedLabels: addedLabels, RemovedLabels: removedLabels})
+		}
+	}
+	for key, metric := range runningMetrics {
+		if _, exists := newMetrics[key]; !exists {
+			removed[key] = metric
+		}
+	}
+
+	// renames: the main metric of a query is changed, sub metrics keep their suffix
+	matched := map[int]bool{}
+	for _, runningQuery := range runningQueries {
+		for i, newQuery := range newQueries {
+			if matched[i] || !isConfigDiffSameQuery(runningQuery, newQuery) {
+				continue
+			}
+			matched[i] = true
+
+			if runningQuery.Metric == newQuery.Metric {
+				break
+			}
+			for _, runningMetricName := range getConfigDiffQueryMetricNames(runningQuery) {
+				fromKey := configDiffMetricKey(runningQuery.Module, runningMetricName)
+				toKey := configDiffMetricKey(newQuery.Module, newQuery.Metric+strings.TrimPrefix(runningMetricName, runningQuery.Metric))
+
+				from, fromRemoved := removed[fromKey]
+				to, toAdded := added[toKey]
+				if fromRemoved && toAdded {
+					diff.Renamed = append(diff.Renamed, configDiffRename{From: from, To: to})
+					delete(removed, fromKey)
+					delete(added, toKey)
+				}
+			}
+			break
+		}
+	}
+
+	for _, metric := range added {
+		diff.Added = append(diff.Added, metric)
+	}
+	for _, metric := range removed {
+		diff.Removed = append(diff.Removed, metric)
+	}
+
+	sortConfigDiffMetrics(diff.Added)
+	sortConfigDiffMetrics(diff.Removed)
+	sort.Slice(diff.Renamed, func(i, j int) bool {
+		return configDiffMetricLess(diff.Renamed[i].From, diff.Renamed[j].From)
+	})
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return configDiffMetricLess(diff.Changed[i].Metric, diff.Changed[j].Metric)
+	})
+
+	return diff
+}
+
+// HasChanges checks if any metric is changed
+func (d *configDiff) HasChanges() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Renamed)+len(d.Changed) > 0
+}
+
+// Write prints the changes grouped by module and a summary
+func (d *configDiff) Write(w io.Writer) {
+	if !d.HasChanges() {
+		fmt.Fprintln(w, "No changes. The metrics of the running instance match the config.") // nolint: errcheck
+		return
+	}
+
+	lines := map[string][]string{}
+	for _, metric := range d.Added {
+		lines[metric.Module] = append(lines[metric.Module], fmt.Sprintf("  + %v%v (query %v)", metric.Name, formatConfigDiffLabels(metric.Labels), strings.Join(metric.Queries, ", ")))
+	}
+	for _, change := range d.Changed {
+		labelChanges := []string{}
+		for _, label := range change.AddedLabels {
+			labelChanges = append(labelChanges, "+"+label)
+		}
+		for _, label := range change.RemovedLabels {
+			labelChanges = append(labelChanges, "-"+label)
+		}
+		lines[change.Metric.Module] = append(lines[change.Metric.Module], fmt.Sprintf("  ~ %v labels: %v (series are replaced)", change.Metric.Name, strings.Join(labelChanges, " ")))
+	}
+	for _, rename := range d.Renamed {
+		lines[rename.From.Module] = append(lines[rename.From.Module], fmt.Sprintf("  > %v -> %v%v (renamed)", rename.From.Name, rename.To.Name, formatConfigDiffLabels(rename.To.Labels)))
+	}
+	for _, metric := range d.Removed {
+		lines[metric.Module] = append(lines[metric.Module], fmt.Sprintf("  - %v%v", metric.Name, formatConfigDiffLabels(metric.Labels)))
+	}
+
+	modules := []string{}
+	for module := range lines {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	for _, module := range modules {
+		fmt.Fprintf(w, "module %q:\n", module) // nolint: errcheck
+		for _, line := range lines[module] {
+			fmt.Fprintln(w, line) // nolint: errcheck
+		}
+		fmt.Fprintln(w) // nolint: errcheck
+	}
+
+	fmt.Fprintf(w, "Plan: %v to add, %v to change, %v to rename, %v to remove.\n", len(d.Added), len(d.Changed), len(d.Renamed), len(d.Removed)) // nolint: errcheck
+}
+
+// collectConfigDiffMetrics returns the metrics of the queries per module and metric name,
+// labels of metrics exposed by several queries are merged
+func collectConfigDiffMetrics(queries []config.ConfigQuery) map[string]configDiffMetric {
+	metrics := map[string]configDiffMetric{}
+	for _, queryConfig := range queries {
+		for metricName, labels := range getConfigDiffQueryMetrics(queryConfig) {
+			key := configDiffMetricKey(queryConfig.Module, metricName)
+			metric, exists := metrics[key]
+			if !exists {
+				metric = configDiffMetric{Module: queryConfig.Module, Name: metricName}
+			}
+
+			labelSet := map[string]bool{}
+			for _, label := range append(metric.Labels, labels...) {
+				labelSet[label] = true
+			}
+			metric.Labels = []string{}
+			for label := range labelSet {
+				metric.Labels = append(metric.Labels, label)
+			}
+			sort.Strings(metric.Labels)
+
+			metric.Queries = append(metric.Queries, queryConfig.GetName())
+			metrics[key] = metric
+		}
+	}
+	return metrics
+}
+
+// getConfigDiffQueryMetrics derives the metrics and label names of a query from its field config (same rules as
+// kusto.BuildPrometheusMetricList), labels of relabel configs and of columns without field config are not included
+func getConfigDiffQueryMetrics(queryConfig config.ConfigQuery) map[string][]string {
+	metrics := map[string][]string{}
+	addConfigDiffMetrics(metrics, queryConfig.Metric, queryConfig.MetricConfig, nil)
+	return metrics
+}
+
+func addConfigDiffMetrics(metrics map[string][]string, name string, metricConfig kusto.ConfigQueryMetric, parentIdLabels []string) {
+	mainLabels := append([]string{}, parentIdLabels...)
+	for labelName := range metricConfig.Labels {
+		mainLabels = append(mainLabels, labelName)
+	}
+
+	idLabels := append([]string{}, parentIdLabels...)
+	subMetrics := map[string][]string{}
+	for _, fieldConfig := range metricConfig.Fields {
+		if fieldConfig.IsTypeIgnore() || fieldConfig.IsExpand() {
+			continue
+		}
+
+		labels := []string{}
+		if !fieldConfig.IsTypeValue() {
+			labels = append(labels, fieldConfig.GetTargetFieldName(fieldConfig.Name))
+		}
+		for labelName := range fieldConfig.Labels {
+			labels = append(labels, labelName)
+		}
+
+		if fieldConfig.IsTypeId() {
+			idLabels = append(idLabels, fieldConfig.GetTargetFieldName(fieldConfig.Name))
+		}
+
+		if fieldConfig.Metric != "" {
+			subMetrics[fieldConfig.Metric] = append(subMetrics[fieldConfig.Metric], labels...)
+		} else {
+			mainLabels = append(mainLabels, labels...)
+		}
+	}
+
+	for subMetricName, labels := range subMetrics {
+		metrics[subMetricName] = append(metrics[subMetricName], append(labels, idLabels...)...)
+	}
+
+	for _, fieldConfig := range metricConfig.Fields {
+		if !fieldConfig.IsExpand() {
+			continue
+		}
+		subMetricName := fieldConfig.Metric
+		if subMetricName == "" {
+			subMetricName = fmt.Sprintf("%s_%s", name, fieldConfig.Name)
+		}
+		subMetricConfig := kusto.ConfigQueryMetric{}
+		if fieldConfig.Expand != nil {
+			subMetricConfig = *fieldConfig.Expand
+		}
+		addConfigDiffMetrics(metrics, subMetricName, subMetricConfig, idLabels)
+	}
+
+	if metricConfig.IsPublished() {
+		metrics[name] = append(metrics[name], append(mainLabels, idLabels...)...)
+	}
+}
+
+// getConfigDiffQueryMetricNames returns the sorted metric names of a query
+func getConfigDiffQueryMetricNames(queryConfig config.ConfigQuery) []string {
+	names := []string{}
+	for metricName := range getConfigDiffQueryMetrics(queryConfig) {
+		names = append(names, metricName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isConfigDiffSameQuery checks if two queries are the same query (same name or same query text in the same module)
+func isConfigDiffSameQuery(a, b config.ConfigQuery) bool {
+	if a.Module != b.Module {
+		return false
+	}
+	if a.Name != "" && b.Name != "" {
+		return a.Name == b.Name
+	}
+	return strings.Join(strings.Fields(a.Query), " ") == strings.Join(strings.Fields(b.Query), " ")
+}
+
+func configDiffMetricKey(module, metricName string) string {
+	return module + "\x00" + metricName
+}
+
+func configDiffMetricLess(a, b configDiffMetric) bool {
+	if a.Module != b.Module {
+		return a.Module < b.Module
+	}
+	return a.Name < b.Name
+}
+
+func sortConfigDiffMetrics(metrics []configDiffMetric) {
+	sort.Slice(metrics, func(i, j int) bool {
+		return configDiffMetricLess(metrics[i], metrics[j])
+	})
+}
+
+func formatConfigDiffLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ", ") + "}"
+}
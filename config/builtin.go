@@ -0,0 +1,530 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	BuiltinResourcesTotalMetric = "azure_resources_total"
+
+	BuiltinCertificatesModule                = "certificates"
+	BuiltinAppServiceCertificateExpiryMetric = "azure_appservice_certificate_expiry_timestamp_seconds"
+	BuiltinCertificateOrderExpiryMetric      = "azure_appservice_certificate_order_expiry_timestamp_seconds"
+
+	BuiltinComputeModule          = "compute"
+	BuiltinComputeInstancesMetric = "azure_compute_instances"
+	BuiltinComputeVCPUsMetric     = "azure_compute_vcpus"
+	BuiltinComputeMemoryMetric    = "azure_compute_memory_bytes"
+
+	BuiltinExposureModule              = "exposure"
+	BuiltinExposurePublicIpMetric      = "azure_exposure_public_ip_info"
+	BuiltinExposureNsgRuleMetric       = "azure_exposure_nsg_open_rule_info"
+	BuiltinExposureStorageAccessMetric = "azure_exposure_storage_public_blob_access_info"
+
+	BuiltinBackupModule            = "backup"
+	BuiltinBackupProtectedMetric   = "azure_backup_protected"
+	BuiltinBackupCoverageMetric    = "azure_backup_coverage_ratio"
+	builtinBackupProtectedItemType = "microsoft.recoveryservices/vaults/backupfabrics/protectioncontainers/protecteditems"
+
+	BuiltinTagsModule               = "tags"
+	BuiltinTagComplianceMetric      = "azure_resource_tag_compliance"
+	BuiltinTagComplianceRatioMetric = "azure_resource_tag_compliance_ratio"
+
+	BuiltinCostModule         = "cost"
+	BuiltinCostVmMetric       = "azure_cost_vm_info"
+	BuiltinCostDiskMetric     = "azure_cost_disk_size_bytes"
+	BuiltinCostResourceMetric = "azure_cost_sku_info"
+
+	BuiltinLocksModule         = "locks"
+	BuiltinLockProtectedMetric = "azure_resource_lock_protected"
+
+	BuiltinExtensionsModule         = "extensions"
+	BuiltinExtensionInstalledMetric = "azure_vm_extension_installed"
+	BuiltinExtensionCoverageMetric  = "azure_vm_extension_coverage_ratio"
+
+	BuiltinAksModule              = "aks"
+	BuiltinAksClusterMetric       = "azure_aks_cluster_info"
+	BuiltinAksAuthorizedIpsMetric = "azure_aks_cluster_authorized_ip_ranges"
+	BuiltinAksNodePoolMetric      = "azure_aks_nodepool_nodes"
+)
+
+var (
+	// ports checked for NSG rules open to the internet (ssh, rdp, smb, winrm, databases, ...)
+	builtinExposureSensitivePorts = []int{21, 22, 23, 135, 139, 445, 1433, 1521, 3306, 3389, 5432, 5985, 5986, 6379, 9200, 27017}
+)
+
+// builtinQueries returns the built-in queries, available without configuration (except required tags)
+func builtinQueries(opts Opts) []ConfigQuery {
+	resourcesTotal := ConfigQuery{}
+	resourcesTotal.Metric = BuiltinResourcesTotalMetric
+	resourcesTotal.Query = "Resources\n" +
+		"| summarize count() by type, location, subscriptionId\n" +
+		"| project type, location, subscriptionID = subscriptionId, count_"
+	resourcesTotal.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+		{Name: "type", Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+		{Name: "location", Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "count_", Type: kusto.MetricFieldTypeValue},
+	}
+
+	queries := []ConfigQuery{resourcesTotal}
+	queries = append(queries, builtinCertificateQueries()...)
+	queries = append(queries, builtinComputeQueries()...)
+	queries = append(queries, builtinExposureQueries()...)
+	queries = append(queries, builtinBackupQueries()...)
+	queries = append(queries, builtinCostQueries()...)
+	queries = append(queries, builtinAksQueries()...)
+	if len(opts.Metrics.Builtin.LockResourceTypes) > 0 {
+		queries = append(queries, builtinLockQueries(opts.Metrics.Builtin.LockResourceTypes)...)
+	}
+	if len(opts.Metrics.Builtin.ExtensionTypes) > 0 {
+		queries = append(queries, builtinExtensionQueries(opts.Metrics.Builtin.ExtensionTypes)...)
+	}
+	if len(opts.Metrics.Builtin.RequiredTags) > 0 {
+		queries = append(queries, builtinTagQueries(opts.Metrics.Builtin.RequiredTags)...)
+	}
+	return queries
+}
+
+// builtinCertificateQueries returns the queries of the certificates module
+func builtinCertificateQueries() []ConfigQuery {
+	// App Service certificates (uploaded or imported from Key Vault)
+	appServiceCertificates := ConfigQuery{}
+	appServiceCertificates.Module = BuiltinCertificatesModule
+	appServiceCertificates.Metric = BuiltinAppServiceCertificateExpiryMetric
+	appServiceCertificates.Query = "Resources\n" +
+		"| where type =~ 'microsoft.web/certificates' and isnotempty(properties.expirationDate)\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    subjectName = tostring(properties.subjectName), thumbprint = tostring(properties.thumbprint), keyVaultId = tostring(properties.keyVaultId),\n" +
+		"    expiry = tolong((todatetime(properties.expirationDate) - datetime(1970-01-01)) / 1s)"
+	appServiceCertificates.MetricConfig.Fields = builtinResourceFields("expiry", "subjectName", "thumbprint", "keyVaultId")
+
+	// App Service certificate orders (purchased certificates)
+	appServiceCertificateOrders := ConfigQuery{}
+	appServiceCertificateOrders.Module = BuiltinCertificatesModule
+	appServiceCertificateOrders.Metric = BuiltinCertificateOrderExpiryMetric
+	appServiceCertificateOrders.Query = "Resources\n" +
+		"| where type =~ 'microsoft.certificateregistration/certificateorders' and isnotempty(properties.expirationTime)\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    distinguishedName = tostring(properties.distinguishedName), status = tostring(properties.status),\n" +
+		"    expiry = tolong((todatetime(properties.expirationTime) - datetime(1970-01-01)) / 1s)"
+	appServiceCertificateOrders.MetricConfig.Fields = builtinResourceFields("expiry", "distinguishedName", "status")
+
+	return []ConfigQuery{appServiceCertificates, appServiceCertificateOrders}
+}
+
+// builtinComputeQueries returns the queries of the compute module
+func builtinComputeQueries() []ConfigQuery {
+	// VM and VMSS instances with capacity from the bundled VM size table (unknown sizes have no capacity series)
+	compute := ConfigQuery{}
+	compute.Module = BuiltinComputeModule
+	compute.Metric = BuiltinComputeInstancesMetric
+	compute.Query = "Resources\n" +
+		"| where type =~ 'microsoft.compute/virtualmachines' or type =~ 'microsoft.compute/virtualmachinescalesets'\n" +
+		"| extend isVm = type =~ 'microsoft.compute/virtualmachines'\n" +
+		"| extend kind = iff(isVm, 'vm', 'vmss'),\n" +
+		"    vmSize = tolower(tostring(iff(isVm, properties.hardwareProfile.vmSize, sku.name))),\n" +
+		"    instances = iff(isVm, tolong(1), tolong(sku.capacity))\n" +
+		"| summarize instances = sum(instances) by subscriptionId, location, kind, vmSize\n" +
+		"| extend size = substring(vmSize, iff(vmSize startswith 'standard_', 9, 0))\n" +
+		"| extend vcpusPerInstance = " + vmSizeKustoCase("size", func(size vmSize) float64 { return float64(size.VCPUs) }) + "\n" +
+		"| extend memoryPerInstance = " + vmSizeKustoCase("size", func(size vmSize) float64 { return size.MemoryGiB }) + "\n" +
+		"| project subscriptionID = subscriptionId, location, kind, vmSize, instances,\n" +
+		"    vcpus = instances * vcpusPerInstance, memoryBytes = instances * memoryPerInstance * 1073741824"
+	compute.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "location", Type: kusto.MetricFieldTypeId, Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+		{Name: "kind", Type: kusto.MetricFieldTypeId},
+		{Name: "vmSize", Type: kusto.MetricFieldTypeId},
+		{Name: "instances", Type: kusto.MetricFieldTypeValue},
+		{Name: "vcpus", Type: kusto.MetricFieldTypeValue, Metric: BuiltinComputeVCPUsMetric},
+		{Name: "memoryBytes", Type: kusto.MetricFieldTypeValue, Metric: BuiltinComputeMemoryMetric},
+	}
+
+	return []ConfigQuery{compute}
+}
+
+// builtinExposureQueries returns the queries of the exposure module (value 1 per exposed resource)
+func builtinExposureQueries() []ConfigQuery {
+	publicIps := ConfigQuery{}
+	publicIps.Module = BuiltinExposureModule
+	publicIps.Metric = BuiltinExposurePublicIpMetric
+	publicIps.Query = "Resources\n" +
+		"| where type =~ 'microsoft.network/publicipaddresses'\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    ipAddress = tostring(properties.ipAddress), attachedTo = tolower(tostring(properties.ipConfiguration.id))"
+	publicIps.Type = QueryTypeInfo
+	publicIps.MetricConfig.Fields = builtinResourceFields("", "ipAddress", "attachedTo")
+
+	// inbound allow rules from any source/internet covering a sensitive port (incl. port ranges and "*")
+	sensitivePorts := []string{}
+	for _, port := range builtinExposureSensitivePorts {
+		sensitivePorts = append(sensitivePorts, strconv.Itoa(port))
+	}
+	nsgRules := ConfigQuery{}
+	nsgRules.Module = BuiltinExposureModule
+	nsgRules.Metric = BuiltinExposureNsgRuleMetric
+	nsgRules.Query = "Resources\n" +
+		"| where type =~ 'microsoft.network/networksecuritygroups'\n" +
+		"| mv-expand rule = properties.securityRules\n" +
+		"| where tostring(rule.properties.direction) =~ 'Inbound' and tostring(rule.properties.access) =~ 'Allow'\n" +
+		"| extend sources = iff(isnotempty(rule.properties.sourceAddressPrefix), pack_array(rule.properties.sourceAddressPrefix), rule.properties.sourceAddressPrefixes)\n" +
+		"| mv-expand source = sources to typeof(string)\n" +
+		"| where source in~ ('*', '0.0.0.0/0', 'Internet', 'Any')\n" +
+		"| extend ports = iff(isnotempty(rule.properties.destinationPortRange), pack_array(rule.properties.destinationPortRange), rule.properties.destinationPortRanges)\n" +
+		"| mv-expand portRange = ports to typeof(string)\n" +
+		"| extend portStart = toint(split(portRange, '-')[0]), portEnd = toint(split(portRange, '-')[-1])\n" +
+		"| extend sensitivePorts = dynamic([" + strings.Join(sensitivePorts, ", ") + "])\n" +
+		"| mv-expand port = sensitivePorts to typeof(int)\n" +
+		"| where portRange == '*' or (port >= portStart and port <= portEnd)\n" +
+		"| summarize by resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    ruleName = tostring(rule.name), protocol = tostring(rule.properties.protocol), port = tostring(port)"
+	nsgRules.Type = QueryTypeInfo
+	nsgRules.MetricConfig.Fields = builtinResourceFields("", "ruleName", "protocol", "port")
+
+	// storage accounts allowing anonymous blob access (not set means allowed for older accounts)
+	storageAccounts := ConfigQuery{}
+	storageAccounts.Module = BuiltinExposureModule
+	storageAccounts.Metric = BuiltinExposureStorageAccessMetric
+	storageAccounts.Query = "Resources\n" +
+		"| where type =~ 'microsoft.storage/storageaccounts'\n" +
+		"| where isnull(properties.allowBlobPublicAccess) or tobool(properties.allowBlobPublicAccess) == true\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    publicNetworkAccess = tostring(properties.publicNetworkAccess), networkDefaultAction = tostring(properties.networkAcls.defaultAction)"
+	storageAccounts.Type = QueryTypeInfo
+	storageAccounts.MetricConfig.Fields = builtinResourceFields("", "publicNetworkAccess", "networkDefaultAction")
+
+	return []ConfigQuery{publicIps, nsgRules, storageAccounts}
+}
+
+// builtinBackupQueries returns the queries of the backup module: protection of VMs and SQL Server VMs
+// (per resource and coverage ratio per subscription) and protected Azure file shares
+func builtinBackupQueries() []ConfigQuery {
+	queries := []ConfigQuery{}
+
+	// resources and the workload type of their protected items
+	resources := []struct {
+		kind         string
+		query        string
+		workloadType string
+	}{
+		{
+			kind:         "vm",
+			query:        "Resources\n| where type =~ 'microsoft.compute/virtualmachines'\n| extend vmId = tolower(id)\n",
+			workloadType: "VM",
+		},
+		{
+			kind:         "sqlvm",
+			query:        "Resources\n| where type =~ 'microsoft.sqlvirtualmachine/sqlvirtualmachines'\n| extend vmId = tolower(tostring(properties.virtualMachineResourceId))\n",
+			workloadType: "SQLDataBase",
+		},
+	}
+
+	for _, resource := range resources {
+		kind := resource.kind
+		query := resource.query +
+			"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location, vmId\n" +
+			"| join kind=leftouter (\n" +
+			"    RecoveryServicesResources\n" +
+			"    | where type =~ '" + builtinBackupProtectedItemType + "' and tostring(properties.workloadType) =~ '" + resource.workloadType + "'\n" +
+			"    | summarize vault = any(tostring(split(id, '/')[8])), protectionState = any(tostring(properties.protectionState))\n" +
+			"        by vmId = tolower(tostring(properties.sourceResourceId))\n" +
+			") on vmId\n" +
+			"| extend kind = '" + kind + "', protected = isnotempty(vault)\n"
+
+		protected := ConfigQuery{}
+		protected.Name = BuiltinBackupProtectedMetric + "_" + kind
+		protected.Module = BuiltinBackupModule
+		protected.Metric = BuiltinBackupProtectedMetric
+		protected.Query = query +
+			"| project resourceId, name, subscriptionID, resourceGroup, location, kind, vault, protectionState, protected"
+		protected.MetricConfig.Fields = builtinResourceFields("protected", "kind", "vault", "protectionState")
+		queries = append(queries, protected)
+
+		coverage := ConfigQuery{}
+		coverage.Name = BuiltinBackupCoverageMetric + "_" + kind
+		coverage.Module = BuiltinBackupModule
+		coverage.Metric = BuiltinBackupCoverageMetric
+		coverage.Query = query +
+			"| summarize ratio = todouble(countif(protected)) / count() by subscriptionID, kind"
+		coverage.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+			{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+			{Name: "kind"},
+			{Name: "ratio", Type: kusto.MetricFieldTypeValue},
+		}
+		queries = append(queries, coverage)
+	}
+
+	// unprotected file shares are not visible in ResourceGraph, only protected shares are listed
+	fileShares := ConfigQuery{}
+	fileShares.Name = BuiltinBackupProtectedMetric + "_fileshare"
+	fileShares.Module = BuiltinBackupModule
+	fileShares.Metric = BuiltinBackupProtectedMetric
+	fileShares.Query = "RecoveryServicesResources\n" +
+		"| where type =~ '" + builtinBackupProtectedItemType + "' and tostring(properties.workloadType) =~ 'AzureFileShare'\n" +
+		"| extend storageAccountId = tolower(tostring(properties.sourceResourceId))\n" +
+		"| project resourceId = strcat(storageAccountId, '/fileservices/default/shares/', tolower(tostring(properties.friendlyName))),\n" +
+		"    name = tostring(properties.friendlyName), subscriptionID = tostring(split(storageAccountId, '/')[2]), resourceGroup = tostring(split(storageAccountId, '/')[4]),\n" +
+		"    location, kind = 'fileshare', vault = tostring(split(id, '/')[8]), protectionState = tostring(properties.protectionState), protected = true"
+	fileShares.MetricConfig.Fields = builtinResourceFields("protected", "kind", "vault", "protectionState")
+	queries = append(queries, fileShares)
+
+	return queries
+}
+
+// builtinTagQueries returns the queries of the tags module checking the required tags of resources and resource groups
+func builtinTagQueries(requiredTags []string) []ConfigQuery {
+	tags := []string{}
+	for _, tag := range requiredTags {
+		tags = append(tags, kustoStringLiteral(tag))
+	}
+
+	query := "union\n" +
+		"    (Resources | project subscriptionId, tags, scope = 'resource'),\n" +
+		"    (ResourceContainers | where type =~ 'microsoft.resources/subscriptions/resourcegroups' | project subscriptionId, tags, scope = 'resourcegroup')\n" +
+		"| extend requiredTags = dynamic([" + strings.Join(tags, ", ") + "])\n" +
+		"| mv-expand tag = requiredTags to typeof(string)\n" +
+		"| extend compliant = isnotempty(tostring(tags[tag]))\n"
+
+	compliance := ConfigQuery{}
+	compliance.Module = BuiltinTagsModule
+	compliance.Metric = BuiltinTagComplianceMetric
+	compliance.Query = query +
+		"| summarize count_ = count() by subscriptionID = subscriptionId, scope, tag, compliant"
+	compliance.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "scope"},
+		{Name: "tag"},
+		{Name: "compliant", Type: kusto.MetricFieldTypeBoolean},
+		{Name: "count_", Type: kusto.MetricFieldTypeValue},
+	}
+
+	ratio := ConfigQuery{}
+	ratio.Module = BuiltinTagsModule
+	ratio.Metric = BuiltinTagComplianceRatioMetric
+	ratio.Query = query +
+		"| summarize ratio = todouble(countif(compliant)) / count() by subscriptionID = subscriptionId, scope, tag"
+	ratio.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "scope"},
+		{Name: "tag"},
+		{Name: "ratio", Type: kusto.MetricFieldTypeValue},
+	}
+
+	return []ConfigQuery{compliance, ratio}
+}
+
+// builtinCostQueries returns the queries of the cost module: static cost drivers per resource as labels
+// (eg. for joins with cost data in Grafana on resourceId)
+func builtinCostQueries() []ConfigQuery {
+	vms := ConfigQuery{}
+	vms.Module = BuiltinCostModule
+	vms.Metric = BuiltinCostVmMetric
+	vms.Query = "Resources\n" +
+		"| where type =~ 'microsoft.compute/virtualmachines'\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    vmSize = tostring(properties.hardwareProfile.vmSize), osType = tostring(properties.storageProfile.osDisk.osType),\n" +
+		"    priority = tostring(properties.priority), licenseType = tostring(properties.licenseType)"
+	vms.Type = QueryTypeInfo
+	vms.MetricConfig.Fields = builtinResourceFields("", "vmSize", "osType", "priority", "licenseType")
+
+	disks := ConfigQuery{}
+	disks.Module = BuiltinCostModule
+	disks.Metric = BuiltinCostDiskMetric
+	disks.Query = "Resources\n" +
+		"| where type =~ 'microsoft.compute/disks'\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    skuName = tostring(sku.name), diskTier = tostring(properties.tier), diskState = tostring(properties.diskState),\n" +
+		"    attachedTo = tolower(tostring(managedBy)), sizeBytes = tolong(properties.diskSizeGB) * 1073741824"
+	disks.MetricConfig.Fields = builtinResourceFields("sizeBytes", "skuName", "diskTier", "diskState", "attachedTo")
+
+	resources := ConfigQuery{}
+	resources.Module = BuiltinCostModule
+	resources.Metric = BuiltinCostResourceMetric
+	resources.Query = "Resources\n" +
+		"| where isnotempty(sku.name)\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location, type = tolower(type),\n" +
+		"    kind, skuName = tostring(sku.name), skuTier = tostring(sku.tier), skuCapacity = tostring(sku.capacity)"
+	resources.Type = QueryTypeInfo
+	resources.MetricConfig.Fields = builtinResourceFields("", "type", "kind", "skuName", "skuTier", "skuCapacity")
+
+	return []ConfigQuery{vms, disks, resources}
+}
+
+// builtinAksQueries returns the queries of the aks module: cluster configuration and node pools
+func builtinAksQueries() []ConfigQuery {
+	clusters := ConfigQuery{}
+	clusters.Module = BuiltinAksModule
+	clusters.Metric = BuiltinAksClusterMetric
+	clusters.Query = "Resources\n" +
+		"| where type =~ 'microsoft.containerservice/managedclusters'\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    kubernetesVersion = tostring(properties.kubernetesVersion), skuTier = tostring(sku.tier),\n" +
+		"    powerState = tostring(properties.powerState.code), networkPlugin = tostring(properties.networkProfile.networkPlugin),\n" +
+		"    rbac = tobool(properties.enableRBAC), aad = isnotempty(properties.aadProfile),\n" +
+		"    privateCluster = coalesce(tobool(properties.apiServerAccessProfile.enablePrivateCluster), false),\n" +
+		"    authorizedIpRanges = array_length(properties.apiServerAccessProfile.authorizedIPRanges) > 0"
+	clusters.Type = QueryTypeInfo
+	clusters.MetricConfig.Fields = append(
+		builtinResourceFields("", "kubernetesVersion", "skuTier", "powerState", "networkPlugin"),
+		kusto.ConfigQueryMetricField{Name: "rbac", Type: kusto.MetricFieldTypeBoolean},
+		kusto.ConfigQueryMetricField{Name: "aad", Type: kusto.MetricFieldTypeBoolean},
+		kusto.ConfigQueryMetricField{Name: "privateCluster", Type: kusto.MetricFieldTypeBoolean},
+		kusto.ConfigQueryMetricField{Name: "authorizedIpRanges", Type: kusto.MetricFieldTypeBoolean},
+	)
+
+	authorizedIps := ConfigQuery{}
+	authorizedIps.Module = BuiltinAksModule
+	authorizedIps.Metric = BuiltinAksAuthorizedIpsMetric
+	authorizedIps.Query = "Resources\n" +
+		"| where type =~ 'microsoft.containerservice/managedclusters'\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    ranges = coalesce(array_length(properties.apiServerAccessProfile.authorizedIPRanges), 0)"
+	authorizedIps.MetricConfig.Fields = builtinResourceFields("ranges")
+
+	nodePools := ConfigQuery{}
+	nodePools.Module = BuiltinAksModule
+	nodePools.Metric = BuiltinAksNodePoolMetric
+	nodePools.Query = "Resources\n" +
+		"| where type =~ 'microsoft.containerservice/managedclusters'\n" +
+		"| mv-expand pool = properties.agentPoolProfiles\n" +
+		"| project resourceId = id, name, subscriptionID = subscriptionId, resourceGroup, location,\n" +
+		"    nodePool = tostring(pool.name), mode = tostring(pool.mode), vmSize = tostring(pool.vmSize), osType = tostring(pool.osType),\n" +
+		"    orchestratorVersion = tostring(pool.orchestratorVersion), autoScaling = coalesce(tobool(pool.enableAutoScaling), false),\n" +
+		"    minCount = tolong(pool.minCount), maxCount = tolong(pool.maxCount), nodes = coalesce(tolong(pool['count']), 0)"
+	nodePools.MetricConfig.Fields = append(
+		builtinResourceFields("nodes", "mode", "vmSize", "osType", "orchestratorVersion"),
+		kusto.ConfigQueryMetricField{Name: "nodePool", Type: kusto.MetricFieldTypeId},
+		kusto.ConfigQueryMetricField{Name: "autoScaling", Type: kusto.MetricFieldTypeBoolean},
+		kusto.ConfigQueryMetricField{Name: "minCount", Metric: BuiltinAksNodePoolMetric + "_min", Type: kusto.MetricFieldTypeValue},
+		kusto.ConfigQueryMetricField{Name: "maxCount", Metric: BuiltinAksNodePoolMetric + "_max", Type: kusto.MetricFieldTypeValue},
+	)
+
+	return []ConfigQuery{clusters, authorizedIps, nodePools}
+}
+
+// builtinLockQueries returns the queries of the locks module: CanNotDelete/ReadOnly lock protection of critical resources
+// (locks of the resource, its resource group or its subscription)
+func builtinLockQueries(resourceTypes []string) []ConfigQuery {
+	types := []string{}
+	for _, resourceType := range resourceTypes {
+		types = append(types, kustoStringLiteral(strings.ToLower(resourceType)))
+	}
+
+	protected := ConfigQuery{}
+	protected.Module = BuiltinLocksModule
+	protected.Metric = BuiltinLockProtectedMetric
+	protected.Query = "Resources\n" +
+		"| where type in~ (" + strings.Join(types, ", ") + ")\n" +
+		"| project resourceId = tolower(id), name, subscriptionID = subscriptionId, resourceGroup, location, type = tolower(type),\n" +
+		"    scopes = pack_array(tolower(id), tolower(strcat('/subscriptions/', subscriptionId, '/resourcegroups/', resourceGroup)), tolower(strcat('/subscriptions/', subscriptionId)))\n" +
+		"| mv-expand scope = scopes to typeof(string)\n" +
+		"| join kind=leftouter (\n" +
+		"    Resources\n" +
+		"    | where type =~ 'microsoft.authorization/locks'\n" +
+		"    | extend lockId = tolower(id)\n" +
+		"    | project scope = substring(lockId, 0, indexof(lockId, '/providers/microsoft.authorization/locks/')), level = tostring(properties.level)\n" +
+		") on scope\n" +
+		"| summarize canNotDelete = countif(level =~ 'CanNotDelete'), readOnly = countif(level =~ 'ReadOnly')\n" +
+		"    by resourceId, name, subscriptionID, resourceGroup, location, type\n" +
+		"| project resourceId, name, subscriptionID, resourceGroup, location, type,\n" +
+		"    lockLevel = iff(readOnly > 0, 'ReadOnly', iff(canNotDelete > 0, 'CanNotDelete', '')), protected = readOnly + canNotDelete > 0"
+	protected.MetricConfig.Fields = builtinResourceFields("protected", "type", "lockLevel")
+
+	return []ConfigQuery{protected}
+}
+
+// builtinExtensionQueries returns the queries of the extensions module: installed extensions (agents) per VM and the
+// rollout coverage per subscription, Linux/Windows extensions are only expected on VMs with the matching OS
+func builtinExtensionQueries(extensionTypes []string) []ConfigQuery {
+	types := []string{}
+	for _, extensionType := range extensionTypes {
+		types = append(types, kustoStringLiteral(extensionType))
+	}
+
+	query := "Resources\n" +
+		"| where type =~ 'microsoft.compute/virtualmachines'\n" +
+		"| project vmId = tolower(id), name, subscriptionID = subscriptionId, resourceGroup, location, osType = tostring(properties.storageProfile.osDisk.osType)\n" +
+		"| extend extensionTypes = dynamic([" + strings.Join(types, ", ") + "])\n" +
+		"| mv-expand extensionType = extensionTypes to typeof(string)\n" +
+		"| where not((extensionType contains 'linux' and osType =~ 'Windows') or (extensionType contains 'windows' and osType =~ 'Linux'))\n" +
+		"| extend extensionKey = tolower(extensionType)\n" +
+		"| join kind=leftouter (\n" +
+		"    Resources\n" +
+		"    | where type =~ 'microsoft.compute/virtualmachines/extensions'\n" +
+		"    | extend extensionId = tolower(id)\n" +
+		"    | project vmId = substring(extensionId, 0, indexof(extensionId, '/extensions/')), extensionKey = tolower(tostring(properties.type)),\n" +
+		"        version = tostring(properties.typeHandlerVersion), provisioningState = tostring(properties.provisioningState)\n" +
+		") on vmId, extensionKey\n"
+
+	installed := ConfigQuery{}
+	installed.Module = BuiltinExtensionsModule
+	installed.Metric = BuiltinExtensionInstalledMetric
+	installed.Query = query +
+		"| project resourceId = vmId, name, subscriptionID, resourceGroup, location, osType, extensionType, version, provisioningState,\n" +
+		"    installed = isnotempty(provisioningState)"
+	installed.MetricConfig.Fields = builtinResourceFields("installed", "osType", "extensionType", "version", "provisioningState")
+
+	coverage := ConfigQuery{}
+	coverage.Module = BuiltinExtensionsModule
+	coverage.Metric = BuiltinExtensionCoverageMetric
+	coverage.Query = query +
+		"| summarize ratio = todouble(countif(provisioningState =~ 'Succeeded')) / count() by subscriptionID, extensionType"
+	coverage.MetricConfig.Fields = []kusto.ConfigQueryMetricField{
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "extensionType"},
+		{Name: "ratio", Type: kusto.MetricFieldTypeValue},
+	}
+
+	return []ConfigQuery{installed, coverage}
+}
+
+// builtinResourceFields returns the fields of resource level queries (resourceId, name, subscriptionID, resourceGroup,
+// location and additional labels) with an optional value field
+func builtinResourceFields(valueField string, labels ...string) []kusto.ConfigQueryMetricField {
+	fields := []kusto.ConfigQueryMetricField{
+		{Name: "resourceId", Type: kusto.MetricFieldTypeId, Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+		{Name: "name"},
+		{Name: "subscriptionID", Type: kusto.MetricFieldTypeId},
+		{Name: "resourceGroup", Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+		{Name: "location", Filters: []kusto.ConfigQueryMetricFieldFilter{{Type: kusto.MetricFieldFilterToLower}}},
+	}
+	if valueField != "" {
+		fields = append(fields, kusto.ConfigQueryMetricField{Name: valueField, Type: kusto.MetricFieldTypeValue})
+	}
+	for _, label := range labels {
+		fields = append(fields, kusto.ConfigQueryMetricField{Name: label})
+	}
+	return fields
+}
+
+// AddBuiltinQueries adds the built-in queries unless the config already has a query with the same metric name,
+// built-in modules are skipped completely if the config already has a module with the same name
+func (c *Config) AddBuiltinQueries(opts Opts) {
+	configQueries := c.Queries
+	configModules := map[string]bool{}
+	for _, existing := range configQueries {
+		configModules[existing.Module] = true
+	}
+
+	added := 0
+	for _, queryConfig := range builtinQueries(opts) {
+		exists := queryConfig.Module != "" && configModules[queryConfig.Module]
+		for _, existing := range configQueries {
+			if existing.Metric == queryConfig.Metric || existing.GetName() == queryConfig.GetName() {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			c.applyQueryDefaults(&queryConfig)
+			c.Queries = append(c.Queries, queryConfig)
+			added++
+		}
+	}
+	c.addSource(ConfigSourceBuiltin, added)
+}
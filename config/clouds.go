@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+var (
+	cloudNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+type (
+	// ConfigCloud is an Azure environment (sovereign cloud) queried by the exporter
+	ConfigCloud struct {
+		// name of the cloud, used as value of the azureCloud label
+		Name string `yaml:"name"`
+
+		// Azure environment name (eg. AZUREPUBLICCLOUD, AZUREUSGOVERNMENTCLOUD, AZURECHINACLOUD)
+		Environment string `yaml:"environment"`
+
+		// subscriptions of the cloud (auto discovery if empty)
+		Subscriptions []string `yaml:"subscriptions"`
+
+		// service principal credentials of the cloud (default: credentials from environment variables)
+		Credentials *ConfigCloudCredentials `yaml:"credentials"`
+	}
+
+	ConfigCloudCredentials struct {
+		TenantID string `yaml:"tenantID"`
+		ClientID string `yaml:"clientID"`
+
+		// name of the environment variable containing the client secret
+		ClientSecretEnv string `yaml:"clientSecretEnv"`
+	}
+)
+
+func (c *ConfigCloud) Validate() error {
+	if !cloudNameRegexp.MatchString(c.Name) {
+		return fmt.Errorf("invalid cloud name \"%v\", only [a-zA-Z0-9_-] allowed", c.Name)
+	}
+
+	if _, err := azure.EnvironmentFromName(c.Environment); err != nil {
+		return fmt.Errorf("invalid Azure environment \"%v\": %w", c.Environment, err)
+	}
+
+	for _, subscriptionId := range c.Subscriptions {
+		if subscriptionId == "" {
+			return errors.New("empty subscription ID")
+		}
+	}
+
+	if c.Credentials != nil {
+		if c.Credentials.TenantID == "" || c.Credentials.ClientID == "" || c.Credentials.ClientSecretEnv == "" {
+			return errors.New("credentials require tenantID, clientID and clientSecretEnv")
+		}
+	}
+
+	return nil
+}
+
+// validateClouds validates all clouds and checks for duplicate names
+func (c *Config) validateClouds() (errs []error) {
+	names := map[string]bool{}
+	for i := range c.Clouds {
+		cloud := &c.Clouds[i]
+		if err := cloud.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cloud \"%v\": %w", cloud.Name, err))
+		}
+
+		if names[cloud.Name] {
+			errs = append(errs, fmt.Errorf("cloud \"%v\": duplicate cloud name", cloud.Name))
+		}
+		names[cloud.Name] = true
+	}
+	return
+}
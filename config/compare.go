@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	CompareMetricSuffix = "_delta"
+)
+
+type (
+	// ConfigQueryCompare executes the query a second time with the scrape time shifted by offset
+	// (eg. one week ago) and publishes the difference of both results as <metric>_delta
+	ConfigQueryCompare struct {
+		Offset string `yaml:"offset"`
+	}
+)
+
+func (c *ConfigQueryCompare) Validate() error {
+	if c.Offset == "" {
+		return errors.New("compare offset is required")
+	}
+
+	val, err := ParseDuration(c.Offset)
+	if err != nil {
+		return fmt.Errorf("invalid compare offset \"%v\": %w", c.Offset, err)
+	}
+	if val <= 0 {
+		return fmt.Errorf("compare offset \"%v\" must be positive", c.Offset)
+	}
+
+	return nil
+}
+
+// GetOffset returns the time shift of the historical query
+func (c *ConfigQueryCompare) GetOffset() time.Duration {
+	val, _ := ParseDuration(c.Offset)
+	return val
+}
+
+// validateCompare checks if the query depends on the scrape time, otherwise both executions would return the same result
+func (c *ConfigQuery) validateCompare() error {
+	if err := c.Compare.Validate(); err != nil {
+		return err
+	}
+
+	if !strings.Contains(c.Query, ".Now") && !strings.Contains(c.Query, "ago ") {
+		return errors.New("compare requires a time based query ({{ .Now }} or {{ ago \"...\" }})")
+	}
+
+	return nil
+}
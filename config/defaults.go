@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+type (
+	// ConfigDefaults are inherited by every query unless overridden by the query
+	ConfigDefaults struct {
+		// additional labels, merged with the labels of the query
+		Labels map[string]string `yaml:"labels"`
+
+		// cache duration of query results
+		Cache *string `yaml:"cache"`
+
+		// column used as metric value if the query has no value field
+		ValueColumn string `yaml:"valueColumn"`
+
+		// subscriptions for queries without own subscription list
+		Subscriptions *[]string `yaml:"subscriptions"`
+
+		// behavior for empty results
+		PublishIfEmpty string `yaml:"publishIfEmpty"`
+
+		// add normalized resource labels (resourceID, subscriptionID, resourceGroup, resourceName, resourceType)
+		NormalizeLabels bool `yaml:"normalizeLabels"`
+
+		// ResourceGraph API version (eg. a preview version)
+		ResourceGraphApiVersion string `yaml:"resourceGraphApiVersion"`
+	}
+)
+
+// applyDefaultFlags overrides the defaults of the config file with the --config.defaults.* flags
+func (c *Config) applyDefaultFlags(opts Opts) {
+	flags := opts.Config.Defaults
+
+	if flags.Cache != "" {
+		cache := flags.Cache
+		c.Defaults.Cache = &cache
+	}
+
+	if len(flags.Subscriptions) > 0 {
+		subscriptions := append([]string{}, flags.Subscriptions...)
+		c.Defaults.Subscriptions = &subscriptions
+	}
+
+	if flags.PublishIfEmpty != "" {
+		c.Defaults.PublishIfEmpty = flags.PublishIfEmpty
+	}
+
+	if flags.ResourceGraphApiVersion != "" {
+		c.Defaults.ResourceGraphApiVersion = flags.ResourceGraphApiVersion
+	}
+
+	if len(flags.Labels) > 0 {
+		labels := map[string]string{}
+		for labelName, labelValue := range c.Defaults.Labels {
+			labels[labelName] = labelValue
+		}
+		for labelName, labelValue := range flags.Labels {
+			labels[labelName] = labelValue
+		}
+		c.Defaults.Labels = labels
+	}
+}
+
+// applyDefaults merges the defaults into all queries
+func (c *Config) applyDefaults() {
+	for i := range c.Queries {
+		c.applyQueryDefaults(&c.Queries[i])
+	}
+}
+
+// applyQueryDefaults merges the defaults into the query
+func (c *Config) applyQueryDefaults(queryConfig *ConfigQuery) {
+	if len(c.Defaults.Labels) > 0 {
+		labels := map[string]string{}
+		for labelName, labelValue := range c.Defaults.Labels {
+			labels[labelName] = labelValue
+		}
+		for labelName, labelValue := range queryConfig.MetricConfig.Labels {
+			labels[labelName] = labelValue
+		}
+		queryConfig.MetricConfig.Labels = labels
+	}
+
+	if queryConfig.Cache == nil {
+		queryConfig.Cache = c.Defaults.Cache
+	}
+
+	if queryConfig.Subscriptions == nil {
+		queryConfig.Subscriptions = c.Defaults.Subscriptions
+	}
+
+	if queryConfig.PublishIfEmpty == "" {
+		queryConfig.PublishIfEmpty = c.Defaults.PublishIfEmpty
+	}
+
+	if queryConfig.ResourceGraphApiVersion == "" {
+		queryConfig.ResourceGraphApiVersion = c.Defaults.ResourceGraphApiVersion
+	}
+
+	if queryConfig.Identity == "" {
+		queryConfig.Identity = c.GetModuleIdentity(queryConfig.Module)
+	}
+
+	if queryConfig.NormalizeLabels == nil {
+		normalizeLabels := c.Defaults.NormalizeLabels
+		queryConfig.NormalizeLabels = &normalizeLabels
+	}
+
+	if (queryConfig.IsInfo() || queryConfig.IsStateSet()) && queryConfig.MetricConfig.Value == nil {
+		value := float64(1)
+		queryConfig.MetricConfig.Value = &value
+	}
+
+	if c.Defaults.ValueColumn != "" && !queryConfig.IsInfo() && !queryConfig.IsStateSet() && !queryConfig.hasValueField() {
+		queryConfig.MetricConfig.Fields = append(queryConfig.MetricConfig.Fields, kusto.ConfigQueryMetricField{
+			Name: c.Defaults.ValueColumn,
+			Type: kusto.MetricFieldTypeValue,
+		})
+	}
+
+	c.applyGuardrails(queryConfig)
+}
+
+func (c *ConfigDefaults) Validate() error {
+	if c.Cache != nil {
+		if _, err := time.ParseDuration(*c.Cache); err != nil {
+			return fmt.Errorf("invalid cache duration \"%v\": %w", *c.Cache, err)
+		}
+	}
+
+	if c.ResourceGraphApiVersion != "" && !resourceGraphApiVersionRegexp.MatchString(c.ResourceGraphApiVersion) {
+		return fmt.Errorf("invalid resourceGraphApiVersion \"%v\" (expected eg. 2021-03-01 or 2020-04-01-preview)", c.ResourceGraphApiVersion)
+	}
+
+	return nil
+}
+
+// hasValueField checks if the query has a (main metric) value field
+func (c *ConfigQuery) hasValueField() bool {
+	for _, field := range c.MetricConfig.Fields {
+		if field.IsTypeValue() && field.Metric == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCacheDuration returns the cache duration of the query results
+func (c *ConfigQuery) GetCacheDuration() time.Duration {
+	if c.Cache != nil {
+		if val, err := time.ParseDuration(*c.Cache); err == nil {
+			return val
+		}
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// QueryResult contains the raw result rows of a query, usable in dependent query templates
+	QueryResult []map[string]interface{}
+)
+
+// GetName returns the name of the query (defaults to the metric name)
+func (c *ConfigQuery) GetName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Metric
+}
+
+// GetQueryByName returns the query with the name, names must be unique if referenced
+func (c *Config) GetQueryByName(name string) (*ConfigQuery, error) {
+	var ret *ConfigQuery
+	for i := range c.Queries {
+		if c.Queries[i].GetName() == name {
+			if ret != nil {
+				return nil, fmt.Errorf("query name \"%v\" is not unique, set a unique name", name)
+			}
+			ret = &c.Queries[i]
+		}
+	}
+
+	if ret == nil {
+		return nil, fmt.Errorf("query \"%v\" not found", name)
+	}
+
+	return ret, nil
+}
+
+// IsDependency checks if any query depends on the query with the name
+func (c *Config) IsDependency(name string) bool {
+	for _, queryConfig := range c.Queries {
+		for _, dependency := range queryConfig.DependsOn {
+			if dependency == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetDependentQueries returns the query and all queries depending (transitively) on it
+func (c *Config) GetDependentQueries(name string) []*ConfigQuery {
+	ret := []*ConfigQuery{}
+	seen := map[string]bool{}
+
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+
+		for i := range c.Queries {
+			queryConfig := &c.Queries[i]
+			if queryConfig.GetName() == current {
+				ret = append(ret, queryConfig)
+				continue
+			}
+
+			for _, dependency := range queryConfig.DependsOn {
+				if dependency == current {
+					queue = append(queue, queryConfig.GetName())
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// validateDependencies checks that all dependencies exist and have no cycles
+func (c *Config) validateDependencies() (errs []error) {
+	for i := range c.Queries {
+		queryConfig := &c.Queries[i]
+		for _, dependency := range queryConfig.DependsOn {
+			if _, err := c.GetQueryByName(dependency); err != nil {
+				errs = append(errs, fmt.Errorf("query \"%v\": dependsOn: %w", queryConfig.GetName(), err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return
+	}
+
+	for i := range c.Queries {
+		if err := c.checkDependencyCycle(&c.Queries[i], []string{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+func (c *Config) checkDependencyCycle(queryConfig *ConfigQuery, path []string) error {
+	for _, name := range path {
+		if name == queryConfig.GetName() {
+			return fmt.Errorf("query \"%v\": dependency cycle %v", path[0], strings.Join(append(path, name), " -> "))
+		}
+	}
+	path = append(path, queryConfig.GetName())
+
+	for _, dependency := range queryConfig.DependsOn {
+		dependencyConfig, err := c.GetQueryByName(dependency)
+		if err != nil {
+			return err
+		}
+
+		if err := c.checkDependencyCycle(dependencyConfig, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Column returns the distinct values of a column as Kusto dynamic array, eg. {{ .Results.resourcegroups.Column "name" }}
+func (r QueryResult) Column(name string) string {
+	values := []string{}
+	valueSeen := map[string]bool{}
+
+	for _, row := range r {
+		var value string
+		switch v := row[name].(type) {
+		case string:
+			value = kustoStringLiteral(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			continue
+		}
+
+		if !valueSeen[value] {
+			valueSeen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+
+	return fmt.Sprintf("dynamic([%s])", strings.Join(values, ", "))
+}
+
+// Count returns the number of result rows
+func (r QueryResult) Count() int {
+	return len(r)
+}
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+var (
+	derivedMetricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
+type (
+	// ConfigDerivedMetric is a metric computed from other metrics of the module (eg. ratios of two queries)
+	ConfigDerivedMetric struct {
+		Metric string `yaml:"metric"`
+		Module string `yaml:"module"`
+
+		// expression with metric names, numbers, + - * / and parentheses
+		Expr string `yaml:"expr"`
+
+		// the series of each referenced metric are summed up by these labels (like sum by) before matching
+		// if empty the series are matched on all labels (except reserved labels, eg. __timestamp__)
+		On []string `yaml:"on"`
+
+		// additional labels
+		Labels map[string]string `yaml:"labels"`
+
+		parsedExpr derivedExpr
+	}
+
+	derivedExpr interface {
+		eval(ctx *derivedEvalContext) derivedValue
+	}
+
+	derivedNumber float64
+
+	derivedMetricRef string
+
+	derivedBinaryExpr struct {
+		operator    byte
+		left, right derivedExpr
+	}
+
+	// derivedValue is a scalar (series is nil) or a vector of series
+	derivedValue struct {
+		scalar float64
+		series []kusto.MetricRow
+	}
+
+	derivedEvalContext struct {
+		lookup func(metricName string) []kusto.MetricRow
+		on     []string
+	}
+)
+
+func (d *ConfigDerivedMetric) Validate() error {
+	if !derivedMetricNameRegexp.MatchString(d.Metric) {
+		return fmt.Errorf("invalid metric name \"%v\"", d.Metric)
+	}
+
+	expr, err := parseDerivedExpr(d.Expr)
+	if err != nil {
+		return fmt.Errorf("invalid expr \"%v\": %w", d.Expr, err)
+	}
+	d.parsedExpr = expr
+
+	return nil
+}
+
+// Evaluate computes the series of the derived metric, lookup returns the series of a metric.
+// Series without value and divisions by zero are skipped.
+func (d *ConfigDerivedMetric) Evaluate(lookup func(metricName string) []kusto.MetricRow) []kusto.MetricRow {
+	if d.parsedExpr == nil {
+		if err := d.Validate(); err != nil {
+			return nil
+		}
+	}
+
+	result := d.parsedExpr.eval(&derivedEvalContext{lookup: lookup, on: d.On})
+	if result.series == nil {
+		// scalar expression
+		value := result.scalar
+		result.series = []kusto.MetricRow{{Labels: prometheus.Labels{}, Value: &value}}
+	}
+
+	for _, row := range result.series {
+		for labelName, labelValue := range d.Labels {
+			row.Labels[labelName] = labelValue
+		}
+	}
+	return result.series
+}
+
+func (n derivedNumber) eval(ctx *derivedEvalContext) derivedValue {
+	return derivedValue{scalar: float64(n)}
+}
+
+func (m derivedMetricRef) eval(ctx *derivedEvalContext) derivedValue {
+	series := []kusto.MetricRow{}
+	for _, row := range ctx.lookup(string(m)) {
+		if row.Value == nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for labelName, labelValue := range row.Labels {
+			labels[labelName] = labelValue
+		}
+		value := *row.Value
+		series = append(series, kusto.MetricRow{Labels: labels, Value: &value})
+	}
+	return derivedValue{series: ctx.aggregate(series)}
+}
+
+func (b *derivedBinaryExpr) eval(ctx *derivedEvalContext) derivedValue {
+	left, right := b.left.eval(ctx), b.right.eval(ctx)
+
+	switch {
+	case left.series == nil && right.series == nil:
+		value, ok := derivedApply(b.operator, left.scalar, right.scalar)
+		if !ok {
+			return derivedValue{series: []kusto.MetricRow{}}
+		}
+		return derivedValue{scalar: value}
+	case left.series == nil:
+		return derivedValue{series: derivedApplyScalar(right.series, func(val float64) (float64, bool) {
+			return derivedApply(b.operator, left.scalar, val)
+		})}
+	case right.series == nil:
+		return derivedValue{series: derivedApplyScalar(left.series, func(val float64) (float64, bool) {
+			return derivedApply(b.operator, val, right.scalar)
+		})}
+	}
+
+	rightIndex := map[string]kusto.MetricRow{}
+	for _, row := range right.series {
+		rightIndex[derivedLabelKey(row.Labels)] = row
+	}
+
+	series := []kusto.MetricRow{}
+	for _, row := range left.series {
+		match, ok := rightIndex[derivedLabelKey(row.Labels)]
+		if !ok {
+			continue
+		}
+		if value, ok := derivedApply(b.operator, *row.Value, *match.Value); ok {
+			series = append(series, kusto.MetricRow{Labels: row.Labels, Value: &value})
+		}
+	}
+	return derivedValue{series: series}
+}
+
+// aggregate sums up the series by the on labels (series are unchanged without on labels)
+func (ctx *derivedEvalContext) aggregate(series []kusto.MetricRow) []kusto.MetricRow {
+	if len(ctx.on) == 0 {
+		return series
+	}
+
+	index := map[string]int{}
+	ret := []kusto.MetricRow{}
+	for _, row := range series {
+		labels := prometheus.Labels{}
+		for _, labelName := range ctx.on {
+			labels[labelName] = row.Labels[labelName]
+		}
+
+		key := derivedLabelKey(labels)
+		if i, ok := index[key]; ok {
+			sum := *ret[i].Value + *row.Value
+			ret[i].Value = &sum
+			continue
+		}
+
+		value := *row.Value
+		index[key] = len(ret)
+		ret = append(ret, kusto.MetricRow{Labels: labels, Value: &value})
+	}
+	return ret
+}
+
+func derivedApplyScalar(series []kusto.MetricRow, apply func(val float64) (float64, bool)) []kusto.MetricRow {
+	ret := []kusto.MetricRow{}
+	for _, row := range series {
+		if value, ok := apply(*row.Value); ok {
+			ret = append(ret, kusto.MetricRow{Labels: row.Labels, Value: &value})
+		}
+	}
+	return ret
+}
+
+func derivedApply(operator byte, left, right float64) (float64, bool) {
+	switch operator {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	}
+	return 0, false
+}
+
+// derivedLabelKey builds a unique key for a label set, reserved labels (__ prefix, eg. the timestamp of the series)
+// are not part of the key
+func derivedLabelKey(labels prometheus.Labels) string {
+	names := []string{}
+	for labelName := range labels {
+		if strings.HasPrefix(labelName, "__") {
+			continue
+		}
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	parts := []string{}
+	for _, labelName := range names {
+		parts = append(parts, labelName+"="+labels[labelName])
+	}
+	return strings.Join(parts, "\xff")
+}
+
+// parseDerivedExpr parses the expression (precedence: * and / before + and -, left associative)
+func parseDerivedExpr(expr string) (derivedExpr, error) {
+	p := &derivedExprParser{input: expr}
+	ret, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected \"%v\" at position %v", string(p.input[p.pos]), p.pos+1)
+	}
+	return ret, nil
+}
+
+type (
+	derivedExprParser struct {
+		input string
+		pos   int
+	}
+)
+
+func (p *derivedExprParser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *derivedExprParser) parseSum() (derivedExpr, error) {
+	return p.parseBinary("+-", p.parseProduct)
+}
+
+func (p *derivedExprParser) parseProduct() (derivedExpr, error) {
+	return p.parseBinary("*/", p.parseOperand)
+}
+
+func (p *derivedExprParser) parseBinary(operators string, next func() (derivedExpr, error)) (derivedExpr, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) || !strings.ContainsRune(operators, rune(p.input[p.pos])) {
+			return left, nil
+		}
+		operator := p.input[p.pos]
+		p.pos++
+
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &derivedBinaryExpr{operator: operator, left: left, right: right}
+	}
+}
+
+func (p *derivedExprParser) parseOperand() (derivedExpr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	start := p.pos
+	switch char := p.input[p.pos]; {
+	case char == '(':
+		p.pos++
+		expr, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing \")\" for \"(\" at position %v", start+1)
+		}
+		p.pos++
+		return expr, nil
+	case (char >= '0' && char <= '9') || char == '.':
+		for p.pos < len(p.input) && ((p.input[p.pos] >= '0' && p.input[p.pos] <= '9') || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number \"%v\" at position %v", p.input[start:p.pos], start+1)
+		}
+		return derivedNumber(value), nil
+	default:
+		for p.pos < len(p.input) && derivedMetricNameRegexp.MatchString(p.input[start:p.pos+1]) {
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, fmt.Errorf("unexpected \"%v\" at position %v", string(char), start+1)
+		}
+		return derivedMetricRef(p.input[start:p.pos]), nil
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+func newTestDerivedSeries(value float64, labels ...string) kusto.MetricRow {
+	row := kusto.MetricRow{Labels: prometheus.Labels{}, Value: &value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		row.Labels[labels[i]] = labels[i+1]
+	}
+	return row
+}
+
+// formatTestDerivedSeries formats the series as sorted "{labels} value" lines
+func formatTestDerivedSeries(series []kusto.MetricRow) string {
+	lines := []string{}
+	for _, row := range series {
+		names := []string{}
+		for labelName := range row.Labels {
+			names = append(names, labelName)
+		}
+		sort.Strings(names)
+
+		labels := []string{}
+		for _, labelName := range names {
+			labels = append(labels, labelName+"="+row.Labels[labelName])
+		}
+		lines = append(lines, "{"+strings.Join(labels, ",")+"} "+strconv.FormatFloat(*row.Value, 'g', -1, 64))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func TestParseDerivedExpr(t *testing.T) {
+	testCases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: "azure_a"},
+		{expr: "azure_a / azure_b"},
+		{expr: " ( azure_a + azure_b ) * 100 "},
+		{expr: "azure:a_b / 0.5"},
+		{expr: "", err: "unexpected end of expression"},
+		{expr: "azure_a /", err: "unexpected end of expression"},
+		{expr: "(azure_a + azure_b", err: `missing ")" for "(" at position 1`},
+		{expr: "azure_a azure_b", err: `unexpected "a" at position 9`},
+		{expr: "azure_a % 2", err: `unexpected "%" at position 9`},
+		{expr: "1.2.3", err: `invalid number "1.2.3" at position 1`},
+		{expr: "azure_a + -1", err: `unexpected "-" at position 11`},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseDerivedExpr(testCase.expr)
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", testCase.expr, err)
+		case testCase.err != "" && (err == nil || err.Error() != testCase.err):
+			t.Errorf("%q: expected error %q, got %v", testCase.expr, testCase.err, err)
+		}
+	}
+}
+
+func TestDerivedMetricValidate(t *testing.T) {
+	derivedMetric := ConfigDerivedMetric{Metric: "azure-invalid", Expr: "azure_a"}
+	if err := derivedMetric.Validate(); err == nil || err.Error() != `invalid metric name "azure-invalid"` {
+		t.Errorf("expected invalid metric name, got %v", err)
+	}
+
+	derivedMetric = ConfigDerivedMetric{Metric: "azure_ratio", Expr: "azure_a /"}
+	if err := derivedMetric.Validate(); err == nil || err.Error() != `invalid expr "azure_a /": unexpected end of expression` {
+		t.Errorf("expected invalid expr, got %v", err)
+	}
+}
+
+func TestDerivedMetricEvaluate(t *testing.T) {
+	metrics := map[string][]kusto.MetricRow{
+		"azure_a": {
+			newTestDerivedSeries(10, "location", "westeurope", "type", "vm"),
+			newTestDerivedSeries(20, "location", "eastus", "type", "vm"),
+			newTestDerivedSeries(30, "location", "eastus", "type", "disk"),
+		},
+		"azure_b": {
+			newTestDerivedSeries(2, "location", "westeurope", "type", "vm"),
+			newTestDerivedSeries(0, "location", "eastus", "type", "vm"),
+			newTestDerivedSeries(5, "location", "northeurope", "type", "vm"),
+		},
+		"azure_ts_a": {
+			newTestDerivedSeries(6, "id", "a", "__timestamp__", "1700000000000"),
+			newTestDerivedSeries(8, "id", "b", "__timestamp__", "1700000060000"),
+		},
+		"azure_ts_b": {
+			newTestDerivedSeries(3, "id", "a", "__timestamp__", "1700000030000"),
+			newTestDerivedSeries(4, "id", "b"),
+		},
+		"azure_nil": {
+			{Labels: prometheus.Labels{"location": "westeurope", "type": "vm"}},
+		},
+	}
+	lookup := func(metricName string) []kusto.MetricRow {
+		return metrics[metricName]
+	}
+
+	testCases := []struct {
+		name     string
+		expr     string
+		on       []string
+		labels   map[string]string
+		expected string
+	}{
+		{name: "precedence", expr: "1 + 2 * 3", expected: "{} 7"},
+		{name: "left associative", expr: "8 - 4 - 2", expected: "{} 2"},
+		{name: "division left associative", expr: "8 / 4 / 2", expected: "{} 1"},
+		{name: "parentheses", expr: "(1 + 2) * 3", expected: "{} 9"},
+		{name: "scalar division by zero", expr: "1 / 0", expected: ""},
+		{
+			name:     "vector and scalar",
+			expr:     "azure_a * 2 + 1",
+			expected: "{location=eastus,type=disk} 61\n{location=eastus,type=vm} 41\n{location=westeurope,type=vm} 21",
+		},
+		{
+			name:     "scalar and vector",
+			expr:     "100 - azure_a",
+			expected: "{location=eastus,type=disk} 70\n{location=eastus,type=vm} 80\n{location=westeurope,type=vm} 90",
+		},
+		{
+			name:     "vector division by zero and unmatched series",
+			expr:     "azure_a / azure_b",
+			expected: "{location=westeurope,type=vm} 5",
+		},
+		{
+			name:     "vector scalar division by zero",
+			expr:     "azure_a / (azure_b * 0)",
+			expected: "",
+		},
+		{
+			name:     "aggregation by on labels",
+			expr:     "azure_a / azure_b",
+			on:       []string{"type"},
+			expected: "{type=vm} 4.285714285714286",
+		},
+		{
+			name:     "aggregation by unknown on label",
+			expr:     "azure_a",
+			on:       []string{"subscriptionID"},
+			expected: "{subscriptionID=} 60",
+		},
+		{
+			name:     "reserved labels are not matched",
+			expr:     "azure_ts_a / azure_ts_b",
+			expected: "{__timestamp__=1700000000000,id=a} 2\n{__timestamp__=1700000060000,id=b} 2",
+		},
+		{
+			name:     "series without value",
+			expr:     "azure_nil + azure_a",
+			expected: "",
+		},
+		{
+			name:     "unknown metric",
+			expr:     "azure_unknown + 1",
+			expected: "",
+		},
+		{
+			name:     "additional labels",
+			expr:     "azure_b + azure_b",
+			labels:   map[string]string{"scope": "capacity"},
+			expected: "{location=eastus,scope=capacity,type=vm} 0\n{location=northeurope,scope=capacity,type=vm} 10\n{location=westeurope,scope=capacity,type=vm} 4",
+		},
+	}
+
+	for _, testCase := range testCases {
+		derivedMetric := ConfigDerivedMetric{Metric: "azure_derived", Expr: testCase.expr, On: testCase.on, Labels: testCase.labels}
+		if err := derivedMetric.Validate(); err != nil {
+			t.Fatalf("%v: unexpected error: %v", testCase.name, err)
+		}
+
+		if actual := formatTestDerivedSeries(derivedMetric.Evaluate(lookup)); actual != testCase.expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v", testCase.name, testCase.expected, actual)
+		}
+	}
+
+	// the series of the referenced metrics are not modified
+	if value := *metrics["azure_a"][0].Value; value != 10 || len(metrics["azure_a"][0].Labels) != 2 {
+		t.Errorf("referenced series were modified: %v %v", metrics["azure_a"][0].Labels, value)
+	}
+}
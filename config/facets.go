@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	FacetMetricInfix = "_by_"
+
+	FacetSortOrderAsc  = "asc"
+	FacetSortOrderDesc = "desc"
+
+	// max facet values per facet supported by the ResourceGraph API
+	FacetMaxTop = 1000
+)
+
+var (
+	facetLabelInvalidCharsRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+)
+
+type (
+	// ConfigQueryFacet requests a facet (count by expression) with the query, the facet result is published
+	// as its own metric with one series per facet value (value = count)
+	ConfigQueryFacet struct {
+		// column or property path (eg. location or properties.storageProfile.osDisk.osType)
+		Expression string `yaml:"expression"`
+
+		// metric name (default: <metric>_by_<label>)
+		Metric string `yaml:"metric"`
+
+		// label of the facet value (default: expression with invalid characters replaced by _)
+		Label string `yaml:"label"`
+
+		// max facet values (default: API default 10)
+		Top int32 `yaml:"top"`
+
+		// sort order by count (asc, desc)
+		SortOrder string `yaml:"sortOrder"`
+
+		// filter applied to the rows before the facet is calculated (eg. "properties.powerState == 'running'")
+		Filter string `yaml:"filter"`
+	}
+)
+
+func (f *ConfigQueryFacet) Validate() error {
+	if f.Expression == "" {
+		return errors.New("facet expression is required")
+	}
+
+	if f.Metric != "" && !derivedMetricNameRegexp.MatchString(f.Metric) {
+		return fmt.Errorf("facet \"%v\": invalid metric name \"%v\"", f.Expression, f.Metric)
+	}
+
+	if f.Label != "" && !queryParamNameRegexp.MatchString(f.Label) {
+		return fmt.Errorf("facet \"%v\": invalid label name \"%v\"", f.Expression, f.Label)
+	}
+
+	if f.Top < 0 || f.Top > FacetMaxTop {
+		return fmt.Errorf("facet \"%v\": top must be between 0 and %v", f.Expression, FacetMaxTop)
+	}
+
+	switch strings.ToLower(f.SortOrder) {
+	case "", FacetSortOrderAsc, FacetSortOrderDesc:
+	default:
+		return fmt.Errorf("facet \"%v\": unsupported sortOrder \"%v\"", f.Expression, f.SortOrder)
+	}
+
+	return nil
+}
+
+// GetLabel returns the label name of the facet values
+func (f *ConfigQueryFacet) GetLabel() string {
+	if f.Label != "" {
+		return f.Label
+	}
+	return strings.Trim(facetLabelInvalidCharsRegexp.ReplaceAllString(f.Expression, "_"), "_")
+}
+
+// GetMetric returns the metric name of the facet
+func (f *ConfigQueryFacet) GetMetric(queryMetric string) string {
+	if f.Metric != "" {
+		return f.Metric
+	}
+	return queryMetric + FacetMetricInfix + f.GetLabel()
+}
+
+// GetSortOrder returns the normalized sort order (empty for the API default)
+func (f *ConfigQueryFacet) GetSortOrder() string {
+	return strings.ToLower(f.SortOrder)
+}
+
+// validateFacets checks the facets of the query, every facet needs its own metric name
+func (c *ConfigQuery) validateFacets() error {
+	metrics := map[string]bool{c.Metric: true}
+	for i := range c.Facets {
+		facet := &c.Facets[i]
+		if err := facet.Validate(); err != nil {
+			return err
+		}
+
+		if !queryParamNameRegexp.MatchString(facet.GetLabel()) {
+			return fmt.Errorf("facet \"%v\": unable to derive label name from expression, label is required", facet.Expression)
+		}
+
+		metric := facet.GetMetric(c.Metric)
+		if metrics[metric] {
+			return fmt.Errorf("facet \"%v\": duplicate metric \"%v\"", facet.Expression, metric)
+		}
+		metrics[metric] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	GuardrailActionReject  = "reject"
+	GuardrailActionRewrite = "rewrite"
+
+	GuardrailRuleProject = "requireProject"
+	GuardrailRuleJoin    = "denyUnboundedJoin"
+	GuardrailRuleLimit   = "requireLimit"
+)
+
+var (
+	// operators limiting the columns of the result
+	guardrailProjectOperators = map[string]bool{
+		"project": true, "project-keep": true, "summarize": true, "count": true, "distinct": true, "make-series": true,
+	}
+
+	// operators limiting the rows of the result (aggregations are no detail queries)
+	guardrailLimitOperators = map[string]bool{
+		"limit": true, "take": true, "top": true, "top-nested": true, "sample": true, "sample-distinct": true,
+		"summarize": true, "count": true, "distinct": true, "make-series": true,
+	}
+
+	// operators filtering the right side of a join
+	guardrailJoinFilterOperators = map[string]bool{
+		"where": true, "filter": true, "summarize": true, "count": true, "distinct": true,
+		"limit": true, "take": true, "top": true, "sample": true,
+	}
+)
+
+type (
+	// ConfigGuardrails is an optional policy for queries protecting shared tenants from expensive queries
+	ConfigGuardrails struct {
+		// reject (default) or rewrite queries violating the rules (rules without rewrite are always rejected)
+		Action string `yaml:"action"`
+
+		// detail queries must project their columns, rewrite projects the fields of the metric config
+		RequireProject bool `yaml:"requireProject"`
+
+		// the right side of joins must be a filtered subquery
+		DenyUnboundedJoin bool `yaml:"denyUnboundedJoin"`
+
+		// detail queries (no aggregation) must limit their rows, rewrite appends "| limit <requireLimit>"
+		RequireLimit int `yaml:"requireLimit"`
+	}
+
+	// guardrailViolation is a rule violation of a query with an optional rewrite
+	guardrailViolation struct {
+		rule    string
+		message string
+		rewrite func(query string) string
+	}
+)
+
+func (g *ConfigGuardrails) Validate() error {
+	switch g.GetAction() {
+	case GuardrailActionReject:
+	case GuardrailActionRewrite:
+	default:
+		return fmt.Errorf("unsupported guardrails action \"%v\"", g.Action)
+	}
+
+	if g.RequireLimit < 0 {
+		return errors.New("guardrails requireLimit must not be negative")
+	}
+
+	return nil
+}
+
+// GetAction returns the action for violations (default reject)
+func (g *ConfigGuardrails) GetAction() string {
+	if g.Action == "" {
+		return GuardrailActionReject
+	}
+	return strings.ToLower(g.Action)
+}
+
+// applyGuardrails rewrites the query if the guardrails action is rewrite
+func (c *Config) applyGuardrails(queryConfig *ConfigQuery) {
+	if c.Guardrails == nil || queryConfig.Unsafe || c.Guardrails.GetAction() != GuardrailActionRewrite {
+		return
+	}
+
+	for _, violation := range c.Guardrails.check(queryConfig) {
+		if violation.rewrite != nil {
+			queryConfig.Query = violation.rewrite(queryConfig.Query)
+			queryConfig.guardrailRewrites = append(queryConfig.guardrailRewrites, violation.rule)
+		}
+	}
+}
+
+// validateGuardrails returns the remaining violations of the query (after rewrite)
+func (c *Config) validateGuardrails(queryConfig *ConfigQuery) error {
+	if c.Guardrails == nil || queryConfig.Unsafe {
+		return nil
+	}
+
+	if violations := c.Guardrails.check(queryConfig); len(violations) > 0 {
+		violation := violations[0]
+		return fmt.Errorf("guardrail %v: %v (set \"unsafe: true\" to skip guardrails)", violation.rule, violation.message)
+	}
+
+	return nil
+}
+
+// GetGuardrailRewrites returns the guardrail rules rewriting the query
+func (c *ConfigQuery) GetGuardrailRewrites() []string {
+	return c.guardrailRewrites
+}
+
+// check returns all rule violations of the query, queries with syntax errors are reported by the validation
+func (g *ConfigGuardrails) check(queryConfig *ConfigQuery) (violations []guardrailViolation) {
+	tokens, err := scanKustoQuery(queryConfig.Query)
+	if err != nil {
+		return
+	}
+	operators := tokens.operators
+
+	hasTopLevelOperator := func(names map[string]bool) bool {
+		for _, operator := range operators {
+			if operator.depth == 0 && names[operator.name] {
+				return true
+			}
+		}
+		return false
+	}
+
+	if g.RequireProject && !hasTopLevelOperator(guardrailProjectOperators) {
+		violation := guardrailViolation{rule: GuardrailRuleProject, message: "query has no project or aggregation"}
+
+		// only fields of the metric config are used if other columns are ignored
+		if queryConfig.MetricConfig.DefaultField.Type == kusto.MetricFieldTypeIgnore && len(queryConfig.MetricConfig.Fields) > 0 {
+			columns := []string{}
+			for _, field := range queryConfig.MetricConfig.Fields {
+				columns = append(columns, field.Name)
+			}
+			violation.rewrite = func(query string) string {
+				return strings.TrimRight(query, " \t\r\n") + "\n| project " + strings.Join(columns, ", ")
+			}
+		}
+		violations = append(violations, violation)
+	}
+
+	if g.DenyUnboundedJoin {
+		for i, operator := range operators {
+			if operator.name != "join" {
+				continue
+			}
+
+			// operators of the right side subquery are nested deeper than the join
+			filtered := false
+			for _, subOperator := range operators[i+1:] {
+				if subOperator.depth <= operator.depth {
+					break
+				}
+				if guardrailJoinFilterOperators[subOperator.name] {
+					filtered = true
+				}
+			}
+
+			if !filtered {
+				violations = append(violations, guardrailViolation{
+					rule:    GuardrailRuleJoin,
+					message: fmt.Sprintf("join at line %v, column %v has no filtered subquery", operator.line, operator.column),
+				})
+			}
+		}
+	}
+
+	if g.RequireLimit > 0 && !hasTopLevelOperator(guardrailLimitOperators) {
+		limit := g.RequireLimit
+		violations = append(violations, guardrailViolation{
+			rule:    GuardrailRuleLimit,
+			message: "detail query has no limit",
+			rewrite: func(query string) string {
+				return fmt.Sprintf("%v\n| limit %d", strings.TrimRight(query, " \t\r\n"), limit)
+			},
+		})
+	}
+
+	return
+}
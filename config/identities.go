@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type (
+	// ConfigIdentity is an additional Azure identity for queries needing other permissions than the default identity
+	// (eg. a security reader for securityresources), either a service principal or a user-assigned managed identity
+	ConfigIdentity struct {
+		ConfigCloudCredentials `yaml:",inline"`
+
+		// client id of the user-assigned managed identity
+		ManagedIdentityClientID string `yaml:"managedIdentityClientID"`
+
+		// modules using the identity for all queries (unless the query sets identity)
+		Modules []string `yaml:"modules"`
+	}
+)
+
+func (i *ConfigIdentity) Validate() error {
+	isServicePrincipal := i.TenantID != "" || i.ClientID != "" || i.ClientSecretEnv != ""
+
+	switch {
+	case isServicePrincipal && i.ManagedIdentityClientID != "":
+		return errors.New("service principal (tenantID, clientID, clientSecretEnv) and managedIdentityClientID are exclusive")
+	case isServicePrincipal:
+		if i.TenantID == "" || i.ClientID == "" || i.ClientSecretEnv == "" {
+			return errors.New("service principal requires tenantID, clientID and clientSecretEnv")
+		}
+	case i.ManagedIdentityClientID == "":
+		return errors.New("service principal (tenantID, clientID, clientSecretEnv) or managedIdentityClientID is required")
+	}
+
+	return nil
+}
+
+// IsManagedIdentity checks if the identity is a user-assigned managed identity
+func (i *ConfigIdentity) IsManagedIdentity() bool {
+	return i.ManagedIdentityClientID != ""
+}
+
+// GetModuleIdentity returns the name of the identity configured for the module (empty for the default identity)
+func (c *Config) GetModuleIdentity(module string) string {
+	for _, name := range c.getIdentityNames() {
+		for _, identityModule := range c.Identities[name].Modules {
+			if identityModule == module {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// getIdentityNames returns the sorted identity names
+func (c *Config) getIdentityNames() []string {
+	names := []string{}
+	for name := range c.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateIdentities validates all identities and the identity references of the queries
+func (c *Config) validateIdentities() (errs []error) {
+	modules := map[string]string{}
+	for _, name := range c.getIdentityNames() {
+		identity := c.Identities[name]
+		if err := identity.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("identity \"%v\": %w", name, err))
+		}
+
+		for _, module := range identity.Modules {
+			if other, exists := modules[module]; exists {
+				errs = append(errs, fmt.Errorf("identity \"%v\": module \"%v\" is already assigned to identity \"%v\"", name, module, other))
+			}
+			modules[module] = name
+		}
+	}
+
+	for _, queryConfig := range c.Queries {
+		if _, exists := c.Identities[queryConfig.Identity]; queryConfig.Identity != "" && !exists {
+			errs = append(errs, fmt.Errorf("query \"%v\": unknown identity \"%v\"", queryConfig.GetName(), queryConfig.Identity))
+		}
+	}
+
+	return
+}
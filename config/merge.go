@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	ConfigSourceFile    = "config file"
+	ConfigSourceQueries = "query file"
+	ConfigSourceBuiltin = "builtin"
+)
+
+type (
+	// ConfigFragment is a config file contributed by another source (eg. Kubernetes ConfigMap), only queries are merged
+	ConfigFragment struct {
+		Queries []ConfigQuery `yaml:"queries"`
+	}
+
+	// ConfigSource is a source of queries of the merged config
+	ConfigSource struct {
+		Source  string `json:"source"`
+		Queries int    `json:"queries"`
+	}
+)
+
+// MergeQueries parses a config fragment and appends its queries (defaults of the config are applied)
+func (c *Config) MergeQueries(source string, content []byte) error {
+	return c.mergeQueries(source, content, true)
+}
+
+// MergeUntrustedQueries parses a config fragment of an untrusted source (eg. Kubernetes ConfigMaps) and appends
+// its queries, fragments with queries setting restricted fields (see ConfigQuery.RestrictedFields) are rejected
+func (c *Config) MergeUntrustedQueries(source string, content []byte) error {
+	return c.mergeQueries(source, content, false)
+}
+
+func (c *Config) mergeQueries(source string, content []byte, trusted bool) error {
+	fragment := ConfigFragment{}
+	if err := yaml.UnmarshalStrict(content, &fragment); err != nil {
+		return fmt.Errorf("unable to parse config fragment \"%v\": %w", source, err)
+	}
+
+	if !trusted {
+		for _, queryConfig := range fragment.Queries {
+			if fields := queryConfig.RestrictedFields(); len(fields) > 0 {
+				return fmt.Errorf("query \"%v\" of config fragment \"%v\": %v only allowed in config and query files", queryConfig.GetName(), source, strings.Join(fields, ", "))
+			}
+		}
+	}
+
+	for _, queryConfig := range fragment.Queries {
+		c.applyQueryDefaults(&queryConfig)
+		c.Queries = append(c.Queries, queryConfig)
+	}
+	c.addSource(source, len(fragment.Queries))
+
+	return nil
+}
+
+// GetSources returns the sources of the queries in merge order
+func (c *Config) GetSources() []ConfigSource {
+	return c.sources
+}
+
+func (c *Config) addSource(source string, queries int) {
+	c.sources = append(c.sources, ConfigSource{Source: source, Queries: queries})
+}
+
+// loadQueryFiles merges the queries of the files, directories are expanded to their yaml files (sorted by name)
+func (c *Config) loadQueryFiles(paths []string) error {
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("unable to read query files \"%v\": %w", path, err)
+		}
+
+		files := []string{path}
+		if stat.IsDir() {
+			files = []string{}
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return fmt.Errorf("unable to read query directory \"%v\": %w", path, err)
+			}
+			for _, entry := range entries {
+				// skip hidden files (eg. ..data symlinks of mounted ConfigMaps)
+				if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+					continue
+				}
+				if ext := filepath.Ext(entry.Name()); ext == ".yaml" || ext == ".yml" {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			/*  #nosec G304 */
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("unable to read query file \"%v\": %w", file, err)
+			}
+
+			if err := c.MergeQueries(ConfigSourceQueries+" "+file, content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
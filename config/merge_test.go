@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeUntrustedQueries(t *testing.T) {
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{content: "queries:\n  - metric: azure_a\n    query: resources | summarize count()"},
+		{content: "queries:\n  - metric: azure_a\n    query: resources | summarize count()\n    unsafe: true", err: `query "azure_a" of config fragment "configmap/team-a/queries/queries.yaml": unsafe only allowed in config and query files`},
+		{content: "queries:\n  - metric: azure_a\n    query: resources | summarize count()\n  - metric: azure_b\n    query: resources | summarize count()\n    identity: admin", err: `query "azure_b" of config fragment "configmap/team-a/queries/queries.yaml": identity only allowed in config and query files`},
+		{content: "queries:\n  - metric: azure_a\n    query: resources | summarize count()\n    unsafe: true\n    identity: admin", err: "unsafe, identity only allowed"},
+	}
+
+	for _, testCase := range testCases {
+		config := Config{}
+		err := config.MergeUntrustedQueries("configmap/team-a/queries/queries.yaml", []byte(testCase.content))
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", testCase.content, err)
+		case testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)):
+			t.Errorf("%q: expected error %q, got %v", testCase.content, testCase.err, err)
+		case testCase.err != "" && len(config.Queries) > 0:
+			t.Errorf("%q: expected fragment to be rejected, got %v queries", testCase.content, len(config.Queries))
+		}
+	}
+}
+
+func TestMergeQueriesTrusted(t *testing.T) {
+	config := Config{}
+	content := "queries:\n  - metric: azure_a\n    query: resources | summarize count()\n    unsafe: true\n    identity: admin"
+	if err := config.MergeQueries("query file queries.yaml", []byte(content)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(config.Queries) != 1 || !config.Queries[0].Unsafe || config.Queries[0].Identity != "admin" {
+		t.Errorf("expected query with unsafe and identity, got %+v", config.Queries)
+	}
+	if sources := config.GetSources(); len(sources) != 1 || sources[0].Queries != 1 {
+		t.Errorf("unexpected sources %+v", sources)
+	}
+}
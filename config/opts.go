@@ -1,29 +1,265 @@
 package config
 
 import (
-	"encoding/json"
-
-	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 type (
 	Opts struct {
+		// version
+		Version bool `long:"version"  description:"Print version information and exit" json:"-"`
+
 		// logger
 		Logger struct {
 			Debug   bool `           long:"debug"        env:"DEBUG"    description:"debug mode"`
 			Verbose bool `short:"v"  long:"verbose"      env:"VERBOSE"  description:"verbose mode"`
 			LogJson bool `           long:"log.json"     env:"LOG_JSON" description:"Switch log output to json format"`
+
+			RateLimitInterval time.Duration `long:"log.ratelimit.interval"  env:"LOG_RATELIMIT_INTERVAL"  description:"Log recurring query errors only once per interval and summarize repetitions (0 = disabled, repetitions are logged at debug level)" default:"5m"`
+
+			DumpApi         []string `long:"debug.dump-api"            env:"DEBUG_DUMP_API"            env-delim:" "  description:"Log the ResourceGraph request and (truncated) response of the query (query name, * for all queries)"`
+			DumpApiMaxBytes int      `long:"debug.dump-api.max-bytes"  env:"DEBUG_DUMP_API_MAX_BYTES"                 description:"Max size of logged ResourceGraph request and response bodies (0 = unlimited)" default:"4096"`
 		}
 
 		// azure
 		Azure struct {
 			Environment  *string  `long:"azure-environment"            env:"AZURE_ENVIRONMENT"                description:"Azure environment name" default:"AZUREPUBLICCLOUD"`
 			Subscription []string `long:"azure-subscription"           env:"AZURE_SUBSCRIPTION_ID"     env-delim:" "  description:"Azure subscription ID"`
+
+			// token cache
+			Token struct {
+				RefreshBefore time.Duration `long:"azure.token.refresh-before"  env:"AZURE_TOKEN_REFRESH_BEFORE"  description:"Refresh cached Azure AD tokens proactively before expiry (0 = refresh on demand)" default:"10m"`
+			}
+
+			// http client
+			Http struct {
+				MaxIdleConns        int           `long:"azure.http.max-idle-conns"           env:"AZURE_HTTP_MAX_IDLE_CONNS"           description:"Maximum number of idle (keep-alive) connections to Azure across all hosts (0 = unlimited)" default:"100"`
+				MaxIdleConnsPerHost int           `long:"azure.http.max-idle-conns-per-host"  env:"AZURE_HTTP_MAX_IDLE_CONNS_PER_HOST"  description:"Maximum number of idle (keep-alive) connections per Azure host (0 = golang default of 2)" default:"100"`
+				MaxConnsPerHost     int           `long:"azure.http.max-conns-per-host"       env:"AZURE_HTTP_MAX_CONNS_PER_HOST"       description:"Maximum number of connections per Azure host (0 = unlimited)" default:"0"`
+				IdleConnTimeout     time.Duration `long:"azure.http.idle-conn-timeout"        env:"AZURE_HTTP_IDLE_CONN_TIMEOUT"        description:"Close idle connections to Azure after this duration (0 = never)" default:"90s"`
+				TLSMinVersion       string        `long:"azure.http.tls-min-version"          env:"AZURE_HTTP_TLS_MIN_VERSION"          description:"Minimum TLS version for connections to Azure" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3" default:"1.2"`
+				DisableHTTP2        bool          `long:"azure.http.disable-http2"            env:"AZURE_HTTP_DISABLE_HTTP2"            description:"Disable HTTP/2 for connections to Azure (use HTTP/1.1 only)"`
+			}
+
+			// pagination
+			Pagination struct {
+				Concurrency int  `long:"azure.pagination.concurrency"   env:"AZURE_PAGINATION_CONCURRENCY"   description:"Number of result pages fetched concurrently per query (rows are processed in page order, 1 = next page is fetched while the current page is processed)" default:"4"`
+				RetryOnSkew bool `long:"azure.pagination.retry-on-skew"  env:"AZURE_PAGINATION_RETRY_ON_SKEW"  description:"Retry the whole query once if the results changed while paginating (total records changed, row count mismatch, ids on multiple pages)"`
+			}
+
+			// authentication endpoints (isolated clouds, Azure Arc)
+			AuthorityHost string `long:"azure.authority-host"  env:"AZURE_AUTHORITY_HOST"  description:"Custom AAD authority host (default: authority of Azure environment)"`
+			ImdsEndpoint  string `long:"azure.imds-endpoint"   env:"AZURE_IMDS_ENDPOINT"   description:"Custom IMDS token endpoint for managed identity (eg. http://localhost:40342/metadata/identity/oauth2/token)"`
+
+			// managed identity
+			Identity struct {
+				ClientID   string `long:"azure.identity.client-id"    env:"AZURE_IDENTITY_CLIENT_ID"    description:"Client ID of the user-assigned managed identity (default: system-assigned identity)"`
+				ResourceID string `long:"azure.identity.resource-id"  env:"AZURE_IDENTITY_RESOURCE_ID"  description:"Resource ID of the user-assigned managed identity (default: system-assigned identity)"`
+			}
+
+			// recording
+			Record string `long:"azure.record"  env:"AZURE_RECORD"  description:"Record raw ResourceGraph responses to directory"`
+			Replay string `long:"azure.replay"  env:"AZURE_REPLAY"  description:"Replay recorded ResourceGraph responses from directory (no Azure access)"`
+			Mock   string `long:"azure.mock"    env:"AZURE_MOCK"    description:"Serve result rows from fixture directory (<dir>/[<module>/]<query name>.json, no Azure access)"`
+
+			// lazy init
+			LazyInit struct {
+				Enable        bool          `long:"azure.lazy-init"                 env:"AZURE_LAZY_INIT"                 description:"Start the http server even if Azure authentication or subscription discovery fails, retry in background (not ready until initialized)"`
+				RetryInterval time.Duration `long:"azure.lazy-init.retry-interval"  env:"AZURE_LAZY_INIT_RETRY_INTERVAL"  description:"Retry interval of the Azure initialization with --azure.lazy-init" default:"30s"`
+			}
+
+			// lighthouse
+			Lighthouse struct {
+				DelegatedOnly bool `long:"azure.lighthouse.delegated-only"  env:"AZURE_LIGHTHOUSE_DELEGATED_ONLY"  description:"Only use Azure Lighthouse delegated subscriptions (customer tenants)"`
+				TenantLabels  bool `long:"azure.lighthouse.tenant-labels"   env:"AZURE_LIGHTHOUSE_TENANT_LABELS"   description:"Add tenantID and managedByTenantID labels to metrics with subscriptionId column"`
+			}
 		}
 
 		// config
 		Config struct {
-			Path string `long:"config" short:"c"  env:"CONFIG"   description:"Config path" required:"true"`
+			Path    string `long:"config" short:"c"  env:"CONFIG"   description:"Config path (required)"`
+			Profile string `long:"profile"           env:"PROFILE"  description:"Default config profile (overridable with probe param profile)"`
+
+			// query files (eg. mounted ConfigMaps), only queries are loaded
+			Queries []string `long:"config.queries"  env:"CONFIG_QUERIES"  env-delim:" "  description:"Additional query files or directories (*.yaml, *.yml), only the queries of these files are loaded"`
+
+			// query defaults, override the defaults of the config file
+			Defaults struct {
+				Cache          string            `long:"config.defaults.cache"             env:"CONFIG_DEFAULTS_CACHE"             description:"Default cache duration of query results (overrides defaults.cache of the config file)"`
+				Subscriptions  []string          `long:"config.defaults.subscriptions"     env:"CONFIG_DEFAULTS_SUBSCRIPTIONS"     env-delim:" "  description:"Default subscriptions of queries (overrides defaults.subscriptions of the config file)"`
+				PublishIfEmpty string            `long:"config.defaults.publish-if-empty"  env:"CONFIG_DEFAULTS_PUBLISH_IF_EMPTY"  description:"Default behavior for empty results (overrides defaults.publishIfEmpty of the config file)" choice:"suppress" choice:"zero" choice:"indicator"`
+				Labels         map[string]string `long:"config.defaults.label"             env:"CONFIG_DEFAULTS_LABELS"            env-delim:" "  description:"Default label (key:value) of all metrics, merged with defaults.labels of the config file (flag wins)"`
+
+				ResourceGraphApiVersion string `long:"config.defaults.resourcegraph-api-version"  env:"CONFIG_DEFAULTS_RESOURCEGRAPH_API_VERSION"  description:"Default ResourceGraph API version of queries, eg. a preview version (overrides defaults.resourceGraphApiVersion of the config file, default: 2019-04-01)"`
+			}
+
+			// query ConfigMap discovery
+			Kubernetes struct {
+				Selector  string        `long:"config.kubernetes.selector"   env:"CONFIG_KUBERNETES_SELECTOR"   description:"Label selector of Kubernetes ConfigMaps whose queries are merged into the config (eg. app=rg-queries, disabled if empty)"`
+				Namespace string        `long:"config.kubernetes.namespace"  env:"CONFIG_KUBERNETES_NAMESPACE"  description:"Namespace of the query ConfigMaps (all namespaces if empty)"`
+				Interval  time.Duration `long:"config.kubernetes.interval"   env:"CONFIG_KUBERNETES_INTERVAL"   description:"Interval for checking the query ConfigMaps for changes" default:"1m"`
+
+				// ResourceGraphQuery controller
+				Crd          bool          `long:"config.kubernetes.crd"            env:"CONFIG_KUBERNETES_CRD"            description:"Reconcile ResourceGraphQuery resources (resourcegraph.webdevops.io/v1alpha1) into queries and report their status"`
+				CrdNamespace string        `long:"config.kubernetes.crd.namespace"  env:"CONFIG_KUBERNETES_CRD_NAMESPACE"  description:"Namespace of the ResourceGraphQuery resources (all namespaces if empty)"`
+				CrdInterval  time.Duration `long:"config.kubernetes.crd.interval"   env:"CONFIG_KUBERNETES_CRD_INTERVAL"   description:"Interval for reconciling the ResourceGraphQuery resources (resources are polled, changes are applied within one interval)" default:"30s"`
+			}
+		}
+
+		// validation
+		Validation struct {
+			Validate       bool `long:"validate"          env:"VALIDATE"          description:"Validate flags, config and Azure connection and exit"`
+			SkipAzureCheck bool `long:"skip-azure-check"  env:"SKIP_AZURE_CHECK"  description:"Skip Azure connection check on validation (config-only validation, requires --validate)"`
+		}
+
+		// readiness
+		Readiness struct {
+			RetryInterval time.Duration `long:"readiness.retry-interval"  env:"READINESS_RETRY_INTERVAL"  description:"Retry interval of failed critical queries (critical: true) until each one succeeded once (not ready until then)" default:"30s"`
+		}
+
+		// probe
+		Probe struct {
+			ScrapeInterval time.Duration `long:"probe.scrape-interval"  env:"PROBE_SCRAPE_INTERVAL"  description:"Default scrape interval for query templates (overridable with probe param interval, rounded to a multiple of this interval, max. 60x)" default:"1m"`
+			DedupStrategy  string        `long:"probe.dedup-strategy"   env:"PROBE_DEDUP_STRATEGY"   description:"Default resolution strategy for duplicate series (overridable per query with dedup)" default:"last" choice:"first" choice:"last" choice:"sum" choice:"max"`
+			MaxSeries      int           `long:"probe.max-series"       env:"PROBE_MAX_SERIES"       description:"Max number of series per probe response, the response is truncated if exceeded (0 = unlimited)" default:"0"`
+			MaxBytes       int           `long:"probe.max-bytes"        env:"PROBE_MAX_BYTES"        description:"Max size of the probe response in bytes (uncompressed), the response is truncated if exceeded (0 = unlimited)" default:"0"`
+			TimeoutOffset  time.Duration `long:"probe.timeout-offset"   env:"PROBE_TIMEOUT_OFFSET"   description:"Offset subtracted from the Prometheus scrape timeout (X-Prometheus-Scrape-Timeout-Seconds), queries not started until then are skipped (lowest priority last)" default:"500ms"`
+		}
+
+		// cache
+		Cache struct {
+			Warmup    bool          `long:"cache.warmup"      env:"CACHE_WARMUP"      description:"Execute all modules of the default profile in background on startup to warm up the cache"`
+			WarmupTtl time.Duration `long:"cache.warmup.ttl"  env:"CACHE_WARMUP_TTL"  description:"Cache duration for warmup results if the profile has no cache duration" default:"5m"`
+
+			// background collector mode
+			Refresh struct {
+				Enable bool    `long:"cache.refresh"         env:"CACHE_REFRESH"         description:"Background collector mode: execute all modules of the default profile periodically (cache duration of the profile or --cache.warmup.ttl) spread over the interval and keep the results cached"`
+				Jitter float64 `long:"cache.refresh.jitter"  env:"CACHE_REFRESH_JITTER"  description:"Random jitter of the refresh interval as fraction of the interval (0-0.5)" default:"0.1"`
+			}
+		}
+
+		// metrics
+		Metrics struct {
+			Allowlist []string `long:"metrics.allowlist"  env:"METRICS_ALLOWLIST"  env-delim:" "  description:"Regexps of metric names exposed by /probe (all metrics if empty)"`
+			Blocklist []string `long:"metrics.blocklist"  env:"METRICS_BLOCKLIST"  env-delim:" "  description:"Regexps of metric names not exposed by /probe"`
+
+			Sanitize struct {
+				Replacement string `long:"metrics.sanitize.replacement"  env:"METRICS_SANITIZE_REPLACEMENT"  description:"Replacement for invalid characters in metric and label names" default:"_"`
+				SnakeCase   bool   `long:"metrics.sanitize.snake-case"   env:"METRICS_SANITIZE_SNAKE_CASE"   description:"Convert camelCase metric and label names to snake_case"`
+				MaxLength   int    `long:"metrics.sanitize.max-length"   env:"METRICS_SANITIZE_MAX_LENGTH"   description:"Max length of metric and label names (0 = unlimited)" default:"0"`
+			}
+
+			Builtin struct {
+				Disable           bool          `long:"metrics.builtin.disable"              env:"METRICS_BUILTIN_DISABLE"                             description:"Disable the built-in queries (azure_resources_total, modules certificates, compute, exposure, backup, tags, cost, aks, locks and extensions)"`
+				RequiredTags      []string      `long:"metrics.builtin.required-tags"        env:"METRICS_BUILTIN_REQUIRED_TAGS"        env-delim:" "  description:"Required tags of resources and resource groups checked by the built-in module tags (module is disabled if empty)"`
+				Quota             bool          `long:"metrics.builtin.quota"                env:"METRICS_BUILTIN_QUOTA"                               description:"Export compute quota limits and usages (Azure Compute Usages API) for all subscriptions and locations of the built-in module compute"`
+				QuotaCache        time.Duration `long:"metrics.builtin.quota-cache"          env:"METRICS_BUILTIN_QUOTA_CACHE"                         description:"Cache duration of compute quotas per subscription and location" default:"15m"`
+				LockResourceTypes []string      `long:"metrics.builtin.lock-resource-types"  env:"METRICS_BUILTIN_LOCK_RESOURCE_TYPES"  env-delim:" "  description:"Critical resource types checked for CanNotDelete/ReadOnly locks by the built-in module locks" default:"microsoft.sql/servers" default:"microsoft.storage/storageaccounts" default:"microsoft.keyvault/vaults" default:"microsoft.documentdb/databaseaccounts" default:"microsoft.dbforpostgresql/flexibleservers" default:"microsoft.dbformysql/flexibleservers" default:"microsoft.recoveryservices/vaults"`
+				ExtensionTypes    []string      `long:"metrics.builtin.extension-types"      env:"METRICS_BUILTIN_EXTENSION_TYPES"      env-delim:" "  description:"VM extension types (agents) tracked by the built-in module extensions" default:"AzureMonitorLinuxAgent" default:"AzureMonitorWindowsAgent" default:"DependencyAgentLinux" default:"DependencyAgentWindows"`
+			}
+
+			Timestamps struct {
+				Enable bool          `long:"metrics.timestamps"          env:"METRICS_TIMESTAMPS"          description:"Export sample timestamps from the timestamp column of queries (see timestamp in config), otherwise the scrape time is used"`
+				MaxAge time.Duration `long:"metrics.timestamps.max-age"  env:"METRICS_TIMESTAMPS_MAX_AGE"  description:"Default max age of sample timestamps, older or future timestamps are exported with scrape time" default:"1h"`
+			}
+
+			Runtime struct {
+				Disable bool `long:"metrics.runtime.disable"  env:"METRICS_RUNTIME_DISABLE"  description:"Disable the Go runtime and process metrics (go_*, process_*) of /metrics"`
+			}
+		}
+
+		// api
+		Api struct {
+			Token     string `long:"api.token"       env:"API_TOKEN"       description:"Bearer token for /api endpoints (api is disabled if empty)" secret:"true"`
+			DebugRows int    `long:"api.debug.rows"  env:"API_DEBUG_ROWS"  description:"Number of result rows kept per query for /api/query/{name}/debug" default:"10"`
+
+			Query struct {
+				AllowedTables   []string `long:"api.query.allowed-tables"    env:"API_QUERY_ALLOWED_TABLES"    env-delim:" "  description:"Tables allowed in ad-hoc queries of /api/query/preview (all tables if empty)"`
+				DeniedOperators []string `long:"api.query.denied-operators"  env:"API_QUERY_DENIED_OPERATORS"  env-delim:" "  description:"Tabular operators denied in ad-hoc queries of /api/query/preview (eg. join, union, evaluate)"`
+				DisabledFile    string   `long:"api.query.disabled-file"     env:"API_QUERY_DISABLED_FILE"     description:"Persist queries disabled via /api/query/{name}/disable in this json file (kept in memory only if empty)"`
+			}
+
+			Load struct {
+				Window time.Duration `long:"api.load.window"  env:"API_LOAD_WINDOW"  description:"Time window of the average probe latency of /api/load and azure_resourcegraph_load_probe_latency_avg_seconds" default:"5m"`
+			}
+		}
+
+		// export
+		Export struct {
+			Blob struct {
+				Url       string `long:"export.blob.url"         env:"EXPORT_BLOB_URL"         description:"Export raw result rows of each query run as json to this Azure Blob storage container url (optional with SAS token, otherwise Azure AD authentication is used)"`
+				Prefix    string `long:"export.blob.prefix"      env:"EXPORT_BLOB_PREFIX"      description:"Blob name prefix for exported query results"`
+				QueueSize int    `long:"export.blob.queue-size"  env:"EXPORT_BLOB_QUEUE_SIZE"  description:"Number of query results waiting for upload, further results are dropped" default:"100"`
+			}
+
+			Otlp struct {
+				Endpoint           string            `long:"export.otlp.endpoint"            env:"EXPORT_OTLP_ENDPOINT"                           description:"Push the metrics of the modules to this OTLP/HTTP endpoint, eg. http://otel-collector:4318 (/v1/metrics is appended to urls without path, disabled if empty)"`
+				Interval           time.Duration     `long:"export.otlp.interval"            env:"EXPORT_OTLP_INTERVAL"                           description:"Push interval of the OTLP export" default:"5m"`
+				Timeout            time.Duration     `long:"export.otlp.timeout"             env:"EXPORT_OTLP_TIMEOUT"                            description:"Timeout of an OTLP push request" default:"30s"`
+				Modules            []string          `long:"export.otlp.module"              env:"EXPORT_OTLP_MODULES"              env-delim:" "  description:"Modules pushed to the OTLP endpoint (all modules of the default profile if empty)"`
+				Headers            map[string]string `long:"export.otlp.header"              env:"EXPORT_OTLP_HEADERS"              env-delim:","  description:"HTTP header (key:value) of the OTLP push requests, eg. for authentication" secret:"true"`
+				ResourceAttributes map[string]string `long:"export.otlp.resource-attribute"  env:"EXPORT_OTLP_RESOURCE_ATTRIBUTES"  env-delim:","  description:"Additional resource attribute (key:value) of the pushed metrics"`
+			}
+
+			Bridge struct {
+				Address  string        `long:"export.bridge.address"   env:"EXPORT_BRIDGE_ADDRESS"                 description:"Flush the metrics of the modules to this StatsD or Graphite endpoint (host:port, disabled if empty)"`
+				Protocol string        `long:"export.bridge.protocol"  env:"EXPORT_BRIDGE_PROTOCOL"                description:"Protocol of the bridge endpoint" choice:"statsd" choice:"graphite" default:"statsd"`
+				Network  string        `long:"export.bridge.network"   env:"EXPORT_BRIDGE_NETWORK"                 description:"Network of the bridge endpoint (default: udp for statsd, tcp for graphite)" choice:"udp" choice:"tcp"`
+				Interval time.Duration `long:"export.bridge.interval"  env:"EXPORT_BRIDGE_INTERVAL"                description:"Flush interval of the bridge export" default:"1m"`
+				Timeout  time.Duration `long:"export.bridge.timeout"   env:"EXPORT_BRIDGE_TIMEOUT"                 description:"Timeout of a flush to the bridge endpoint" default:"10s"`
+				Prefix   string        `long:"export.bridge.prefix"    env:"EXPORT_BRIDGE_PREFIX"                  description:"Prefix of the metric paths (eg. azure.resourcegraph)"`
+				Labels   string        `long:"export.bridge.labels"    env:"EXPORT_BRIDGE_LABELS"                  description:"Labels as tags (DogStatsD, Graphite 1.1) or as path components (label values sorted by label name)" choice:"tags" choice:"path" default:"tags"`
+				Modules  []string      `long:"export.bridge.module"    env:"EXPORT_BRIDGE_MODULES"   env-delim:" "  description:"Modules flushed to the bridge endpoint (all modules of the default profile if empty)"`
+			}
+		}
+
+		// audit
+		Audit struct {
+			Log string `long:"audit.log"  env:"AUDIT_LOG"  description:"Append an audit log entry (json lines) for every ResourceGraph API call to this file (\"-\" for stdout, disabled if empty)"`
+		}
+
+		// eventgrid
+		EventGrid struct {
+			Key string `long:"eventgrid.key"  env:"EVENTGRID_KEY"  description:"Key for the Azure Event Grid webhook /webhook/eventgrid?key=<key> (webhook is disabled if empty)" secret:"true"`
+		}
+
+		// service
+		Service struct {
+			Action string `long:"service"       env:"SERVICE"       description:"Windows service management (install/uninstall registers the service with the current arguments, run is used by the service manager)" choice:"install" choice:"uninstall" choice:"run"`
+			Name   string `long:"service.name"  env:"SERVICE_NAME"  description:"Windows service name" default:"azure-resourcegraph-exporter"`
+		}
+
+		// web
+		Web struct {
+			EnableLifecycle bool   `long:"web.enable-lifecycle"  env:"WEB_ENABLE_LIFECYCLE"  description:"Enable shutdown and reload via HTTP request (/-/quit, /-/reload)"`
+			ConfigFile      string `long:"web.config.file"       env:"WEB_CONFIG_FILE"       description:"Path to web config file for TLS, basic auth and HTTP/2 (exporter-toolkit format)"`
+
+			// server timeouts and limits
+			ReadHeaderTimeout time.Duration `long:"web.read-header-timeout"  env:"WEB_READ_HEADER_TIMEOUT"  description:"Max duration for reading the request headers (0 = unlimited)" default:"10s"`
+			ReadTimeout       time.Duration `long:"web.read-timeout"         env:"WEB_READ_TIMEOUT"         description:"Max duration for reading the whole request incl. body (0 = unlimited)" default:"30s"`
+			WriteTimeout      time.Duration `long:"web.write-timeout"        env:"WEB_WRITE_TIMEOUT"        description:"Max duration from the end of the request headers until the response is written, must cover the probe duration (0 = unlimited)" default:"0"`
+			IdleTimeout       time.Duration `long:"web.idle-timeout"         env:"WEB_IDLE_TIMEOUT"         description:"Max duration an idle keep-alive connection is kept open (0 = read timeout)" default:"2m"`
+			MaxHeaderBytes    int           `long:"web.max-header-bytes"     env:"WEB_MAX_HEADER_BYTES"     description:"Max size of the request headers in bytes" default:"1048576"`
+			DisableKeepAlive  bool          `long:"web.disable-keep-alive"   env:"WEB_DISABLE_KEEP_ALIVE"   description:"Close connections after every request"`
+
+			// client allowlist
+			AllowCidr []string `long:"web.allow-cidr"  env:"WEB_ALLOW_CIDR"  env-delim:" "  description:"Client networks (CIDR or ip) allowed to access /probe, /metrics, /query, /api, /-/reload and /-/quit (all clients if empty, /webhook/eventgrid is not restricted and only protected by --eventgrid.key)"`
+		}
+
+		// runtime tuning
+		Runtime struct {
+			MaxProcs      int     `long:"runtime.gomaxprocs"        env:"RUNTIME_GOMAXPROCS"        description:"GOMAXPROCS (0 = CPU limit of the cgroup unless the GOMAXPROCS env variable is set, -1 = Go default)" default:"0"`
+			MemLimit      string  `long:"runtime.gomemlimit"        env:"RUNTIME_GOMEMLIMIT"        description:"Soft memory limit of the Go runtime, eg. 512MiB (empty = ratio of the cgroup memory limit unless the GOMEMLIMIT env variable is set, off = disabled)"`
+			MemLimitRatio float64 `long:"runtime.gomemlimit.ratio"  env:"RUNTIME_GOMEMLIMIT_RATIO"  description:"Ratio of the cgroup memory limit used as soft memory limit of the Go runtime" default:"0.9"`
+		}
+
+		// chaos testing (hidden)
+		Chaos struct {
+			Latency       time.Duration `long:"chaos.latency"         env:"CHAOS_LATENCY"                        description:"Delay every ResourceGraph request (testing only)" hidden:"true"`
+			LatencyJitter time.Duration `long:"chaos.latency-jitter"  env:"CHAOS_LATENCY_JITTER"                 description:"Additional random delay of ResourceGraph requests up to this duration (testing only)" hidden:"true"`
+			ThrottleRatio float64       `long:"chaos.throttle-ratio"  env:"CHAOS_THROTTLE_RATIO"                 description:"Ratio of ResourceGraph requests failing with 429 Too Many Requests (0-1, testing only)" hidden:"true"`
+			ErrorRatio    float64       `long:"chaos.error-ratio"     env:"CHAOS_ERROR_RATIO"                    description:"Ratio of ResourceGraph requests failing with 500 Internal Server Error (0-1, testing only)" hidden:"true"`
+			Queries       []string      `long:"chaos.queries"         env:"CHAOS_QUERIES"         env-delim:" "  description:"Queries affected by the injected faults (query name, all queries if empty, testing only)" hidden:"true"`
 		}
 
 		// general options
@@ -31,10 +267,7 @@ type (
 	}
 )
 
-func (o *Opts) GetJson() []byte {
-	jsonBytes, err := json.Marshal(o)
-	if err != nil {
-		log.Panic(err)
-	}
-	return jsonBytes
+// Redacted returns a copy of the options with all secrets redacted (see Redact)
+func (o *Opts) Redacted() Opts {
+	return Redact(*o).(Opts)
 }
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// ResourceGraph table names (eg. Resources, ResourceContainers, SecurityResources, ResourceChanges)
+	kustoTableNameRegexp = regexp.MustCompile(`^[a-z]*(resources|resourcecontainers|resourcechanges|resourcecontainerchanges)$`)
+)
+
+type (
+	// QueryPolicy restricts the tables and operators of ad-hoc queries
+	QueryPolicy struct {
+		// allowed tables (all tables if empty)
+		AllowedTables []string
+
+		// denied tabular operators (eg. join, union, evaluate)
+		DeniedOperators []string
+	}
+
+	// QueryPolicyError is a policy violation of a query
+	QueryPolicyError struct {
+		Line    int
+		Column  int
+		Message string
+	}
+)
+
+func (e *QueryPolicyError) Error() string {
+	return fmt.Sprintf("query policy violation at line %v, column %v: %v", e.Line, e.Column, e.Message)
+}
+
+// Check validates the query against the policy, template actions are masked (see scanKustoQuery) and can
+// emit any text, ad-hoc queries are checked again after rendering (see ConfigQuery.CheckPolicy)
+func (p *QueryPolicy) Check(query string) error {
+	tokens, err := scanKustoQuery(query)
+	if err != nil {
+		return err
+	}
+
+	deniedOperators := map[string]bool{}
+	for _, operator := range p.DeniedOperators {
+		deniedOperators[strings.ToLower(operator)] = true
+	}
+
+	for _, operator := range tokens.operators {
+		if deniedOperators[operator.name] {
+			return &QueryPolicyError{Line: operator.line, Column: operator.column, Message: fmt.Sprintf("operator \"%v\" is not allowed", operator.name)}
+		}
+	}
+
+	for _, identifier := range tokens.identifiers {
+		// statements starting with an operator (eg. union, externaldata)
+		if identifier.statement && deniedOperators[identifier.name] {
+			return &QueryPolicyError{Line: identifier.line, Column: identifier.column, Message: fmt.Sprintf("operator \"%v\" is not allowed", identifier.name)}
+		}
+
+		if len(p.AllowedTables) > 0 && kustoTableNameRegexp.MatchString(identifier.name) && !p.isAllowedTable(identifier.name) {
+			return &QueryPolicyError{Line: identifier.line, Column: identifier.column, Message: fmt.Sprintf("table \"%v\" is not allowed", identifier.name)}
+		}
+	}
+
+	return nil
+}
+
+// isAllowedTable checks if the table is in the allowlist (case insensitive)
+func (p *QueryPolicy) isAllowedTable(name string) bool {
+	for _, table := range p.AllowedTables {
+		if strings.EqualFold(table, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAdhocQuery parses an ad-hoc query (eg. query preview), restricted fields and subscriptions are rejected
+// and the query runs with the default identity, the policy is checked against the query template and
+// again against the rendered query (see CheckPolicy)
+func (c *Config) ParseAdhocQuery(content []byte, policy *QueryPolicy) (ConfigQuery, error) {
+	queryConfig := ConfigQuery{}
+	if err := yaml.UnmarshalStrict(content, &queryConfig); err != nil {
+		return queryConfig, fmt.Errorf("unable to parse query: %w", err)
+	}
+
+	fields := queryConfig.RestrictedFields()
+	if queryConfig.Subscriptions != nil {
+		fields = append(fields, "subscriptions")
+	}
+	if len(fields) > 0 {
+		return queryConfig, fmt.Errorf("%v not allowed in ad-hoc queries", strings.Join(fields, ", "))
+	}
+
+	queryConfig, err := c.ParseQuery(content)
+	if err != nil {
+		return queryConfig, err
+	}
+
+	// identity of the module (applied by the defaults)
+	queryConfig.Identity = ""
+
+	if err := policy.Check(queryConfig.Query); err != nil {
+		return queryConfig, err
+	}
+	queryConfig.policy = policy
+
+	return queryConfig, nil
+}
+
+// RestrictedFields returns the fields set by the query which are only allowed in trusted sources (config and
+// query files), unsafe skips the guardrails and identity selects a (privileged) identity
+func (c *ConfigQuery) RestrictedFields() (fields []string) {
+	if c.Unsafe {
+		fields = append(fields, "unsafe")
+	}
+	if c.Identity != "" {
+		fields = append(fields, "identity")
+	}
+	return
+}
+
+// ParseRestrictedFields returns the restricted fields set by the query (yaml or json, see RestrictedFields)
+func ParseRestrictedFields(content []byte) ([]string, error) {
+	queryConfig := ConfigQuery{}
+	if err := yaml.Unmarshal(content, &queryConfig); err != nil {
+		return nil, fmt.Errorf("unable to parse query: %w", err)
+	}
+	return queryConfig.RestrictedFields(), nil
+}
+
+// CheckPolicy validates the rendered query against the policy of ad-hoc queries (nil for config queries)
+func (c *ConfigQuery) CheckPolicy(query string) error {
+	if c.policy == nil {
+		return nil
+	}
+	return c.policy.Check(query)
+}
+
+// IsQueryPolicyError checks if the error is a policy violation or syntax error of the policy check
+func IsQueryPolicyError(err error) bool {
+	var policyErr *QueryPolicyError
+	var syntaxErr *KustoSyntaxError
+	return errors.As(err, &policyErr) || errors.As(err, &syntaxErr)
+}
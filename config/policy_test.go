@@ -0,0 +1,129 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestQueryPolicy() *QueryPolicy {
+	return &QueryPolicy{
+		AllowedTables:   []string{"resources"},
+		DeniedOperators: []string{"join"},
+	}
+}
+
+// renderTestQuery renders the query template like a probe execution
+func renderTestQuery(t *testing.T, queryConfig ConfigQuery) string {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tmpl, err := queryConfig.ParseQueryTemplate(now)
+	if err != nil {
+		t.Fatalf("unable to parse query template: %v", err)
+	}
+
+	query := strings.Builder{}
+	if err := tmpl.Execute(&query, NewQueryTemplateData(now, time.Minute)); err != nil {
+		t.Fatalf("unable to render query: %v", err)
+	}
+	return query.String()
+}
+
+func TestQueryPolicyCheck(t *testing.T) {
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{query: "resources | project id"},
+		{query: "Resources | where type =~ 'microsoft.compute/virtualmachines' | count"},
+		{query: "resources | join (securityresources) on id", err: `line 1, column 13: operator "join" is not allowed`},
+		{query: "resources | JOIN (resources) on id", err: `operator "join" is not allowed`},
+		{query: "securityresources | project id", err: `line 1, column 1: table "securityresources" is not allowed`},
+		{query: "resources | where name == 'securityresources'"},
+		{query: "resources | project properties.securityresources"},
+		{query: "resources |", err: "missing operator after '|'"},
+	}
+
+	for _, testCase := range testCases {
+		err := newTestQueryPolicy().Check(testCase.query)
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", testCase.query, err)
+		case testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)):
+			t.Errorf("%v: expected error %q, got %v", testCase.query, testCase.err, err)
+		case testCase.err != "" && !IsQueryPolicyError(err):
+			t.Errorf("%v: expected policy error, got %T", testCase.query, err)
+		}
+	}
+}
+
+func TestParseAdhocQueryTemplateBypass(t *testing.T) {
+	config := Config{}
+	content := []byte(`
+metric: azure_test
+query: resources {{ print "| join (securityresources) on id" }} | project id
+`)
+
+	// template actions are masked by the check of the query template
+	queryConfig, err := config.ParseAdhocQuery(content, newTestQueryPolicy())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query := renderTestQuery(t, queryConfig)
+	if query != "resources | join (securityresources) on id | project id" {
+		t.Fatalf("unexpected rendered query %q", query)
+	}
+
+	err = queryConfig.CheckPolicy(query)
+	if err == nil || !IsQueryPolicyError(err) || !strings.Contains(err.Error(), `operator "join" is not allowed`) {
+		t.Errorf("expected policy violation of the rendered query, got %v", err)
+	}
+
+	// config queries are not restricted by the policy
+	configQuery, err := config.ParseQuery(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := configQuery.CheckPolicy(query); err != nil {
+		t.Errorf("unexpected policy error of config query: %v", err)
+	}
+}
+
+func TestParseAdhocQueryRestrictedFields(t *testing.T) {
+	config := Config{}
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{content: "metric: azure_test\nquery: resources | project id\nunsafe: true", err: "unsafe not allowed in ad-hoc queries"},
+		{content: "metric: azure_test\nquery: resources | project id\nidentity: admin", err: "identity not allowed in ad-hoc queries"},
+		{content: "metric: azure_test\nquery: resources | project id\nsubscriptions: [abc]", err: "subscriptions not allowed in ad-hoc queries"},
+		{content: "metric: azure_test\nquery: resources | project id\nunsafe: true\nidentity: admin", err: "unsafe, identity not allowed in ad-hoc queries"},
+		{content: "metric: azure_test\nquery: resources | project id"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := config.ParseAdhocQuery([]byte(testCase.content), newTestQueryPolicy())
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", testCase.content, err)
+		case testCase.err != "" && (err == nil || err.Error() != testCase.err):
+			t.Errorf("%q: expected error %q, got %v", testCase.content, testCase.err, err)
+		}
+	}
+}
+
+func TestParseAdhocQueryModuleIdentity(t *testing.T) {
+	config := Config{
+		Identities: map[string]ConfigIdentity{"admin": {Modules: []string{"inventory"}}},
+	}
+
+	queryConfig, err := config.ParseAdhocQuery([]byte("module: inventory\nmetric: azure_test\nquery: resources | project id"), newTestQueryPolicy())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if queryConfig.Identity != "" {
+		t.Errorf("expected default identity, got %q", queryConfig.Identity)
+	}
+}
@@ -0,0 +1,737 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	PostProcessAggregationCount = "count"
+	PostProcessAggregationSum   = "sum"
+	PostProcessAggregationMin   = "min"
+	PostProcessAggregationMax   = "max"
+	PostProcessAggregationAvg   = "avg"
+
+	// bucket label of values above the last boundary (if no labels are configured)
+	PostProcessBucketInf = "+Inf"
+)
+
+var (
+	postProcessColumnRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+)
+
+type (
+	// ConfigQueryPostProcessStep is a step of the local post-processing of the result rows (before the metrics are built),
+	// for operations not supported (well) by the ResourceGraph query language. Every step has exactly one operation.
+	ConfigQueryPostProcessStep struct {
+		// keeps the rows matching the condition (eg. "diskSizeGB >= 128 and location =~ '^west'")
+		Where string `yaml:"where"`
+
+		// adds the named capture groups of the regex as columns
+		Extract *ConfigQueryPostProcessExtract `yaml:"extract"`
+
+		// adds the bucket of a numeric column as column
+		Bucket *ConfigQueryPostProcessBucket `yaml:"bucket"`
+
+		// keeps only these columns, "name=source" renames the column (source can be a path like properties.sku.name)
+		Project []string `yaml:"project"`
+
+		// aggregates the rows by columns
+		Summarize *ConfigQueryPostProcessSummarize `yaml:"summarize"`
+
+		parsedWhere   postProcessCondition
+		parsedProject []postProcessProjection
+	}
+
+	ConfigQueryPostProcessExtract struct {
+		Field string `yaml:"field"`
+
+		// regex with named capture groups (eg. "/resourceGroups/(?P<resourceGroup>[^/]+)/"), rows not matching get empty columns
+		Regex string `yaml:"regex"`
+
+		parsedRegexp *regexp.Regexp
+	}
+
+	ConfigQueryPostProcessBucket struct {
+		Field string `yaml:"field"`
+
+		// column of the bucket (default: <field>_bucket)
+		Target string `yaml:"target"`
+
+		// ascending upper bounds (inclusive) of the buckets
+		Boundaries []float64 `yaml:"boundaries"`
+
+		// one label per bucket plus one for values above the last boundary (default: upper bound, +Inf)
+		Labels []string `yaml:"labels"`
+	}
+
+	ConfigQueryPostProcessSummarize struct {
+		By           []string                            `yaml:"by"`
+		Aggregations []ConfigQueryPostProcessAggregation `yaml:"aggregations"`
+	}
+
+	ConfigQueryPostProcessAggregation struct {
+		// count, sum, min, max, avg
+		Function string `yaml:"function"`
+
+		// numeric column (not used by count)
+		Field string `yaml:"field"`
+
+		// result column (default: count_ or <function>_<field> like Kusto)
+		As string `yaml:"as"`
+	}
+
+	postProcessProjection struct {
+		name   string
+		source string
+	}
+
+	// postProcessCondition is a parsed where condition
+	postProcessCondition interface {
+		match(row map[string]interface{}) bool
+	}
+
+	postProcessAnd struct {
+		left, right postProcessCondition
+	}
+
+	postProcessOr struct {
+		left, right postProcessCondition
+	}
+
+	postProcessNot struct {
+		condition postProcessCondition
+	}
+
+	postProcessComparison struct {
+		column   string
+		operator string
+		value    string
+		regex    *regexp.Regexp
+
+		// unquoted number, compared numerically with numeric column values
+		number   float64
+		isNumber bool
+	}
+)
+
+func (s *ConfigQueryPostProcessStep) Validate() error {
+	operations := []string{}
+	if s.Where != "" {
+		operations = append(operations, "where")
+	}
+	if s.Extract != nil {
+		operations = append(operations, "extract")
+	}
+	if s.Bucket != nil {
+		operations = append(operations, "bucket")
+	}
+	if s.Project != nil {
+		operations = append(operations, "project")
+	}
+	if s.Summarize != nil {
+		operations = append(operations, "summarize")
+	}
+	if len(operations) != 1 {
+		return fmt.Errorf("step must have exactly one operation (where, extract, bucket, project, summarize), found %v", len(operations))
+	}
+
+	switch {
+	case s.Where != "":
+		condition, err := parsePostProcessCondition(s.Where)
+		if err != nil {
+			return fmt.Errorf("invalid where \"%v\": %w", s.Where, err)
+		}
+		s.parsedWhere = condition
+	case s.Extract != nil:
+		return s.Extract.Validate()
+	case s.Bucket != nil:
+		return s.Bucket.Validate()
+	case s.Project != nil:
+		if len(s.Project) == 0 {
+			return errors.New("project requires columns")
+		}
+		s.parsedProject = make([]postProcessProjection, 0, len(s.Project))
+		for _, column := range s.Project {
+			projection := postProcessProjection{name: column, source: column}
+			if parts := strings.SplitN(column, "=", 2); len(parts) == 2 {
+				projection = postProcessProjection{name: strings.TrimSpace(parts[0]), source: strings.TrimSpace(parts[1])}
+			}
+			if !queryParamNameRegexp.MatchString(projection.name) || !postProcessColumnRegexp.MatchString(projection.source) {
+				return fmt.Errorf("invalid project column \"%v\"", column)
+			}
+			s.parsedProject = append(s.parsedProject, projection)
+		}
+	case s.Summarize != nil:
+		return s.Summarize.Validate()
+	}
+
+	return nil
+}
+
+func (e *ConfigQueryPostProcessExtract) Validate() error {
+	if e.Field == "" {
+		return errors.New("extract field is required")
+	}
+
+	regex, err := regexp.Compile(e.Regex)
+	if err != nil {
+		return fmt.Errorf("extract: invalid regex \"%v\": %w", e.Regex, err)
+	}
+
+	groups := 0
+	for _, name := range regex.SubexpNames() {
+		if name != "" {
+			groups++
+		}
+	}
+	if groups == 0 {
+		return fmt.Errorf("extract: regex \"%v\" has no named capture groups (eg. (?P<name>...))", e.Regex)
+	}
+	e.parsedRegexp = regex
+
+	return nil
+}
+
+func (b *ConfigQueryPostProcessBucket) Validate() error {
+	if b.Field == "" {
+		return errors.New("bucket field is required")
+	}
+
+	if b.Target != "" && !queryParamNameRegexp.MatchString(b.Target) {
+		return fmt.Errorf("bucket: invalid target \"%v\"", b.Target)
+	}
+
+	if len(b.Boundaries) == 0 {
+		return errors.New("bucket: boundaries are required")
+	}
+	for i := 1; i < len(b.Boundaries); i++ {
+		if b.Boundaries[i] <= b.Boundaries[i-1] {
+			return errors.New("bucket: boundaries must be ascending")
+		}
+	}
+
+	if b.Labels != nil && len(b.Labels) != len(b.Boundaries)+1 {
+		return fmt.Errorf("bucket: %v labels expected (one per boundary plus one for larger values), found %v", len(b.Boundaries)+1, len(b.Labels))
+	}
+
+	return nil
+}
+
+// GetTarget returns the column of the bucket
+func (b *ConfigQueryPostProcessBucket) GetTarget() string {
+	if b.Target == "" {
+		return strings.ReplaceAll(b.Field, ".", "_") + "_bucket"
+	}
+	return b.Target
+}
+
+// GetBucket returns the label of the bucket of the value
+func (b *ConfigQueryPostProcessBucket) GetBucket(value float64) string {
+	for i, boundary := range b.Boundaries {
+		if value <= boundary {
+			if b.Labels != nil {
+				return b.Labels[i]
+			}
+			return strconv.FormatFloat(boundary, 'f', -1, 64)
+		}
+	}
+
+	if b.Labels != nil {
+		return b.Labels[len(b.Labels)-1]
+	}
+	return PostProcessBucketInf
+}
+
+func (s *ConfigQueryPostProcessSummarize) Validate() error {
+	for _, column := range s.By {
+		if !postProcessColumnRegexp.MatchString(column) {
+			return fmt.Errorf("summarize: invalid by column \"%v\"", column)
+		}
+	}
+
+	if len(s.Aggregations) == 0 {
+		return errors.New("summarize: aggregations are required")
+	}
+
+	names := map[string]bool{}
+	for _, aggregation := range s.Aggregations {
+		switch aggregation.GetFunction() {
+		case PostProcessAggregationCount:
+		case PostProcessAggregationSum, PostProcessAggregationMin, PostProcessAggregationMax, PostProcessAggregationAvg:
+			if aggregation.Field == "" {
+				return fmt.Errorf("summarize: %v requires field", aggregation.Function)
+			}
+		default:
+			return fmt.Errorf("summarize: unsupported function \"%v\"", aggregation.Function)
+		}
+
+		name := aggregation.GetAs()
+		if !queryParamNameRegexp.MatchString(name) {
+			return fmt.Errorf("summarize: invalid column \"%v\" (use as)", name)
+		}
+		if names[name] {
+			return fmt.Errorf("summarize: duplicate column \"%v\"", name)
+		}
+		names[name] = true
+	}
+
+	return nil
+}
+
+func (a *ConfigQueryPostProcessAggregation) GetFunction() string {
+	return strings.ToLower(a.Function)
+}
+
+// GetAs returns the result column of the aggregation
+func (a *ConfigQueryPostProcessAggregation) GetAs() string {
+	switch {
+	case a.As != "":
+		return a.As
+	case a.GetFunction() == PostProcessAggregationCount:
+		return "count_"
+	}
+	return a.GetFunction() + "_" + strings.ReplaceAll(a.Field, ".", "_")
+}
+
+// PostProcessRows applies the post-processing steps to the rows (rows are returned unchanged without steps)
+func (c *ConfigQuery) PostProcessRows(rows []map[string]interface{}) []map[string]interface{} {
+	for i := range c.PostProcess {
+		rows = c.PostProcess[i].apply(rows)
+	}
+	return rows
+}
+
+func (s *ConfigQueryPostProcessStep) apply(rows []map[string]interface{}) []map[string]interface{} {
+	if (s.Where != "" && s.parsedWhere == nil) || (s.Project != nil && s.parsedProject == nil) ||
+		(s.Extract != nil && s.Extract.parsedRegexp == nil) {
+		if err := s.Validate(); err != nil {
+			return rows
+		}
+	}
+
+	ret := make([]map[string]interface{}, 0, len(rows))
+	switch {
+	case s.Where != "":
+		for _, row := range rows {
+			if s.parsedWhere.match(row) {
+				ret = append(ret, row)
+			}
+		}
+	case s.Extract != nil:
+		regex := s.Extract.parsedRegexp
+		for _, row := range rows {
+			row = copyPostProcessRow(row)
+			match := regex.FindStringSubmatch(postProcessString(lookupPostProcessValue(row, s.Extract.Field)))
+			for i, name := range regex.SubexpNames() {
+				if name == "" {
+					continue
+				}
+				row[name] = ""
+				if match != nil {
+					row[name] = match[i]
+				}
+			}
+			ret = append(ret, row)
+		}
+	case s.Bucket != nil:
+		target := s.Bucket.GetTarget()
+		for _, row := range rows {
+			row = copyPostProcessRow(row)
+			row[target] = ""
+			if value, ok := postProcessNumber(lookupPostProcessValue(row, s.Bucket.Field)); ok {
+				row[target] = s.Bucket.GetBucket(value)
+			}
+			ret = append(ret, row)
+		}
+	case s.Project != nil:
+		for _, row := range rows {
+			projected := map[string]interface{}{}
+			for _, projection := range s.parsedProject {
+				projected[projection.name] = lookupPostProcessValue(row, projection.source)
+			}
+			ret = append(ret, projected)
+		}
+	case s.Summarize != nil:
+		ret = s.Summarize.apply(rows)
+	}
+	return ret
+}
+
+// apply groups the rows by the by columns (in order of their first row), non-numeric values are ignored by sum, min, max and avg
+func (s *ConfigQueryPostProcessSummarize) apply(rows []map[string]interface{}) []map[string]interface{} {
+	type group struct {
+		row    map[string]interface{}
+		values [][]float64
+		count  int
+	}
+
+	groups := []*group{}
+	index := map[string]*group{}
+	for _, row := range rows {
+		keys := make([]string, len(s.By))
+		for i, column := range s.By {
+			keys[i] = postProcessString(lookupPostProcessValue(row, column))
+		}
+		key := strings.Join(keys, "\xff")
+
+		g, exists := index[key]
+		if !exists {
+			g = &group{row: map[string]interface{}{}, values: make([][]float64, len(s.Aggregations))}
+			for _, column := range s.By {
+				g.row[strings.ReplaceAll(column, ".", "_")] = lookupPostProcessValue(row, column)
+			}
+			index[key] = g
+			groups = append(groups, g)
+		}
+
+		g.count++
+		for i, aggregation := range s.Aggregations {
+			if aggregation.GetFunction() == PostProcessAggregationCount {
+				continue
+			}
+			if value, ok := postProcessNumber(lookupPostProcessValue(row, aggregation.Field)); ok {
+				g.values[i] = append(g.values[i], value)
+			}
+		}
+	}
+
+	ret := make([]map[string]interface{}, 0, len(groups))
+	for _, g := range groups {
+		for i, aggregation := range s.Aggregations {
+			name := aggregation.GetAs()
+			values := g.values[i]
+			switch aggregation.GetFunction() {
+			case PostProcessAggregationCount:
+				g.row[name] = float64(g.count)
+				continue
+			}
+
+			if len(values) == 0 {
+				g.row[name] = nil
+				continue
+			}
+
+			result := values[0]
+			switch aggregation.GetFunction() {
+			case PostProcessAggregationSum, PostProcessAggregationAvg:
+				result = 0
+				for _, value := range values {
+					result += value
+				}
+				if aggregation.GetFunction() == PostProcessAggregationAvg {
+					result /= float64(len(values))
+				}
+			case PostProcessAggregationMin:
+				for _, value := range values {
+					result = math.Min(result, value)
+				}
+			case PostProcessAggregationMax:
+				for _, value := range values {
+					result = math.Max(result, value)
+				}
+			}
+			g.row[name] = result
+		}
+		ret = append(ret, g.row)
+	}
+	return ret
+}
+
+func copyPostProcessRow(row map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(row)+1)
+	for name, value := range row {
+		ret[name] = value
+	}
+	return ret
+}
+
+// lookupPostProcessValue returns the value of the column, paths (eg. properties.sku.name) are resolved in nested objects
+func lookupPostProcessValue(row map[string]interface{}, column string) interface{} {
+	if value, exists := row[column]; exists {
+		return value
+	}
+
+	var value interface{} = row
+	for _, name := range strings.Split(column, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+func postProcessString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func postProcessNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		if ret, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return ret, true
+		}
+	}
+	return 0, false
+}
+
+func (c *postProcessAnd) match(row map[string]interface{}) bool {
+	return c.left.match(row) && c.right.match(row)
+}
+
+func (c *postProcessOr) match(row map[string]interface{}) bool {
+	return c.left.match(row) || c.right.match(row)
+}
+
+func (c *postProcessNot) match(row map[string]interface{}) bool {
+	return !c.condition.match(row)
+}
+
+// match compares numerically if the value is an unquoted number and the column value is numeric,
+// otherwise as strings (missing columns are empty strings)
+func (c *postProcessComparison) match(row map[string]interface{}) bool {
+	value := lookupPostProcessValue(row, c.column)
+
+	switch c.operator {
+	case "=~":
+		return c.regex.MatchString(postProcessString(value))
+	case "!~":
+		return !c.regex.MatchString(postProcessString(value))
+	}
+
+	compare := strings.Compare(postProcessString(value), c.value)
+	if number, ok := postProcessNumber(value); ok && c.isNumber {
+		switch {
+		case number < c.number:
+			compare = -1
+		case number > c.number:
+			compare = 1
+		default:
+			compare = 0
+		}
+	}
+
+	switch c.operator {
+	case "==":
+		return compare == 0
+	case "!=":
+		return compare != 0
+	case "<":
+		return compare < 0
+	case "<=":
+		return compare <= 0
+	case ">":
+		return compare > 0
+	case ">=":
+		return compare >= 0
+	}
+	return false
+}
+
+// parsePostProcessCondition parses a where condition: comparisons "<column> <operator> <value>"
+// (operators == != < <= > >= =~ !~, values are numbers or quoted strings) combined with and, or, not and parentheses
+func parsePostProcessCondition(condition string) (postProcessCondition, error) {
+	p := &postProcessConditionParser{input: condition}
+	ret, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected \"%v\" at position %v", string(p.input[p.pos]), p.pos+1)
+	}
+	return ret, nil
+}
+
+type (
+	postProcessConditionParser struct {
+		input string
+		pos   int
+	}
+)
+
+func (p *postProcessConditionParser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes the keyword (case insensitive, followed by a non-word character)
+func (p *postProcessConditionParser) keyword(keyword string) bool {
+	p.skipSpace()
+	end := p.pos + len(keyword)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], keyword) {
+		return false
+	}
+	if end < len(p.input) && isPostProcessColumnChar(p.input[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *postProcessConditionParser) parseOr() (postProcessCondition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &postProcessOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *postProcessConditionParser) parseAnd() (postProcessCondition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &postProcessAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *postProcessConditionParser) parseNot() (postProcessCondition, error) {
+	if p.keyword("not") {
+		condition, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &postProcessNot{condition: condition}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *postProcessConditionParser) parseOperand() (postProcessCondition, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, errors.New("unexpected end of condition")
+	}
+
+	start := p.pos
+	if p.input[p.pos] == '(' {
+		p.pos++
+		condition, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing \")\" for \"(\" at position %v", start+1)
+		}
+		p.pos++
+		return condition, nil
+	}
+
+	for p.pos < len(p.input) && isPostProcessColumnChar(p.input[p.pos]) {
+		p.pos++
+	}
+	column := p.input[start:p.pos]
+	if !postProcessColumnRegexp.MatchString(column) {
+		return nil, fmt.Errorf("expected column at position %v", start+1)
+	}
+
+	p.skipSpace()
+	operator := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">"} {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			operator = candidate
+			break
+		}
+	}
+	if operator == "" {
+		return nil, fmt.Errorf("expected operator (== != < <= > >= =~ !~) at position %v", p.pos+1)
+	}
+	p.pos += len(operator)
+
+	value, isNumber, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &postProcessComparison{column: column, operator: operator, value: value, isNumber: isNumber}
+	if isNumber {
+		comparison.number, _ = strconv.ParseFloat(value, 64)
+	}
+	if operator == "=~" || operator == "!~" {
+		if comparison.regex, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid regex \"%v\": %w", value, err)
+		}
+	}
+	return comparison, nil
+}
+
+// parseValue parses a quoted string (single or double quotes, backslash escapes the quote) or a number
+func (p *postProcessConditionParser) parseValue() (value string, isNumber bool, err error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return "", false, errors.New("unexpected end of condition, expected value")
+	}
+
+	start := p.pos
+	if quote := p.input[p.pos]; quote == '\'' || quote == '"' {
+		str := strings.Builder{}
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			switch char := p.input[p.pos]; {
+			case char == '\\' && p.pos+1 < len(p.input) && p.input[p.pos+1] == quote:
+				p.pos++
+				str.WriteByte(quote)
+			case char == quote:
+				p.pos++
+				return str.String(), false, nil
+			default:
+				str.WriteByte(char)
+			}
+		}
+		return "", false, fmt.Errorf("unterminated string at position %v", start+1)
+	}
+
+	for p.pos < len(p.input) && strings.ContainsRune("0123456789.-+eE", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if _, err := strconv.ParseFloat(p.input[start:p.pos], 64); err != nil {
+		return "", false, fmt.Errorf("expected quoted string or number at position %v", start+1)
+	}
+	return p.input[start:p.pos], true, nil
+}
+
+func isPostProcessColumnChar(char byte) bool {
+	return char == '_' || char == '.' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// parseTestPostProcessSteps parses and validates the post-processing steps (yaml list)
+func parseTestPostProcessSteps(content string) ([]ConfigQueryPostProcessStep, error) {
+	steps := []ConfigQueryPostProcessStep{}
+	if err := yaml.UnmarshalStrict([]byte(content), &steps); err != nil {
+		return nil, err
+	}
+	for i := range steps {
+		if err := steps[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+func newTestPostProcessRows() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"id": "/subscriptions/s1/resourceGroups/rg-a/providers/x/disk1", "location": "westeurope", "properties": map[string]interface{}{"diskSizeGB": float64(32), "sku": map[string]interface{}{"name": "Premium_LRS"}}},
+		{"id": "/subscriptions/s1/resourceGroups/rg-a/providers/x/disk2", "location": "northeurope", "properties": map[string]interface{}{"diskSizeGB": float64(128), "sku": map[string]interface{}{"name": "Standard_LRS"}}},
+		{"id": "/subscriptions/s1/resourceGroups/rg-b/providers/x/disk3", "location": "eastus", "properties": map[string]interface{}{"diskSizeGB": "1024", "sku": map[string]interface{}{"name": "Premium_LRS"}}},
+		{"id": "/subscriptions/s1/providers/x/disk4", "location": "westeurope", "properties": map[string]interface{}{"diskSizeGB": "n/a"}},
+	}
+}
+
+func TestPostProcessValidate(t *testing.T) {
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{content: `[{where: "location == 'westeurope'"}]`},
+		{content: `[{extract: {field: id, regex: "/resourceGroups/(?P<resourceGroup>[^/]+)/"}}]`},
+		{content: `[{bucket: {field: properties.diskSizeGB, boundaries: [64, 512]}}]`},
+		{content: `[{project: [location, "sku=properties.sku.name"]}]`},
+		{content: `[{summarize: {by: [location], aggregations: [{function: count}, {function: SUM, field: size}]}}]`},
+
+		{content: `[{}]`, err: "step must have exactly one operation (where, extract, bucket, project, summarize), found 0"},
+		{content: `[{where: "a == 1", project: [a]}]`, err: "step must have exactly one operation (where, extract, bucket, project, summarize), found 2"},
+
+		{content: `[{where: "location"}]`, err: `invalid where "location": expected operator (== != < <= > >= =~ !~) at position 9`},
+		{content: `[{where: "location == westeurope"}]`, err: `invalid where "location == westeurope": expected quoted string or number at position 13`},
+		{content: `[{where: "location == 'westeurope"}]`, err: `invalid where "location == 'westeurope": unterminated string at position 13`},
+		{content: `[{where: "(a == 1"}]`, err: `invalid where "(a == 1": missing ")" for "(" at position 1`},
+		{content: `[{where: "a == 1 b == 2"}]`, err: `invalid where "a == 1 b == 2": unexpected "b" at position 8`},
+		{content: `[{where: "a == 1 and"}]`, err: `invalid where "a == 1 and": unexpected end of condition`},
+		{content: `[{where: "a =~ '('"}]`, err: "invalid where \"a =~ '('\": invalid regex \"(\": error parsing regexp: missing closing ): `(`"},
+		{content: `[{where: "== 1"}]`, err: `invalid where "== 1": expected column at position 1`},
+
+		{content: `[{extract: {regex: "(?P<a>.*)"}}]`, err: "extract field is required"},
+		{content: `[{extract: {field: id, regex: "(.*)"}}]`, err: `extract: regex "(.*)" has no named capture groups (eg. (?P<name>...))`},
+		{content: `[{extract: {field: id, regex: "(?P<a>"}}]`, err: "extract: invalid regex \"(?P<a>\": error parsing regexp: missing closing ): `(?P<a>`"},
+
+		{content: `[{bucket: {boundaries: [1]}}]`, err: "bucket field is required"},
+		{content: `[{bucket: {field: size, target: "a-b", boundaries: [1]}}]`, err: `bucket: invalid target "a-b"`},
+		{content: `[{bucket: {field: size}}]`, err: "bucket: boundaries are required"},
+		{content: `[{bucket: {field: size, boundaries: [2, 1]}}]`, err: "bucket: boundaries must be ascending"},
+		{content: `[{bucket: {field: size, boundaries: [1, 2], labels: [a, b]}}]`, err: "bucket: 3 labels expected (one per boundary plus one for larger values), found 2"},
+
+		{content: `[{project: []}]`, err: "project requires columns"},
+		{content: `[{project: ["a.b"]}]`, err: `invalid project column "a.b"`},
+		{content: `[{project: ["a=b-c"]}]`, err: `invalid project column "a=b-c"`},
+
+		{content: `[{summarize: {by: [location]}}]`, err: "summarize: aggregations are required"},
+		{content: `[{summarize: {by: ["a-b"], aggregations: [{function: count}]}}]`, err: `summarize: invalid by column "a-b"`},
+		{content: `[{summarize: {aggregations: [{function: median, field: a}]}}]`, err: `summarize: unsupported function "median"`},
+		{content: `[{summarize: {aggregations: [{function: sum}]}}]`, err: "summarize: sum requires field"},
+		{content: `[{summarize: {aggregations: [{function: count}, {function: count}]}}]`, err: `summarize: duplicate column "count_"`},
+		{content: `[{summarize: {aggregations: [{function: count, as: "a-b"}]}}]`, err: `summarize: invalid column "a-b" (use as)`},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseTestPostProcessSteps(testCase.content)
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", testCase.content, err)
+		case testCase.err != "" && (err == nil || err.Error() != testCase.err):
+			t.Errorf("%v: expected error %q, got %v", testCase.content, testCase.err, err)
+		}
+	}
+}
+
+func TestPostProcessWhere(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"name": "a", "size": float64(10), "location": "westeurope", "tier": "premium"},
+		{"name": "b", "size": float64(100), "location": "northeurope", "tier": "standard"},
+		{"name": "c", "size": "9", "location": "eastus", "tier": "premium"},
+		{"name": "d", "location": "westus", "tier": "it's"},
+	}
+
+	testCases := []struct {
+		where    string
+		expected []string
+	}{
+		{where: "size > 9", expected: []string{"a", "b"}},
+		{where: "size >= 9", expected: []string{"a", "b", "c"}},
+		// missing and non-numeric values are compared as strings ("" < "10")
+		{where: "size < 10", expected: []string{"c", "d"}},
+		{where: "size <= 10", expected: []string{"a", "c", "d"}},
+		{where: "size == 100", expected: []string{"b"}},
+		{where: "size != 100", expected: []string{"a", "c", "d"}},
+		// quoted values are compared as strings
+		{where: "size > '9'", expected: []string{}},
+		{where: "location == 'westeurope'", expected: []string{"a"}},
+		{where: `location != "westeurope"`, expected: []string{"b", "c", "d"}},
+		{where: "location =~ 'europe$'", expected: []string{"a", "b"}},
+		{where: "location !~ '^west'", expected: []string{"b", "c"}},
+		{where: "missing == ''", expected: []string{"a", "b", "c", "d"}},
+		{where: `tier == 'it\'s'`, expected: []string{"d"}},
+		// and before or, not before and
+		{where: "tier == 'premium' or size > 50 and location =~ 'europe'", expected: []string{"a", "b", "c"}},
+		{where: "(tier == 'premium' or size > 50) and location =~ 'europe'", expected: []string{"a", "b"}},
+		{where: "not tier == 'premium' and location =~ 'europe'", expected: []string{"b"}},
+		{where: "NOT (tier == 'premium' OR location == 'westus')", expected: []string{"b"}},
+		{where: "notes == '' and order == ''", expected: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, testCase := range testCases {
+		step := ConfigQueryPostProcessStep{Where: testCase.where}
+		if err := step.Validate(); err != nil {
+			t.Fatalf("%v: unexpected error: %v", testCase.where, err)
+		}
+
+		names := []string{}
+		for _, row := range step.apply(rows) {
+			names = append(names, row["name"].(string))
+		}
+		if !equalTestStrings(names, testCase.expected) {
+			t.Errorf("%v: expected %v, got %v", testCase.where, testCase.expected, names)
+		}
+	}
+}
+
+func TestPostProcessRows(t *testing.T) {
+	testCases := []struct {
+		name     string
+		steps    string
+		expected string
+	}{
+		{
+			name:     "no steps",
+			steps:    `[]`,
+			expected: `[{"id":"/subscriptions/s1/resourceGroups/rg-a/providers/x/disk1","location":"westeurope","properties":{"diskSizeGB":32,"sku":{"name":"Premium_LRS"}}},{"id":"/subscriptions/s1/resourceGroups/rg-a/providers/x/disk2","location":"northeurope","properties":{"diskSizeGB":128,"sku":{"name":"Standard_LRS"}}},{"id":"/subscriptions/s1/resourceGroups/rg-b/providers/x/disk3","location":"eastus","properties":{"diskSizeGB":"1024","sku":{"name":"Premium_LRS"}}},{"id":"/subscriptions/s1/providers/x/disk4","location":"westeurope","properties":{"diskSizeGB":"n/a"}}]`,
+		},
+		{
+			name: "extract and project",
+			steps: `
+- extract: {field: id, regex: "/resourceGroups/(?P<resourceGroup>[^/]+)/"}
+- project: [resourceGroup, "sku=properties.sku.name"]`,
+			expected: `[{"resourceGroup":"rg-a","sku":"Premium_LRS"},{"resourceGroup":"rg-a","sku":"Standard_LRS"},{"resourceGroup":"rg-b","sku":"Premium_LRS"},{"resourceGroup":"","sku":null}]`,
+		},
+		{
+			name: "bucket with default labels",
+			steps: `
+- bucket: {field: properties.diskSizeGB, boundaries: [32, 512]}
+- project: [properties_diskSizeGB_bucket]`,
+			expected: `[{"properties_diskSizeGB_bucket":"32"},{"properties_diskSizeGB_bucket":"512"},{"properties_diskSizeGB_bucket":"+Inf"},{"properties_diskSizeGB_bucket":""}]`,
+		},
+		{
+			name: "bucket with labels",
+			steps: `
+- bucket: {field: properties.diskSizeGB, target: size, boundaries: [64, 512], labels: [small, medium, large]}
+- project: [size]`,
+			expected: `[{"size":"small"},{"size":"medium"},{"size":"large"},{"size":""}]`,
+		},
+		{
+			name: "where and summarize",
+			steps: `
+- where: "properties.sku.name =~ '_LRS$'"
+- summarize:
+    by: [properties.sku.name]
+    aggregations:
+      - function: count
+      - function: sum
+        field: properties.diskSizeGB
+      - function: min
+        field: properties.diskSizeGB
+      - function: max
+        field: properties.diskSizeGB
+      - function: avg
+        field: properties.diskSizeGB
+        as: avgSize`,
+			expected: `[{"avgSize":528,"count_":2,"max_properties_diskSizeGB":1024,"min_properties_diskSizeGB":32,"properties_sku_name":"Premium_LRS","sum_properties_diskSizeGB":1056},{"avgSize":128,"count_":1,"max_properties_diskSizeGB":128,"min_properties_diskSizeGB":128,"properties_sku_name":"Standard_LRS","sum_properties_diskSizeGB":128}]`,
+		},
+		{
+			name: "summarize without numeric values",
+			steps: `
+- where: "location == 'westeurope'"
+- extract: {field: id, regex: "/resourceGroups/(?P<resourceGroup>[^/]+)/"}
+- summarize: {by: [resourceGroup], aggregations: [{function: sum, field: properties.diskSizeGB}]}`,
+			expected: `[{"resourceGroup":"rg-a","sum_properties_diskSizeGB":32},{"resourceGroup":"","sum_properties_diskSizeGB":null}]`,
+		},
+		{
+			name:     "summarize without by",
+			steps:    `[{summarize: {aggregations: [{function: count}]}}]`,
+			expected: `[{"count_":4}]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		steps, err := parseTestPostProcessSteps(testCase.steps)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", testCase.name, err)
+		}
+
+		rows := newTestPostProcessRows()
+		queryConfig := ConfigQuery{PostProcess: steps}
+		actual, _ := json.Marshal(queryConfig.PostProcessRows(rows))
+		if string(actual) != testCase.expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v", testCase.name, testCase.expected, string(actual))
+		}
+
+		// the input rows are not modified
+		if original, _ := json.Marshal(newTestPostProcessRows()); string(original) != mustMarshalTestJson(rows) {
+			t.Errorf("%v: input rows were modified", testCase.name)
+		}
+	}
+}
+
+func mustMarshalTestJson(value interface{}) string {
+	content, _ := json.Marshal(value)
+	return string(content)
+}
+
+func equalTestStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	ConfigProfile struct {
+		// subscriptions used for queries without own subscription list
+		Subscriptions []string `yaml:"subscriptions"`
+
+		// default cache duration if not set by probe param
+		Cache *string `yaml:"cache"`
+
+		// enabled modules (all modules if empty)
+		Modules []string `yaml:"modules"`
+	}
+)
+
+func (p *ConfigProfile) Validate() error {
+	if p.Cache != nil {
+		if _, err := time.ParseDuration(*p.Cache); err != nil {
+			return fmt.Errorf("invalid cache duration \"%v\": %w", *p.Cache, err)
+		}
+	}
+
+	return nil
+}
+
+// GetCacheDuration returns the default cache duration of the profile
+func (p *ConfigProfile) GetCacheDuration() time.Duration {
+	if p.Cache != nil {
+		if val, err := time.ParseDuration(*p.Cache); err == nil {
+			return val
+		}
+	}
+	return 0
+}
+
+// IsModuleEnabled checks if the module is enabled in the profile
+func (p *ConfigProfile) IsModuleEnabled(module string) bool {
+	if len(p.Modules) == 0 {
+		return true
+	}
+
+	for _, enabledModule := range p.Modules {
+		if enabledModule == module {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProfile returns the profile by name, an empty name returns an empty profile (no restrictions)
+func (c *Config) GetProfile(name string) (*ConfigProfile, error) {
+	if name == "" {
+		return &ConfigProfile{}, nil
+	}
+
+	if profile, ok := c.Profiles[name]; ok {
+		return &profile, nil
+	}
+
+	return nil, fmt.Errorf("profile \"%v\" not found", name)
+}
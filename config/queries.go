@@ -0,0 +1,573 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	QueryParamTypeString = "string"
+	QueryParamTypeInt    = "int"
+	QueryParamTypeFloat  = "float"
+	QueryParamTypeBool   = "bool"
+	QueryParamTypeList   = "list"
+
+	DedupStrategyNone  = "" // use default strategy
+	DedupStrategyFirst = "first"
+	DedupStrategyLast  = "last"
+	DedupStrategySum   = "sum"
+	DedupStrategyMax   = "max"
+
+	SortByValue = "value"
+
+	QueryTypeGauge    = "gauge"
+	QueryTypeInfo     = "info"
+	QueryTypeStateSet = "stateset"
+
+	InfoMetricSuffix = "_info"
+
+	PublishIfEmptySuppress  = "suppress"
+	PublishIfEmptyZero      = "zero"
+	PublishIfEmptyIndicator = "indicator"
+
+	ResultFormatObjectArray = "objectArray"
+	ResultFormatTable       = "table"
+)
+
+var (
+	queryParamNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// ResourceGraph API versions (date with optional preview suffix)
+	resourceGraphApiVersionRegexp = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}(-preview)?$`)
+)
+
+type (
+	Config struct {
+		ApiVersion     string                    `yaml:"apiVersion"`
+		Defaults       ConfigDefaults            `yaml:"defaults"`
+		Clouds         []ConfigCloud             `yaml:"clouds"`
+		Identities     map[string]ConfigIdentity `yaml:"identities"`
+		Profiles       map[string]ConfigProfile  `yaml:"profiles"`
+		RelabelConfigs []RelabelConfig           `yaml:"relabelConfigs"`
+		Guardrails     *ConfigGuardrails         `yaml:"guardrails"`
+		Queries        []ConfigQuery             `yaml:"queries"`
+		DerivedMetrics []ConfigDerivedMetric     `yaml:"derivedMetrics"`
+
+		// sources of the queries (config file, query files, ConfigMaps, builtin)
+		sources []ConfigSource
+	}
+
+	ConfigQuery struct {
+		kusto.ConfigQuery `yaml:",inline"`
+		Name              string                `yaml:"name"`
+		DependsOn         []string              `yaml:"dependsOn"`
+		Params            []ConfigQueryParam    `yaml:"params"`
+		Dedup             string                `yaml:"dedup"`
+		TopN              int                   `yaml:"topN"`
+		SortBy            string                `yaml:"sortBy"`
+		TopNOther         *bool                 `yaml:"topNOther"`
+		RelabelConfigs    []RelabelConfig       `yaml:"relabelConfigs"`
+		PerSubscription   bool                  `yaml:"perSubscription"`
+		Cache             *string               `yaml:"cache"`
+		PublishIfEmpty    string                `yaml:"publishIfEmpty"`
+		ResourceTypes     []string              `yaml:"resourceTypes"`
+		Unsafe            bool                  `yaml:"unsafe"`
+		Timestamp         *ConfigQueryTimestamp `yaml:"timestamp"`
+		Type              string                `yaml:"type"`
+		StateSet          *ConfigQueryStateSet  `yaml:"stateset"`
+		NormalizeLabels   *bool                 `yaml:"normalizeLabels"`
+		Compare           *ConfigQueryCompare   `yaml:"compare"`
+		Identity          string                `yaml:"identity"`
+		Canary            bool                  `yaml:"canary"`
+		Critical          bool                  `yaml:"critical"`
+		Priority          int                   `yaml:"priority"`
+		Facets            []ConfigQueryFacet    `yaml:"facets"`
+		ResultFormat      string                `yaml:"resultFormat"`
+		SplitKey          string                `yaml:"splitKey"`
+
+		// local post-processing of the result rows (before the metrics are built)
+		PostProcess []ConfigQueryPostProcessStep `yaml:"postProcess"`
+
+		// ResourceGraph API version (empty = version of the exporter)
+		ResourceGraphApiVersion string `yaml:"resourceGraphApiVersion"`
+
+		// guardrail rules which rewrote the query
+		guardrailRewrites []string
+
+		// policy of ad-hoc queries (see ParseAdhocQuery)
+		policy *QueryPolicy
+	}
+
+	ConfigQueryParam struct {
+		Name    string  `yaml:"name"`
+		Type    string  `yaml:"type"`
+		Default *string `yaml:"default"`
+	}
+)
+
+// LoadConfig reads and parses the config file and the query files.
+// Precedence of query settings: query > flags (--config.defaults.*) > defaults of the config file
+func LoadConfig(opts Opts) (config Config, err error) {
+	if opts.Config.Path != "" {
+		/*  #nosec G304 */
+		content, err := ioutil.ReadFile(opts.Config.Path)
+		if err != nil {
+			return config, fmt.Errorf("unable to read config \"%v\": %w", opts.Config.Path, err)
+		}
+
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return config, fmt.Errorf("unable to parse config \"%v\": %w", opts.Config.Path, err)
+		}
+	}
+
+	config.applyDefaultFlags(opts)
+	config.applyDefaults()
+
+	if opts.Config.Path != "" {
+		config.addSource(ConfigSourceFile+" "+opts.Config.Path, len(config.Queries))
+	}
+
+	if err := config.loadQueryFiles(opts.Config.Queries); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// Validate validates all queries and returns every problem found
+func (c *Config) Validate() (errs []error) {
+	if err := c.validateApiVersion(); err != nil {
+		return []error{err}
+	}
+
+	if len(c.Queries) == 0 {
+		return []error{errors.New("no queries found")}
+	}
+
+	if err := c.Defaults.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("defaults: %w", err))
+	}
+
+	errs = append(errs, c.validateClouds()...)
+	errs = append(errs, c.validateIdentities()...)
+
+	for name, profile := range c.Profiles {
+		if err := profile.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile \"%v\": %w", name, err))
+		}
+	}
+
+	for i := range c.RelabelConfigs {
+		if err := c.RelabelConfigs[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("relabelConfigs[%v]: %w", i, err))
+		}
+	}
+
+	if c.Guardrails != nil {
+		if err := c.Guardrails.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := range c.Queries {
+		// validate a copy, kusto validation modifies the default field name
+		queryConfig := c.Queries[i]
+		if err := queryConfig.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("query \"%v\": %w", queryConfig.Metric, err))
+		} else if err := c.validateGuardrails(&c.Queries[i]); err != nil {
+			errs = append(errs, fmt.Errorf("query \"%v\": %w", queryConfig.Metric, err))
+		}
+	}
+
+	errs = append(errs, c.validateDependencies()...)
+
+	for i := range c.DerivedMetrics {
+		if err := c.DerivedMetrics[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("derived metric \"%v\": %w", c.DerivedMetrics[i].Metric, err))
+		}
+	}
+
+	return
+}
+
+// MatchesResourceType checks if the query covers the resource type (for event based cache invalidation),
+// without configured resourceTypes the query text is searched for the resource type
+func (q *ConfigQuery) MatchesResourceType(resourceType string) bool {
+	resourceType = strings.ToLower(resourceType)
+
+	if len(q.ResourceTypes) == 0 {
+		return strings.Contains(strings.ToLower(q.Query), resourceType)
+	}
+
+	for _, val := range q.ResourceTypes {
+		if val == "*" || strings.EqualFold(val, resourceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetModules returns the sorted list of module names used by the queries ("" for queries without module)
+func (c *Config) GetModules() []string {
+	modules := []string{}
+	seen := map[string]bool{}
+	for _, queryConfig := range c.Queries {
+		if !seen[queryConfig.Module] {
+			seen[queryConfig.Module] = true
+			modules = append(modules, queryConfig.Module)
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// GetModuleQueriesByPriority returns the queries of the module, highest priority first (config order for equal priority)
+func (c *Config) GetModuleQueriesByPriority(module string) []*ConfigQuery {
+	queries := []*ConfigQuery{}
+	for i := range c.Queries {
+		if c.Queries[i].Module == module {
+			queries = append(queries, &c.Queries[i])
+		}
+	}
+
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].Priority > queries[j].Priority
+	})
+	return queries
+}
+
+// validateApiVersion checks if the config api version is supported (empty defaults to latest version)
+func (c *Config) validateApiVersion() error {
+	if c.ApiVersion == "" {
+		c.ApiVersion = ConfigApiVersionLatest
+	}
+
+	for _, apiVersion := range SupportedApiVersions {
+		if c.ApiVersion == apiVersion {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported apiVersion \"%v\", supported: %v", c.ApiVersion, strings.Join(SupportedApiVersions, ", "))
+}
+
+func (c *ConfigQuery) Validate() error {
+	if err := c.ConfigQuery.Validate(); err != nil {
+		return err
+	}
+
+	paramNames := map[string]bool{}
+	for _, param := range c.Params {
+		if err := param.Validate(); err != nil {
+			return err
+		}
+
+		if paramNames[param.Name] {
+			return fmt.Errorf("param \"%v\": duplicate param name", param.Name)
+		}
+		paramNames[param.Name] = true
+	}
+
+	switch c.GetDedupStrategy() {
+	case DedupStrategyNone:
+	case DedupStrategyFirst:
+	case DedupStrategyLast:
+	case DedupStrategySum:
+	case DedupStrategyMax:
+	default:
+		return fmt.Errorf("unsupported dedup strategy \"%v\"", c.Dedup)
+	}
+
+	for i := range c.RelabelConfigs {
+		if err := c.RelabelConfigs[i].Validate(); err != nil {
+			return fmt.Errorf("relabelConfigs[%v]: %w", i, err)
+		}
+	}
+
+	if c.Cache != nil {
+		if _, err := time.ParseDuration(*c.Cache); err != nil {
+			return fmt.Errorf("invalid cache duration \"%v\": %w", *c.Cache, err)
+		}
+	}
+
+	if c.Timestamp != nil {
+		if err := c.Timestamp.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch c.GetType() {
+	case QueryTypeGauge:
+	case QueryTypeInfo:
+		if err := c.validateInfo(); err != nil {
+			return err
+		}
+	case QueryTypeStateSet:
+		if err := c.validateStateSet(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported query type \"%v\"", c.Type)
+	}
+
+	if c.StateSet != nil && !c.IsStateSet() {
+		return errors.New("stateset requires type stateset")
+	}
+
+	if c.Compare != nil {
+		if err := c.validateCompare(); err != nil {
+			return err
+		}
+	}
+
+	if c.SplitKey != "" && !queryParamNameRegexp.MatchString(c.SplitKey) {
+		return fmt.Errorf("invalid splitKey \"%v\"", c.SplitKey)
+	}
+
+	if c.ResourceGraphApiVersion != "" && !resourceGraphApiVersionRegexp.MatchString(c.ResourceGraphApiVersion) {
+		return fmt.Errorf("invalid resourceGraphApiVersion \"%v\" (expected eg. 2021-03-01 or 2020-04-01-preview)", c.ResourceGraphApiVersion)
+	}
+
+	for i := range c.PostProcess {
+		if err := c.PostProcess[i].Validate(); err != nil {
+			return fmt.Errorf("postProcess[%v]: %w", i, err)
+		}
+	}
+
+	switch c.GetResultFormat() {
+	case ResultFormatObjectArray:
+	case ResultFormatTable:
+	default:
+		return fmt.Errorf("unsupported resultFormat \"%v\"", c.ResultFormat)
+	}
+
+	if len(c.Facets) > 0 {
+		if err := c.validateFacets(); err != nil {
+			return err
+		}
+	}
+
+	switch c.GetPublishIfEmpty() {
+	case PublishIfEmptySuppress:
+	case PublishIfEmptyZero:
+	case PublishIfEmptyIndicator:
+	default:
+		return fmt.Errorf("unsupported publishIfEmpty \"%v\"", c.PublishIfEmpty)
+	}
+
+	if c.TopN < 0 {
+		return errors.New("topN must not be negative")
+	}
+
+	if _, err := c.ParseQueryTemplate(time.Now()); err != nil {
+		return fmt.Errorf("unable to parse query template: %w", err)
+	}
+
+	if err := ValidateKustoSyntax(c.Query); err != nil {
+		return fmt.Errorf("invalid query: %w", err)
+	}
+
+	return nil
+}
+
+func (c *ConfigQuery) GetDedupStrategy() string {
+	return strings.ToLower(c.Dedup)
+}
+
+func (c *ConfigQuery) GetSortBy() string {
+	if c.SortBy == "" {
+		return SortByValue
+	}
+	return c.SortBy
+}
+
+// GetType returns the metric type of the query (default: gauge)
+func (c *ConfigQuery) GetType() string {
+	if c.Type == "" {
+		return QueryTypeGauge
+	}
+	return strings.ToLower(c.Type)
+}
+
+// GetResultFormat returns the result format requested from the ResourceGraph API (objectArray or table)
+func (c *ConfigQuery) GetResultFormat() string {
+	switch strings.ToLower(c.ResultFormat) {
+	case "", strings.ToLower(ResultFormatObjectArray):
+		return ResultFormatObjectArray
+	case ResultFormatTable:
+		return ResultFormatTable
+	}
+	return c.ResultFormat
+}
+
+// IsInfo checks if the query is an info metric (constant value 1 with descriptive labels)
+func (c *ConfigQuery) IsInfo() bool {
+	return c.GetType() == QueryTypeInfo
+}
+
+// validateInfo checks the OpenMetrics info conventions: name suffix _info, value 1 and no value fields
+func (c *ConfigQuery) validateInfo() error {
+	if !strings.HasSuffix(c.Metric, InfoMetricSuffix) {
+		return fmt.Errorf("info metric \"%v\" must end with %v", c.Metric, InfoMetricSuffix)
+	}
+
+	if c.MetricConfig.Value != nil && *c.MetricConfig.Value != 1 {
+		return errors.New("info metrics have the constant value 1")
+	}
+
+	return c.validateLabelFields(QueryTypeInfo)
+}
+
+// validateLabelFields checks that all fields are labels (value 1 or state values are set by the exporter)
+func (c *ConfigQuery) validateLabelFields(queryType string) error {
+	for _, field := range c.MetricConfig.Fields {
+		if field.IsTypeValue() || field.IsExpand() {
+			return fmt.Errorf("field \"%v\": %v metrics only support label fields", field.Name, queryType)
+		}
+	}
+
+	if c.MetricConfig.DefaultField.IsTypeValue() || c.MetricConfig.DefaultField.IsExpand() {
+		return fmt.Errorf("defaultField: %v metrics only support label fields", queryType)
+	}
+
+	return nil
+}
+
+// IsNormalizeLabelsEnabled checks if normalized resource labels are added to the series
+func (c *ConfigQuery) IsNormalizeLabelsEnabled() bool {
+	return c.NormalizeLabels != nil && *c.NormalizeLabels
+}
+
+// IsTopNOtherEnabled checks if rows beyond topN should be aggregated into an "other" row
+func (c *ConfigQuery) IsTopNOtherEnabled() bool {
+	if c.TopNOther != nil {
+		return *c.TopNOther
+	}
+	return true
+}
+
+// GetPublishIfEmpty returns the behavior for empty results (default: suppress)
+func (c *ConfigQuery) GetPublishIfEmpty() string {
+	if c.PublishIfEmpty == "" {
+		return PublishIfEmptySuppress
+	}
+	return strings.ToLower(c.PublishIfEmpty)
+}
+
+// HasParam checks if the query declares a param with the name
+func (c *ConfigQuery) HasParam(name string) bool {
+	for _, param := range c.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ConfigQueryParam) Validate() error {
+	if !queryParamNameRegexp.MatchString(p.Name) {
+		return fmt.Errorf("param \"%v\": invalid param name", p.Name)
+	}
+
+	switch p.GetType() {
+	case QueryParamTypeString:
+	case QueryParamTypeInt:
+	case QueryParamTypeFloat:
+	case QueryParamTypeBool:
+	case QueryParamTypeList:
+	default:
+		return fmt.Errorf("param \"%v\": unsupported type \"%v\"", p.Name, p.Type)
+	}
+
+	if p.Default != nil {
+		if _, err := p.KustoValue(*p.Default); err != nil {
+			return fmt.Errorf("param \"%v\": invalid default: %w", p.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *ConfigQueryParam) GetType() (ret string) {
+	ret = strings.ToLower(p.Type)
+
+	if ret == "" {
+		ret = QueryParamTypeString
+	}
+
+	return
+}
+
+// KustoValue converts the value into a (safely quoted) Kusto literal based on the param type
+func (p *ConfigQueryParam) KustoValue(value string) (string, error) {
+	switch p.GetType() {
+	case QueryParamTypeInt:
+		val, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("value \"%v\" is not an int", value)
+		}
+		return strconv.FormatInt(val, 10), nil
+	case QueryParamTypeFloat:
+		val, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("value \"%v\" is not a float", value)
+		}
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case QueryParamTypeBool:
+		val, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("value \"%v\" is not a bool", value)
+		}
+		return strconv.FormatBool(val), nil
+	case QueryParamTypeList:
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, kustoStringLiteral(item))
+			}
+		}
+		return fmt.Sprintf("dynamic([%s])", strings.Join(list, ", ")), nil
+	default:
+		return kustoStringLiteral(value), nil
+	}
+}
+
+// kustoStringLiteral builds an escaped Kusto string literal
+func kustoStringLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, "\r", `\r`)
+	return "'" + value + "'"
+}
+
+// ParseQuery parses a single query (yaml), applies the defaults of the config and validates it
+func (c *Config) ParseQuery(content []byte) (ConfigQuery, error) {
+	queryConfig := ConfigQuery{}
+	if err := yaml.UnmarshalStrict(content, &queryConfig); err != nil {
+		return queryConfig, fmt.Errorf("unable to parse query: %w", err)
+	}
+
+	c.applyQueryDefaults(&queryConfig)
+
+	// validate a copy, kusto validation modifies the default field name
+	validationCopy := queryConfig
+	if err := validationCopy.Validate(); err != nil {
+		return queryConfig, err
+	}
+
+	if err := c.validateGuardrails(&queryConfig); err != nil {
+		return queryConfig, err
+	}
+
+	return queryConfig, nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	RedactedValue = "<redacted>"
+)
+
+var (
+	// password/secret parts of connection strings (eg. "AccountKey=xxx;" or "Password=xxx;")
+	redactConnectionStringRegexp = regexp.MustCompile(`(?i)((?:password|pwd|secret|accountkey|sharedaccesskey|clientsecret|token)=)[^;]*`)
+)
+
+// Redact returns a copy of the struct with all secrets redacted:
+//   - string fields (and string slices and maps) tagged with `secret:"true"` are replaced (if not empty)
+//   - credentials in urls (eg. proxy urls) and connection strings are removed from all other string fields
+func Redact(v interface{}) interface{} {
+	value := reflect.ValueOf(v)
+	redacted := reflect.New(value.Type()).Elem()
+	redacted.Set(value)
+	redactValue(redacted, false)
+	return redacted.Interface()
+}
+
+func redactValue(value reflect.Value, secret bool) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				// unexported
+				continue
+			}
+			redactValue(value.Field(i), field.Tag.Get("secret") == "true")
+		}
+	case reflect.Ptr:
+		if value.IsNil() || value.Elem().Kind() != reflect.String {
+			return
+		}
+		// copy pointer target, the original value is shared
+		redactedString := reflect.New(value.Elem().Type())
+		redactedString.Elem().Set(value.Elem())
+		redactValue(redactedString.Elem(), secret)
+		value.Set(redactedString)
+	case reflect.Slice:
+		if value.IsNil() || value.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		// copy slice, the original backing array is shared
+		redactedSlice := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		reflect.Copy(redactedSlice, value)
+		for i := 0; i < redactedSlice.Len(); i++ {
+			redactValue(redactedSlice.Index(i), secret)
+		}
+		value.Set(redactedSlice)
+	case reflect.Map:
+		if value.IsNil() || value.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		// copy map, the original map is shared
+		redactedMap := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			redactedValue := reflect.New(value.Type().Elem()).Elem()
+			redactedValue.Set(iter.Value())
+			redactValue(redactedValue, secret)
+			redactedMap.SetMapIndex(iter.Key(), redactedValue)
+		}
+		value.Set(redactedMap)
+	case reflect.String:
+		if secret {
+			if value.String() != "" {
+				value.SetString(RedactedValue)
+			}
+		} else {
+			value.SetString(RedactString(value.String()))
+		}
+	}
+}
+
+// RedactString removes credentials from urls (incl. SAS signatures) and connection strings
+func RedactString(val string) string {
+	if parsedUrl, err := url.Parse(val); err == nil && parsedUrl.Host != "" {
+		// SAS token signature (kept unescaped for readability)
+		queryParts := strings.Split(parsedUrl.RawQuery, "&")
+		for i, part := range queryParts {
+			if strings.HasPrefix(strings.ToLower(part), "sig=") {
+				queryParts[i] = part[:4] + RedactedValue
+				parsedUrl.RawQuery = strings.Join(queryParts, "&")
+				val = parsedUrl.String()
+			}
+		}
+
+		if parsedUrl.User != nil {
+			if _, hasPassword := parsedUrl.User.Password(); hasPassword {
+				return parsedUrl.Redacted()
+			}
+		}
+	}
+
+	return redactConnectionStringRegexp.ReplaceAllString(val, "${1}"+RedactedValue)
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	RelabelActionReplace   = "replace"
+	RelabelActionKeep      = "keep"
+	RelabelActionDrop      = "drop"
+	RelabelActionLabelMap  = "labelmap"
+	RelabelActionLabelDrop = "labeldrop"
+	RelabelActionLabelKeep = "labelkeep"
+
+	RelabelDefaultSeparator   = ";"
+	RelabelDefaultRegexp      = "(.*)"
+	RelabelDefaultReplacement = "$1"
+)
+
+type (
+	// RelabelConfig follows the Prometheus relabel_config format
+	RelabelConfig struct {
+		SourceLabels []string `yaml:"source_labels" json:"source_labels,omitempty"`
+		Separator    *string  `yaml:"separator"     json:"separator,omitempty"`
+		Regex        *string  `yaml:"regex"         json:"regex,omitempty"`
+		TargetLabel  string   `yaml:"target_label"  json:"target_label,omitempty"`
+		Replacement  *string  `yaml:"replacement"   json:"replacement,omitempty"`
+		Action       string   `yaml:"action"        json:"action,omitempty"`
+
+		parsedRegexp *regexp.Regexp
+	}
+)
+
+func (r *RelabelConfig) Validate() error {
+	regex, err := regexp.Compile("^(?:" + r.GetRegex() + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex \"%v\": %w", r.GetRegex(), err)
+	}
+	r.parsedRegexp = regex
+
+	switch r.GetAction() {
+	case RelabelActionReplace:
+		if r.TargetLabel == "" {
+			return errors.New("action \"replace\" requires target_label")
+		}
+	case RelabelActionKeep, RelabelActionDrop:
+		if len(r.SourceLabels) == 0 {
+			return fmt.Errorf("action \"%v\" requires source_labels", r.GetAction())
+		}
+	case RelabelActionLabelMap, RelabelActionLabelDrop, RelabelActionLabelKeep:
+	default:
+		return fmt.Errorf("unsupported relabel action \"%v\"", r.Action)
+	}
+
+	return nil
+}
+
+func (r *RelabelConfig) GetAction() string {
+	if r.Action == "" {
+		return RelabelActionReplace
+	}
+	return strings.ToLower(r.Action)
+}
+
+func (r *RelabelConfig) GetSeparator() string {
+	if r.Separator == nil {
+		return RelabelDefaultSeparator
+	}
+	return *r.Separator
+}
+
+func (r *RelabelConfig) GetRegex() string {
+	if r.Regex == nil {
+		return RelabelDefaultRegexp
+	}
+	return *r.Regex
+}
+
+func (r *RelabelConfig) GetReplacement() string {
+	if r.Replacement == nil {
+		return RelabelDefaultReplacement
+	}
+	return *r.Replacement
+}
+
+// GetRegexp returns the compiled (anchored) regex
+func (r *RelabelConfig) GetRegexp() *regexp.Regexp {
+	if r.parsedRegexp == nil {
+		r.parsedRegexp = regexp.MustCompile("^(?:" + r.GetRegex() + ")$")
+	}
+	return r.parsedRegexp
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	ConfigApiVersionV1 = "v1"
+
+	// ConfigApiVersionLatest is the current config api version
+	ConfigApiVersionLatest = ConfigApiVersionV1
+
+	JsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	JsonSchemaId    = "https://github.com/webdevops/azure-resourcegraph-exporter/config/" + ConfigApiVersionLatest + ".json"
+)
+
+var (
+	// SupportedApiVersions contains all config api versions which can be loaded
+	SupportedApiVersions = []string{ConfigApiVersionV1}
+
+	// schemaEnums contains the allowed values for fields (type.yamlName)
+	schemaEnums = map[string][]string{
+		"Config.apiVersion":                          SupportedApiVersions,
+		"ConfigQuery.dedup":                          {DedupStrategyFirst, DedupStrategyLast, DedupStrategySum, DedupStrategyMax},
+		"ConfigQuery.publishIfEmpty":                 {PublishIfEmptySuppress, PublishIfEmptyZero, PublishIfEmptyIndicator},
+		"ConfigQuery.type":                           {QueryTypeGauge, QueryTypeInfo, QueryTypeStateSet},
+		"ConfigDefaults.publishIfEmpty":              {PublishIfEmptySuppress, PublishIfEmptyZero, PublishIfEmptyIndicator},
+		"ConfigQueryParam.type":                      {QueryParamTypeString, QueryParamTypeInt, QueryParamTypeFloat, QueryParamTypeBool, QueryParamTypeList},
+		"ConfigQueryMetricField.type":                {"id", "value", "expand", "ignore", "string", "bool", "boolean"},
+		"ConfigQueryMetricFieldFilter.type":          {"tolower", "toLower", "toupper", "toUpper", "totitle", "toTitle", "regexp", "tounixtime", "toUnixtime"},
+		"ConfigQueryPostProcessAggregation.function": {PostProcessAggregationCount, PostProcessAggregationSum, PostProcessAggregationMin, PostProcessAggregationMax, PostProcessAggregationAvg},
+		"RelabelConfig.action":                       {RelabelActionReplace, RelabelActionKeep, RelabelActionDrop, RelabelActionLabelMap, RelabelActionLabelDrop, RelabelActionLabelKeep},
+	}
+)
+
+// JsonSchema builds the JSON Schema of the config file
+func JsonSchema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+
+	schema := buildJsonSchemaType(reflect.TypeOf(Config{}), definitions)
+	schema["$schema"] = JsonSchemaDraft
+	schema["$id"] = JsonSchemaId
+	schema["title"] = "azure-resourcegraph-exporter config " + ConfigApiVersionLatest
+	schema["definitions"] = definitions
+
+	// allow additional root properties (eg. yaml anchors)
+	schema["additionalProperties"] = true
+
+	return schema
+}
+
+func buildJsonSchemaType(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return buildJsonSchemaType(t.Elem(), definitions)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": buildJsonSchemaType(t.Elem(), definitions),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": buildJsonSchemaType(t.Elem(), definitions),
+		}
+	case reflect.Struct:
+		name := t.Name()
+		ref := map[string]interface{}{"$ref": "#/definitions/" + name}
+		if _, exists := definitions[name]; exists {
+			return ref
+		}
+
+		// reserve name for recursive types
+		definitions[name] = map[string]interface{}{}
+
+		definition := map[string]interface{}{
+			"type":                 "object",
+			"properties":           buildJsonSchemaProperties(t, name, definitions),
+			"additionalProperties": false,
+		}
+
+		// filters can be set as string or as object
+		if name == "ConfigQueryMetricFieldFilter" {
+			definition = map[string]interface{}{
+				"oneOf": []interface{}{
+					map[string]interface{}{"type": "string", "enum": schemaEnums["ConfigQueryMetricFieldFilter.type"]},
+					definition,
+				},
+			}
+		}
+
+		definitions[name] = definition
+		if name == "Config" {
+			delete(definitions, name)
+			return definition
+		}
+		return ref
+	}
+
+	return map[string]interface{}{}
+}
+
+func buildJsonSchemaProperties(t reflect.Type, typeName string, definitions map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		inline := len(tag) > 1 && tag[1] == "inline"
+
+		if inline {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			for propName, prop := range buildJsonSchemaProperties(fieldType, fieldType.Name(), definitions) {
+				properties[propName] = prop
+			}
+			continue
+		}
+
+		if name == "" || name == "-" {
+			continue
+		}
+
+		prop := buildJsonSchemaType(field.Type, definitions)
+		if enum, ok := schemaEnums[typeName+"."+name]; ok {
+			prop["enum"] = enum
+		}
+		properties[name] = prop
+	}
+
+	return properties
+}
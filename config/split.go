@@ -0,0 +1,107 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// default key column used to rejoin the rows of split queries
+	SplitKeyDefault = "id"
+)
+
+var (
+	kustoProjectOperatorRegexp = regexp.MustCompile(`(?i)^\s*project\s+`)
+)
+
+// GetSplitKey returns the column used to rejoin the rows if the projected columns are split across requests
+func (c *ConfigQuery) GetSplitKey() string {
+	if c.SplitKey != "" {
+		return c.SplitKey
+	}
+	return SplitKeyDefault
+}
+
+// ParseProjectQuery splits a query ending with a project operator into the query before the project operator
+// and the projected column expressions, ok is false if the last operator is not project
+func ParseProjectQuery(query string) (base string, columns []string, ok bool) {
+	pipes := splitKustoTopLevel(query, '|')
+	if len(pipes) < 2 {
+		return "", nil, false
+	}
+
+	last := pipes[len(pipes)-1]
+	match := kustoProjectOperatorRegexp.FindString(last)
+	if match == "" {
+		return "", nil, false
+	}
+
+	for _, column := range splitKustoTopLevel(last[len(match):], ',') {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil, false
+	}
+
+	base = strings.TrimSpace(strings.Join(pipes[:len(pipes)-1], "|"))
+	return base, columns, true
+}
+
+// BuildProjectQuery appends a project operator with the column expressions to the query
+func BuildProjectQuery(base string, columns []string) string {
+	return base + "\n| project " + strings.Join(columns, ", ")
+}
+
+// ProjectColumnName returns the name of a projected column (alias or plain column name),
+// empty if the name is generated by Kusto (eg. member access without alias)
+func ProjectColumnName(expression string) string {
+	name := strings.TrimSpace(expression)
+	if parts := splitKustoTopLevel(expression, '='); len(parts) > 1 && parts[1] != "" {
+		// alias (an empty second part is a comparison ==)
+		name = strings.TrimSpace(parts[0])
+	}
+
+	if !queryParamNameRegexp.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// splitKustoTopLevel splits the query at the separator outside of string literals, comments and brackets
+func splitKustoTopLevel(query string, separator rune) (parts []string) {
+	runes := []rune(query)
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case char == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case char == '\'' || char == '"':
+			for i+1 < len(runes) {
+				i++
+				if runes[i] == '\\' {
+					i++
+					continue
+				}
+				if runes[i] == char {
+					break
+				}
+			}
+		case char == '(' || char == '[' || char == '{':
+			depth++
+		case char == ')' || char == ']' || char == '}':
+			depth--
+		case char == separator && depth == 0:
+			parts = append(parts, string(runes[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(parts, string(runes[start:]))
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+type (
+	// ConfigQueryStateSet converts an enum label into one series per state (OpenMetrics StateSet)
+	ConfigQueryStateSet struct {
+		// label containing the current state (eg. powerState)
+		Label string `yaml:"label"`
+
+		// possible states (discovered from the query result if empty)
+		States []string `yaml:"states"`
+	}
+)
+
+func (s *ConfigQueryStateSet) Validate() error {
+	if s.Label == "" {
+		return errors.New("stateset label is required")
+	}
+
+	states := map[string]bool{}
+	for _, state := range s.States {
+		if state == "" {
+			return errors.New("stateset states must not be empty")
+		}
+		if states[state] {
+			return fmt.Errorf("duplicate stateset state \"%v\"", state)
+		}
+		states[state] = true
+	}
+
+	return nil
+}
+
+// IsStateSet checks if the query is a stateset metric (one series per state with 0/1 values)
+func (c *ConfigQuery) IsStateSet() bool {
+	return c.GetType() == QueryTypeStateSet
+}
+
+// validateStateSet checks the stateset config, the state values are set by the exporter
+func (c *ConfigQuery) validateStateSet() error {
+	if c.StateSet == nil {
+		return errors.New("type stateset requires stateset")
+	}
+
+	if err := c.StateSet.Validate(); err != nil {
+		return err
+	}
+
+	return c.validateLabelFields(QueryTypeStateSet)
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// template actions are masked before the syntax check (rendered values are only known at scrape time),
+	// the output of an action is not restricted to Kusto literals (eg. {{ print "| join ..." }})
+	queryTemplateActionRegexp = regexp.MustCompile(`(?s){{.*?}}`)
+
+	// tabular operators of the Kusto query language (operator reference, incl. legacy aliases), Azure ResourceGraph
+	// supports a subset of them and rejects the others when the query is executed
+	kustoTabularOperators = map[string]bool{
+		"as": true, "consume": true, "count": true, "distinct": true, "evaluate": true, "extend": true,
+		"externaldata": true, "facet": true, "filter": true, "find": true, "fork": true, "getschema": true,
+		"graph-mark-components": true, "graph-match": true, "graph-merge": true, "graph-shortest-paths": true,
+		"graph-to-table": true, "invoke": true, "join": true, "limit": true, "lookup": true, "macro-expand": true,
+		"make-graph": true, "make-series": true, "mv-apply": true, "mv-expand": true, "mvapply": true,
+		"mvexpand": true, "order": true, "parse": true, "parse-kv": true, "parse-where": true, "partition": true,
+		"print": true, "project": true, "project-away": true, "project-keep": true, "project-rename": true,
+		"project-reorder": true, "range": true, "reduce": true, "render": true, "sample": true,
+		"sample-distinct": true, "scan": true, "search": true, "serialize": true, "sort": true, "summarize": true,
+		"take": true, "top": true, "top-hitters": true, "top-nested": true, "union": true, "where": true,
+	}
+
+	kustoBrackets = map[rune]rune{')': '(', ']': '[', '}': '{'}
+)
+
+type (
+	// KustoSyntaxError is a syntax error of a query with position (1-based)
+	KustoSyntaxError struct {
+		Line    int
+		Column  int
+		Message string
+	}
+
+	kustoBracket struct {
+		char   rune
+		line   int
+		column int
+	}
+
+	// kustoToken is a tabular operator (after a pipe) or identifier with its bracket depth (0 = top level statement)
+	kustoToken struct {
+		name   string
+		depth  int
+		line   int
+		column int
+
+		// identifier is the first token of a statement (table, let, union, ...)
+		statement bool
+	}
+
+	// kustoQueryTokens are the tabular operators and identifiers (without member access, eg. properties.name) of a query
+	kustoQueryTokens struct {
+		operators   []kustoToken
+		identifiers []kustoToken
+	}
+)
+
+func (e *KustoSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %v, column %v: %v", e.Line, e.Column, e.Message)
+}
+
+// ValidateKustoSyntax performs a lightweight syntax check of the query: string literals, comments, brackets
+// and tabular operators after pipes. It does not replace the ResourceGraph parser but catches broken
+// queries on startup instead of the first scrape. Template actions ({{ ... }}) are masked.
+func ValidateKustoSyntax(query string) error {
+	_, err := scanKustoQuery(query)
+	return err
+}
+
+// scanKustoQuery checks the syntax and returns the tabular operators and identifiers of the query in order
+func scanKustoQuery(query string) (tokens kustoQueryTokens, err error) {
+	query = queryTemplateActionRegexp.ReplaceAllStringFunc(query, func(action string) string {
+		// keep line breaks for line/column positions
+		return strings.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return 'x'
+		}, action)
+	})
+
+	runes := []rune(query)
+	line, column := 1, 0
+	brackets := []kustoBracket{}
+
+	// position of the last pipe waiting for an operator
+	var pipe *kustoBracket
+
+	// last character outside of whitespace and comments (member access detection)
+	var previous rune
+	statement := true
+
+	syntaxError := func(line, column int, format string, args ...interface{}) (kustoQueryTokens, error) {
+		return kustoQueryTokens{}, &KustoSyntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		column++
+		if char == '\n' {
+			line++
+			column = 0
+			continue
+		}
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\r':
+			continue
+
+		case char == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			// comment until end of line
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+			continue
+
+		case char == '`' && strings.HasPrefix(string(runes[i:]), "```"):
+			// multi-line string literal
+			startLine, startColumn := line, column
+			i += 2
+			column += 2
+
+			terminated := false
+			for i+1 < len(runes) {
+				i++
+				column++
+				if runes[i] == '\n' {
+					line++
+					column = 0
+					continue
+				}
+				if strings.HasPrefix(string(runes[i:]), "```") {
+					i += 2
+					column += 2
+					terminated = true
+					break
+				}
+			}
+			if !terminated {
+				return syntaxError(startLine, startColumn, "unterminated multi-line string literal")
+			}
+
+		case char == '\'' || char == '"' || ((char == '@' || char == 'h' || char == 'H') && i+1 < len(runes) && (runes[i+1] == '\'' || runes[i+1] == '"')):
+			// string literal, verbatim (@"...") or obfuscated (h"...")
+			startColumn := column
+			verbatim := char == '@'
+			if char != '\'' && char != '"' {
+				i++
+				column++
+				char = runes[i]
+			}
+
+			terminated := false
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+				column++
+				if !verbatim && runes[i] == '\\' {
+					i++
+					column++
+					continue
+				}
+				if runes[i] == char {
+					if verbatim && i+1 < len(runes) && runes[i+1] == char {
+						// escaped quote in verbatim string
+						i++
+						column++
+						continue
+					}
+					terminated = true
+					break
+				}
+			}
+			if !terminated {
+				return syntaxError(line, startColumn, "unterminated string literal")
+			}
+
+		case char == '(' || char == '[' || char == '{':
+			brackets = append(brackets, kustoBracket{char: char, line: line, column: column})
+
+		case char == ')' || char == ']' || char == '}':
+			if pipe != nil {
+				return syntaxError(pipe.line, pipe.column, "missing operator after '|'")
+			}
+			if len(brackets) == 0 || brackets[len(brackets)-1].char != kustoBrackets[char] {
+				return syntaxError(line, column, "unexpected '%c'", char)
+			}
+			brackets = brackets[:len(brackets)-1]
+
+		case char == '|':
+			if pipe != nil {
+				return syntaxError(pipe.line, pipe.column, "missing operator after '|'")
+			}
+			pipe = &kustoBracket{char: char, line: line, column: column}
+
+		case char == ';':
+			if pipe != nil {
+				return syntaxError(pipe.line, pipe.column, "missing operator after '|'")
+			}
+			statement = true
+
+		case isKustoIdentifierChar(char):
+			startColumn := column
+			start := i
+			for i+1 < len(runes) && (isKustoIdentifierChar(runes[i+1]) || (runes[i+1] == '-' && i+2 < len(runes) && isKustoIdentifierChar(runes[i+2]))) {
+				i++
+				column++
+			}
+
+			token := kustoToken{name: strings.ToLower(string(runes[start : i+1])), depth: len(brackets), line: line, column: startColumn}
+			switch {
+			case pipe != nil:
+				if !kustoTabularOperators[token.name] {
+					return syntaxError(line, startColumn, "unknown tabular operator \"%v\" after '|'", string(runes[start:i+1]))
+				}
+				tokens.operators = append(tokens.operators, token)
+			case previous != '.':
+				token.statement = statement
+				tokens.identifiers = append(tokens.identifiers, token)
+			}
+			statement = false
+		}
+
+		if pipe != nil && char != '|' {
+			pipe = nil
+		}
+		previous = char
+	}
+
+	if pipe != nil {
+		return syntaxError(pipe.line, pipe.column, "missing operator after '|'")
+	}
+
+	if len(brackets) > 0 {
+		bracket := brackets[len(brackets)-1]
+		return syntaxError(bracket.line, bracket.column, "unclosed '%c'", bracket.char)
+	}
+
+	return tokens, nil
+}
+
+// IsKustoTabularOperator checks if the name is a known tabular operator
+func IsKustoTabularOperator(name string) bool {
+	return kustoTabularOperators[strings.ToLower(name)]
+}
+
+func isKustoIdentifierChar(char rune) bool {
+	return char == '_' || char == '$' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatTestKustoTokens formats the tokens as "name@line:column/depth" (statements with * suffix)
+func formatTestKustoTokens(tokens []kustoToken) string {
+	parts := []string{}
+	for _, token := range tokens {
+		part := fmt.Sprintf("%v@%v:%v/%v", token.name, token.line, token.column, token.depth)
+		if token.statement {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestValidateKustoSyntax(t *testing.T) {
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{query: "Resources | project id, name"},
+		{query: "Resources\n| where type =~ 'microsoft.compute/virtualmachines'\n| summarize count() by location"},
+		{query: "Resources | parse-kv tags as (env:string) with (pair_delimiter=',', kv_delimiter='=') | reduce by name"},
+		{query: "Resources | mv-expand tags | top-nested 3 of location by count()"},
+		{query: "let a = 1; Resources | take a"},
+		{query: "Resources | where name == 'a|b' | project id"},
+		{query: `Resources | where name == "it\"s|" | project id`},
+		{query: `Resources | where name == @"C:\temp\" | project id`},
+		{query: `Resources | where name == h'secret|' | project id`},
+		{query: "Resources | extend a = ```multi\n| line\n``` | project a"},
+		{query: "Resources // comment | wher\n| project id"},
+		{query: "Resources | where name in ('a', 'b') and tags['env'] == 'prod' | project id, properties.storageProfile"},
+		{query: "Resources | where {{ .Params.location }} == location | project id"},
+
+		{query: "Resources | wher name == 'a'", err: `syntax error at line 1, column 13: unknown tabular operator "wher" after '|'`},
+		{query: "Resources\n| project id\n| wher name == 'a'", err: `syntax error at line 3, column 3: unknown tabular operator "wher" after '|'`},
+		{query: "Resources |", err: "syntax error at line 1, column 11: missing operator after '|'"},
+		{query: "Resources | | project id", err: "syntax error at line 1, column 11: missing operator after '|'"},
+		{query: "Resources | ; Resources", err: "syntax error at line 1, column 11: missing operator after '|'"},
+		{query: "Resources | where (name == 'a' |)", err: "syntax error at line 1, column 32: missing operator after '|'"},
+		{query: "Resources | where (name == 'a'", err: "syntax error at line 1, column 19: unclosed '('"},
+		{query: "Resources | where name == 'a')", err: "syntax error at line 1, column 30: unexpected ')'"},
+		{query: "Resources | where tags['a') == 1", err: "syntax error at line 1, column 27: unexpected ')'"},
+		{query: "Resources | where name == 'a", err: "syntax error at line 1, column 27: unterminated string literal"},
+		{query: "Resources | where name == 'a\n' | project id", err: "syntax error at line 1, column 27: unterminated string literal"},
+		{query: `Resources | where name == "a\"`, err: "syntax error at line 1, column 27: unterminated string literal"},
+		{query: "Resources | extend a = ```multi\nline", err: "syntax error at line 1, column 24: unterminated multi-line string literal"},
+	}
+
+	for _, testCase := range testCases {
+		err := ValidateKustoSyntax(testCase.query)
+		switch {
+		case testCase.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", testCase.query, err)
+		case testCase.err != "" && (err == nil || err.Error() != testCase.err):
+			t.Errorf("%q: expected error %q, got %v", testCase.query, testCase.err, err)
+		}
+	}
+}
+
+func TestScanKustoQueryTokens(t *testing.T) {
+	testCases := []struct {
+		query       string
+		operators   string
+		identifiers string
+	}{
+		{
+			query:       "Resources | where type == 'a|b' | PROJECT id",
+			operators:   "where@1:13/0 project@1:35/0",
+			identifiers: "resources@1:1/0* type@1:19/0 id@1:43/0",
+		},
+		{
+			query:       "Resources\n| join kind=inner (ResourceContainers | project subscriptionId) on subscriptionId",
+			operators:   "join@2:3/0 project@2:41/1",
+			identifiers: "resources@1:1/0* kind@2:8/0 inner@2:13/0 resourcecontainers@2:20/1 subscriptionid@2:49/1 on@2:65/0 subscriptionid@2:68/0",
+		},
+		{
+			// number literals are scanned as identifiers
+			query:       "let vms = Resources | where type =~ 'x'; union vms, (SecurityResources | take 1)",
+			operators:   "where@1:23/0 take@1:74/1",
+			identifiers: "let@1:1/0* vms@1:5/0 resources@1:11/0 type@1:29/0 union@1:42/0* vms@1:48/0 securityresources@1:54/1 1@1:79/1",
+		},
+		{
+			// member access and comments are not identifiers
+			query:       "Resources // securityresources | join\n| project properties.securityResources, tags.env",
+			operators:   "project@2:3/0",
+			identifiers: "resources@1:1/0* properties@2:11/0 tags@2:41/0",
+		},
+		{
+			// dashed operators and identifiers
+			query:       "Resources | project-away name | mv-expand tags",
+			operators:   "project-away@1:13/0 mv-expand@1:33/0",
+			identifiers: "resources@1:1/0* name@1:26/0 tags@1:43/0",
+		},
+	}
+
+	for _, testCase := range testCases {
+		tokens, err := scanKustoQuery(testCase.query)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", testCase.query, err)
+		}
+		if operators := formatTestKustoTokens(tokens.operators); operators != testCase.operators {
+			t.Errorf("%q: expected operators\n%v\ngot\n%v", testCase.query, testCase.operators, operators)
+		}
+		if identifiers := formatTestKustoTokens(tokens.identifiers); identifiers != testCase.identifiers {
+			t.Errorf("%q: expected identifiers\n%v\ngot\n%v", testCase.query, testCase.identifiers, identifiers)
+		}
+	}
+}
+
+func TestScanKustoQueryTemplateMasking(t *testing.T) {
+	// positions after (multi-line) template actions are kept
+	err := ValidateKustoSyntax("Resources\n| where location in ({{ range\n.Params }}{{ . }}{{ end }})\n| wher")
+	if err == nil || err.Error() != `syntax error at line 4, column 3: unknown tabular operator "wher" after '|'` {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// brackets and strings inside actions are masked
+	if err := ValidateKustoSyntax(`Resources | where name == {{ printf "'%v(" .Params.name }} | project id`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the output of actions is not restricted to Kusto literals: operators and tables emitted by an action are
+	// invisible in the template and only found in the rendered query (see QueryPolicy and ConfigQuery.CheckPolicy)
+	action := `{{ print "| join (securityresources) on id" }}`
+	tokens, err := scanKustoQuery("resources " + action + " | project id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if operators := formatTestKustoTokens(tokens.operators); operators != "project@1:60/0" {
+		t.Errorf("expected only the operators outside of the action, got %v", operators)
+	}
+	if identifiers := formatTestKustoTokens(tokens.identifiers); identifiers != "resources@1:1/0* "+strings.Repeat("x", len(action))+"@1:11/0 id@1:68/0" {
+		t.Errorf("expected the action masked as a single identifier, got %v", identifiers)
+	}
+
+	tokens, err = scanKustoQuery("resources | join (securityresources) on id | project id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if operators := formatTestKustoTokens(tokens.operators); operators != "join@1:13/0 project@1:46/0" {
+		t.Errorf("expected operators of the rendered query, got %v", operators)
+	}
+}
+
+func TestIsKustoTabularOperator(t *testing.T) {
+	for _, operator := range []string{"where", "WHERE", "parse-kv", "reduce", "mv-expand", "mvexpand", "top-hitters", "graph-match"} {
+		if !IsKustoTabularOperator(operator) {
+			t.Errorf("expected %q to be a tabular operator", operator)
+		}
+	}
+	for _, operator := range []string{"wher", "let", "resources", "count()", ""} {
+		if IsKustoTabularOperator(operator) {
+			t.Errorf("expected %q not to be a tabular operator", operator)
+		}
+	}
+}
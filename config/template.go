@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type (
+	QueryTemplateData struct {
+		// query params as Kusto literals
+		Params map[string]string
+
+		// scrape time as Kusto datetime literal
+		Now string
+
+		// scrape interval as Kusto timespan literal
+		ScrapeInterval string
+
+		// result rows of the queries from dependsOn
+		Results map[string]QueryResult
+	}
+)
+
+// NewQueryTemplateData builds the template data for the scrape time and interval
+func NewQueryTemplateData(now time.Time, scrapeInterval time.Duration) QueryTemplateData {
+	return QueryTemplateData{
+		Params:         map[string]string{},
+		Now:            KustoDatetime(now),
+		ScrapeInterval: KustoTimespan(scrapeInterval),
+		Results:        map[string]QueryResult{},
+	}
+}
+
+// queryTemplateFuncs returns the template functions relative to the scrape time
+func queryTemplateFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		// datetime before scrape time, eg. {{ ago "1h" }}
+		"ago": func(value string) (string, error) {
+			duration, err := ParseDuration(value)
+			if err != nil {
+				return "", err
+			}
+			return KustoDatetime(now.Add(-duration)), nil
+		},
+
+		// timespan literal, eg. {{ timespan "7d" }}
+		"timespan": func(value string) (string, error) {
+			duration, err := ParseDuration(value)
+			if err != nil {
+				return "", err
+			}
+			return KustoTimespan(duration), nil
+		},
+	}
+}
+
+// ParseQueryTemplate parses the query as template, functions are bound to the scrape time
+func (c *ConfigQuery) ParseQueryTemplate(now time.Time) (*template.Template, error) {
+	return template.New(c.Metric).Funcs(queryTemplateFuncs(now)).Option("missingkey=error").Parse(c.Query)
+}
+
+// ParseDuration parses a golang duration with additional support for days (eg. "7d")
+func ParseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration \"%v\"", value)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// KustoDatetime builds a Kusto datetime literal
+func KustoDatetime(value time.Time) string {
+	return fmt.Sprintf("datetime(%s)", value.UTC().Format(time.RFC3339))
+}
+
+// KustoTimespan builds a Kusto timespan literal
+func KustoTimespan(value time.Duration) string {
+	if value%time.Second == 0 {
+		return fmt.Sprintf("%ds", int64(value/time.Second))
+	}
+	return fmt.Sprintf("%dms", value.Milliseconds())
+}
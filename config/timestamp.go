@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// ConfigQueryTimestamp is the datetime column used as sample timestamp (eg. last change time)
+	ConfigQueryTimestamp struct {
+		Field  string  `yaml:"field"`
+		MaxAge *string `yaml:"maxAge"`
+	}
+)
+
+func (t *ConfigQueryTimestamp) Validate() error {
+	if t.Field == "" {
+		return errors.New("timestamp field is required")
+	}
+
+	if t.MaxAge != nil {
+		val, err := time.ParseDuration(*t.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp maxAge \"%v\": %w", *t.MaxAge, err)
+		}
+		if val <= 0 {
+			return fmt.Errorf("timestamp maxAge \"%v\" must be positive", *t.MaxAge)
+		}
+	}
+
+	return nil
+}
+
+// GetMaxAge returns the max age of sample timestamps (fallback if not set)
+func (t *ConfigQueryTimestamp) GetMaxAge(fallback time.Duration) time.Duration {
+	if t.MaxAge != nil {
+		if val, err := time.ParseDuration(*t.MaxAge); err == nil {
+			return val
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// vmSize is the capacity of a VM size
+	vmSize struct {
+		VCPUs     int
+		MemoryGiB float64
+	}
+)
+
+var (
+	// bundled VM size table (common general purpose, burstable, memory and compute optimized sizes),
+	// names are lowercase without "standard_" prefix
+	vmSizes = buildVmSizes()
+)
+
+// buildVmSizes builds the VM size table from the size series (name pattern, vCPU counts and memory per vCPU)
+func buildVmSizes() map[string]vmSize {
+	sizes := map[string]vmSize{}
+
+	series := func(memoryPerVCPU float64, vcpus []int, patterns ...string) {
+		for _, pattern := range patterns {
+			for _, count := range vcpus {
+				sizes[fmt.Sprintf(pattern, count)] = vmSize{VCPUs: count, MemoryGiB: float64(count) * memoryPerVCPU}
+			}
+		}
+	}
+
+	// general purpose (4 GiB per vCPU)
+	series(4, []int{2, 4, 8, 16, 32, 48, 64}, "d%d_v3", "d%ds_v3", "d%d_v4", "d%ds_v4", "d%dd_v4", "d%dds_v4")
+	series(4, []int{2, 4, 8, 16, 32, 48, 64, 96}, "d%da_v4", "d%das_v4", "d%d_v5", "d%ds_v5", "d%dd_v5", "d%dds_v5", "d%das_v5", "d%dads_v5")
+
+	// memory optimized (8 GiB per vCPU)
+	series(8, []int{2, 4, 8, 16, 20, 32, 48}, "e%d_v3", "e%ds_v3", "e%d_v4", "e%ds_v4", "e%dd_v4", "e%dds_v4")
+	series(8, []int{2, 4, 8, 16, 20, 32, 48, 64}, "e%da_v4", "e%das_v4", "e%d_v5", "e%ds_v5", "e%dd_v5", "e%dds_v5", "e%das_v5", "e%dads_v5")
+	for _, name := range []string{"e64_v3", "e64s_v3"} {
+		sizes[name] = vmSize{VCPUs: 64, MemoryGiB: 432}
+	}
+	for _, name := range []string{"e64_v4", "e64s_v4", "e64d_v4", "e64ds_v4"} {
+		sizes[name] = vmSize{VCPUs: 64, MemoryGiB: 504}
+	}
+	for _, name := range []string{"e96a_v4", "e96as_v4", "e96_v5", "e96s_v5", "e96d_v5", "e96ds_v5", "e96as_v5", "e96ads_v5"} {
+		sizes[name] = vmSize{VCPUs: 96, MemoryGiB: 672}
+	}
+
+	// compute optimized (2 GiB per vCPU)
+	series(2, []int{2, 4, 8, 16, 32, 48, 64, 72}, "f%ds_v2")
+
+	// storage optimized (8 GiB per vCPU)
+	series(8, []int{8, 16, 32, 48, 64, 80}, "l%ds_v2")
+
+	// Av2
+	series(2, []int{1, 2, 4, 8}, "a%d_v2")
+	series(8, []int{2, 4, 8}, "a%dm_v2")
+
+	// Dv2 and DSv2
+	for _, prefix := range []string{"d", "ds"} {
+		for name, size := range map[string]vmSize{
+			"1": {1, 3.5}, "2": {2, 7}, "3": {4, 14}, "4": {8, 28}, "5": {16, 56},
+			"11": {2, 14}, "12": {4, 28}, "13": {8, 56}, "14": {16, 112}, "15": {20, 140},
+		} {
+			sizes[prefix+name+"_v2"] = size
+		}
+	}
+
+	// burstable
+	for name, size := range map[string]vmSize{
+		"b1ls": {1, 0.5}, "b1s": {1, 1}, "b1ms": {1, 2}, "b2s": {2, 4}, "b2ms": {2, 8}, "b4ms": {4, 16},
+		"b8ms": {8, 32}, "b12ms": {12, 48}, "b16ms": {16, 64}, "b20ms": {20, 80},
+	} {
+		sizes[name] = size
+	}
+
+	return sizes
+}
+
+// vmSizeKustoCase builds a Kusto case() expression mapping the (lowercase, without "standard_" prefix) size column
+// to the value of the bundled size table, sizes with identical values are grouped in one condition
+func vmSizeKustoCase(column string, value func(size vmSize) float64) string {
+	groups := map[float64][]string{}
+	for name, size := range vmSizes {
+		groups[value(size)] = append(groups[value(size)], kustoStringLiteral(name))
+	}
+
+	values := []float64{}
+	for val := range groups {
+		values = append(values, val)
+	}
+	sort.Float64s(values)
+
+	conditions := []string{}
+	for _, val := range values {
+		sort.Strings(groups[val])
+		conditions = append(conditions, fmt.Sprintf("%v in (%v), %v", column, strings.Join(groups[val], ","), strconv.FormatFloat(val, 'f', -1, 64)))
+	}
+
+	return fmt.Sprintf("case(%v, real(null))", strings.Join(conditions, ",\n    "))
+}
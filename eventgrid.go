@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EventGridMaxBodySize = 1 * 1024 * 1024
+
+	EventGridSubscriptionValidationEvent = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	EventGridResourceEventPrefix         = "Microsoft.Resources."
+)
+
+type (
+	// EventGridEvent is an event in Event Grid schema
+	EventGridEvent struct {
+		ID        string `json:"id"`
+		EventType string `json:"eventType"`
+		Topic     string `json:"topic"`
+		Subject   string `json:"subject"`
+		Data      struct {
+			ValidationCode string `json:"validationCode"`
+			SubscriptionID string `json:"subscriptionId"`
+			ResourceURI    string `json:"resourceUri"`
+		} `json:"data"`
+	}
+
+	EventGridValidationResponse struct {
+		ValidationResponse string `json:"validationResponse"`
+	}
+)
+
+// handleEventGridWebhook receives Azure Event Grid resource events (ResourceWriteSuccess, ResourceDeleteSuccess, ...)
+// and invalidates the cached results of queries covering the changed resource type in the changed subscription
+func handleEventGridWebhook(w http.ResponseWriter, r *http.Request) {
+	if opts.EventGrid.Key == "" {
+		http.Error(w, "eventgrid webhook is disabled, set --eventgrid.key to enable", http.StatusForbidden)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("key")), []byte(opts.EventGrid.Key)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		// CloudEvents abuse protection handshake
+		if origin := r.Header.Get("WebHook-Request-Origin"); origin != "" {
+			w.Header().Set("WebHook-Allowed-Origin", origin)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events := []EventGridEvent{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, EventGridMaxBodySize)).Decode(&events); err != nil {
+		http.Error(w, "unable to parse events: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		if event.EventType == EventGridSubscriptionValidationEvent {
+			log.WithField("topic", event.Topic).Info("eventgrid: validated webhook subscription")
+			writeApiJson(w, EventGridValidationResponse{ValidationResponse: event.Data.ValidationCode})
+			return
+		}
+	}
+
+	for _, event := range events {
+		if strings.HasPrefix(event.EventType, EventGridResourceEventPrefix) {
+			invalidateCacheForEvent(event)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// invalidateCacheForEvent deletes all cache entries of queries (and their dependent queries and modules)
+// covering the resource type of the event in the subscription of the event
+func invalidateCacheForEvent(event EventGridEvent) {
+	resourceId := event.Subject
+	if event.Data.ResourceURI != "" {
+		resourceId = event.Data.ResourceURI
+	}
+
+	subscriptionId, resourceType := parseEventGridResourceId(resourceId)
+	if event.Data.SubscriptionID != "" {
+		subscriptionId = event.Data.SubscriptionID
+	}
+
+	contextLogger := log.WithFields(log.Fields{
+		"event":          event.EventType,
+		"subscriptionID": subscriptionId,
+		"resourceType":   resourceType,
+	})
+
+	if subscriptionId == "" || resourceType == "" {
+		contextLogger.Debugf("eventgrid: ignoring event for resource \"%v\"", resourceId)
+		return
+	}
+
+	cfg := getConfig()
+	for i := range cfg.Queries {
+		queryConfig := &cfg.Queries[i]
+		if !queryConfig.MatchesResourceType(resourceType) {
+			continue
+		}
+
+		queryMatches := cacheQueryMatcher(cfg.GetDependentQueries(queryConfig.GetName()))
+		entries := findCacheEntries(func(key string, info ProbeCacheKey) bool {
+			return queryMatches(info) && info.HasSubscription(subscriptionId)
+		})
+
+		if len(entries) > 0 {
+			invalidateCacheEntries("eventgrid", entries)
+			contextLogger.WithField("query", queryConfig.GetName()).Infof("eventgrid: invalidated %v cache entries", len(entries))
+		}
+	}
+}
+
+// parseEventGridResourceId returns the subscription and the ResourceGraph resource type (lowercase) of a resource id,
+// eg. microsoft.sql/servers/databases for /subscriptions/x/resourceGroups/y/providers/Microsoft.Sql/servers/a/databases/b
+func parseEventGridResourceId(resourceId string) (subscriptionId, resourceType string) {
+	parts := strings.Split(strings.Trim(strings.ToLower(resourceId), "/"), "/")
+	if len(parts) < 2 || parts[0] != "subscriptions" {
+		return
+	}
+	subscriptionId = parts[1]
+
+	// use the last provider segment (nested providers, eg. extension resources)
+	providerIndex := -1
+	for i, part := range parts {
+		if part == "providers" {
+			providerIndex = i
+		}
+	}
+
+	switch {
+	case providerIndex >= 0 && providerIndex+2 < len(parts):
+		typeParts := []string{parts[providerIndex+1]}
+		for i := providerIndex + 2; i < len(parts); i += 2 {
+			typeParts = append(typeParts, parts[i])
+		}
+		resourceType = strings.Join(typeParts, "/")
+	case len(parts) >= 4 && parts[2] == "resourcegroups":
+		resourceType = "microsoft.resources/subscriptions/resourcegroups"
+	case len(parts) == 2:
+		resourceType = "microsoft.resources/subscriptions"
+	}
+
+	return
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BlobExportApiVersion     = "2020-10-02"
+	BlobExportUploadTimeout  = 5 * time.Minute
+	BlobExportBlobTimeFormat = "20060102T150405.000Z"
+)
+
+type (
+	// QueryExport is the archived result of one query run
+	QueryExport struct {
+		Module       string                   `json:"module"`
+		Query        string                   `json:"query"`
+		Metric       string                   `json:"metric"`
+		Profile      string                   `json:"profile"`
+		Params       map[string]string        `json:"params,omitempty"`
+		Time         time.Time                `json:"time"`
+		TotalRecords int64                    `json:"totalRecords"`
+		RowCount     int                      `json:"rowCount"`
+		Rows         []map[string]interface{} `json:"rows"`
+	}
+
+	// blobExporter uploads query results in the background to an Azure Blob storage container
+	blobExporter struct {
+		containerUrl *url.URL
+		prefix       string
+		queue        chan QueryExport
+		logger       *log.Entry
+
+		client         autorest.Client
+		authorizerOnce sync.Once
+		authorizerErr  error
+	}
+)
+
+var (
+	queryExporter *blobExporter
+)
+
+// initQueryExport starts the blob exporter if --export.blob.url is set
+func initQueryExport() error {
+	if opts.Export.Blob.Url == "" {
+		return nil
+	}
+
+	containerUrl, err := url.Parse(opts.Export.Blob.Url)
+	if err != nil {
+		// the parse error contains the url (incl. SAS token)
+		return fmt.Errorf("invalid container url for --export.blob.url: %w", errors.Unwrap(err))
+	}
+
+	exporter := &blobExporter{
+		containerUrl: containerUrl,
+		prefix:       opts.Export.Blob.Prefix,
+		queue:        make(chan QueryExport, opts.Export.Blob.QueueSize),
+		logger:       log.WithField("container", containerUrl.Host+containerUrl.Path),
+		client:       autorest.NewClientWithUserAgent(UserAgent + gitTag),
+	}
+	exporter.client.Sender = azureHttpClient()
+
+	go exporter.run()
+	queryExporter = exporter
+	exporter.logger.Infof("exporting query results to Azure Blob storage")
+	return nil
+}
+
+// isQueryExportEnabled checks if query results are exported (rows need to be collected)
+func isQueryExportEnabled() bool {
+	return queryExporter != nil
+}
+
+// Enqueue adds the result to the upload queue, results are dropped if the queue is full
+func (e *blobExporter) Enqueue(export QueryExport) {
+	select {
+	case e.queue <- export:
+	default:
+		prometheusExportBlobs.WithLabelValues("dropped").Inc()
+		logRateLimiter.Warn(e.logger.WithField("query", export.Query), "export queue is full, dropping query result")
+	}
+}
+
+// run uploads the queued results one by one
+func (e *blobExporter) run() {
+	for export := range e.queue {
+		if err := e.upload(export); err != nil {
+			prometheusExportBlobs.WithLabelValues("error").Inc()
+			logRateLimiter.Error(e.logger.WithField("query", export.Query), fmt.Sprintf("unable to export query result: %v", err))
+			continue
+		}
+		prometheusExportBlobs.WithLabelValues("success").Inc()
+	}
+}
+
+// upload writes the result as block blob (Put Blob)
+func (e *blobExporter) upload(export QueryExport) error {
+	e.authorizerOnce.Do(func() {
+		if e.hasSasToken() {
+			return
+		}
+
+		// Azure AD authentication (default cloud), the token is requested with the first upload
+		cloud := getAzureCloud("")
+		e.client.Authorizer, e.authorizerErr = newAzureResourceAuthorizer(cloud, cloud.Environment.ResourceIdentifiers.Storage)
+	})
+	if e.authorizerErr != nil {
+		return e.authorizerErr
+	}
+
+	content, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	blobUrl := *e.containerUrl
+	blobUrl.Path = strings.TrimSuffix(blobUrl.Path, "/") + "/" + e.blobName(export)
+
+	ctx, cancel := context.WithTimeout(context.Background(), BlobExportUploadTimeout)
+	defer cancel()
+
+	req, err := autorest.Prepare(
+		(&http.Request{}).WithContext(ctx),
+		autorest.AsPut(),
+		autorest.WithBaseURL(blobUrl.String()),
+		autorest.WithHeader("x-ms-version", BlobExportApiVersion),
+		autorest.WithHeader("x-ms-blob-type", "BlockBlob"),
+		autorest.AsContentType("application/json"),
+		autorest.WithBytes(&content),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := autorest.SendWithSender(e.client, req, autorest.DoRetryForStatusCodes(e.client.RetryAttempts, e.client.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return err
+	}
+
+	err = autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusCreated), autorest.ByClosing())
+	if err != nil {
+		return err
+	}
+
+	e.logger.WithField("blob", blobUrl.Path).Debugf("exported %v rows", export.RowCount)
+	return nil
+}
+
+// blobName returns the timestamped blob name: <prefix><module>/<query>/<yyyy>/<mm>/<dd>/<time>.json
+func (e *blobExporter) blobName(export QueryExport) string {
+	module := export.Module
+	if module == "" {
+		module = "_default"
+	}
+
+	exportTime := export.Time.UTC()
+	return e.prefix + path.Join(
+		module,
+		export.Query,
+		exportTime.Format("2006/01/02"),
+		exportTime.Format(BlobExportBlobTimeFormat)+".json",
+	)
+}
+
+// hasSasToken checks if the container url contains a SAS token (no Azure AD authentication needed)
+func (e *blobExporter) hasSasToken() bool {
+	return e.containerUrl.Query().Get("sig") != ""
+}
+
+// validateQueryExportFlags checks the --export.blob.* flags
+func validateQueryExportFlags() (errs []error) {
+	if opts.Export.Blob.Url != "" {
+		if containerUrl, err := url.Parse(opts.Export.Blob.Url); err != nil || containerUrl.Scheme != "https" || containerUrl.Host == "" {
+			errs = append(errs, errors.New("invalid url for --export.blob.url, expected https://<account>.blob.core.windows.net/<container>[?<sas token>]"))
+		}
+	}
+
+	if opts.Export.Blob.QueueSize < 1 {
+		errs = append(errs, errors.New("--export.blob.queue-size must be at least 1"))
+	}
+	return
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	BridgeProtocolStatsd   = "statsd"
+	BridgeProtocolGraphite = "graphite"
+
+	// labels as tags (DogStatsD tags, Graphite 1.1 tags) or as path components (label values sorted by label name)
+	BridgeLabelsTags = "tags"
+	BridgeLabelsPath = "path"
+
+	// max payload of a StatsD UDP packet (fits into the Ethernet MTU)
+	BridgeStatsdMaxPacketSize = 1432
+)
+
+var (
+	bridgePathInvalidCharsRegexp = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+	bridgeTagInvalidCharsRegexp  = regexp.MustCompile(`[\s;~,|#]+`)
+)
+
+type (
+	// bridgeSample is one series of the flushed metrics
+	bridgeSample struct {
+		name      string
+		labels    map[string]string
+		value     float64
+		timestamp time.Time
+	}
+)
+
+// isBridgeExportEnabled checks if metrics are flushed to a StatsD or Graphite endpoint
+func isBridgeExportEnabled() bool {
+	return opts.Export.Bridge.Address != ""
+}
+
+// startBridgeExport flushes the metrics of the modules (default profile) periodically to the StatsD or Graphite endpoint
+func startBridgeExport() {
+	log.WithField("address", opts.Export.Bridge.Address).Infof("flushing metrics to %v endpoint every %v", opts.Export.Bridge.Protocol, opts.Export.Bridge.Interval.String())
+
+	go func() {
+		ticker := time.NewTicker(opts.Export.Bridge.Interval)
+		defer ticker.Stop()
+
+		for {
+			for _, module := range getBridgeModules() {
+				contextLogger := log.WithFields(log.Fields{"module": module, "address": opts.Export.Bridge.Address})
+				if err := flushBridgeModule(module); err != nil {
+					prometheusExportBridge.WithLabelValues(module, "error").Inc()
+					logRateLimiter.Error(contextLogger, fmt.Sprintf("unable to flush metrics to %v endpoint: %v", opts.Export.Bridge.Protocol, err))
+					continue
+				}
+				prometheusExportBridge.WithLabelValues(module, "success").Inc()
+			}
+
+			select {
+			case <-ticker.C:
+			case <-lifecycleQuit:
+				return
+			}
+		}
+	}()
+}
+
+// getBridgeModules returns the flushed modules (--export.bridge.module or all modules of the config)
+func getBridgeModules() []string {
+	if len(opts.Export.Bridge.Modules) > 0 {
+		return opts.Export.Bridge.Modules
+	}
+	return getConfig().GetModules()
+}
+
+// flushBridgeModule executes the module (or uses the cached result) and sends the metrics
+func flushBridgeModule(module string) error {
+	probe, err := newProbe(module, opts.Config.Profile)
+	if errors.Is(err, ErrModuleNotEnabled) {
+		log.WithField("module", module).Debugf("%v flush skipped: %v", opts.Export.Bridge.Protocol, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	probe.Caller = AuditCallerBridgeExport
+
+	metricList, err := probe.ExecuteCached(context.Background())
+	if err != nil {
+		return err
+	}
+
+	samples := buildBridgeSamples(&metricList, time.Now())
+	if len(samples) == 0 {
+		probe.Logger.Debug("no metrics to flush")
+		return nil
+	}
+
+	var lines []string
+	switch opts.Export.Bridge.Protocol {
+	case BridgeProtocolGraphite:
+		lines = formatGraphiteLines(samples)
+	default:
+		lines = formatStatsdLines(samples)
+	}
+
+	if err := sendBridgeLines(lines); err != nil {
+		return err
+	}
+
+	probe.Logger.WithField("address", opts.Export.Bridge.Address).Debugf("flushed %v series to %v endpoint", len(samples), opts.Export.Bridge.Protocol)
+	return nil
+}
+
+// buildBridgeSamples returns the series of the metric list (sorted by metric name), NaN and Inf are skipped
+func buildBridgeSamples(metricList *kusto.MetricList, now time.Time) (samples []bridgeSample) {
+	metricNames := metricList.GetMetricNames()
+	sort.Strings(metricNames)
+
+	for _, metricName := range metricNames {
+		if !metricNameFilter.IsExposed(metricName) {
+			continue
+		}
+
+		for _, row := range metricList.GetMetricList(metricName) {
+			if row.Value == nil || math.IsNaN(*row.Value) || math.IsInf(*row.Value, 0) {
+				continue
+			}
+
+			sample := bridgeSample{name: metricName, labels: map[string]string{}, value: *row.Value, timestamp: now}
+			for labelName, labelValue := range row.Labels {
+				if labelName == MetricTimestampLabel {
+					if millis, err := strconv.ParseInt(labelValue, 10, 64); err == nil {
+						sample.timestamp = time.UnixMilli(millis)
+					}
+					continue
+				}
+				sample.labels[labelName] = labelValue
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return
+}
+
+// path returns the prefixed metric path, with --export.bridge.labels=path the label values are appended
+func (s bridgeSample) path() string {
+	parts := []string{}
+	if opts.Export.Bridge.Prefix != "" {
+		parts = append(parts, strings.Trim(opts.Export.Bridge.Prefix, "."))
+	}
+	parts = append(parts, s.name)
+
+	if opts.Export.Bridge.Labels == BridgeLabelsPath {
+		for _, labelName := range s.labelNames() {
+			value := bridgePathInvalidCharsRegexp.ReplaceAllString(s.labels[labelName], "_")
+			if value == "" {
+				value = "_"
+			}
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// tags returns the labels as name:value (StatsD) or name=value (Graphite) pairs sorted by label name
+func (s bridgeSample) tags(separator string) []string {
+	if opts.Export.Bridge.Labels != BridgeLabelsTags {
+		return nil
+	}
+
+	tags := []string{}
+	for _, labelName := range s.labelNames() {
+		value := bridgeTagInvalidCharsRegexp.ReplaceAllString(s.labels[labelName], "_")
+		if value == "" {
+			// empty tag values are not supported
+			continue
+		}
+		tags = append(tags, labelName+separator+value)
+	}
+	return tags
+}
+
+func (s bridgeSample) labelNames() []string {
+	names := make([]string, 0, len(s.labels))
+	for labelName := range s.labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatStatsdLines formats the samples as StatsD gauges (tags in DogStatsD format), negative values are preceded
+// by a reset to 0 as StatsD treats signed gauge values as relative change
+func formatStatsdLines(samples []bridgeSample) []string {
+	lines := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		suffix := "|g"
+		if tags := sample.tags(":"); len(tags) > 0 {
+			suffix += "|#" + strings.Join(tags, ",")
+		}
+
+		value := strconv.FormatFloat(sample.value, 'f', -1, 64)
+		if sample.value < 0 {
+			lines = append(lines, sample.path()+":0"+suffix)
+		}
+		lines = append(lines, sample.path()+":"+value+suffix)
+	}
+	return lines
+}
+
+// formatGraphiteLines formats the samples in the Graphite plaintext protocol (tags in Graphite 1.1 format)
+func formatGraphiteLines(samples []bridgeSample) []string {
+	lines := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		path := sample.path()
+		if tags := sample.tags("="); len(tags) > 0 {
+			path += ";" + strings.Join(tags, ";")
+		}
+		lines = append(lines, path+" "+strconv.FormatFloat(sample.value, 'f', -1, 64)+" "+strconv.FormatInt(sample.timestamp.Unix(), 10))
+	}
+	return lines
+}
+
+// sendBridgeLines sends the lines to the endpoint, via udp the lines are batched into packets (StatsD)
+func sendBridgeLines(lines []string) error {
+	conn, err := net.DialTimeout(getBridgeNetwork(), opts.Export.Bridge.Address, opts.Export.Bridge.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // #nosec G307
+
+	if err := conn.SetDeadline(time.Now().Add(opts.Export.Bridge.Timeout)); err != nil {
+		return err
+	}
+
+	if getBridgeNetwork() != "udp" {
+		_, err := conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+		return err
+	}
+
+	packet := bytes.Buffer{}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > BridgeStatsdMaxPacketSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+// getBridgeNetwork returns the network of the endpoint (default: udp for StatsD, tcp for Graphite)
+func getBridgeNetwork() string {
+	switch {
+	case opts.Export.Bridge.Network != "":
+		return opts.Export.Bridge.Network
+	case opts.Export.Bridge.Protocol == BridgeProtocolGraphite:
+		return "tcp"
+	}
+	return "udp"
+}
+
+// validateBridgeExportFlags checks the --export.bridge.* flags
+func validateBridgeExportFlags() (errs []error) {
+	if !isBridgeExportEnabled() {
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(opts.Export.Bridge.Address); err != nil {
+		errs = append(errs, fmt.Errorf("invalid address for --export.bridge.address, expected host:port: %w", err))
+	}
+	if opts.Export.Bridge.Interval <= 0 {
+		errs = append(errs, errors.New("--export.bridge.interval must be positive"))
+	}
+	if opts.Export.Bridge.Timeout <= 0 {
+		errs = append(errs, errors.New("--export.bridge.timeout must be positive"))
+	}
+	if strings.Contains(opts.Export.Bridge.Prefix, " ") {
+		errs = append(errs, errors.New("--export.bridge.prefix must not contain spaces"))
+	}
+	return
+}
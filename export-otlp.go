@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	OtlpMetricsPath = "/v1/metrics"
+	OtlpServiceName = "azure-resourcegraph-exporter"
+
+	// resource attribute of the module
+	OtlpModuleAttribute = "azure.resourcegraph.module"
+
+	// metrics with this suffix are pushed as cumulative monotonic sums (Prometheus counter convention), others as gauges
+	OtlpSumSuffix = "_total"
+
+	// AggregationTemporality CUMULATIVE
+	otlpAggregationTemporalityCumulative = 2
+)
+
+type (
+	// OTLP/HTTP JSON encoding of ExportMetricsServiceRequest (opentelemetry-proto metrics/v1)
+	otlpExportMetricsRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+
+	otlpMetric struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Gauge       *otlpGauge `json:"gauge,omitempty"`
+		Sum         *otlpSum   `json:"sum,omitempty"`
+	}
+
+	otlpGauge struct {
+		DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+	}
+
+	otlpSum struct {
+		DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality int                   `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	}
+
+	otlpNumberDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          float64        `json:"asDouble"`
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+var (
+	// start time of cumulative sums
+	otlpStartTime = time.Now()
+)
+
+// isOtlpExportEnabled checks if metrics are pushed to an OTLP endpoint
+func isOtlpExportEnabled() bool {
+	return opts.Export.Otlp.Endpoint != ""
+}
+
+// startOtlpExport pushes the metrics of the modules (default profile) periodically to the OTLP/HTTP endpoint
+func startOtlpExport() {
+	endpoint := getOtlpEndpoint()
+	log.WithField("endpoint", endpoint).Infof("pushing metrics to OTLP endpoint every %v", opts.Export.Otlp.Interval.String())
+
+	go func() {
+		ticker := time.NewTicker(opts.Export.Otlp.Interval)
+		defer ticker.Stop()
+
+		for {
+			for _, module := range getOtlpModules() {
+				contextLogger := log.WithFields(log.Fields{"module": module, "endpoint": endpoint})
+				if err := pushOtlpModule(endpoint, module); err != nil {
+					prometheusExportOtlp.WithLabelValues(module, "error").Inc()
+					logRateLimiter.Error(contextLogger, fmt.Sprintf("unable to push metrics to OTLP endpoint: %v", err))
+					continue
+				}
+				prometheusExportOtlp.WithLabelValues(module, "success").Inc()
+			}
+
+			select {
+			case <-ticker.C:
+			case <-lifecycleQuit:
+				return
+			}
+		}
+	}()
+}
+
+// getOtlpEndpoint returns the url of the metrics endpoint (/v1/metrics is appended to urls without path)
+func getOtlpEndpoint() string {
+	endpoint, err := url.Parse(opts.Export.Otlp.Endpoint)
+	if err != nil {
+		return opts.Export.Otlp.Endpoint
+	}
+	if strings.Trim(endpoint.Path, "/") == "" {
+		endpoint.Path = OtlpMetricsPath
+	}
+	return endpoint.String()
+}
+
+// getOtlpModules returns the pushed modules (--export.otlp.module or all modules of the config)
+func getOtlpModules() []string {
+	if len(opts.Export.Otlp.Modules) > 0 {
+		return opts.Export.Otlp.Modules
+	}
+	return getConfig().GetModules()
+}
+
+// pushOtlpModule executes the module (or uses the cached result) and pushes the metrics
+func pushOtlpModule(endpoint, module string) error {
+	probe, err := newProbe(module, opts.Config.Profile)
+	if errors.Is(err, ErrModuleNotEnabled) {
+		log.WithField("module", module).Debugf("OTLP push skipped: %v", err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	probe.Caller = AuditCallerOtlpExport
+
+	metricList, err := probe.ExecuteCached(context.Background())
+	if err != nil {
+		return err
+	}
+
+	request := buildOtlpExportMetricsRequest(module, &metricList, time.Now())
+	if len(request.ResourceMetrics[0].ScopeMetrics[0].Metrics) == 0 {
+		probe.Logger.Debug("no metrics to push")
+		return nil
+	}
+
+	content, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Export.Otlp.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent+gitTag)
+	for name, value := range opts.Export.Otlp.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // #nosec G307
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP endpoint returned %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	probe.Logger.WithField("endpoint", endpoint).Debugf("pushed %v series to OTLP endpoint", countMetricListSeries(&metricList))
+	return nil
+}
+
+// buildOtlpExportMetricsRequest converts the metric list into OTLP metrics, labels become data point attributes
+func buildOtlpExportMetricsRequest(module string, metricList *kusto.MetricList, now time.Time) otlpExportMetricsRequest {
+	metricNames := metricList.GetMetricNames()
+	sort.Strings(metricNames)
+
+	metrics := []otlpMetric{}
+	for _, metricName := range metricNames {
+		if !metricNameFilter.IsExposed(metricName) {
+			continue
+		}
+
+		dataPoints := []otlpNumberDataPoint{}
+		for _, row := range metricList.GetMetricList(metricName) {
+			// NaN and Inf can't be encoded as json
+			if row.Value == nil || math.IsNaN(*row.Value) || math.IsInf(*row.Value, 0) {
+				continue
+			}
+
+			timestamp := now
+			if value, ok := row.Labels[MetricTimestampLabel]; ok {
+				if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+					timestamp = time.UnixMilli(millis)
+				}
+			}
+
+			labels := map[string]string{}
+			for labelName, labelValue := range row.Labels {
+				if labelName != MetricTimestampLabel {
+					labels[labelName] = labelValue
+				}
+			}
+
+			dataPoints = append(dataPoints, otlpNumberDataPoint{
+				Attributes:   newOtlpAttributes(labels),
+				TimeUnixNano: strconv.FormatInt(timestamp.UnixNano(), 10),
+				AsDouble:     *row.Value,
+			})
+		}
+		if len(dataPoints) == 0 {
+			continue
+		}
+
+		metric := otlpMetric{Name: metricName, Description: metricName}
+		if strings.HasSuffix(metricName, OtlpSumSuffix) {
+			for i := range dataPoints {
+				dataPoints[i].StartTimeUnixNano = strconv.FormatInt(otlpStartTime.UnixNano(), 10)
+			}
+			metric.Sum = &otlpSum{
+				DataPoints:             dataPoints,
+				AggregationTemporality: otlpAggregationTemporalityCumulative,
+				IsMonotonic:            true,
+			}
+		} else {
+			metric.Gauge = &otlpGauge{DataPoints: dataPoints}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return otlpExportMetricsRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: getOtlpResourceAttributes(module)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: OtlpServiceName, Version: gitTag},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+// getOtlpResourceAttributes returns the service attributes, the module (if not the default module) and --export.otlp.resource-attribute (wins)
+func getOtlpResourceAttributes(module string) []otlpKeyValue {
+	attributes := map[string]string{
+		"service.name":    OtlpServiceName,
+		"service.version": gitTag,
+	}
+	if module != "" {
+		attributes[OtlpModuleAttribute] = module
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes["service.instance.id"] = hostname
+	}
+	for name, value := range opts.Export.Otlp.ResourceAttributes {
+		attributes[name] = value
+	}
+	return newOtlpAttributes(attributes)
+}
+
+// newOtlpAttributes converts the labels into attributes (sorted by key)
+func newOtlpAttributes(labels map[string]string) []otlpKeyValue {
+	attributes := make([]otlpKeyValue, 0, len(labels))
+	for name, value := range labels {
+		attributes = append(attributes, otlpKeyValue{Key: name, Value: otlpAnyValue{StringValue: value}})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Key < attributes[j].Key
+	})
+	return attributes
+}
+
+// validateOtlpExportFlags checks the --export.otlp.* flags
+func validateOtlpExportFlags() (errs []error) {
+	if !isOtlpExportEnabled() {
+		return
+	}
+
+	if endpoint, err := url.Parse(opts.Export.Otlp.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		errs = append(errs, errors.New("invalid url for --export.otlp.endpoint, expected eg. http://otel-collector:4318"))
+	}
+	if opts.Export.Otlp.Interval <= 0 {
+		errs = append(errs, errors.New("--export.otlp.interval must be positive"))
+	}
+	if opts.Export.Otlp.Timeout <= 0 {
+		errs = append(errs, errors.New("--export.otlp.timeout must be positive"))
+	}
+	return
+}
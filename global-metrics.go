@@ -1,11 +1,48 @@
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 var (
 	prometheusQueryTime     *prometheus.SummaryVec
 	prometheusQueryResults  *prometheus.GaugeVec
 	prometheusQueryRequests *prometheus.CounterVec
+	prometheusQueryErrors   *prometheus.CounterVec
+
+	prometheusQueryDuplicateSeries *prometheus.CounterVec
+	prometheusQuerySeries          *prometheus.GaugeVec
+	prometheusQueryCanary          *prometheus.GaugeVec
+	prometheusQueryInconsistent    *prometheus.GaugeVec
+	prometheusQueryColumns         *prometheus.GaugeVec
+	prometheusQuerySchemaChanges   *prometheus.CounterVec
+	prometheusQueryDisabled        *prometheus.GaugeVec
+	prometheusQuerySkipped         *prometheus.CounterVec
+
+	prometheusProbeCoalesced     *prometheus.CounterVec
+	prometheusProbeTruncations   *prometheus.CounterVec
+	prometheusCacheInvalidations *prometheus.CounterVec
+
+	prometheusCacheRefreshInterval *prometheus.GaugeVec
+	prometheusCacheRefreshDuration *prometheus.SummaryVec
+
+	prometheusCacheHits    *prometheus.CounterVec
+	prometheusCacheMisses  *prometheus.CounterVec
+	prometheusCacheExpired *prometheus.CounterVec
+
+	prometheusExportBlobs  *prometheus.CounterVec
+	prometheusExportOtlp   *prometheus.CounterVec
+	prometheusExportBridge *prometheus.CounterVec
+
+	prometheusBuildInfo *prometheus.GaugeVec
+
+	prometheusAzureTokenExpiry   *prometheus.GaugeVec
+	prometheusAzureTokenRequests *prometheus.CounterVec
+	prometheusAzureTokenErrors   *prometheus.CounterVec
+
+	prometheusSubscriptionAccessError *prometheus.GaugeVec
 )
 
 func initGlobalMetrics() {
@@ -44,4 +81,299 @@ func initGlobalMetrics() {
 		},
 	)
 	prometheus.MustRegister(prometheusQueryRequests)
+
+	prometheusQueryErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_query_errors",
+			Help: "Azure ResourceGraph query error count",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryErrors)
+
+	prometheusQueryDuplicateSeries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_query_duplicate_series",
+			Help: "Azure ResourceGraph count of merged result rows with duplicate labels per query",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryDuplicateSeries)
+
+	prometheusQuerySeries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_query_series",
+			Help: "Azure ResourceGraph number of series built from the query result",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQuerySeries)
+
+	prometheusQueryCanary = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_query_canary",
+			Help: "Azure ResourceGraph query is a canary (metrics are hidden from /probe)",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryCanary)
+
+	prometheusQueryInconsistent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_query_inconsistent",
+			Help: "Azure ResourceGraph query result changed while paginating (metrics might be inconsistent)",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryInconsistent)
+
+	prometheusQueryColumns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_query_columns",
+			Help: "Azure ResourceGraph number of columns returned by the query",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryColumns)
+
+	prometheusQuerySchemaChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_query_schema_changes",
+			Help: "Azure ResourceGraph count of changed column sets (columns added or removed) between query executions",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQuerySchemaChanges)
+
+	prometheusQueryDisabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_query_disabled",
+			Help: "Azure ResourceGraph query disabled via api",
+		},
+		[]string{
+			"query",
+		},
+	)
+	prometheus.MustRegister(prometheusQueryDisabled)
+
+	prometheusQuerySkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_query_skipped",
+			Help: "Azure ResourceGraph count of queries skipped because the probe deadline (scrape timeout) was exceeded",
+		},
+		[]string{
+			"module",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(prometheusQuerySkipped)
+
+	prometheusCacheRefreshInterval = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_cache_refresh_interval_seconds",
+			Help: "Azure ResourceGraph current (adapted) refresh interval per module in background collector mode",
+		},
+		[]string{
+			"module",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheRefreshInterval)
+
+	prometheusCacheRefreshDuration = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name: "azure_resourcegraph_cache_refresh_duration_seconds",
+			Help: "Azure ResourceGraph execution time of background refreshes per module",
+		},
+		[]string{
+			"module",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheRefreshDuration)
+
+	prometheusProbeCoalesced = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_probe_coalesced",
+			Help: "Azure ResourceGraph count of probe requests served by an in-flight execution with identical parameters",
+		},
+		[]string{
+			"module",
+		},
+	)
+	prometheus.MustRegister(prometheusProbeCoalesced)
+
+	prometheusProbeTruncations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_probe_truncations",
+			Help: "Azure ResourceGraph count of probe responses truncated by --probe.max-series or --probe.max-bytes",
+		},
+		[]string{
+			"module",
+			"limit",
+		},
+	)
+	prometheus.MustRegister(prometheusProbeTruncations)
+
+	prometheusCacheInvalidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_cache_invalidations",
+			Help: "Azure ResourceGraph count of invalidated cache entries",
+		},
+		[]string{
+			"source",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheInvalidations)
+
+	prometheusCacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_cache_hits_total",
+			Help: "Azure ResourceGraph count of cache hits per module and query (empty query for probe results)",
+		},
+		[]string{
+			"module",
+			"query",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheHits)
+
+	prometheusCacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_cache_misses_total",
+			Help: "Azure ResourceGraph count of cache misses per module and query (empty query for probe results)",
+		},
+		[]string{
+			"module",
+			"query",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheMisses)
+
+	prometheusCacheExpired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_cache_expired_total",
+			Help: "Azure ResourceGraph count of cache entries removed after expiry per module and query (empty query for probe results)",
+		},
+		[]string{
+			"module",
+			"query",
+		},
+	)
+	prometheus.MustRegister(prometheusCacheExpired)
+
+	prometheus.MustRegister(&cacheEntriesCollector{})
+
+	prometheusExportBlobs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_export_blobs",
+			Help: "Azure ResourceGraph count of query results exported to Azure Blob storage",
+		},
+		[]string{
+			"status",
+		},
+	)
+	prometheus.MustRegister(prometheusExportBlobs)
+
+	prometheusExportOtlp = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_export_otlp_pushes",
+			Help: "Azure ResourceGraph count of metric pushes to the OTLP endpoint per module and status",
+		},
+		[]string{
+			"module",
+			"status",
+		},
+	)
+	prometheus.MustRegister(prometheusExportOtlp)
+
+	prometheusExportBridge = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_resourcegraph_export_bridge_flushes",
+			Help: "Azure ResourceGraph count of metric flushes to the StatsD or Graphite endpoint per module and status",
+		},
+		[]string{
+			"module",
+			"status",
+		},
+	)
+	prometheus.MustRegister(prometheusExportBridge)
+
+	prometheusBuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_resourcegraph_exporter_build_info",
+			Help: "Azure ResourceGraph exporter build information",
+		},
+		[]string{
+			"version",
+			"revision",
+			"goversion",
+		},
+	)
+	prometheus.MustRegister(prometheusBuildInfo)
+	prometheusBuildInfo.WithLabelValues(gitTag, gitCommit, runtime.Version()).Set(1)
+
+	prometheusAzureTokenExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_ad_token_expiry_timestamp_seconds",
+			Help: "Azure AD token expiry as unix timestamp",
+		},
+		[]string{
+			"scope",
+		},
+	)
+	prometheus.MustRegister(prometheusAzureTokenExpiry)
+
+	prometheusAzureTokenRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_ad_token_requests",
+			Help: "Azure AD token acquisition count",
+		},
+		[]string{
+			"scope",
+		},
+	)
+	prometheus.MustRegister(prometheusAzureTokenRequests)
+
+	prometheusAzureTokenErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azure_ad_token_errors",
+			Help: "Azure AD token acquisition error count",
+		},
+		[]string{
+			"scope",
+		},
+	)
+	prometheus.MustRegister(prometheusAzureTokenErrors)
+
+	prometheusSubscriptionAccessError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "azure_subscription_access_error",
+			Help: "Azure configured subscription not accessible on startup (1 = skipped in all queries, otherwise 0)",
+		},
+		[]string{
+			"subscriptionID",
+			"cloud",
+		},
+	)
+	prometheus.MustRegister(prometheusSubscriptionAccessError)
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	HealthStatusOk     = "ok"
+	HealthStatusFailed = "failed"
+)
+
+type (
+	// HealthCheck is a named check of a health endpoint (/livez, /readyz, /healthz)
+	HealthCheck struct {
+		Name  string
+		Check func() error
+	}
+
+	// HealthResponse is the json body of a health endpoint (?format=json or Accept: application/json)
+	HealthResponse struct {
+		Status string              `json:"status"`
+		Checks []HealthCheckResult `json:"checks"`
+	}
+
+	HealthCheckResult struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+var (
+	ErrShuttingDown = errors.New("shutting down")
+
+	// liveness only fails if the process has to be restarted
+	livenessChecks = []HealthCheck{
+		{Name: "ping", Check: healthCheckPing},
+	}
+
+	// readiness fails while the exporter can't serve probes (config not loaded, Azure not initialized,
+	// critical queries not succeeded yet, graceful shutdown)
+	readinessChecks = []HealthCheck{
+		{Name: "ping", Check: healthCheckPing},
+		{Name: "config", Check: healthCheckConfig},
+		{Name: "azure", Check: healthCheckAzure},
+		{Name: "critical-queries", Check: healthCheckCriticalQueries},
+		{Name: "shutdown", Check: healthCheckShutdown},
+	}
+)
+
+func healthCheckPing() error {
+	return nil
+}
+
+func healthCheckAzure() error {
+	if !isAzureReady() {
+		return ErrAzureNotReady
+	}
+	return nil
+}
+
+func healthCheckShutdown() error {
+	select {
+	case <-lifecycleQuit:
+		return ErrShuttingDown
+	default:
+		return nil
+	}
+}
+
+// newHealthHandler serves the checks like the Kubernetes API server health endpoints: "ok" if all checks pass,
+// the result per check with ?verbose (always on failure), single checks via <path>/<check> and excluded
+// checks via ?exclude=<check>. Failures return 503.
+func newHealthHandler(path string, checks []HealthCheck) http.Handler {
+	name := strings.TrimPrefix(path, "/")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected := checks
+		if checkName := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, path), "/"); checkName != "" {
+			selected = nil
+			for _, check := range checks {
+				if check.Name == checkName {
+					selected = append(selected, check)
+				}
+			}
+			if len(selected) == 0 {
+				http.Error(w, fmt.Sprintf("unknown check \"%v\"", checkName), http.StatusNotFound)
+				return
+			}
+		}
+
+		excluded := map[string]bool{}
+		for _, checkName := range r.URL.Query()["exclude"] {
+			excluded[checkName] = true
+		}
+
+		response := HealthResponse{Status: HealthStatusOk, Checks: []HealthCheckResult{}}
+		excludedChecks := []string{}
+		for _, check := range selected {
+			if excluded[check.Name] {
+				excludedChecks = append(excludedChecks, check.Name)
+				continue
+			}
+
+			result := HealthCheckResult{Name: check.Name, Status: HealthStatusOk}
+			if err := check.Check(); err != nil {
+				result.Status = HealthStatusFailed
+				result.Message = err.Error()
+				response.Status = HealthStatusFailed
+			}
+			response.Checks = append(response.Checks, result)
+		}
+
+		statusCode := http.StatusOK
+		if response.Status != HealthStatusOk {
+			statusCode = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(statusCode)
+
+		_, verbose := r.URL.Query()["verbose"]
+		if !verbose && statusCode == http.StatusOK {
+			if _, err := fmt.Fprint(w, HealthStatusOk); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+
+		body := strings.Builder{}
+		for _, result := range response.Checks {
+			if result.Status == HealthStatusOk {
+				body.WriteString(fmt.Sprintf("[+]%v ok\n", result.Name))
+			} else {
+				body.WriteString(fmt.Sprintf("[-]%v failed: %v\n", result.Name, result.Message))
+			}
+		}
+		for _, checkName := range excludedChecks {
+			body.WriteString(fmt.Sprintf("[+]%v excluded: ok\n", checkName))
+		}
+		if statusCode == http.StatusOK {
+			body.WriteString(fmt.Sprintf("%v check passed\n", name))
+		} else {
+			body.WriteString(fmt.Sprintf("%v check failed\n", name))
+		}
+
+		if _, err := fmt.Fprint(w, body.String()); err != nil {
+			log.Error(err)
+		}
+	})
+}
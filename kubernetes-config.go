@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	KubernetesServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	KubernetesRequestTimeout     = 30 * time.Second
+)
+
+type (
+	// kubernetesConfigFragment is one yaml key of a discovered ConfigMap
+	kubernetesConfigFragment struct {
+		Source  string
+		Content string
+	}
+
+	kubernetesConfigMapList struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}
+)
+
+var (
+	kubernetesConfigFragments      []kubernetesConfigFragment
+	kubernetesConfigFragmentsMutex sync.RWMutex
+)
+
+// isKubernetesConfigEnabled checks if query ConfigMaps are discovered
+func isKubernetesConfigEnabled() bool {
+	return opts.Config.Kubernetes.Selector != ""
+}
+
+// initKubernetesConfig discovers the query ConfigMaps before the config is loaded
+func initKubernetesConfig() error {
+	if !isKubernetesConfigEnabled() {
+		return nil
+	}
+
+	fragments, err := discoverKubernetesConfigFragments(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to discover Kubernetes ConfigMaps: %w", err)
+	}
+	setKubernetesConfigFragments(fragments)
+
+	log.Infof("discovered %v config fragments in Kubernetes ConfigMaps (selector %v)", len(fragments), opts.Config.Kubernetes.Selector)
+	return nil
+}
+
+// startKubernetesConfigWatcher polls the ConfigMaps and reloads the config if they are changed
+func startKubernetesConfigWatcher() {
+	if !isKubernetesConfigEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(opts.Config.Kubernetes.Interval)
+		defer ticker.Stop()
+
+		// invalid ConfigMaps are not retried until they are changed again
+		var failed []kubernetesConfigFragment
+
+		for range ticker.C {
+			fragments, err := discoverKubernetesConfigFragments(context.Background())
+			if err != nil {
+				log.Errorf("unable to discover Kubernetes ConfigMaps: %v", err)
+				continue
+			}
+
+			previous := getKubernetesConfigFragments()
+			if reflect.DeepEqual(previous, fragments) || reflect.DeepEqual(failed, fragments) {
+				continue
+			}
+
+			log.Infof("Kubernetes ConfigMaps changed (%v config fragments), reloading config", len(fragments))
+			setKubernetesConfigFragments(fragments)
+			if errs := reloadConfig(); len(errs) > 0 {
+				for _, err := range errs {
+					log.Errorf("config reload failed, keeping previous ConfigMaps: %v", err)
+				}
+				setKubernetesConfigFragments(previous)
+				failed = fragments
+			}
+		}
+	}()
+}
+
+func getKubernetesConfigFragments() []kubernetesConfigFragment {
+	kubernetesConfigFragmentsMutex.RLock()
+	defer kubernetesConfigFragmentsMutex.RUnlock()
+	return kubernetesConfigFragments
+}
+
+func setKubernetesConfigFragments(fragments []kubernetesConfigFragment) {
+	kubernetesConfigFragmentsMutex.Lock()
+	defer kubernetesConfigFragmentsMutex.Unlock()
+	kubernetesConfigFragments = fragments
+}
+
+// mergeKubernetesConfig merges the queries of the discovered ConfigMaps and of the ResourceGraphQuery resources
+// into the config, both are untrusted sources (no unsafe queries or identities)
+func mergeKubernetesConfig(newConfig *config.Config, crdFragments []kubernetesConfigFragment) (errs []error) {
+	fragments := append([]kubernetesConfigFragment{}, getKubernetesConfigFragments()...)
+	for _, fragment := range append(fragments, crdFragments...) {
+		if err := newConfig.MergeUntrustedQueries(fragment.Source, []byte(fragment.Content)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// discoverKubernetesConfigFragments lists the ConfigMaps matching the selector using the in-cluster service account,
+// every yaml key (*.yaml, *.yml) is a config fragment
+func discoverKubernetesConfigFragments(ctx context.Context) ([]kubernetesConfigFragment, error) {
+	path := "/api/v1/configmaps"
+	if opts.Config.Kubernetes.Namespace != "" {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/configmaps", url.PathEscape(opts.Config.Kubernetes.Namespace))
+	}
+
+	body, err := kubernetesRequest(ctx, http.MethodGet, path+"?labelSelector="+url.QueryEscape(opts.Config.Kubernetes.Selector), "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing ConfigMaps: %w", err)
+	}
+
+	list := kubernetesConfigMapList{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("unable to decode ConfigMap list: %w", err)
+	}
+
+	fragments := []kubernetesConfigFragment{}
+	for _, item := range list.Items {
+		for key, content := range item.Data {
+			if !strings.HasSuffix(key, ".yaml") && !strings.HasSuffix(key, ".yml") {
+				continue
+			}
+			fragments = append(fragments, kubernetesConfigFragment{
+				Source:  fmt.Sprintf("configmap/%s/%s/%s", item.Metadata.Namespace, item.Metadata.Name, key),
+				Content: content,
+			})
+		}
+	}
+
+	// stable order for change detection and query order
+	sort.Slice(fragments, func(i, j int) bool {
+		return fragments[i].Source < fragments[j].Source
+	})
+
+	return fragments, nil
+}
+
+// kubernetesRequest sends a request to the Kubernetes API using the in-cluster service account and returns the body
+// of a successful response
+func kubernetesRequest(ctx context.Context, method, path, contentType string, content []byte) ([]byte, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running inside Kubernetes (KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT not set)")
+	}
+
+	// token is read on every request, projected service account tokens are rotated
+	token, err := ioutil.ReadFile(KubernetesServiceAccountPath + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token: %w", err)
+	}
+
+	caCert, err := ioutil.ReadFile(KubernetesServiceAccountPath + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account ca: %w", err)
+	}
+	caPool := x509.NewCertPool()
+	caPool.AppendCertsFromPEM(caCert)
+
+	ctx, cancel := context.WithTimeout(ctx, KubernetesRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("https://%s%s", net.JoinHostPort(host, port), path), bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: caPool, MinVersion: tls.VersionTLS12},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
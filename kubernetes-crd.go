@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	KubernetesCrdGroup   = "resourcegraph.webdevops.io"
+	KubernetesCrdVersion = "v1alpha1"
+	KubernetesCrdPlural  = "resourcegraphqueries"
+
+	KubernetesCrdConditionReady = "Ready"
+
+	KubernetesCrdReasonAccepted     = "Accepted"
+	KubernetesCrdReasonInvalidSpec  = "InvalidSpec"
+	KubernetesCrdReasonReloadFailed = "ReloadFailed"
+)
+
+type (
+	kubernetesResourceGraphQueryList struct {
+		Items []kubernetesResourceGraphQuery `json:"items"`
+	}
+
+	// kubernetesResourceGraphQuery is a ResourceGraphQuery resource, the spec is a query (same format as in the config file)
+	kubernetesResourceGraphQuery struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Namespace  string `json:"namespace"`
+			Generation int64  `json:"generation"`
+		} `json:"metadata"`
+		Spec   json.RawMessage                    `json:"spec"`
+		Status kubernetesResourceGraphQueryStatus `json:"status"`
+	}
+
+	kubernetesResourceGraphQueryStatus struct {
+		ObservedGeneration int64                            `json:"observedGeneration"`
+		Conditions         []kubernetesCondition            `json:"conditions"`
+		LastRun            *kubernetesResourceGraphQueryRun `json:"lastRun"`
+	}
+
+	kubernetesCondition struct {
+		Type               string `json:"type"`
+		Status             string `json:"status"`
+		Reason             string `json:"reason"`
+		Message            string `json:"message"`
+		LastTransitionTime string `json:"lastTransitionTime"`
+	}
+
+	// kubernetesResourceGraphQueryRun is the last execution of the query (see /api/query/{name}/debug)
+	kubernetesResourceGraphQueryRun struct {
+		Time        string   `json:"time"`
+		Duration    string   `json:"duration"`
+		RowCount    int      `json:"rowCount"`
+		SeriesCount int      `json:"seriesCount"`
+		Error       string   `json:"error,omitempty"`
+		Warnings    []string `json:"warnings,omitempty"`
+	}
+
+	// kubernetesCrdResult is the validation result of a ResourceGraphQuery resource
+	kubernetesCrdResult struct {
+		module       string
+		queryName    string
+		errs         []error
+		reloadFailed bool
+	}
+)
+
+var (
+	// config fragments of the accepted ResourceGraphQuery resources
+	kubernetesCrdFragments      []kubernetesConfigFragment
+	kubernetesCrdFragmentsMutex sync.RWMutex
+)
+
+// isKubernetesCrdEnabled checks if ResourceGraphQuery resources are reconciled
+func isKubernetesCrdEnabled() bool {
+	return opts.Config.Kubernetes.Crd
+}
+
+// initKubernetesCrd reconciles the ResourceGraphQuery resources before the config is loaded, invalid resources
+// don't fail the startup (they are reported in their status)
+func initKubernetesCrd() error {
+	if !isKubernetesCrdEnabled() {
+		return nil
+	}
+
+	resources, err := listKubernetesResourceGraphQueries(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to list ResourceGraphQuery resources: %w", err)
+	}
+
+	fragments, _, err := reconcileKubernetesResourceGraphQueries(resources)
+	if err != nil {
+		return err
+	}
+	setKubernetesCrdFragments(fragments)
+
+	log.Infof("accepted %v of %v ResourceGraphQuery resources", len(fragments), len(resources))
+	return nil
+}
+
+// startKubernetesCrdController reconciles the ResourceGraphQuery resources periodically (polling, no watch), reloads
+// the config if the accepted resources are changed and updates the status of the resources
+func startKubernetesCrdController() {
+	if !isKubernetesCrdEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(opts.Config.Kubernetes.CrdInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := syncKubernetesResourceGraphQueries(context.Background()); err != nil {
+				logRateLimiter.Error(log.WithField("crd", KubernetesCrdPlural+"."+KubernetesCrdGroup), err.Error())
+			}
+
+			select {
+			case <-ticker.C:
+			case <-lifecycleQuit:
+				return
+			}
+		}
+	}()
+}
+
+func getKubernetesCrdFragments() []kubernetesConfigFragment {
+	kubernetesCrdFragmentsMutex.RLock()
+	defer kubernetesCrdFragmentsMutex.RUnlock()
+	return kubernetesCrdFragments
+}
+
+func setKubernetesCrdFragments(fragments []kubernetesConfigFragment) {
+	kubernetesCrdFragmentsMutex.Lock()
+	defer kubernetesCrdFragmentsMutex.Unlock()
+	kubernetesCrdFragments = fragments
+}
+
+// syncKubernetesResourceGraphQueries runs one reconciliation of the ResourceGraphQuery resources
+func syncKubernetesResourceGraphQueries(ctx context.Context) error {
+	resources, err := listKubernetesResourceGraphQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list ResourceGraphQuery resources: %w", err)
+	}
+
+	fragments, results, err := reconcileKubernetesResourceGraphQueries(resources)
+	if err != nil {
+		return err
+	}
+
+	previous := getKubernetesCrdFragments()
+	if !reflect.DeepEqual(previous, fragments) {
+		log.Infof("ResourceGraphQuery resources changed (%v accepted, %v rejected), reloading config", len(fragments), len(resources)-len(fragments))
+		setKubernetesCrdFragments(fragments)
+		if errs := reloadConfig(); len(errs) > 0 {
+			setKubernetesCrdFragments(previous)
+
+			// resources which were not active before are not active now
+			active := map[string]bool{}
+			for _, fragment := range previous {
+				active[fragment.Source] = true
+			}
+			for source, result := range results {
+				if len(result.errs) == 0 && !active[source] {
+					result.errs = errs
+					result.reloadFailed = true
+					results[source] = result
+				}
+			}
+
+			for _, err := range errs {
+				log.Errorf("config reload failed, keeping previous ResourceGraphQuery resources: %v", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, resource := range resources {
+		result := results[resource.source()]
+		status := resource.buildStatus(result, now)
+		if reflect.DeepEqual(resource.Status, status) {
+			continue
+		}
+
+		contextLogger := log.WithFields(log.Fields{"namespace": resource.Metadata.Namespace, "name": resource.Metadata.Name})
+		if len(result.errs) > 0 {
+			contextLogger.Warnf("ResourceGraphQuery rejected: %v", status.Conditions[0].Message)
+		}
+		if err := patchKubernetesResourceGraphQueryStatus(ctx, resource, status); err != nil {
+			contextLogger.Errorf("unable to update ResourceGraphQuery status: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileKubernetesResourceGraphQueries validates the resources one by one on top of the config (config file,
+// ConfigMaps and the resources accepted before), resources with errors are rejected and don't affect the others
+func reconcileKubernetesResourceGraphQueries(resources []kubernetesResourceGraphQuery) ([]kubernetesConfigFragment, map[string]kubernetesCrdResult, error) {
+	if _, errs := buildConfig(nil); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("config is invalid, ResourceGraphQuery resources are not reconciled: %w", errs[0])
+	}
+
+	var fragments []kubernetesConfigFragment
+	results := map[string]kubernetesCrdResult{}
+	for _, resource := range resources {
+		result := kubernetesCrdResult{}
+
+		if len(resource.Spec) == 0 || string(resource.Spec) == "null" {
+			result.errs = []error{errors.New("spec is empty")}
+			results[resource.source()] = result
+			continue
+		}
+
+		// resources are an untrusted source, parse errors are reported by the config validation
+		if fields, err := config.ParseRestrictedFields(resource.Spec); err == nil && len(fields) > 0 {
+			result.errs = []error{fmt.Errorf("%v not allowed in ResourceGraphQuery resources (only in config and query files)", strings.Join(fields, ", "))}
+			results[resource.source()] = result
+			continue
+		}
+
+		fragment := resource.fragment()
+		candidate, errs := buildConfig(append(append([]kubernetesConfigFragment{}, fragments...), fragment))
+		if len(errs) == 0 {
+			fragments = append(fragments, fragment)
+			if queryConfig, err := candidate.ParseQuery(resource.Spec); err == nil {
+				result.module = queryConfig.Module
+				result.queryName = queryConfig.GetName()
+			}
+		}
+		result.errs = errs
+		results[resource.source()] = result
+	}
+
+	return fragments, results, nil
+}
+
+// listKubernetesResourceGraphQueries lists the ResourceGraphQuery resources (sorted by namespace and name)
+func listKubernetesResourceGraphQueries(ctx context.Context) ([]kubernetesResourceGraphQuery, error) {
+	path := fmt.Sprintf("/apis/%s/%s/%s", KubernetesCrdGroup, KubernetesCrdVersion, KubernetesCrdPlural)
+	if opts.Config.Kubernetes.CrdNamespace != "" {
+		path = fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", KubernetesCrdGroup, KubernetesCrdVersion, url.PathEscape(opts.Config.Kubernetes.CrdNamespace), KubernetesCrdPlural)
+	}
+
+	body, err := kubernetesRequest(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list := kubernetesResourceGraphQueryList{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("unable to decode ResourceGraphQuery list: %w", err)
+	}
+
+	// stable order for change detection and query order
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].source() < list.Items[j].source()
+	})
+
+	return list.Items, nil
+}
+
+// patchKubernetesResourceGraphQueryStatus updates the status subresource of the resource
+func patchKubernetesResourceGraphQueryStatus(ctx context.Context, resource kubernetesResourceGraphQuery, status kubernetesResourceGraphQueryStatus) error {
+	content, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf(
+		"/apis/%s/%s/namespaces/%s/%s/%s/status",
+		KubernetesCrdGroup,
+		KubernetesCrdVersion,
+		url.PathEscape(resource.Metadata.Namespace),
+		KubernetesCrdPlural,
+		url.PathEscape(resource.Metadata.Name),
+	)
+	_, err = kubernetesRequest(ctx, http.MethodPatch, path, "application/merge-patch+json", content)
+	return err
+}
+
+func (r kubernetesResourceGraphQuery) source() string {
+	return fmt.Sprintf("resourcegraphquery/%s/%s", r.Metadata.Namespace, r.Metadata.Name)
+}
+
+// fragment returns the spec as config fragment with one query (json is valid yaml)
+func (r kubernetesResourceGraphQuery) fragment() kubernetesConfigFragment {
+	return kubernetesConfigFragment{
+		Source:  r.source(),
+		Content: `{"queries":[` + string(r.Spec) + `]}`,
+	}
+}
+
+// buildStatus returns the Ready condition of the validation result and the last execution of accepted queries,
+// the transition time is kept if the condition status is not changed
+func (r kubernetesResourceGraphQuery) buildStatus(result kubernetesCrdResult, now time.Time) kubernetesResourceGraphQueryStatus {
+	condition := kubernetesCondition{
+		Type:    KubernetesCrdConditionReady,
+		Status:  "True",
+		Reason:  KubernetesCrdReasonAccepted,
+		Message: "query is active",
+	}
+	if len(result.errs) > 0 {
+		messages := []string{}
+		for _, err := range result.errs {
+			messages = append(messages, err.Error())
+		}
+		condition.Status = "False"
+		condition.Reason = KubernetesCrdReasonInvalidSpec
+		if result.reloadFailed {
+			condition.Reason = KubernetesCrdReasonReloadFailed
+		}
+		condition.Message = strings.Join(messages, "; ")
+	}
+
+	condition.LastTransitionTime = now.UTC().Format(time.RFC3339)
+	for _, previous := range r.Status.Conditions {
+		if previous.Type == condition.Type && previous.Status == condition.Status {
+			condition.LastTransitionTime = previous.LastTransitionTime
+		}
+	}
+
+	status := kubernetesResourceGraphQueryStatus{
+		ObservedGeneration: r.Metadata.Generation,
+		Conditions:         []kubernetesCondition{condition},
+	}
+	if len(result.errs) == 0 && result.queryName != "" {
+		status.LastRun = getKubernetesResourceGraphQueryRun(result.module, result.queryName)
+	}
+	return status
+}
+
+// getKubernetesResourceGraphQueryRun returns the last execution of the query, nil if it wasn't executed yet
+func getKubernetesResourceGraphQueryRun(module, queryName string) *kubernetesResourceGraphQueryRun {
+	queryDebugInfosMutex.RLock()
+	debugInfo, exists := queryDebugInfos[module+"/"+queryName]
+	queryDebugInfosMutex.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	debugInfo.mutex.Lock()
+	defer debugInfo.mutex.Unlock()
+
+	run := &kubernetesResourceGraphQueryRun{
+		Time:        debugInfo.Time.UTC().Format(time.RFC3339),
+		Duration:    debugInfo.Duration,
+		RowCount:    debugInfo.RowCount,
+		SeriesCount: debugInfo.SeriesCount,
+		Error:       debugInfo.Error,
+	}
+	if len(debugInfo.Warnings) > 0 {
+		run.Warnings = append([]string{}, debugInfo.Warnings...)
+	}
+	return run
+}
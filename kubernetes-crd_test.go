@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestKubernetesResourceGraphQuery(name, spec string) kubernetesResourceGraphQuery {
+	resource := kubernetesResourceGraphQuery{Spec: json.RawMessage(spec)}
+	resource.Metadata.Name = name
+	resource.Metadata.Namespace = "team-a"
+	resource.Metadata.Generation = 1
+	return resource
+}
+
+func TestReconcileKubernetesResourceGraphQueriesRestrictedFields(t *testing.T) {
+	queryFile := filepath.Join(t.TempDir(), "queries.yaml")
+	if err := ioutil.WriteFile(queryFile, []byte("queries:\n  - metric: azure_resources\n    query: resources | summarize count()\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Config.Queries = []string{queryFile}
+	opts.Metrics.Builtin.Disable = true
+	defer func() {
+		opts.Config.Queries = nil
+		opts.Metrics.Builtin.Disable = false
+	}()
+
+	resources := []kubernetesResourceGraphQuery{
+		newTestKubernetesResourceGraphQuery("valid", `{"metric": "azure_team_a_valid", "module": "team-a", "query": "resources | summarize count()"}`),
+		newTestKubernetesResourceGraphQuery("unsafe", `{"metric": "azure_team_a_unsafe", "module": "team-a", "query": "resources | summarize count()", "unsafe": true}`),
+		newTestKubernetesResourceGraphQuery("identity", `{"metric": "azure_team_a_identity", "module": "team-a", "query": "resources | summarize count()", "identity": "admin"}`),
+	}
+
+	fragments, results, err := reconcileKubernetesResourceGraphQueries(resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fragments) != 1 || fragments[0].Source != "resourcegraphquery/team-a/valid" {
+		t.Fatalf("expected only the valid resource to be accepted, got %+v", fragments)
+	}
+
+	now := time.Now()
+	for _, testCase := range []struct {
+		resource kubernetesResourceGraphQuery
+		reason   string
+		message  string
+	}{
+		{resource: resources[0], reason: KubernetesCrdReasonAccepted, message: "query is active"},
+		{resource: resources[1], reason: KubernetesCrdReasonInvalidSpec, message: "unsafe not allowed in ResourceGraphQuery resources"},
+		{resource: resources[2], reason: KubernetesCrdReasonInvalidSpec, message: "identity not allowed in ResourceGraphQuery resources"},
+	} {
+		condition := testCase.resource.buildStatus(results[testCase.resource.source()], now).Conditions[0]
+		if condition.Reason != testCase.reason || !strings.Contains(condition.Message, testCase.message) {
+			t.Errorf("%v: expected condition %v (%v), got %v (%v)", testCase.resource.source(), testCase.reason, testCase.message, condition.Reason, condition.Message)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	LandingPageEndpoint struct {
+		Path        string
+		Description string
+		Link        bool
+	}
+)
+
+var (
+	landingPageHeaders = map[string]string{
+		"Referrer-Policy":        "same-origin",
+		"X-Frame-Options":        "DENY",
+		"X-Content-Type-Options": "nosniff",
+	}
+
+	landingPageEndpoints = []LandingPageEndpoint{
+		{Path: "/metrics", Description: "Exporter metrics", Link: true},
+		{Path: "/probe", Description: "Execute ResourceGraph queries (module, profile, cache, interval and param.* parameters)", Link: true},
+		{Path: "/query", Description: "Query UI", Link: true},
+		{Path: "/livez", Description: "Liveness check (?verbose, ?format=json)", Link: true},
+		{Path: "/readyz", Description: "Readiness check (?verbose, ?format=json)", Link: true},
+		{Path: "/healthz", Description: "Health check (deprecated, same as /livez)", Link: true},
+		{Path: "/-/healthy", Description: "Health check", Link: true},
+		{Path: "/-/ready", Description: "Readiness check", Link: true},
+		{Path: "/-/reload", Description: "Reload config (POST, requires --web.enable-lifecycle)"},
+		{Path: "/-/quit", Description: "Graceful shutdown (POST, requires --web.enable-lifecycle)"},
+		{Path: "/api/config", Description: "Effective runtime configuration (requires api token)"},
+		{Path: "/api/loglevel", Description: "Current (GET), change (PUT ?level=debug&duration=15m) or reset (DELETE) the log level (requires api token)"},
+		{Path: "/api/load", Description: "Current load as scaling signal (in-flight probes and queries, queue depth, probe latency, requires api token)"},
+		{Path: "/api/cache", Description: "List (GET) or invalidate (DELETE) cache entries (requires api token)"},
+		{Path: "/api/cache/{query}", Description: "List (GET) or invalidate (DELETE) cached results of a query (requires api token)"},
+		{Path: "/api/snapshot", Description: "Materialized metrics (cached probe results) as json for regression tests (requires api token)"},
+	}
+)
+
+// newLandingPageHandler serves the exporter-toolkit landing page at / and 404 for all other unknown paths,
+// the page is built per request as the modules change on config reloads
+func newLandingPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		landingPage, err := web.NewLandingPage(buildLandingConfig(getConfig().GetModules()))
+		if err != nil {
+			log.Error(err)
+			http.Error(w, "unable to build landing page", http.StatusInternalServerError)
+			return
+		}
+
+		// headers of the web config (http_server_config.headers) take precedence
+		for headerName, headerValue := range landingPageHeaders {
+			if w.Header().Get(headerName) == "" {
+				w.Header().Set(headerName, headerValue)
+			}
+		}
+		landingPage.ServeHTTP(w, r)
+	}
+}
+
+// buildLandingConfig builds the landing page with build info, endpoints (endpoints not requested via GET
+// are listed without link) and modules
+func buildLandingConfig(modules []string) web.LandingConfig {
+	landingConfig := web.LandingConfig{
+		Name:        "azure-resourcegraph-exporter",
+		Description: "Prometheus exporter for Azure ResourceGraph queries",
+		Version:     gitTag + " (" + gitCommit + ", " + runtime.Version() + ")",
+		Form: web.LandingForm{
+			Action: "/probe",
+			Inputs: []web.LandingFormInput{
+				{Label: "Module", Type: "text", Name: "module", Placeholder: "module"},
+			},
+		},
+	}
+
+	extraHTML := strings.Builder{}
+	extraHTML.WriteString("<h2>API and lifecycle</h2><ul>")
+	for _, endpoint := range landingPageEndpoints {
+		if endpoint.Link {
+			landingConfig.Links = append(landingConfig.Links, web.LandingLinks{Address: endpoint.Path, Text: endpoint.Path, Description: endpoint.Description})
+			continue
+		}
+		extraHTML.WriteString("<li><code>" + html.EscapeString(endpoint.Path) + "</code>: " + html.EscapeString(endpoint.Description) + "</li>")
+	}
+	extraHTML.WriteString("</ul>")
+
+	extraHTML.WriteString("<h2>Modules</h2><ul>")
+	for _, module := range modules {
+		name := html.EscapeString(module)
+		if module == "" {
+			name = "<i>(default)</i>"
+		}
+		extraHTML.WriteString(`<li><a href="/probe?module=` + html.EscapeString(url.QueryEscape(module)) + `">` + name + "</a></li>")
+	}
+	extraHTML.WriteString("</ul>")
+	landingConfig.ExtraHTML = extraHTML.String()
+
+	return landingConfig
+}
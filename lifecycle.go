@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LifecycleShutdownTimeout = 30 * time.Second
+)
+
+var (
+	lifecycleQuit     = make(chan struct{})
+	lifecycleQuitOnce sync.Once
+	lifecycleReload   sync.Mutex
+)
+
+// startLifecycleHandler reloads the config on SIGHUP and shuts down the server on quit requests
+func startLifecycleHandler(server *http.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				log.Infof("received SIGHUP, reloading config")
+				if errs := reloadConfig(); len(errs) > 0 {
+					for _, err := range errs {
+						log.Errorf("config reload failed: %v", err)
+					}
+				}
+			case <-lifecycleQuit:
+				log.Infof("shutting down http server")
+				systemdNotify(SystemdNotifyStopping)
+				ctx, cancel := context.WithTimeout(context.Background(), LifecycleShutdownTimeout)
+				if err := server.Shutdown(ctx); err != nil {
+					log.Error(err)
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+}
+
+// reloadConfig loads, validates and activates the config file; the current config is kept on errors
+func reloadConfig() []error {
+	lifecycleReload.Lock()
+	defer lifecycleReload.Unlock()
+
+	systemdNotify(SystemdNotifyReloading)
+	defer systemdNotify(SystemdNotifyReady)
+
+	newConfig, errs := loadConfig()
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if errs := validateWebConfig(); len(errs) > 0 {
+		return errs
+	}
+
+	setConfig(newConfig)
+	metricCache.Flush()
+	log.Infof("config reloaded (%v queries)", len(newConfig.Queries))
+	return nil
+}
+
+// lifecycleEnabled checks if lifecycle requests are allowed and the http method is valid
+func lifecycleEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if !opts.Web.EnableLifecycle {
+		http.Error(w, "lifecycle api is disabled, set --web.enable-lifecycle to enable", http.StatusForbidden)
+		return false
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	return true
+}
+
+func handleLifecycleHealthy(w http.ResponseWriter, r *http.Request) {
+	if _, err := fmt.Fprint(w, "Healthy"); err != nil {
+		log.Error(err)
+	}
+}
+
+// handleLifecycleReady reports readiness, the exporter is not ready until the Azure connection is initialized (see --azure.lazy-init)
+// and while shutting down (same checks as /readyz)
+func handleLifecycleReady(w http.ResponseWriter, r *http.Request) {
+	for _, check := range readinessChecks {
+		if err := check.Check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "Ready"); err != nil {
+		log.Error(err)
+	}
+}
+
+func handleLifecycleReload(w http.ResponseWriter, r *http.Request) {
+	if !lifecycleEnabled(w, r) {
+		return
+	}
+
+	log.Infof("received reload request, reloading config")
+	if errs := reloadConfig(); len(errs) > 0 {
+		msg := "config reload failed:"
+		for _, err := range errs {
+			log.Errorf("config reload failed: %v", err)
+			msg += "\n" + err.Error()
+		}
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := fmt.Fprint(w, "Config reloaded"); err != nil {
+		log.Error(err)
+	}
+}
+
+func handleLifecycleQuit(w http.ResponseWriter, r *http.Request) {
+	if !lifecycleEnabled(w, r) {
+		return
+	}
+
+	log.Infof("received quit request")
+	if _, err := fmt.Fprint(w, "Requesting termination... Goodbye!"); err != nil {
+		log.Error(err)
+	}
+
+	requestShutdown()
+}
+
+// requestShutdown triggers the graceful shutdown of the http server
+func requestShutdown() {
+	lifecycleQuitOnce.Do(func() {
+		close(lifecycleQuit)
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/subscriptions"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	LighthouseLabelTenantID          = "tenantID"
+	LighthouseLabelManagedByTenantID = "managedByTenantID"
+
+	ResourceGraphSubscriptionIdField = "subscriptionId"
+)
+
+type (
+	AzureSubscriptionTenant struct {
+		TenantID          string
+		ManagedByTenantID string
+		Delegated         bool
+	}
+)
+
+var (
+	// tenant of the authenticated identity (managing tenant for Azure Lighthouse)
+	AzureTenantID = os.Getenv("AZURE_TENANT_ID")
+
+	// tenant information per (lowercase) subscription id
+	AzureSubscriptionTenants = map[string]AzureSubscriptionTenant{}
+)
+
+// isDelegatedSubscription detects Azure Lighthouse delegated subscriptions (subscriptions from a customer tenant)
+func isDelegatedSubscription(subscription subscriptions.Subscription) bool {
+	if AzureTenantID != "" && subscription.TenantID != nil {
+		return !strings.EqualFold(*subscription.TenantID, AzureTenantID)
+	}
+
+	return subscription.ManagedByTenants != nil && len(*subscription.ManagedByTenants) > 0
+}
+
+// buildSubscriptionTenantMap collects tenant information and filters to delegated subscriptions (if enabled)
+func buildSubscriptionTenantMap() {
+	AzureSubscriptionTenants = map[string]AzureSubscriptionTenant{}
+
+	subscriptionList := []subscriptions.Subscription{}
+	for _, subscription := range AzureSubscriptions {
+		if subscription.SubscriptionID == nil {
+			continue
+		}
+
+		delegated := isDelegatedSubscription(subscription)
+		if opts.Azure.Lighthouse.DelegatedOnly && !delegated {
+			continue
+		}
+
+		tenant := AzureSubscriptionTenant{
+			Delegated: delegated,
+		}
+		if subscription.TenantID != nil {
+			tenant.TenantID = *subscription.TenantID
+		}
+		if subscription.ManagedByTenants != nil {
+			managedByTenantIds := []string{}
+			for _, managedByTenant := range *subscription.ManagedByTenants {
+				if managedByTenant.TenantID != nil {
+					managedByTenantIds = append(managedByTenantIds, *managedByTenant.TenantID)
+				}
+			}
+			tenant.ManagedByTenantID = strings.Join(managedByTenantIds, ",")
+		}
+
+		AzureSubscriptionTenants[strings.ToLower(*subscription.SubscriptionID)] = tenant
+		subscriptionList = append(subscriptionList, subscription)
+	}
+	AzureSubscriptions = subscriptionList
+}
+
+// addSubscriptionTenantLabels adds customer and managing tenant labels based on the subscriptionId column of the row
+func addSubscriptionTenantLabels(row map[string]interface{}, metricList map[string][]kusto.MetricRow) {
+	subscriptionId, ok := row[ResourceGraphSubscriptionIdField].(string)
+	if !ok {
+		return
+	}
+
+	tenant, ok := AzureSubscriptionTenants[strings.ToLower(subscriptionId)]
+	if !ok {
+		return
+	}
+
+	for metricName := range metricList {
+		for i := range metricList[metricName] {
+			metricList[metricName][i].Labels[LighthouseLabelTenantID] = tenant.TenantID
+			metricList[metricName][i].Labels[LighthouseLabelManagedByTenantID] = tenant.ManagedByTenantID
+		}
+	}
+}
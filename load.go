@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// ApiLoadResponse summarizes the current load of the exporter (/api/load), eg. as scaling signal for KEDA or HPA
+	ApiLoadResponse struct {
+		// in-flight probe executions and queries (incl. cache refresh and warmup)
+		InflightProbes  int64 `json:"inflightProbes"`
+		InflightQueries int64 `json:"inflightQueries"`
+
+		// probe requests waiting for an in-flight execution plus query results waiting for the export
+		QueueDepth int64        `json:"queueDepth"`
+		Queue      ApiLoadQueue `json:"queue"`
+
+		// average execution time of the probes finished within the window
+		ProbeLatencyAvgSeconds float64 `json:"probeLatencyAvgSeconds"`
+		ProbeCount             int     `json:"probeCount"`
+		Window                 string  `json:"window"`
+	}
+
+	ApiLoadQueue struct {
+		WaitingProbes int64 `json:"waitingProbes"`
+		Export        int64 `json:"export"`
+	}
+
+	// loadLatencyWindow keeps the execution times of the probes finished within the window (--api.load.window)
+	loadLatencyWindow struct {
+		samples []loadLatencySample
+		mutex   sync.Mutex
+	}
+
+	loadLatencySample struct {
+		time     time.Time
+		duration time.Duration
+	}
+)
+
+var (
+	loadInflightProbes  int64
+	loadInflightQueries int64
+	loadWaitingProbes   int64
+	loadProbeLatency    = &loadLatencyWindow{}
+)
+
+// initLoadMetrics registers the load of the exporter as metrics (same values as /api/load)
+func initLoadMetrics() {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "azure_resourcegraph_load_inflight_probes",
+				Help: "Azure ResourceGraph number of in-flight probe executions",
+			},
+			func() float64 {
+				return float64(atomic.LoadInt64(&loadInflightProbes))
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "azure_resourcegraph_load_inflight_queries",
+				Help: "Azure ResourceGraph number of in-flight queries",
+			},
+			func() float64 {
+				return float64(atomic.LoadInt64(&loadInflightQueries))
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "azure_resourcegraph_load_queue_depth",
+				Help: "Azure ResourceGraph number of probe requests waiting for an in-flight execution and queued query exports",
+			},
+			func() float64 {
+				queue := getLoadQueue()
+				return float64(queue.WaitingProbes + queue.Export)
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "azure_resourcegraph_load_probe_latency_avg_seconds",
+				Help: "Azure ResourceGraph average probe execution time within --api.load.window",
+			},
+			func() float64 {
+				avg, _ := loadProbeLatency.Average()
+				return avg.Seconds()
+			},
+		),
+	)
+}
+
+// trackProbeExecution counts the probe as in-flight until the returned function is called, which records the execution time
+func trackProbeExecution() func() {
+	startTime := time.Now()
+	atomic.AddInt64(&loadInflightProbes, 1)
+	return func() {
+		atomic.AddInt64(&loadInflightProbes, -1)
+		loadProbeLatency.Add(time.Since(startTime))
+	}
+}
+
+// trackQueryExecution counts the query as in-flight until the returned function is called
+func trackQueryExecution() func() {
+	atomic.AddInt64(&loadInflightQueries, 1)
+	return func() {
+		atomic.AddInt64(&loadInflightQueries, -1)
+	}
+}
+
+func getLoadQueue() ApiLoadQueue {
+	queue := ApiLoadQueue{WaitingProbes: atomic.LoadInt64(&loadWaitingProbes)}
+	if isQueryExportEnabled() {
+		queue.Export = int64(len(queryExporter.queue))
+	}
+	return queue
+}
+
+func getLoad() ApiLoadResponse {
+	queue := getLoadQueue()
+	avg, count := loadProbeLatency.Average()
+	return ApiLoadResponse{
+		InflightProbes:         atomic.LoadInt64(&loadInflightProbes),
+		InflightQueries:        atomic.LoadInt64(&loadInflightQueries),
+		QueueDepth:             queue.WaitingProbes + queue.Export,
+		Queue:                  queue,
+		ProbeLatencyAvgSeconds: avg.Seconds(),
+		ProbeCount:             count,
+		Window:                 opts.Api.Load.Window.String(),
+	}
+}
+
+// Add records the execution time of a finished probe
+func (l *loadLatencyWindow) Add(duration time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.samples = append(l.samples, loadLatencySample{time: time.Now(), duration: duration})
+	l.expire()
+}
+
+// Average returns the average execution time and the number of probes finished within the window
+func (l *loadLatencyWindow) Average() (time.Duration, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.expire()
+	if len(l.samples) == 0 {
+		return 0, 0
+	}
+
+	sum := time.Duration(0)
+	for _, sample := range l.samples {
+		sum += sample.duration
+	}
+	return sum / time.Duration(len(l.samples)), len(l.samples)
+}
+
+// expire removes the samples older than the window, samples are ordered by time
+func (l *loadLatencyWindow) expire() {
+	expiry := time.Now().Add(-opts.Api.Load.Window)
+	i := 0
+	for i < len(l.samples) && l.samples[i].time.Before(expiry) {
+		i++
+	}
+	l.samples = l.samples[i:]
+}
+
+// handleApiLoad returns the current load of the exporter
+func handleApiLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeApiJson(w, getLoad())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// ApiLogLevelResponse is the current log level (/api/loglevel)
+	ApiLogLevelResponse struct {
+		Level   string `json:"level"`
+		Default string `json:"default"`
+		// ResetAt is empty if the level is not reset automatically
+		ResetAt string `json:"resetAt,omitempty"`
+	}
+)
+
+var (
+	// log level set by the flags on startup (--verbose, --debug)
+	logLevelDefault = log.InfoLevel
+
+	logLevelMutex      sync.Mutex
+	logLevelResetTimer *time.Timer
+	logLevelResetAt    time.Time
+)
+
+// initLogLevel remembers the startup log level and starts the signal handler (SIGUSR1 more verbose, SIGUSR2 reset)
+func initLogLevel() {
+	logLevelDefault = log.GetLevel()
+	startLogLevelSignalHandler()
+}
+
+// setLogLevel changes the log level at runtime, the startup level is restored after the duration (0 = permanent)
+func setLogLevel(level log.Level, duration time.Duration, source string) {
+	logLevelMutex.Lock()
+	defer logLevelMutex.Unlock()
+
+	stopLogLevelResetTimer()
+	if duration > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(duration, func() {
+			logLevelMutex.Lock()
+			defer logLevelMutex.Unlock()
+
+			// the level might have been changed again while the timer fired
+			if logLevelResetTimer == timer {
+				restoreLogLevel("timeout")
+			}
+		})
+		logLevelResetTimer = timer
+		logLevelResetAt = time.Now().Add(duration)
+	}
+
+	log.SetLevel(level)
+	if duration > 0 {
+		log.Warnf("log level changed to %v by %v, reset to %v in %v", level, source, logLevelDefault, duration)
+	} else {
+		log.Warnf("log level changed to %v by %v", level, source)
+	}
+}
+
+// resetLogLevel restores the startup log level
+func resetLogLevel(source string) {
+	logLevelMutex.Lock()
+	defer logLevelMutex.Unlock()
+
+	restoreLogLevel(source)
+}
+
+func restoreLogLevel(source string) {
+	stopLogLevelResetTimer()
+	log.SetLevel(logLevelDefault)
+	log.Warnf("log level reset to %v by %v", logLevelDefault, source)
+}
+
+func stopLogLevelResetTimer() {
+	if logLevelResetTimer != nil {
+		logLevelResetTimer.Stop()
+		logLevelResetTimer = nil
+	}
+	logLevelResetAt = time.Time{}
+}
+
+// increaseLogLevel switches to the next more verbose level (info, debug, trace)
+func increaseLogLevel(source string) {
+	level := log.GetLevel()
+	if level < log.TraceLevel {
+		level++
+	}
+	setLogLevel(level, 0, source)
+}
+
+// handleApiLogLevel returns (GET), changes (PUT with ?level= and optional ?duration=) or resets (DELETE) the log level
+func handleApiLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level, err := log.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid level: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		duration := time.Duration(0)
+		if value := r.URL.Query().Get("duration"); value != "" {
+			if duration, err = time.ParseDuration(value); err != nil || duration < 0 {
+				http.Error(w, fmt.Sprintf("invalid duration \"%v\"", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		setLogLevel(level, duration, "api ("+r.RemoteAddr+")")
+	case http.MethodDelete:
+		resetLogLevel("api (" + r.RemoteAddr + ")")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	logLevelMutex.Lock()
+	response := ApiLogLevelResponse{
+		Level:   log.GetLevel().String(),
+		Default: logLevelDefault.String(),
+	}
+	if !logLevelResetAt.IsZero() {
+		response.ResetAt = logLevelResetAt.Format(time.RFC3339)
+	}
+	logLevelMutex.Unlock()
+
+	writeApiJson(w, response)
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// startLogLevelSignalHandler switches to the next more verbose log level on SIGUSR1 and resets the level on SIGUSR2
+func startLogLevelSignalHandler() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				increaseLogLevel("SIGUSR1")
+			case syscall.SIGUSR2:
+				resetLogLevel("SIGUSR2")
+			}
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package main
+
+// startLogLevelSignalHandler is not supported on windows (no SIGUSR1/SIGUSR2), use /api/loglevel
+func startLogLevelSignalHandler() {}
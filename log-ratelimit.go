@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// LogRateLimiter logs recurring messages only once per interval and summarizes suppressed repetitions
+	LogRateLimiter struct {
+		interval time.Duration
+		mutex    sync.Mutex
+		entries  map[string]*logRateLimiterEntry
+	}
+
+	logRateLimiterEntry struct {
+		logger     *log.Entry
+		level      log.Level
+		message    string
+		lastSeen   time.Time
+		suppressed int
+	}
+)
+
+var (
+	logRateLimiter *LogRateLimiter
+)
+
+func initLogRateLimiter() {
+	logRateLimiter = NewLogRateLimiter(opts.Logger.RateLimitInterval)
+}
+
+// NewLogRateLimiter creates a rate limiter, an interval of 0 disables rate limiting
+func NewLogRateLimiter(interval time.Duration) *LogRateLimiter {
+	limiter := &LogRateLimiter{
+		interval: interval,
+		entries:  map[string]*logRateLimiterEntry{},
+	}
+
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				limiter.flush()
+			}
+		}()
+	}
+
+	return limiter
+}
+
+// Error logs an error message, repetitions within the interval are only logged at debug level
+func (l *LogRateLimiter) Error(logger *log.Entry, message string) {
+	l.log(logger, log.ErrorLevel, message)
+}
+
+// Warn logs a warning message, repetitions within the interval are only logged at debug level
+func (l *LogRateLimiter) Warn(logger *log.Entry, message string) {
+	l.log(logger, log.WarnLevel, message)
+}
+
+func (l *LogRateLimiter) log(logger *log.Entry, level log.Level, message string) {
+	if l.interval <= 0 {
+		logger.Log(level, message)
+		return
+	}
+
+	key := logRateLimiterKey(logger, level, message)
+
+	l.mutex.Lock()
+	entry, exists := l.entries[key]
+	if !exists {
+		entry = &logRateLimiterEntry{
+			logger:  logger,
+			level:   level,
+			message: message,
+		}
+		l.entries[key] = entry
+	}
+	entry.lastSeen = time.Now()
+	if exists {
+		entry.suppressed++
+	}
+	l.mutex.Unlock()
+
+	if exists {
+		logger.WithField("suppressed", true).Debug(message)
+	} else {
+		logger.Log(level, message)
+	}
+}
+
+// flush logs a summary for suppressed messages and forgets messages which did not occur in the last interval
+func (l *LogRateLimiter) flush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, entry := range l.entries {
+		if entry.suppressed > 0 {
+			entry.logger.Log(entry.level, fmt.Sprintf("%v (repeated %v times in the last %v)", entry.message, entry.suppressed, l.interval))
+			entry.suppressed = 0
+		} else if time.Since(entry.lastSeen) >= l.interval {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// logRateLimiterKey builds the identity of a message from level, message and logger fields
+func logRateLimiterKey(logger *log.Entry, level log.Level, message string) string {
+	fieldNames := make([]string, 0, len(logger.Data))
+	for name := range logger.Data {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+
+	parts := []string{level.String(), message}
+	for _, name := range fieldNames {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, logger.Data[name]))
+	}
+	return strings.Join(parts, "\x00")
+}
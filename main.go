@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -10,19 +11,17 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/subscriptions"
 	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/google/uuid"
 	"github.com/jessevdk/go-flags"
 	cache "github.com/patrickmn/go-cache"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	log "github.com/sirupsen/logrus"
 	"github.com/webdevops/go-prometheus-common/azuretracing"
-	"github.com/webdevops/go-prometheus-common/kusto"
 
 	"github.com/webdevops/azure-resourcegraph-exporter/config"
 )
@@ -31,17 +30,20 @@ const (
 	Author = "webdevops.io"
 
 	UserAgent = "azure-resourcegraph-exporter/"
+
+	MetricCacheDefaultExpiration = 120 * time.Second
+	MetricCacheCleanupInterval   = 60 * time.Second
 )
 
 var (
 	argparser *flags.Parser
 	opts      config.Opts
 
-	Config kusto.Config
+	// current config, replaced on reload (use getConfig())
+	Config      *config.Config
+	configMutex sync.RWMutex
 
-	AzureAuthorizer    autorest.Authorizer
 	AzureSubscriptions []subscriptions.Subscription
-	AzureEnvironment   azure.Environment
 
 	metricCache *cache.Cache
 
@@ -53,17 +55,103 @@ var (
 func main() {
 	initArgparser()
 
+	if opts.Service.Action != "" {
+		if err := handleServiceAction(run); err != nil {
+			log.Error(err)
+			os.Exit(ExitCodeFlags)
+		}
+		os.Exit(ExitCodeOk)
+	}
+
+	run()
+}
+
+// run starts the exporter and blocks until the http server is stopped
+func run() {
 	log.Infof("starting azure-resourcegraph-exporter v%s (%s; %s; by %v)", gitTag, gitCommit, runtime.Version(), Author)
-	log.Info(string(opts.GetJson()))
+	logStartupOptions()
+	if isChaosEnabled() {
+		log.Warnf("chaos testing enabled, injecting faults into ResourceGraph requests (latency %v + jitter %v, throttle ratio %v, error ratio %v)", opts.Chaos.Latency, opts.Chaos.LatencyJitter, opts.Chaos.ThrottleRatio, opts.Chaos.ErrorRatio)
+	}
+	initRuntimeTuning()
 	initGlobalMetrics()
-
-	metricCache = cache.New(120*time.Second, 60*time.Second)
+	initRuntimeMetrics()
+	initLoadMetrics()
+	initMetricNameSanitizer()
+	initLogRateLimiter()
+	initLogLevel()
+
+	metricCache = cache.New(MetricCacheDefaultExpiration, MetricCacheCleanupInterval)
+	initCacheMetrics()
+
+	validation := StartupValidation{}
+	validation.Check("flags", ExitCodeFlags, validateFlags()...)
+	validation.Check("flags", ExitCodeFlags, initMetricNameFilter()...)
+	if len(validation.Problems) == 0 {
+		// export, audit log and disabled queries are only initialized with valid flags
+		validation.Check("flags", ExitCodeFlags, initQueryExport(), initAuditLog(), initQueryDisable())
+	}
 
 	log.Infof("loading config")
-	readConfig()
+	validation.Check("config", ExitCodeConfig, initKubernetesConfig())
+	validation.Check("config", ExitCodeConfig, initKubernetesCrd())
+	validation.Check("config", ExitCodeConfig, readConfig()...)
+
+	if opts.Azure.Mock != "" {
+		log.Infof("mock mode, using fixtures from %v", opts.Azure.Mock)
+		validation.Check("azure", ExitCodeAzure, initAzureClouds(), replaySubscriptions(opts.Azure.Mock))
+	} else if opts.Azure.Replay != "" {
+		log.Infof("replay mode, using recorded ResourceGraph responses from %v", opts.Azure.Replay)
+		validation.Check("azure", ExitCodeAzure, initAzureClouds(), replaySubscriptions(opts.Azure.Replay))
+	} else if isAzureLazyInit() && !opts.Validation.Validate {
+		log.Infof("init Azure in background (lazy init)")
+		validation.Check("azure", ExitCodeAzure, initAzureClouds())
+	} else if !opts.Validation.SkipAzureCheck {
+		log.Infof("init Azure")
+		validation.Check("azure", ExitCodeAzure, initAzureConnection()...)
+
+		if opts.Azure.Record != "" {
+			log.Infof("record mode, saving ResourceGraph responses to %v", opts.Azure.Record)
+			validation.Check("azure", ExitCodeAzure, recordSubscriptions())
+		}
+	}
+
+	validation.Finish()
+	if opts.Validation.Validate {
+		log.Infof("validation successful")
+		os.Exit(ExitCodeOk)
+	}
+
+	if isAzureLazyInit() {
+		startAzureLazyInit()
+	} else {
+		setAzureReady()
+	}
 
-	log.Infof("init Azure")
-	initAzureConnection()
+	startKubernetesConfigWatcher()
+	startKubernetesCrdController()
+
+	if isAzureReady() {
+		startCriticalQueries()
+	}
+
+	if opts.Cache.Warmup && isAzureReady() {
+		log.Infof("starting cache warmup")
+		startCacheWarmup()
+	}
+
+	if opts.Cache.Refresh.Enable && isAzureReady() {
+		log.Infof("starting background cache refresh")
+		startCacheRefresh()
+	}
+
+	if isOtlpExportEnabled() && isAzureReady() {
+		startOtlpExport()
+	}
+
+	if isBridgeExportEnabled() && isAzureReady() {
+		startBridgeExport()
+	}
 
 	log.Infof("starting http server on %s", opts.ServerBind)
 	startHttpServer()
@@ -72,19 +160,39 @@ func main() {
 // init argparser and parse/validate arguments
 func initArgparser() {
 	argparser = flags.NewParser(&opts, flags.Default)
+	argparser.SubcommandsOptional = true
+	initCommands()
 	_, err := argparser.Parse()
 
 	// check if there is an parse error
 	if err != nil {
 		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
 			os.Exit(0)
-		} else {
+		} else if ok {
 			fmt.Println()
 			argparser.WriteHelp(os.Stdout)
-			os.Exit(1)
+			os.Exit(ExitCodeFlags)
+		} else {
+			// subcommand failed
+			log.Error(err)
+			os.Exit(ExitCodeFlags)
 		}
 	}
 
+	// subcommand was executed
+	if argparser.Active != nil {
+		os.Exit(ExitCodeOk)
+	}
+
+	// print version
+	if opts.Version {
+		fmt.Printf("azure-resourcegraph-exporter %s\n", gitTag)
+		fmt.Printf("  revision:   %s\n", gitCommit)
+		fmt.Printf("  go version: %s\n", runtime.Version())
+		fmt.Printf("  platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		os.Exit(ExitCodeOk)
+	}
+
 	// verbose level
 	if opts.Logger.Verbose {
 		log.SetLevel(log.DebugLevel)
@@ -117,69 +225,131 @@ func initArgparser() {
 	}
 }
 
-func readConfig() {
-	Config = kusto.NewConfig(opts.Config.Path)
+func readConfig() (errs []error) {
+	newConfig, errs := loadConfig()
+	if len(errs) == 0 {
+		setConfig(newConfig)
+		logStartupConfig(newConfig)
+	}
+	return
+}
+
+// loadConfig loads and validates the config file without activating it
+func loadConfig() (*config.Config, []error) {
+	newConfig, errs := buildConfig(getKubernetesCrdFragments())
+	if newConfig == nil {
+		return nil, errs
+	}
 
-	if err := Config.Validate(); err != nil {
-		log.Panic(err)
+	for _, queryConfig := range newConfig.Queries {
+		if rewrites := queryConfig.GetGuardrailRewrites(); len(rewrites) > 0 {
+			log.WithField("query", queryConfig.GetName()).Warnf("query rewritten by guardrails %v: %v", strings.Join(rewrites, ", "), queryConfig.Query)
+		}
 	}
+
+	return newConfig, errs
+}
+
+// buildConfig loads the config file, merges the Kubernetes queries (ConfigMaps and the passed ResourceGraphQuery
+// resources) and the builtin queries and validates the result
+func buildConfig(crdFragments []kubernetesConfigFragment) (*config.Config, []error) {
+	newConfig, err := config.LoadConfig(opts)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	errs := mergeKubernetesConfig(&newConfig, crdFragments)
+
+	if !opts.Metrics.Builtin.Disable {
+		newConfig.AddBuiltinQueries(opts)
+	}
+
+	errs = append(errs, newConfig.Validate()...)
+
+	if _, err := newConfig.GetProfile(opts.Config.Profile); err != nil {
+		errs = append(errs, err)
+	}
+
+	return &newConfig, errs
+}
+
+// isConfigSet checks if a config file or query files are configured
+func isConfigSet() bool {
+	return opts.Config.Path != "" || len(opts.Config.Queries) > 0 || isKubernetesConfigEnabled() || isKubernetesCrdEnabled()
+}
+
+// getConfig returns the currently active config
+func getConfig() *config.Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return Config
+}
+
+// setConfig activates a new config
+func setConfig(newConfig *config.Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	Config = newConfig
 }
 
 // Init and build Azure authorzier
-func initAzureConnection() {
-	var err error
+func initAzureConnection() (errs []error) {
+	if err := initAzureClouds(); err != nil {
+		return []error{err}
+	}
+
+	return connectAzureClouds()
+}
+
+// connectAzureClouds creates the authorizers and fetches the subscriptions of all clouds
+func connectAzureClouds() (errs []error) {
 	ctx := context.Background()
 
-	// setup azure authorizer
-	AzureAuthorizer, err = auth.NewAuthorizerFromEnvironment()
-	if err != nil {
-		log.Panic(err)
+	AzureSubscriptions = []subscriptions.Subscription{}
+	for _, cloud := range AzureClouds {
+		subscriptionList, cloudErrs := cloud.connect(ctx)
+		errs = append(errs, cloudErrs...)
+		AzureSubscriptions = append(AzureSubscriptions, subscriptionList...)
 	}
 
-	AzureEnvironment, err = azure.EnvironmentFromName(*opts.Azure.Environment)
-	if err != nil {
-		log.Panic(err)
+	buildSubscriptionTenantMap()
+	if opts.Azure.Lighthouse.DelegatedOnly && len(AzureSubscriptions) == 0 {
+		errs = append(errs, errors.New("no Azure Lighthouse delegated subscriptions found"))
 	}
 
-	subscriptionsClient := subscriptions.NewClientWithBaseURI(AzureEnvironment.ResourceManagerEndpoint)
-	decorateAzureAutoRest(&subscriptionsClient.Client)
-
-	if len(opts.Azure.Subscription) == 0 {
-		// auto lookup subscriptions
-		listResult, err := subscriptionsClient.List(ctx)
-		if err != nil {
-			log.Panic(err)
-		}
-		AzureSubscriptions = listResult.Values()
+	return
+}
 
-		if len(AzureSubscriptions) == 0 {
-			log.Panic("no Azure Subscriptions found via auto detection, does this ServicePrincipal have read permissions to the subscriptions?")
-		}
-	} else {
-		// fixed subscription list
-		AzureSubscriptions = []subscriptions.Subscription{}
-		for _, subId := range opts.Azure.Subscription {
-			result, err := subscriptionsClient.Get(ctx, subId)
-			if err != nil {
-				log.Panic(err)
+// getSubscriptionDisplayName returns the display name of a discovered subscription
+func getSubscriptionDisplayName(subscriptionId string) string {
+	for _, subscription := range AzureSubscriptions {
+		if subscription.SubscriptionID != nil && strings.EqualFold(*subscription.SubscriptionID, subscriptionId) {
+			if subscription.DisplayName != nil {
+				return *subscription.DisplayName
 			}
-			AzureSubscriptions = append(AzureSubscriptions, result)
+			break
 		}
 	}
+	return ""
 }
 
 // start and handle prometheus handler
 func startHttpServer() {
-	// healthz
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := fmt.Fprint(w, "Ok"); err != nil {
-			log.Error(err)
-		}
-	})
+	initWebAllowCidr()
+
+	// landing page
+	http.HandleFunc("/", newLandingPageHandler())
+
+	// health checks (Kubernetes conventions, /healthz is the deprecated liveness endpoint)
+	for path, checks := range map[string][]HealthCheck{"/livez": livenessChecks, "/healthz": livenessChecks, "/readyz": readinessChecks} {
+		handler := newHealthHandler(path, checks)
+		http.Handle(path, handler)
+		http.Handle(path+"/", handler)
+	}
 
 	// report
 	reportTmpl := template.Must(template.ParseFiles("./templates/query.html"))
-	http.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+	http.Handle("/query", webAllowCidr(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cspNonce := base64.StdEncoding.EncodeToString([]byte(uuid.New().String()))
 
 		w.Header().Add("Content-Type", "text/html")
@@ -195,27 +365,65 @@ func startHttpServer() {
 		)
 
 		templatePayload := struct {
-			Nonce string
+			Nonce                  string
+			PortalUrl              string
+			SubscriptionPortalUrls map[string]string
 		}{
-			Nonce: cspNonce,
+			Nonce:                  cspNonce,
+			PortalUrl:              getAzureCloud("").PortalUrl(),
+			SubscriptionPortalUrls: getSubscriptionPortalUrls(),
 		}
 
 		if err := reportTmpl.Execute(w, templatePayload); err != nil {
 			log.Error(err)
 		}
-	})
-
-	http.Handle("/metrics", azuretracing.RegisterAzureMetricAutoClean(promhttp.Handler()))
-
-	http.HandleFunc("/probe", handleProbeRequest)
+	})))
+
+	http.Handle("/metrics", webAllowCidr(azuretracing.RegisterAzureMetricAutoClean(newMetricsHandler())))
+
+	http.Handle("/probe", webAllowCidr(http.HandlerFunc(handleProbeRequest)))
+
+	// api
+	http.Handle("/api/config", webAllowCidr(apiAuth(handleApiConfig)))
+	http.Handle("/api/cache", webAllowCidr(apiAuth(handleApiCache)))
+	http.Handle("/api/cache/", webAllowCidr(apiAuth(handleApiCache)))
+	http.Handle("/api/snapshot", webAllowCidr(apiAuth(handleApiSnapshot)))
+	// Event Grid delivers from Azure networks, the webhook is only protected by its key
+	http.HandleFunc("/webhook/eventgrid", handleEventGridWebhook)
+	http.Handle("/api/query/", webAllowCidr(apiAuth(handleApiQuery)))
+	http.Handle("/api/query/preview", webAllowCidr(apiAuth(handleApiQueryPreview)))
+	http.Handle("/api/load", webAllowCidr(apiAuth(handleApiLoad)))
+	http.Handle("/api/loglevel", webAllowCidr(apiAuth(handleApiLogLevel)))
+
+	// lifecycle
+	http.HandleFunc("/-/healthy", handleLifecycleHealthy)
+	http.HandleFunc("/-/ready", handleLifecycleReady)
+	http.Handle("/-/reload", webAllowCidr(http.HandlerFunc(handleLifecycleReload)))
+	http.Handle("/-/quit", webAllowCidr(http.HandlerFunc(handleLifecycleQuit)))
+
+	server := &http.Server{
+		ReadHeaderTimeout: opts.Web.ReadHeaderTimeout,
+		ReadTimeout:       opts.Web.ReadTimeout,
+		WriteTimeout:      opts.Web.WriteTimeout,
+		IdleTimeout:       opts.Web.IdleTimeout,
+		MaxHeaderBytes:    opts.Web.MaxHeaderBytes,
+	}
+	server.SetKeepAlivesEnabled(!opts.Web.DisableKeepAlive)
+	startLifecycleHandler(server)
+	systemdNotify(SystemdNotifyReady)
 
-	log.Fatal(http.ListenAndServe(opts.ServerBind, nil))
+	// tls, basic auth and response headers of --web.config.file are handled by the exporter-toolkit
+	if err := web.ListenAndServe(server, newWebFlagConfig(), webToolkitLogger{}); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	log.Infof("http server stopped")
 }
 
-func decorateAzureAutoRest(client *autorest.Client) {
-	client.Authorizer = AzureAuthorizer
+func decorateAzureAutoRest(client *autorest.Client, authorizer autorest.Authorizer) {
+	client.Authorizer = authorizer
+	client.Sender = azureHttpClient()
 	if err := client.AddToUserAgent(UserAgent + gitTag); err != nil {
-		log.Panic(err)
+		log.Warnf("unable to set user agent: %v", err)
 	}
 	azuretracing.DecorateAzureAutoRestClient(client)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+// executeCompareQuery executes the query with the scrape time shifted by the compare offset and adds the
+// difference to the current result as <metric>_delta (the historical execution is not recorded in exporter metrics)
+func (p *Probe) executeCompareQuery(ctx context.Context, client ResourceGraphClient, queryConfig config.ConfigQuery, dependencyResults map[string]config.QueryResult, result *ProbeQueryResult) error {
+	historical := *p
+	historical.RequestTime = p.RequestTime.Add(-queryConfig.Compare.GetOffset())
+	historical.DryRun = true
+	historical.Logger = p.Logger.WithField("compareOffset", queryConfig.Compare.Offset)
+
+	historicalResult, err := historical.executeQuery(ctx, client, queryConfig, dependencyResults)
+	if err != nil {
+		return err
+	}
+
+	compareMetricList(&result.MetricList, &historicalResult.MetricList)
+	return nil
+}
+
+// compareMetricList adds the difference current - previous of every metric as <metric>_delta,
+// series missing in one of the results are treated as 0 (new or removed series)
+func compareMetricList(current, previous *kusto.MetricList) {
+	metricNames := map[string]bool{}
+	for _, metricName := range current.GetMetricNames() {
+		metricNames[metricName] = true
+	}
+	for _, metricName := range previous.GetMetricNames() {
+		metricNames[metricName] = true
+	}
+
+	for metricName := range metricNames {
+		labelNames := compareMetricLabelNames(current, previous, metricName)
+
+		rows := []kusto.MetricRow{}
+		rowIndex := map[string]int{}
+		addRows := func(metricRows []kusto.MetricRow, sign float64) {
+			for _, row := range metricRows {
+				if row.Value == nil {
+					continue
+				}
+
+				key := metricRowKey(labelNames, row)
+				if i, exists := rowIndex[key]; exists {
+					value := *rows[i].Value + sign**row.Value
+					rows[i].Value = &value
+					continue
+				}
+
+				labels := prometheus.Labels{}
+				for labelName, labelValue := range row.Labels {
+					if labelName != MetricTimestampLabel {
+						labels[labelName] = labelValue
+					}
+				}
+				value := sign * *row.Value
+				rowIndex[key] = len(rows)
+				rows = append(rows, kusto.MetricRow{Labels: labels, Value: &value})
+			}
+		}
+		addRows(current.GetMetricList(metricName), 1)
+		addRows(previous.GetMetricList(metricName), -1)
+
+		current.Add(metricName+config.CompareMetricSuffix, rows...)
+	}
+}
+
+// compareMetricLabelNames returns the label names of the metric in both results
+func compareMetricLabelNames(current, previous *kusto.MetricList, metricName string) []string {
+	labelNames := map[string]bool{}
+	for _, labelName := range sortedMetricLabelNames(current, metricName) {
+		labelNames[labelName] = true
+	}
+	for _, labelName := range sortedMetricLabelNames(previous, metricName) {
+		labelNames[labelName] = true
+	}
+
+	ret := []string{}
+	for labelName := range labelNames {
+		ret = append(ret, labelName)
+	}
+	sort.Strings(ret)
+	return ret
+}
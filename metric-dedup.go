@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+// metricRowKey builds a unique key for the label set of a row, missing labels are treated as empty
+// (as they are filled with empty values when building the prometheus metrics)
+func metricRowKey(labelNames []string, row kusto.MetricRow) string {
+	parts := make([]string, len(labelNames))
+	for i, labelName := range labelNames {
+		parts[i] = labelName + "=" + row.Labels[labelName]
+	}
+	return strings.Join(parts, "\xff")
+}
+
+// sortedMetricLabelNames returns all label names of the metric in stable order (without the sample timestamp)
+func sortedMetricLabelNames(metricList *kusto.MetricList, metricName string) []string {
+	labelNames := []string{}
+	for _, labelName := range metricList.GetMetricLabelNames(metricName) {
+		if labelName != MetricTimestampLabel {
+			labelNames = append(labelNames, labelName)
+		}
+	}
+	sort.Strings(labelNames)
+	return labelNames
+}
+
+type (
+	MetricDuplicate struct {
+		MetricName string
+		Labels     string
+		Values     []*float64
+	}
+)
+
+// dedupMetricList merges rows with identical label sets using the dedup strategy and returns the found duplicates
+func dedupMetricList(metricList *kusto.MetricList, strategy string) (duplicates []MetricDuplicate) {
+	for _, metricName := range metricList.GetMetricNames() {
+		labelNames := sortedMetricLabelNames(metricList, metricName)
+
+		rows := []kusto.MetricRow{}
+		rowIndex := map[string]int{}
+		duplicateIndex := map[string]int{}
+		for _, row := range metricList.GetMetricList(metricName) {
+			key := metricRowKey(labelNames, row)
+
+			i, exists := rowIndex[key]
+			if !exists {
+				rowIndex[key] = len(rows)
+				rows = append(rows, row)
+				continue
+			}
+
+			// collect conflicting values for diagnostics
+			if d, ok := duplicateIndex[key]; ok {
+				duplicates[d].Values = append(duplicates[d].Values, row.Value)
+			} else {
+				duplicateIndex[key] = len(duplicates)
+				duplicates = append(duplicates, MetricDuplicate{
+					MetricName: metricName,
+					Labels:     strings.ReplaceAll(key, "\xff", ", "),
+					Values:     []*float64{rows[i].Value, row.Value},
+				})
+			}
+
+			rows[i].Value = dedupMetricValue(strategy, rows[i].Value, row.Value)
+			if _, ok := row.Labels[MetricTimestampLabel]; ok {
+				rows[i].Labels[MetricTimestampLabel] = newerMetricRowTimestamp(rows[i], row)
+			}
+		}
+
+		metricList.List[metricName] = rows
+	}
+
+	return
+}
+
+// FormatValues returns the conflicting values for logging
+func (d *MetricDuplicate) FormatValues() string {
+	values := make([]string, len(d.Values))
+	for i, value := range d.Values {
+		if value != nil {
+			values[i] = strconv.FormatFloat(*value, 'g', -1, 64)
+		} else {
+			values[i] = "<nil>"
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// dedupMetricValue merges two values of a duplicate row, nil values are ignored for sum and max
+func dedupMetricValue(strategy string, current, value *float64) *float64 {
+	switch strategy {
+	case config.DedupStrategyLast:
+		return value
+	case config.DedupStrategySum:
+		if current == nil {
+			return value
+		} else if value == nil {
+			return current
+		}
+		sum := *current + *value
+		return &sum
+	case config.DedupStrategyMax:
+		if current == nil || (value != nil && *value > *current) {
+			return value
+		}
+		return current
+	default:
+		return current
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	EmptyIndicatorMetricSuffix = "_empty"
+)
+
+// applyPublishIfEmpty adds zero value or indicator series based on the publishIfEmpty behavior of the query
+func applyPublishIfEmpty(metricList *kusto.MetricList, queryConfig config.ConfigQuery, empty bool) {
+	buildRow := func(value float64) kusto.MetricRow {
+		row := kusto.MetricRow{
+			Labels: prometheus.Labels{},
+			Value:  &value,
+		}
+		for labelName, labelValue := range queryConfig.MetricConfig.Labels {
+			row.Labels[labelName] = labelValue
+		}
+		return row
+	}
+
+	switch queryConfig.GetPublishIfEmpty() {
+	case config.PublishIfEmptyZero:
+		if empty {
+			metricList.Add(queryConfig.Metric, buildRow(0))
+		}
+	case config.PublishIfEmptyIndicator:
+		value := float64(0)
+		if empty {
+			value = 1
+		}
+		metricList.Add(queryConfig.Metric+EmptyIndicatorMetricSuffix, buildRow(value))
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+var (
+	// buffers are reused between scrapes, large probes (>100k series) would otherwise allocate the whole response every scrape
+	metricEncodeBufferPool = sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+
+	metricEncodeGzipPool = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+
+	metricLabelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	metricHelpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+const (
+	ProbeLimitMaxSeries = "max-series"
+	ProbeLimitMaxBytes  = "max-bytes"
+
+	ProbeTruncatedMetric = "azure_resourcegraph_probe_truncated"
+)
+
+type (
+	// metricEncoder encodes metric lists in prometheus text format,
+	// label value and index slices are preallocated once and reused for all metric names
+	metricEncoder struct {
+		// limits of the response (0 = unlimited), the response is truncated if exceeded
+		MaxSeries int
+		MaxBytes  int
+
+		// exceeded limit (empty if not truncated)
+		Truncated string
+
+		labelValues []string
+		index       []int
+		series      []int
+		seriesCount int
+		scratch     [32]byte
+	}
+)
+
+// writeProbeMetrics writes the metric list in prometheus text format (gzip compressed if accepted by the client)
+// and returns the exceeded limit if the response was truncated
+func writeProbeMetrics(w http.ResponseWriter, r *http.Request, metricList *kusto.MetricList) (string, error) {
+	buf := metricEncodeBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer metricEncodeBufferPool.Put(buf)
+
+	encoder := metricEncoder{
+		MaxSeries: opts.Probe.MaxSeries,
+		MaxBytes:  opts.Probe.MaxBytes,
+	}
+	encoder.Encode(buf, metricList)
+	encoder.EncodeTruncated(buf)
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		_, err := buf.WriteTo(w)
+		return encoder.Truncated, err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := metricEncodeGzipPool.Get().(*gzip.Writer)
+	defer metricEncodeGzipPool.Put(gz)
+	gz.Reset(w)
+
+	if _, err := buf.WriteTo(gz); err != nil {
+		return encoder.Truncated, err
+	}
+	return encoder.Truncated, gz.Close()
+}
+
+// Encode writes all exposed metrics sorted by metric name and label values, missing labels are written as empty values.
+// Sample timestamps (if set) are written after the value. Encoding stops if MaxSeries or MaxBytes is exceeded. Series with identical labels (eg. same metric from multiple
+// queries) are written once, the last value wins.
+func (e *metricEncoder) Encode(buf *bytes.Buffer, metricList *kusto.MetricList) {
+	metricNames := metricList.GetMetricNames()
+	sort.Strings(metricNames)
+
+	for _, metricName := range metricNames {
+		if !metricNameFilter.IsExposed(metricName) {
+			continue
+		}
+
+		rows := metricList.GetMetricList(metricName)
+		labelNames := sortedMetricLabelNames(metricList, metricName)
+		labelCount := len(labelNames)
+
+		// collect label values of all series with values into one flat slice
+		e.index = e.index[:0]
+		if cap(e.labelValues) < len(rows)*labelCount {
+			e.labelValues = make([]string, 0, len(rows)*labelCount)
+		}
+		e.labelValues = e.labelValues[:0]
+		for i, row := range rows {
+			if row.Value == nil {
+				continue
+			}
+			e.index = append(e.index, i)
+			for _, labelName := range labelNames {
+				e.labelValues = append(e.labelValues, row.Labels[labelName])
+			}
+		}
+
+		if len(e.index) == 0 {
+			continue
+		}
+
+		e.series = e.series[:0]
+		for i := range e.index {
+			e.series = append(e.series, i)
+		}
+		series := e.series
+		sort.SliceStable(series, func(a, b int) bool {
+			return e.compareLabels(series[a], series[b], labelCount) < 0
+		})
+
+		metricStart := buf.Len()
+		written := 0
+
+		buf.WriteString("# HELP ")
+		buf.WriteString(metricName)
+		buf.WriteByte(' ')
+		metricHelpEscaper.WriteString(buf, metricName) // nolint: errcheck
+		buf.WriteString("\n# TYPE ")
+		buf.WriteString(metricName)
+		buf.WriteString(" gauge\n")
+
+		for n, s := range series {
+			if n+1 < len(series) && e.compareLabels(s, series[n+1], labelCount) == 0 {
+				// duplicate series, the following one wins
+				continue
+			}
+
+			if e.MaxSeries > 0 && e.seriesCount >= e.MaxSeries {
+				e.Truncated = ProbeLimitMaxSeries
+				break
+			}
+			seriesStart := buf.Len()
+
+			buf.WriteString(metricName)
+			if labelCount > 0 {
+				buf.WriteByte('{')
+				for l, labelName := range labelNames {
+					if l > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(labelName)
+					buf.WriteString(`="`)
+					metricLabelValueEscaper.WriteString(buf, e.labelValues[s*labelCount+l]) // nolint: errcheck
+					buf.WriteByte('"')
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.Write(strconv.AppendFloat(e.scratch[:0], *rows[e.index[s]].Value, 'g', -1, 64))
+			if timestamp, err := strconv.ParseInt(rows[e.index[s]].Labels[MetricTimestampLabel], 10, 64); err == nil {
+				buf.WriteByte(' ')
+				buf.Write(strconv.AppendInt(e.scratch[:0], timestamp, 10))
+			}
+			buf.WriteByte('\n')
+
+			if e.MaxBytes > 0 && buf.Len() > e.MaxBytes {
+				buf.Truncate(seriesStart)
+				e.Truncated = ProbeLimitMaxBytes
+				break
+			}
+			e.seriesCount++
+			written++
+		}
+
+		if e.Truncated != "" {
+			if written == 0 {
+				// no series of this metric fits, remove HELP and TYPE
+				buf.Truncate(metricStart)
+			}
+			return
+		}
+	}
+}
+
+// EncodeTruncated writes the indicator metric with one series per configured limit (1 if exceeded, otherwise 0)
+func (e *metricEncoder) EncodeTruncated(buf *bytes.Buffer) {
+	limits := []string{}
+	if e.MaxSeries > 0 {
+		limits = append(limits, ProbeLimitMaxSeries)
+	}
+	if e.MaxBytes > 0 {
+		limits = append(limits, ProbeLimitMaxBytes)
+	}
+	if len(limits) == 0 {
+		return
+	}
+
+	buf.WriteString("# HELP " + ProbeTruncatedMetric + " Probe response truncated by limit\n")
+	buf.WriteString("# TYPE " + ProbeTruncatedMetric + " gauge\n")
+	for _, limit := range limits {
+		value := "0"
+		if e.Truncated == limit {
+			value = "1"
+		}
+		buf.WriteString(ProbeTruncatedMetric + `{limit="` + limit + `"} ` + value + "\n")
+	}
+}
+
+// compareLabels compares the label values of two series
+func (e *metricEncoder) compareLabels(a, b, labelCount int) int {
+	for l := 0; l < labelCount; l++ {
+		if c := strings.Compare(e.labelValues[a*labelCount+l], e.labelValues[b*labelCount+l]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
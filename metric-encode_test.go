@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+// encodeMetricListWithRegistry encodes the metric list via GaugeVecs and expfmt (like promhttp does),
+// used as reference for the metricEncoder output
+func encodeMetricListWithRegistry(t testing.TB, metricList *kusto.MetricList) string {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	for _, metricName := range metricList.GetMetricNames() {
+		metricLabelNames := metricList.GetMetricLabelNames(metricName)
+
+		gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metricName,
+			Help: metricName,
+		}, metricLabelNames)
+		registry.MustRegister(gaugeVec)
+
+		for _, metric := range metricList.GetMetricList(metricName) {
+			labels := prometheus.Labels{}
+			for _, labelName := range metricLabelNames {
+				labels[labelName] = metric.Labels[labelName]
+			}
+
+			if metric.Value != nil {
+				gaugeVec.With(labels).Set(*metric.Value)
+			}
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unable to gather metrics: %v", err)
+	}
+
+	buf := bytes.Buffer{}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatalf("unable to encode metric family: %v", err)
+		}
+	}
+	return buf.String()
+}
+
+func newTestMetricRow(value *float64, labels prometheus.Labels) kusto.MetricRow {
+	return kusto.MetricRow{Labels: labels, Value: value}
+}
+
+func testMetricValue(value float64) *float64 {
+	return &value
+}
+
+func TestMetricEncoderMatchesExpfmt(t *testing.T) {
+	metricList := kusto.MetricList{}
+	metricList.Init()
+	metricList.Add(
+		"azure_resourcegraph_vm",
+		newTestMetricRow(testMetricValue(1), prometheus.Labels{"name": "vm-b", "location": "westeurope"}),
+		newTestMetricRow(testMetricValue(2), prometheus.Labels{"name": "vm-a", "location": "westeurope"}),
+		newTestMetricRow(testMetricValue(0.5), prometheus.Labels{"name": "vm-c"}),
+		newTestMetricRow(nil, prometheus.Labels{"name": "vm-d", "location": "northeurope"}),
+		newTestMetricRow(testMetricValue(1e21), prometheus.Labels{"name": "vm-e", "location": "eastus", "tag": "escaped \"quote\" \\ and\nnewline"}),
+	)
+	metricList.Add(
+		"azure_resourcegraph_count",
+		newTestMetricRow(testMetricValue(42), prometheus.Labels{}),
+	)
+	metricList.Add(
+		"azure_resourcegraph_special",
+		newTestMetricRow(testMetricValue(math.Inf(1)), prometheus.Labels{"value": "inf"}),
+		newTestMetricRow(testMetricValue(math.Inf(-1)), prometheus.Labels{"value": "-inf"}),
+		newTestMetricRow(testMetricValue(math.NaN()), prometheus.Labels{"value": "nan"}),
+		newTestMetricRow(testMetricValue(-0.000001), prometheus.Labels{"value": "small"}),
+	)
+	metricList.Add(
+		"azure_resourcegraph_duplicate",
+		newTestMetricRow(testMetricValue(1), prometheus.Labels{"name": "dup"}),
+		newTestMetricRow(testMetricValue(2), prometheus.Labels{"name": "other"}),
+		newTestMetricRow(testMetricValue(3), prometheus.Labels{"name": "dup"}),
+	)
+
+	expected := encodeMetricListWithRegistry(t, &metricList)
+
+	buf := bytes.Buffer{}
+	encoder := metricEncoder{}
+	encoder.Encode(&buf, &metricList)
+
+	if actual := buf.String(); actual != expected {
+		t.Errorf("encoder output differs from expfmt output\nexpected:\n%v\nactual:\n%v", expected, actual)
+	}
+}
+
+func TestMetricEncoderDuplicateSeries(t *testing.T) {
+	metricList := kusto.MetricList{}
+	metricList.Init()
+	metricList.Add(
+		"azure_resourcegraph_duplicate",
+		newTestMetricRow(testMetricValue(1), prometheus.Labels{"name": "dup"}),
+		newTestMetricRow(nil, prometheus.Labels{"name": "dup"}),
+		newTestMetricRow(testMetricValue(2), prometheus.Labels{"name": "dup"}),
+		newTestMetricRow(testMetricValue(3), prometheus.Labels{"name": "dup", "location": ""}),
+	)
+
+	buf := bytes.Buffer{}
+	encoder := metricEncoder{}
+	encoder.Encode(&buf, &metricList)
+
+	// missing labels are empty values, so all rows with values are the same series and the last one wins
+	expected := "# HELP azure_resourcegraph_duplicate azure_resourcegraph_duplicate\n" +
+		"# TYPE azure_resourcegraph_duplicate gauge\n" +
+		"azure_resourcegraph_duplicate{location=\"\",name=\"dup\"} 3\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected encoder output\nexpected:\n%v\nactual:\n%v", expected, actual)
+	}
+	if encoder.seriesCount != 1 {
+		t.Errorf("expected 1 series, got %v", encoder.seriesCount)
+	}
+}
+
+func TestMetricEncoderMaxSeries(t *testing.T) {
+	metricList := kusto.MetricList{}
+	metricList.Init()
+	for i := 0; i < 10; i++ {
+		metricList.Add("azure_resourcegraph_a", newTestMetricRow(testMetricValue(float64(i)), prometheus.Labels{"id": fmt.Sprintf("%02d", i)}))
+		metricList.Add("azure_resourcegraph_b", newTestMetricRow(testMetricValue(float64(i)), prometheus.Labels{"id": fmt.Sprintf("%02d", i)}))
+	}
+
+	buf := bytes.Buffer{}
+	encoder := metricEncoder{MaxSeries: 15}
+	encoder.Encode(&buf, &metricList)
+
+	if encoder.Truncated != ProbeLimitMaxSeries {
+		t.Errorf("expected truncation by %v, got \"%v\"", ProbeLimitMaxSeries, encoder.Truncated)
+	}
+	if encoder.seriesCount != 15 {
+		t.Errorf("expected 15 series, got %v", encoder.seriesCount)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("azure_resourcegraph_b{id=\"04\"} 4\n")) || bytes.Contains(buf.Bytes(), []byte("azure_resourcegraph_b{id=\"05\"}")) {
+		t.Errorf("unexpected truncated output:\n%v", buf.String())
+	}
+}
+
+// newBenchmarkMetricList builds a metric list with 10 metrics of 10k series each
+func newBenchmarkMetricList() *kusto.MetricList {
+	metricList := kusto.MetricList{}
+	metricList.Init()
+	for m := 0; m < 10; m++ {
+		metricName := fmt.Sprintf("azure_resourcegraph_benchmark_%d", m)
+		rows := make([]kusto.MetricRow, 0, 10000)
+		for i := 0; i < 10000; i++ {
+			rows = append(rows, newTestMetricRow(testMetricValue(float64(i)), prometheus.Labels{
+				"id":             fmt.Sprintf("/subscriptions/00000000-0000-0000-0000-%012d/resourceGroups/rg-%d/providers/Microsoft.Compute/virtualMachines/vm-%d", i%50, i%200, i),
+				"name":           fmt.Sprintf("vm-%d", i),
+				"location":       []string{"westeurope", "northeurope", "eastus"}[i%3],
+				"subscriptionId": fmt.Sprintf("00000000-0000-0000-0000-%012d", i%50),
+			}))
+		}
+		metricList.Add(metricName, rows...)
+	}
+	return &metricList
+}
+
+func BenchmarkEncode(b *testing.B) {
+	metricList := newBenchmarkMetricList()
+	buf := bytes.Buffer{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		encoder := metricEncoder{}
+		encoder.Encode(&buf, metricList)
+	}
+}
+
+func BenchmarkEncodeExpfmt(b *testing.B) {
+	metricList := newBenchmarkMetricList()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeMetricListWithRegistry(b, metricList)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type (
+	// MetricNameFilter filters the metric names exposed by /probe (allowlist and blocklist regexps)
+	MetricNameFilter struct {
+		Allowlist []*regexp.Regexp
+		Blocklist []*regexp.Regexp
+	}
+)
+
+var (
+	metricNameFilter MetricNameFilter
+)
+
+// initMetricNameFilter compiles the allowlist and blocklist regexps (anchored, like relabel configs)
+func initMetricNameFilter() (errs []error) {
+	compile := func(flag string, expressions []string) []*regexp.Regexp {
+		ret := []*regexp.Regexp{}
+		for _, expression := range expressions {
+			regex, err := regexp.Compile("^(?:" + expression + ")$")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid regexp \"%v\" for %v: %w", expression, flag, err))
+				continue
+			}
+			ret = append(ret, regex)
+		}
+		return ret
+	}
+
+	metricNameFilter = MetricNameFilter{
+		Allowlist: compile("--metrics.allowlist", opts.Metrics.Allowlist),
+		Blocklist: compile("--metrics.blocklist", opts.Metrics.Blocklist),
+	}
+	return
+}
+
+// IsExposed checks if the metric matches the allowlist (if set) and does not match the blocklist
+func (f *MetricNameFilter) IsExposed(metricName string) bool {
+	if len(f.Allowlist) > 0 && !matchesAnyRegexp(f.Allowlist, metricName) {
+		return false
+	}
+	return !matchesAnyRegexp(f.Blocklist, metricName)
+}
+
+func matchesAnyRegexp(list []*regexp.Regexp, value string) bool {
+	for _, regex := range list {
+		if regex.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
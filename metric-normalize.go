@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+const (
+	// normalized labels (azure-metrics-exporter conventions), all values are lowercase
+	NormalizedLabelResourceID     = "resourceID"
+	NormalizedLabelSubscriptionID = "subscriptionID"
+	NormalizedLabelResourceGroup  = "resourceGroup"
+	NormalizedLabelResourceName   = "resourceName"
+	NormalizedLabelResourceType   = "resourceType"
+)
+
+var (
+	// labels checked for the resource id (in this order)
+	normalizeResourceIdLabels = []string{"resourceID", "resourceId", "id"}
+)
+
+// normalizeMetricListLabels adds normalized resource labels parsed from the resource id label of each row,
+// so ResourceGraph metrics can be joined with other Azure exporters in PromQL (eg. on resourceID)
+func normalizeMetricListLabels(metricList *kusto.MetricList) {
+	for _, rows := range metricList.List {
+		for _, row := range rows {
+			for _, labelName := range normalizeResourceIdLabels {
+				if labels, ok := normalizeResourceIdLabelValues(row.Labels[labelName]); ok {
+					for normalizedLabelName, labelValue := range labels {
+						row.Labels[normalizedLabelName] = labelValue
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// normalizeResourceIdLabelValues returns the normalized labels of a resource, resource group or subscription id
+func normalizeResourceIdLabelValues(resourceId string) (map[string]string, bool) {
+	subscriptionId, resourceType := parseEventGridResourceId(resourceId)
+	if subscriptionId == "" {
+		return nil, false
+	}
+
+	resourceId = "/" + strings.Trim(strings.ToLower(resourceId), "/")
+	parts := strings.Split(strings.TrimPrefix(resourceId, "/"), "/")
+
+	labels := map[string]string{
+		NormalizedLabelResourceID:     resourceId,
+		NormalizedLabelSubscriptionID: subscriptionId,
+		NormalizedLabelResourceGroup:  "",
+		NormalizedLabelResourceName:   parts[len(parts)-1],
+		NormalizedLabelResourceType:   resourceType,
+	}
+	if len(parts) >= 4 && parts[2] == "resourcegroups" {
+		labels[NormalizedLabelResourceGroup] = parts[3]
+	}
+
+	return labels, true
+}
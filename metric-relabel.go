@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	RelabelMetricNameLabel = "__name__"
+)
+
+// relabelMetricList applies the relabel configs to all rows, the metric name is available as __name__
+func relabelMetricList(metricList *kusto.MetricList, relabelConfigs []config.RelabelConfig) {
+	if len(relabelConfigs) == 0 {
+		return
+	}
+
+	list := map[string][]kusto.MetricRow{}
+	for metricName, rows := range metricList.List {
+		for _, row := range rows {
+			labels := prometheus.Labels{}
+			for labelName, labelValue := range row.Labels {
+				labels[labelName] = labelValue
+			}
+			labels[RelabelMetricNameLabel] = metricName
+
+			if labels = relabel(labels, relabelConfigs); labels == nil {
+				// dropped
+				continue
+			}
+
+			newMetricName := labels[RelabelMetricNameLabel]
+			delete(labels, RelabelMetricNameLabel)
+			if newMetricName == "" {
+				continue
+			}
+
+			row.Labels = labels
+			list[newMetricName] = append(list[newMetricName], row)
+		}
+	}
+	metricList.List = list
+}
+
+// relabel applies the relabel configs to the label set, returns nil if the series should be dropped
+func relabel(labels prometheus.Labels, relabelConfigs []config.RelabelConfig) prometheus.Labels {
+	for i := range relabelConfigs {
+		relabelConfig := &relabelConfigs[i]
+		regex := relabelConfig.GetRegexp()
+
+		sourceValues := make([]string, len(relabelConfig.SourceLabels))
+		for n, sourceLabel := range relabelConfig.SourceLabels {
+			sourceValues[n] = labels[sourceLabel]
+		}
+		sourceValue := strings.Join(sourceValues, relabelConfig.GetSeparator())
+
+		switch relabelConfig.GetAction() {
+		case config.RelabelActionKeep:
+			if !regex.MatchString(sourceValue) {
+				return nil
+			}
+		case config.RelabelActionDrop:
+			if regex.MatchString(sourceValue) {
+				return nil
+			}
+		case config.RelabelActionReplace:
+			match := regex.FindStringSubmatchIndex(sourceValue)
+			if match == nil {
+				continue
+			}
+			targetLabel := string(regex.ExpandString([]byte{}, relabelConfig.TargetLabel, sourceValue, match))
+			value := string(regex.ExpandString([]byte{}, relabelConfig.GetReplacement(), sourceValue, match))
+			if value == "" {
+				delete(labels, targetLabel)
+			} else {
+				labels[targetLabel] = value
+			}
+		case config.RelabelActionLabelMap:
+			mappedLabels := prometheus.Labels{}
+			for labelName, labelValue := range labels {
+				if regex.MatchString(labelName) {
+					mappedLabels[regex.ReplaceAllString(labelName, relabelConfig.GetReplacement())] = labelValue
+				}
+			}
+			for labelName, labelValue := range mappedLabels {
+				labels[labelName] = labelValue
+			}
+		case config.RelabelActionLabelDrop:
+			for labelName := range labels {
+				if labelName != RelabelMetricNameLabel && regex.MatchString(labelName) {
+					delete(labels, labelName)
+				}
+			}
+		case config.RelabelActionLabelKeep:
+			for labelName := range labels {
+				if labelName != RelabelMetricNameLabel && !regex.MatchString(labelName) {
+					delete(labels, labelName)
+				}
+			}
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// runtimeRegistry contains the Go runtime and process metrics, they are only exposed by /metrics
+	runtimeRegistry = prometheus.NewRegistry()
+)
+
+// initRuntimeMetrics moves the Go runtime and process collectors from the default registry to the runtime registry
+// (unless disabled by --metrics.runtime.disable)
+func initRuntimeMetrics() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	if opts.Metrics.Runtime.Disable {
+		return
+	}
+
+	runtimeRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// newMetricsHandler creates the handler of /metrics (exporter metrics and runtime metrics),
+// probe responses are encoded from the metric list of the probe and never contain registry metrics
+func newMetricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, runtimeRegistry}, promhttp.HandlerOpts{}),
+	)
+}
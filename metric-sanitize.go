@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+type (
+	MetricNameSanitizer struct {
+		// replacement for invalid characters
+		Replacement string
+
+		// convert camelCase to snake_case
+		SnakeCase bool
+
+		// max length of names (0 = unlimited)
+		MaxLength int
+	}
+)
+
+var (
+	metricNameSanitizer MetricNameSanitizer
+)
+
+func initMetricNameSanitizer() {
+	metricNameSanitizer = MetricNameSanitizer{
+		Replacement: opts.Metrics.Sanitize.Replacement,
+		SnakeCase:   opts.Metrics.Sanitize.SnakeCase,
+		MaxLength:   opts.Metrics.Sanitize.MaxLength,
+	}
+}
+
+// MetricName sanitizes a metric name ([a-zA-Z_:][a-zA-Z0-9_:]*)
+func (s *MetricNameSanitizer) MetricName(name string) string {
+	return s.sanitize(name, true)
+}
+
+// LabelName sanitizes a label name ([a-zA-Z_][a-zA-Z0-9_]*)
+func (s *MetricNameSanitizer) LabelName(name string) string {
+	return s.sanitize(name, false)
+}
+
+func (s *MetricNameSanitizer) sanitize(name string, allowColon bool) string {
+	if s.SnakeCase {
+		name = toSnakeCase(name)
+	}
+
+	ret := strings.Builder{}
+	for i, char := range name {
+		switch {
+		case char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z'):
+			ret.WriteRune(char)
+		case char == ':' && allowColon:
+			ret.WriteRune(char)
+		case char >= '0' && char <= '9':
+			if i == 0 {
+				// names must not start with a digit
+				ret.WriteString("_")
+			}
+			ret.WriteRune(char)
+		default:
+			ret.WriteString(s.Replacement)
+		}
+	}
+	name = ret.String()
+	if name == "" {
+		name = "_"
+	}
+
+	if s.MaxLength > 0 && len(name) > s.MaxLength {
+		name = name[:s.MaxLength]
+	}
+
+	return name
+}
+
+// toSnakeCase converts camelCase (and PascalCase) names to snake_case
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	ret := strings.Builder{}
+	for i, char := range runes {
+		if unicode.IsUpper(char) && i > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				ret.WriteRune('_')
+			}
+		}
+		ret.WriteRune(unicode.ToLower(char))
+	}
+	return ret.String()
+}
+
+// sanitizeMetricList sanitizes all metric and label names of the metric list
+func sanitizeMetricList(metricList *kusto.MetricList) {
+	list := map[string][]kusto.MetricRow{}
+	for metricName, rows := range metricList.List {
+		metricName = metricNameSanitizer.MetricName(metricName)
+		for _, row := range rows {
+			labels := prometheus.Labels{}
+			for labelName, labelValue := range row.Labels {
+				if labelName == MetricTimestampLabel {
+					labels[labelName] = labelValue
+					continue
+				}
+				labels[metricNameSanitizer.LabelName(labelName)] = labelValue
+			}
+			row.Labels = labels
+			list[metricName] = append(list[metricName], row)
+		}
+	}
+	metricList.List = list
+}
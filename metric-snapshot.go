@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/snapshot"
+)
+
+// handleApiSnapshot serves /api/snapshot with the materialized metrics (cached probe results of all modules, filter
+// with ?profile= and ?module=), the series are the same as exposed by /probe
+func handleApiSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	matches := func(info ProbeCacheKey) bool {
+		if v, ok := params["profile"]; ok && v[0] != info.Profile {
+			return false
+		}
+		if v, ok := params["module"]; ok && v[0] != info.Module {
+			return false
+		}
+		return true
+	}
+
+	writeApiJson(w, buildMetricSnapshot(matches))
+}
+
+// buildMetricSnapshot converts the cached probe results into a snapshot, the cache items are copied at once so all
+// modules are from the same point in time
+func buildMetricSnapshot(matches func(info ProbeCacheKey) bool) *snapshot.Snapshot {
+	ret := &snapshot.Snapshot{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Version: gitTag,
+		Modules: []snapshot.Module{},
+	}
+
+	for _, item := range metricCache.Items() {
+		entry, ok := item.Object.(probeCacheEntry)
+		// query results are part of the probe results
+		if !ok || entry.Key.Query != "" || !matches(entry.Key) {
+			continue
+		}
+
+		metricList := kusto.MetricList{}
+		metricList.Init()
+		if err := json.Unmarshal(entry.Data, &metricList); err != nil {
+			continue
+		}
+
+		module := snapshot.Module{
+			Profile:       entry.Key.Profile,
+			Module:        entry.Key.Module,
+			Params:        entry.Key.Params,
+			Interval:      entry.Key.Interval,
+			Subscriptions: entry.Key.Subscriptions,
+			Metrics:       buildMetricSnapshotMetrics(&metricList),
+		}
+		if item.Expiration > 0 {
+			module.Expires = time.Unix(0, item.Expiration).UTC().Format(time.RFC3339)
+		}
+		ret.Modules = append(ret.Modules, module)
+	}
+
+	ret.Sort()
+	return ret
+}
+
+// buildMetricSnapshotMetrics returns the exposed metrics of the metric list, series without value are skipped and
+// duplicate series are merged (the following one wins) like in the Prometheus text format
+func buildMetricSnapshotMetrics(metricList *kusto.MetricList) []snapshot.Metric {
+	metricNames := metricList.GetMetricNames()
+	sort.Strings(metricNames)
+
+	metrics := []snapshot.Metric{}
+	for _, metricName := range metricNames {
+		if !metricNameFilter.IsExposed(metricName) {
+			continue
+		}
+
+		labelNames := sortedMetricLabelNames(metricList, metricName)
+
+		series := []snapshot.Series{}
+		index := map[string]int{}
+		for _, row := range metricList.GetMetricList(metricName) {
+			if row.Value == nil {
+				continue
+			}
+
+			labels := make(map[string]string, len(labelNames))
+			for _, labelName := range labelNames {
+				labels[labelName] = row.Labels[labelName]
+			}
+
+			s := snapshot.Series{
+				Labels: labels,
+				Value:  strconv.FormatFloat(*row.Value, 'g', -1, 64),
+			}
+			if timestamp, err := strconv.ParseInt(row.Labels[MetricTimestampLabel], 10, 64); err == nil {
+				s.Timestamp = timestamp
+			}
+
+			if i, exists := index[s.Key()]; exists {
+				series[i] = s
+				continue
+			}
+			index[s.Key()] = len(series)
+			series = append(series, s)
+		}
+
+		if len(series) == 0 {
+			continue
+		}
+
+		metrics = append(metrics, snapshot.Metric{
+			Name:   metricName,
+			Help:   metricName,
+			Type:   snapshot.MetricTypeGauge,
+			Series: series,
+		})
+	}
+	return metrics
+}
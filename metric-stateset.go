@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+// expandStateSetMetricList converts the state label of the main metric into one series per state with value 1 for
+// the current state and 0 for all other states (OpenMetrics StateSet), the state label is named like the metric.
+// States are configured or discovered from the result (non-empty values only).
+func expandStateSetMetricList(metricList *kusto.MetricList, queryConfig config.ConfigQuery) {
+	stateLabel := queryConfig.StateSet.Label
+	rows := metricList.GetMetricList(queryConfig.Metric)
+
+	states := queryConfig.StateSet.States
+	if len(states) == 0 {
+		discovered := map[string]bool{}
+		for _, row := range rows {
+			if state := row.Labels[stateLabel]; state != "" && !discovered[state] {
+				discovered[state] = true
+				states = append(states, state)
+			}
+		}
+		sort.Strings(states)
+	}
+
+	list := []kusto.MetricRow{}
+	for _, row := range rows {
+		for _, state := range states {
+			labels := prometheus.Labels{}
+			for labelName, labelValue := range row.Labels {
+				if labelName != stateLabel {
+					labels[labelName] = labelValue
+				}
+			}
+			labels[queryConfig.Metric] = state
+
+			value := float64(0)
+			if row.Labels[stateLabel] == state {
+				value = 1
+			}
+			list = append(list, kusto.MetricRow{Labels: labels, Value: &value})
+		}
+	}
+
+	if len(list) > 0 {
+		metricList.List[queryConfig.Metric] = list
+	} else {
+		delete(metricList.List, queryConfig.Metric)
+	}
+}
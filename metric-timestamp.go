@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	// reserved label carrying the sample timestamp (unix milliseconds) through dedup, relabeling and caching,
+	// it is not exported as label but written as sample timestamp
+	MetricTimestampLabel = "__timestamp__"
+)
+
+// isMetricTimestampEnabled checks if sample timestamps of the query are exported
+func isMetricTimestampEnabled(queryConfig config.ConfigQuery) bool {
+	return opts.Metrics.Timestamps.Enable && queryConfig.Timestamp != nil
+}
+
+// parseMetricRowTimestamp parses the timestamp column of the result row, timestamps older than maxAge or in the
+// future are not used as Prometheus rejects samples outside of its head block (exported with scrape time instead)
+func parseMetricRowTimestamp(row map[string]interface{}, timestampConfig *config.ConfigQueryTimestamp, now time.Time) (time.Time, bool) {
+	value, ok := row[timestampConfig.Field].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if timestamp.After(now) || now.Sub(timestamp) > timestampConfig.GetMaxAge(opts.Metrics.Timestamps.MaxAge) {
+		return time.Time{}, false
+	}
+
+	return timestamp, true
+}
+
+// setMetricRowTimestamp sets the sample timestamp of the rows
+func setMetricRowTimestamp(rows []kusto.MetricRow, timestamp time.Time) {
+	value := strconv.FormatInt(timestamp.UnixMilli(), 10)
+	for _, row := range rows {
+		row.Labels[MetricTimestampLabel] = value
+	}
+}
+
+// newerMetricRowTimestamp returns the newer timestamp label value of two rows (eg. for merged duplicates)
+func newerMetricRowTimestamp(a, b kusto.MetricRow) string {
+	aVal, aErr := strconv.ParseInt(a.Labels[MetricTimestampLabel], 10, 64)
+	bVal, bErr := strconv.ParseInt(b.Labels[MetricTimestampLabel], 10, 64)
+	if aErr != nil || (bErr == nil && bVal > aVal) {
+		return b.Labels[MetricTimestampLabel]
+	}
+	return a.Labels[MetricTimestampLabel]
+}
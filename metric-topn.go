@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	TopNOtherLabelValue = "other"
+)
+
+// topNMetricList limits each metric to the topN largest rows (by value or label),
+// the remaining rows are summed up into one "other" row (if enabled)
+func topNMetricList(metricList *kusto.MetricList, topN int, sortBy string, other bool) {
+	if topN <= 0 {
+		return
+	}
+
+	for _, metricName := range metricList.GetMetricNames() {
+		rows := metricList.GetMetricList(metricName)
+		if len(rows) <= topN {
+			continue
+		}
+
+		sort.SliceStable(rows, func(i, j int) bool {
+			return metricRowSortValueLess(rows[j], rows[i], sortBy)
+		})
+
+		remainder := rows[topN:]
+		rows = rows[:topN]
+		if other {
+			rows = append(rows, buildTopNOtherRow(remainder))
+		}
+		metricList.List[metricName] = rows
+	}
+}
+
+// metricRowSortValueLess compares two rows by value or label (numeric if possible), nil values are sorted first
+func metricRowSortValueLess(a, b kusto.MetricRow, sortBy string) bool {
+	if sortBy == config.SortByValue {
+		if a.Value == nil || b.Value == nil {
+			return a.Value == nil && b.Value != nil
+		}
+		return *a.Value < *b.Value
+	}
+
+	aLabel, bLabel := a.Labels[sortBy], b.Labels[sortBy]
+	aVal, aErr := strconv.ParseFloat(aLabel, 64)
+	bVal, bErr := strconv.ParseFloat(bLabel, 64)
+	if aErr == nil && bErr == nil {
+		return aVal < bVal
+	}
+	return aLabel < bLabel
+}
+
+// buildTopNOtherRow sums up the rows, labels with different values are set to "other"
+func buildTopNOtherRow(rows []kusto.MetricRow) kusto.MetricRow {
+	otherRow := kusto.MetricRow{
+		Labels: prometheus.Labels{},
+	}
+
+	for i, row := range rows {
+		for labelName, labelValue := range row.Labels {
+			if i == 0 {
+				otherRow.Labels[labelName] = labelValue
+			} else if otherRow.Labels[labelName] != labelValue {
+				otherRow.Labels[labelName] = TopNOtherLabelValue
+			}
+		}
+
+		// labels not set in all rows
+		for labelName := range otherRow.Labels {
+			if _, ok := row.Labels[labelName]; !ok {
+				otherRow.Labels[labelName] = TopNOtherLabelValue
+			}
+		}
+
+		if row.Value != nil {
+			sum := *row.Value
+			if otherRow.Value != nil {
+				sum += *otherRow.Value
+			}
+			otherRow.Value = &sum
+		}
+	}
+
+	return otherRow
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	// ProbeCacheKey identifies a cached probe result (without query) or query result
+	ProbeCacheKey struct {
+		Profile       string            `json:"profile"`
+		Module        string            `json:"module"`
+		Query         string            `json:"query,omitempty"`
+		Params        map[string]string `json:"params"`
+		Interval      string            `json:"interval"`
+		Subscriptions string            `json:"subscriptions"`
+
+		// subscriptionIDs (lowercase) of the subscription scope, used for event based invalidation
+		subscriptionIDs []string
+	}
+
+	// probeCacheEntry is stored in the metric cache, the key is kept for inspection via api
+	probeCacheEntry struct {
+		Key     ProbeCacheKey
+		Data    []byte
+		Expires time.Time
+	}
+)
+
+// String returns the cache key, params and subscriptions are part of the key so
+// parameterized probes and probes with different subscription scopes never share cache entries
+func (k ProbeCacheKey) String() string {
+	ret := "cache:" + k.Profile + ":" + k.Module
+	if k.Query != "" {
+		ret += "#" + k.Query
+	}
+	return ret + "?" + buildProbeQueryParamsCacheKey(k.Params) + "@" + k.Interval + "/" + k.Subscriptions
+}
+
+// ExecuteCached returns the cached probe result or executes the probe and caches the complete result (if the profile
+// has a cache duration), used by the push exports
+func (p *Probe) ExecuteCached(ctx context.Context) (kusto.MetricList, error) {
+	metricList := kusto.MetricList{}
+	metricList.Init()
+	if p.CacheTime > 0 && getCache(p.CacheKey(), &metricList) {
+		return metricList, nil
+	}
+
+	metricList, err := p.Execute(ctx)
+	if err == nil && p.CacheTime > 0 && len(p.Skipped) == 0 {
+		_ = p.StoreCache(metricList, p.CacheTime)
+	}
+	return metricList, err
+}
+
+// CacheKey returns the cache key for the probe result (profile, module, query params, interval and subscriptions),
+// only params declared by the queries of the module are part of the key
+func (p *Probe) CacheKey() ProbeCacheKey {
+	params := map[string]string{}
+	for paramName := range p.moduleParamNames() {
+		if value, ok := p.Params[paramName]; ok {
+			params[paramName] = value
+		}
+	}
+
+	return ProbeCacheKey{
+		Profile:         p.ProfileName,
+		Module:          p.Module,
+		Params:          params,
+		Interval:        p.ScrapeInterval.String(),
+		Subscriptions:   subscriptionScopeHash(p.Subscriptions),
+		subscriptionIDs: normalizeSubscriptionIDs(p.Subscriptions),
+	}
+}
+
+// QueryCacheKey returns the cache key for a query result, only params used by the query
+// and its dependencies are part of the key so results are shared across unrelated params
+func (p *Probe) QueryCacheKey(queryConfig *config.ConfigQuery) ProbeCacheKey {
+	key := p.CacheKey()
+	key.Query = queryConfig.GetName()
+
+	subscriptions := p.Subscriptions
+	if queryConfig.Subscriptions != nil {
+		subscriptions = *queryConfig.Subscriptions
+	}
+	key.Subscriptions = subscriptionScopeHash(subscriptions)
+	key.subscriptionIDs = normalizeSubscriptionIDs(subscriptions)
+
+	key.Params = map[string]string{}
+	for _, paramName := range p.queryParamNames(queryConfig, map[string]bool{}) {
+		if value, ok := p.Params[paramName]; ok {
+			key.Params[paramName] = value
+		}
+	}
+
+	return key
+}
+
+// moduleParamNames returns the declared params of all queries of the module and their dependencies
+func (p *Probe) moduleParamNames() map[string]bool {
+	ret := map[string]bool{}
+	seen := map[string]bool{}
+	for _, queryConfig := range p.Config.GetModuleQueriesByPriority(p.Module) {
+		for _, paramName := range p.queryParamNames(queryConfig, seen) {
+			ret[paramName] = true
+		}
+	}
+	return ret
+}
+
+// queryParamNames returns the declared params of the query and its dependencies
+func (p *Probe) queryParamNames(queryConfig *config.ConfigQuery, seen map[string]bool) (ret []string) {
+	if seen[queryConfig.GetName()] {
+		return
+	}
+	seen[queryConfig.GetName()] = true
+
+	for _, param := range queryConfig.Params {
+		ret = append(ret, param.Name)
+	}
+
+	for _, dependency := range queryConfig.DependsOn {
+		if dependencyConfig, err := p.Config.GetQueryByName(dependency); err == nil {
+			ret = append(ret, p.queryParamNames(dependencyConfig, seen)...)
+		}
+	}
+
+	return
+}
+
+// HasSubscription checks if the subscription is part of the subscription scope
+func (k ProbeCacheKey) HasSubscription(subscriptionId string) bool {
+	subscriptionId = strings.ToLower(subscriptionId)
+	for _, val := range k.subscriptionIDs {
+		if val == subscriptionId {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSubscriptionIDs returns the sorted lowercase subscription list
+func normalizeSubscriptionIDs(subscriptions []string) []string {
+	list := make([]string, len(subscriptions))
+	for i, subscriptionId := range subscriptions {
+		list[i] = strings.ToLower(subscriptionId)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// subscriptionScopeHash returns a short hash of the (unordered) subscription list
+func subscriptionScopeHash(subscriptions []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(normalizeSubscriptionIDs(subscriptions), ",")))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// cacheQueryMatcher matches the cached results of the queries and the probe results of their modules
+func cacheQueryMatcher(queries []*config.ConfigQuery) func(info ProbeCacheKey) bool {
+	queryNames := map[string]bool{}
+	modules := map[string]bool{}
+	for _, queryConfig := range queries {
+		queryNames[queryConfig.GetName()] = true
+		modules[queryConfig.Module] = true
+	}
+
+	return func(info ProbeCacheKey) bool {
+		if info.Query != "" {
+			return queryNames[info.Query]
+		}
+		return modules[info.Module]
+	}
+}
+
+// findCacheEntries returns all cache entries matching the filter
+func findCacheEntries(matches func(key string, info ProbeCacheKey) bool) []ApiCacheEntry {
+	entries := []ApiCacheEntry{}
+	for key, item := range metricCache.Items() {
+		entry, ok := item.Object.(probeCacheEntry)
+		if !ok || !matches(key, entry.Key) {
+			continue
+		}
+
+		row := ApiCacheEntry{
+			Key:  key,
+			Info: entry.Key,
+			Size: len(entry.Data),
+		}
+		if item.Expiration > 0 {
+			row.Expires = time.Unix(0, item.Expiration).UTC().Format(time.RFC3339)
+		}
+		entries = append(entries, row)
+	}
+	return entries
+}
+
+// invalidateCacheEntries deletes the cache entries and counts the invalidations per source
+func invalidateCacheEntries(source string, entries []ApiCacheEntry) {
+	for _, entry := range entries {
+		metricCache.Delete(entry.Key)
+	}
+	prometheusCacheInvalidations.WithLabelValues(source).Add(float64(len(entries)))
+}
+
+// getCache reads the cache entry and decodes it into target
+func getCache(key ProbeCacheKey, target interface{}) bool {
+	hit := false
+	if v, ok := metricCache.Get(key.String()); ok {
+		if entry, ok := v.(probeCacheEntry); ok {
+			hit = json.Unmarshal(entry.Data, target) == nil
+		}
+	}
+
+	metricLabels := prometheus.Labels{"module": key.Module, "query": key.Query}
+	if hit {
+		prometheusCacheHits.With(metricLabels).Inc()
+	} else {
+		prometheusCacheMisses.With(metricLabels).Inc()
+	}
+	return hit
+}
+
+// setCache encodes the payload and stores it in the cache
+func setCache(key ProbeCacheKey, payload interface{}, ttl time.Duration) error {
+	cacheData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	metricCache.Set(key.String(), probeCacheEntry{Key: key, Data: cacheData, Expires: time.Now().Add(ttl)}, ttl)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+)
+
+type (
+	// probeFlight is an in-flight probe execution shared by concurrent requests with identical parameters
+	probeFlight struct {
+		done       chan struct{}
+		metricList kusto.MetricList
+		skipped    []string
+		err        error
+	}
+)
+
+var (
+	probeFlights      = map[string]*probeFlight{}
+	probeFlightsMutex sync.Mutex
+)
+
+// ExecuteShared runs the probe once for all concurrent requests with the same cache key (eg. HA Prometheus pairs),
+// requests joining an in-flight execution wait for it and get the same (read only) metric list
+func (p *Probe) ExecuteShared(ctx context.Context) (metricList kusto.MetricList, shared bool, err error) {
+	key := p.CacheKey().String()
+
+	probeFlightsMutex.Lock()
+	if flight, exists := probeFlights[key]; exists {
+		probeFlightsMutex.Unlock()
+		prometheusProbeCoalesced.WithLabelValues(p.Module).Inc()
+		p.Logger.Debug("joined in-flight execution")
+
+		atomic.AddInt64(&loadWaitingProbes, 1)
+		defer atomic.AddInt64(&loadWaitingProbes, -1)
+
+		select {
+		case <-flight.done:
+			p.Skipped = flight.skipped
+			return flight.metricList, true, flight.err
+		case <-ctx.Done():
+			return metricList, true, ctx.Err()
+		}
+	}
+
+	flight := &probeFlight{done: make(chan struct{})}
+	probeFlights[key] = flight
+	probeFlightsMutex.Unlock()
+
+	defer func() {
+		probeFlightsMutex.Lock()
+		delete(probeFlights, key)
+		probeFlightsMutex.Unlock()
+		close(flight.done)
+	}()
+
+	// the execution is not bound to the request context as other requests might be waiting for it
+	flight.metricList, flight.err = p.Execute(context.Background())
+	flight.skipped = p.Skipped
+	return flight.metricList, false, flight.err
+}
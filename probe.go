@@ -2,191 +2,694 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
 )
 
 const (
-	RESOURCEGRAPH_QUERY_OPTIONS_TOP = 1000
+	SubscriptionFanOutLabelID   = "subscriptionID"
+	SubscriptionFanOutLabelName = "subscriptionName"
+
+	// max. probe param interval as multiple of --probe.scrape-interval
+	ProbeScrapeIntervalMaxFactor = 60
 )
 
-func handleProbeRequest(w http.ResponseWriter, r *http.Request) {
-	registry := prometheus.NewRegistry()
+var (
+	ErrModuleNotEnabled = errors.New("module is not enabled in profile")
+	ErrProbeDeadline    = errors.New("skipped, probe deadline (scrape timeout) exceeded")
+)
 
-	requestTime := time.Now()
+type (
+	Probe struct {
+		Module         string
+		Params         map[string]string
+		ProfileName    string
+		Profile        *config.ConfigProfile
+		CacheTime      time.Duration
+		ScrapeInterval time.Duration
+		RequestTime    time.Time
 
-	params := r.URL.Query()
-	moduleName := params.Get("module")
-	cacheKey := "cache:" + moduleName
+		// subscriptions for queries without own subscription list
+		Subscriptions []string
 
-	probeLogger := log.WithField("module", moduleName)
+		Logger *log.Entry
 
-	cacheTime := 0 * time.Second
-	cacheTimeDurationStr := params.Get("cache")
-	if cacheTimeDurationStr != "" {
-		if v, err := time.ParseDuration(cacheTimeDurationStr); err == nil {
-			cacheTime = v
-		} else {
-			probeLogger.Errorln(err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+		// config snapshot, the config might be reloaded while the probe is running
+		Config *config.Config
+
+		// dry run (query preview), no exporter metrics and debug infos are recorded
+		DryRun bool
+
+		// client which triggered the probe (remote address or cache-warmup) for the audit log
+		Caller string
+
+		// queries not started after the deadline are skipped (zero = no deadline)
+		Deadline time.Time
+
+		// queries skipped because of the deadline, the probe result is not cached
+		Skipped []string
+
+		// executed queries of the current execution (incl. dependencies)
+		results map[*config.ConfigQuery]*ProbeQueryResult
+	}
+
+	ProbeQueryResult struct {
+		MetricList kusto.MetricList
+
+		// raw result rows (only collected if other queries depend on the query)
+		Rows config.QueryResult
+
+		// details of the execution (not cached)
+		Debug *QueryDebugInfo `json:"-"`
 	}
+)
 
-	ctx := context.Background()
+func handleProbeRequest(w http.ResponseWriter, r *http.Request) {
+	if !isAzureReady() {
+		http.Error(w, ErrAzureNotReady.Error(), http.StatusServiceUnavailable)
+		return
+	}
 
-	defaultSubscriptions := []string{}
-	for _, subscription := range AzureSubscriptions {
-		defaultSubscriptions = append(defaultSubscriptions, *subscription.SubscriptionID)
+	probe, err := newProbeFromRequest(r)
+	if err == nil {
+		err = probe.ValidateParams()
+	}
+	if err != nil {
+		logRateLimiter.Error(log.NewEntry(log.StandardLogger()), err.Error())
+		if errors.Is(err, ErrModuleNotEnabled) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
 	}
 
-	// Create and authorize a ResourceGraph client
-	resourcegraphClient := resourcegraph.NewWithBaseURI(AzureEnvironment.ResourceManagerEndpoint)
-	decorateAzureAutoRest(&resourcegraphClient.Client)
+	probeLogger := probe.Logger
+	cacheKey := probe.CacheKey()
 
 	metricList := kusto.MetricList{}
 	metricList.Init()
 
 	// check if value is cached
 	executeQuery := true
-	if cacheTime.Seconds() > 0 {
-		if v, ok := metricCache.Get(cacheKey); ok {
-			if cacheData, ok := v.([]byte); ok {
-				if err := json.Unmarshal(cacheData, &metricList); err == nil {
-					probeLogger.Debug("fetched from cache")
-					w.Header().Add("X-metrics-cached", "true")
-					executeQuery = false
-				} else {
-					probeLogger.Debug("unable to parse cache data")
-				}
-			}
+	if probe.CacheTime.Seconds() > 0 {
+		if getCache(cacheKey, &metricList) {
+			probeLogger.Debug("fetched from cache")
+			w.Header().Add("X-metrics-cached", "true")
+			executeQuery = false
 		}
 	}
 
 	if executeQuery {
 		w.Header().Add("X-metrics-cached", "false")
-		for _, queryConfig := range Config.Queries {
-			// check if query matches module name
-			if queryConfig.Module != moduleName {
-				continue
-			}
-			startTime := time.Now()
 
-			contextLogger := probeLogger.WithField("metric", queryConfig.Metric)
-			contextLogger.Debug("starting query")
+		var shared bool
+		metricList, shared, err = probe.ExecuteShared(r.Context())
+		if shared {
+			w.Header().Add("X-metrics-coalesced", "true")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// partial results (skipped queries) are not cached
+		if len(probe.Skipped) > 0 {
+			w.Header().Add("X-metrics-skipped", strings.Join(probe.Skipped, ","))
+		}
 
-			if queryConfig.Subscriptions == nil {
-				queryConfig.Subscriptions = &defaultSubscriptions
+		// store to cache (if enabeld)
+		if probe.CacheTime.Seconds() > 0 && len(probe.Skipped) == 0 {
+			if err := probe.StoreCache(metricList, probe.CacheTime); err == nil {
+				w.Header().Add("X-metrics-cached-until", time.Now().Add(probe.CacheTime).Format(time.RFC3339))
 			}
+		}
+	}
 
-			requestQueryTop := int32(RESOURCEGRAPH_QUERY_OPTIONS_TOP)
-			requestQuerySkip := int32(0)
+	probeLogger.Debug("writing prometheus metrics")
+	truncated, err := writeProbeMetrics(w, r, &metricList)
+	if truncated != "" {
+		logRateLimiter.Warn(probeLogger, fmt.Sprintf("probe response truncated, limit --probe.%v exceeded", truncated))
+		prometheusProbeTruncations.With(prometheus.Labels{"module": probe.Module, "limit": truncated}).Inc()
+	}
+	if err != nil {
+		probeLogger.Warnf("unable to write metrics: %v", err)
+	}
+	probeLogger.WithField("duration", time.Since(probe.RequestTime).String()).Debug("finished request")
+}
 
-			// Set options
-			RequestOptions := resourcegraph.QueryRequestOptions{
-				ResultFormat: "objectArray",
-				Top:          &requestQueryTop,
-				Skip:         &requestQuerySkip,
-			}
+// newProbe creates a probe for the module with the default settings of the profile
+func newProbe(module, profileName string) (*Probe, error) {
+	probe := &Probe{
+		Module:         module,
+		Params:         map[string]string{},
+		ProfileName:    profileName,
+		ScrapeInterval: opts.Probe.ScrapeInterval,
+		RequestTime:    time.Now(),
+		Config:         getConfig(),
+	}
+	probe.Logger = log.WithField("module", probe.Module)
 
-			// Run the query and get the results
-			resultTotalRecords := int32(0)
-			for {
-				// Create the query request
-				Request := resourcegraph.QueryRequest{
-					Subscriptions: queryConfig.Subscriptions,
-					Query:         &queryConfig.Query,
-					Options:       &RequestOptions,
-				}
+	profile, err := probe.Config.GetProfile(probe.ProfileName)
+	if err != nil {
+		return nil, err
+	}
+	probe.Profile = profile
 
-				prometheusQueryRequests.With(prometheus.Labels{"module": moduleName, "metric": queryConfig.Metric}).Inc()
+	if !profile.IsModuleEnabled(probe.Module) {
+		return nil, fmt.Errorf("%w: module \"%v\", profile \"%v\"", ErrModuleNotEnabled, probe.Module, probe.ProfileName)
+	}
 
-				var results, queryErr = resourcegraphClient.Resources(ctx, Request)
-				if results.TotalRecords != nil {
-					resultTotalRecords = int32(*results.TotalRecords)
-				}
+	probe.CacheTime = profile.GetCacheDuration()
 
-				if queryErr == nil {
-					contextLogger.Debug("parsing result")
-
-					if resultList, ok := results.Data.([]interface{}); ok {
-						// check if we got data, otherwise break the for loop
-						if len(resultList) == 0 {
-							break
-						}
-
-						for _, v := range resultList {
-							if resultRow, ok := v.(map[string]interface{}); ok {
-								for metricName, metric := range kusto.BuildPrometheusMetricList(queryConfig.Metric, queryConfig.MetricConfig, resultRow) {
-									metricList.Add(metricName, metric...)
-								}
-							}
-						}
-					} else {
-						// got invalid or empty data, skipping
-						break
-					}
+	if len(profile.Subscriptions) > 0 {
+		probe.Subscriptions = append(probe.Subscriptions, profile.Subscriptions...)
+	} else {
+		for _, subscription := range AzureSubscriptions {
+			probe.Subscriptions = append(probe.Subscriptions, *subscription.SubscriptionID)
+		}
+	}
 
-					contextLogger.Debug("metrics parsed")
-				} else {
-					contextLogger.Errorln(queryErr.Error())
-					http.Error(w, queryErr.Error(), http.StatusBadRequest)
-					return
-				}
+	return probe, nil
+}
+
+// newProbeFromRequest parses and validates the probe request params
+func newProbeFromRequest(r *http.Request) (*Probe, error) {
+	params := r.URL.Query()
+
+	profileName := opts.Config.Profile
+	if v := params.Get("profile"); v != "" {
+		profileName = v
+	}
+
+	probe, err := newProbe(params.Get("module"), profileName)
+	if err != nil {
+		return nil, err
+	}
+	probe.Params = parseProbeQueryParams(params)
+	probe.Caller = r.RemoteAddr
+
+	// deadline from the Prometheus scrape timeout
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if timeout, err := strconv.ParseFloat(v, 64); err == nil && timeout > 0 {
+			probe.Deadline = time.Now().Add(time.Duration(timeout*float64(time.Second)) - opts.Probe.TimeoutOffset)
+		}
+	}
+
+	if v := params.Get("cache"); v != "" {
+		if probe.CacheTime, err = time.ParseDuration(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if v := params.Get("interval"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		if probe.ScrapeInterval, err = roundProbeScrapeInterval(interval, opts.Probe.ScrapeInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	return probe, nil
+}
+
+// roundProbeScrapeInterval rounds the interval to a multiple of the default scrape interval (up to
+// ProbeScrapeIntervalMaxFactor), the interval is part of the cache key and arbitrary values would create
+// new cache entries and executions per value
+func roundProbeScrapeInterval(interval, defaultInterval time.Duration) (time.Duration, error) {
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval \"%v\", must be positive", interval)
+	}
+
+	interval = interval.Round(defaultInterval)
+	if interval < defaultInterval {
+		interval = defaultInterval
+	} else if maxInterval := defaultInterval * ProbeScrapeIntervalMaxFactor; interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval, nil
+}
+
+// ValidateParams checks that all params are declared by the queries of the module,
+// undeclared params would create new cache entries and executions per value
+func (p *Probe) ValidateParams() error {
+	declaredParams := p.moduleParamNames()
+	undeclaredParams := []string{}
+	for paramName := range p.Params {
+		if !declaredParams[paramName] {
+			undeclaredParams = append(undeclaredParams, ProbeQueryParamPrefix+paramName)
+		}
+	}
+
+	if len(undeclaredParams) > 0 {
+		sort.Strings(undeclaredParams)
+		return fmt.Errorf("query params not declared by the queries of module \"%v\": %v", p.Module, strings.Join(undeclaredParams, ", "))
+	}
+	return nil
+}
+
+// StoreCache saves the metrics to the cache
+func (p *Probe) StoreCache(metricList kusto.MetricList, ttl time.Duration) error {
+	if err := setCache(p.CacheKey(), metricList, ttl); err != nil {
+		return err
+	}
+
+	p.Logger.Debugf("saved metric to cache for %s minutes", ttl.String())
+	return nil
+}
+
+// Execute runs all queries of the module (and their dependencies) and returns the generated metrics
+func (p *Probe) Execute(ctx context.Context) (kusto.MetricList, error) {
+	defer trackProbeExecution()()
+
+	metricList := kusto.MetricList{}
+	metricList.Init()
+
+	resourcegraphClient := newResourceGraphClient()
+	p.results = map[*config.ConfigQuery]*ProbeQueryResult{}
+
+	for _, queryConfig := range p.Config.GetModuleQueriesByPriority(p.Module) {
+		result, err := p.executeQueryWithDependencies(ctx, resourcegraphClient, queryConfig)
+		if errors.Is(err, ErrQueryDisabled) {
+			p.Logger.WithField("metric", queryConfig.Metric).Debug(err)
+			continue
+		} else if errors.Is(err, ErrProbeDeadline) {
+			p.Logger.WithField("metric", queryConfig.Metric).Warn(err)
+			p.Skipped = append(p.Skipped, queryConfig.GetName())
+			prometheusQuerySkipped.With(prometheus.Labels{"module": p.Module, "metric": queryConfig.Metric}).Inc()
+			continue
+		} else if err != nil {
+			return metricList, err
+		}
+
+		// canary queries are executed (self-metrics, dependencies) but their metrics are not published
+		if queryConfig.Canary && !p.DryRun {
+			p.Logger.WithField("metric", queryConfig.Metric).Debug("canary query, metrics are not published")
+			continue
+		}
+
+		for metricName, metric := range result.MetricList.List {
+			metricList.Add(metricName, metric...)
+		}
+	}
+
+	if p.Module == config.BuiltinComputeModule && isComputeQuotaEnabled() {
+		p.collectComputeQuotas(ctx, &metricList)
+	}
+
+	// derived metrics are evaluated in order, later ones can use earlier ones
+	for i := range p.Config.DerivedMetrics {
+		derivedConfig := &p.Config.DerivedMetrics[i]
+		if derivedConfig.Module != p.Module {
+			continue
+		}
+
+		metricList.Add(derivedConfig.Metric, derivedConfig.Evaluate(metricList.GetMetricList)...)
+	}
+
+	return metricList, nil
+}
+
+// executeQueryWithDependencies runs the dependencies and the query, every query is only executed once per probe
+func (p *Probe) executeQueryWithDependencies(ctx context.Context, client ResourceGraphClient, queryConfig *config.ConfigQuery) (*ProbeQueryResult, error) {
+	if result, ok := p.results[queryConfig]; ok {
+		return result, nil
+	}
+
+	if isQueryDisabled(queryConfig.GetName()) && !p.DryRun {
+		return nil, fmt.Errorf("query \"%v\": %w", queryConfig.GetName(), ErrQueryDisabled)
+	}
+
+	// query result cache (if enabled for the query)
+	queryCacheKey := p.QueryCacheKey(queryConfig)
+	queryCacheTime := queryConfig.GetCacheDuration()
+	if queryCacheTime > 0 {
+		result := &ProbeQueryResult{}
+		if getCache(queryCacheKey, result) {
+			p.Logger.WithField("metric", queryConfig.Metric).Debug("fetched query result from cache")
+			p.results[queryConfig] = result
+			return result, nil
+		}
+	}
+
+	// cached results are still used after the deadline
+	if !p.Deadline.IsZero() && time.Now().After(p.Deadline) {
+		return nil, fmt.Errorf("query \"%v\": %w", queryConfig.GetName(), ErrProbeDeadline)
+	}
+
+	dependencyResults := map[string]config.QueryResult{}
+	for _, dependency := range queryConfig.DependsOn {
+		dependencyConfig, err := p.Config.GetQueryByName(dependency)
+		if err != nil {
+			return nil, err
+		}
+
+		dependencyResult, err := p.executeQueryWithDependencies(ctx, client, dependencyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("query \"%v\": dependency \"%v\" failed: %w", queryConfig.GetName(), dependency, err)
+		}
+		dependencyResults[dependency] = dependencyResult.Rows
+	}
+
+	result, err := p.executeQuery(ctx, client, *queryConfig, dependencyResults)
+	if err != nil {
+		return nil, err
+	}
+
+	if queryConfig.Compare != nil {
+		if err := p.executeCompareQuery(ctx, client, *queryConfig, dependencyResults, result); err != nil {
+			return nil, fmt.Errorf("query \"%v\": compare offset \"%v\" failed: %w", queryConfig.GetName(), queryConfig.Compare.Offset, err)
+		}
+	}
+
+	if queryCacheTime > 0 {
+		if err := setCache(queryCacheKey, result, queryCacheTime); err != nil {
+			p.Logger.WithField("metric", queryConfig.Metric).Debugf("unable to cache query result: %v", err)
+		}
+	}
+
+	p.results[queryConfig] = result
+	if queryConfig.Critical && !p.DryRun {
+		markCriticalQuerySucceeded(queryConfig.GetName())
+	}
+	return result, nil
+}
+
+// executeQuery runs one query and builds and post-processes the metrics
+func (p *Probe) executeQuery(ctx context.Context, client ResourceGraphClient, queryConfig config.ConfigQuery, dependencyResults map[string]config.QueryResult) (*ProbeQueryResult, error) {
+	defer trackQueryExecution()()
+	return p.executeQueryAttempt(ctx, client, queryConfig, dependencyResults, false)
+}
+
+// executeQueryAttempt runs the query, if the results changed while paginating the query is retried once
+// (--azure.pagination.retry-on-skew), otherwise the metrics are flagged as inconsistent
+func (p *Probe) executeQueryAttempt(ctx context.Context, client ResourceGraphClient, queryConfig config.ConfigQuery, dependencyResults map[string]config.QueryResult, retried bool) (*ProbeQueryResult, error) {
+	startTime := time.Now()
+	metricLabels := prometheus.Labels{"module": p.Module, "metric": queryConfig.Metric}
+
+	contextLogger := p.Logger.WithField("metric", queryConfig.Metric)
+	contextLogger.Debug("starting query")
+
+	result := &ProbeQueryResult{}
+	result.MetricList.Init()
+	queryMetricList := &result.MetricList
+	collectRows := p.Config.IsDependency(queryConfig.GetName())
+	exportRows := isQueryExportEnabled() && !p.DryRun
+	exportedRows := []map[string]interface{}{}
+	debugInfo := newQueryDebugInfo(p, queryConfig)
+
+	query, err := buildQuery(queryConfig, p.Params, p.RequestTime, p.ScrapeInterval, dependencyResults)
+	if err == nil {
+		// template actions of ad-hoc queries can emit any text
+		err = queryConfig.CheckPolicy(query)
+	}
+	if err != nil {
+		logRateLimiter.Error(contextLogger, err.Error())
+		debugInfo.Finish(queryConfig, queryMetricList, err)
+		return nil, err
+	}
+	debugInfo.Query = query
+
+	subscriptions := p.Subscriptions
+	if queryConfig.Subscriptions != nil {
+		subscriptions = *queryConfig.Subscriptions
+	}
+
+	onRequest := func() {
+		if !p.DryRun {
+			prometheusQueryRequests.With(metricLabels).Inc()
+		}
+	}
+
+	rowCount := 0
+	schema := newQuerySchema()
+	processRow := func(row map[string]interface{}, labels prometheus.Labels) {
+		rowCount++
+		debugInfo.AddRow(row)
+		if collectRows {
+			result.Rows = append(result.Rows, row)
+		}
+		if exportRows {
+			exportedRows = append(exportedRows, row)
+		}
+
+		rowMetricList := kusto.BuildPrometheusMetricList(queryConfig.Metric, queryConfig.MetricConfig, row)
+		timestamp, hasTimestamp := time.Time{}, false
+		if isMetricTimestampEnabled(queryConfig) {
+			timestamp, hasTimestamp = parseMetricRowTimestamp(row, queryConfig.Timestamp, p.RequestTime)
+		}
+		if opts.Azure.Lighthouse.TenantLabels {
+			addSubscriptionTenantLabels(row, rowMetricList)
+		}
 
-				*RequestOptions.Skip += requestQueryTop
-				if *RequestOptions.Skip >= resultTotalRecords {
-					break
+		for metricName, metric := range rowMetricList {
+			for _, metricRow := range metric {
+				for labelName, labelValue := range labels {
+					metricRow.Labels[labelName] = labelValue
 				}
 			}
+			if hasTimestamp {
+				setMetricRowTimestamp(metric, timestamp)
+			}
+			queryMetricList.Add(metricName, metric...)
+		}
+	}
 
-			elapsedTime := time.Since(startTime)
-			contextLogger.WithField("results", resultTotalRecords).Debugf("fetched %v results", resultTotalRecords)
-			prometheusQueryTime.With(prometheus.Labels{"module": moduleName, "metric": queryConfig.Metric}).Observe(elapsedTime.Seconds())
-			prometheusQueryResults.With(prometheus.Labels{"module": moduleName, "metric": queryConfig.Metric}).Set(float64(resultTotalRecords))
+	resultTotalRecords := int64(0)
+	resultSkew := []string{}
+	columnsValidated := false
+	processQueryResult := func(queryResult ResourceGraphQueryResult, labels prometheus.Labels) {
+		resultTotalRecords += queryResult.TotalRecords
+		resultSkew = append(resultSkew, queryResult.Skew...)
+		schema.AddColumns(queryResult.Columns)
+
+		// the field mapping is checked against the column types once (table format only),
+		// post-processed rows have other columns
+		if queryResult.Columns != nil && !columnsValidated && len(queryConfig.PostProcess) == 0 {
+			columnsValidated = true
+			for _, err := range validateResourceGraphColumns(queryConfig, queryResult.Columns) {
+				logRateLimiter.Warn(contextLogger, err.Error())
+				debugInfo.Warn("%v", err)
+			}
 		}
 
-		// store to cache (if enabeld)
-		if cacheTime.Seconds() > 0 {
-			if cacheData, err := json.Marshal(metricList); err == nil {
-				w.Header().Add("X-metrics-cached-until", time.Now().Add(cacheTime).Format(time.RFC3339))
-				metricCache.Set(cacheKey, cacheData, cacheTime)
-				probeLogger.Debugf("saved metric to cache for %s minutes", cacheTime.String())
+		// facets are published as their own metrics, failed facets don't fail the query
+		for _, err := range buildFacetMetricList(queryMetricList, queryConfig, queryResult.Facets, labels) {
+			logRateLimiter.Warn(contextLogger, err.Error())
+			debugInfo.Warn("%v", err)
+		}
+	}
+
+	// rows of a request (subscription in perSubscription mode) are buffered for the post-processing
+	executeRequest := func(request ResourceGraphRequest, labels prometheus.Labels) (ResourceGraphQueryResult, error) {
+		rows := []map[string]interface{}{}
+		queryResult, err := executeResourceGraphQuery(ctx, client, request, onRequest, func(row map[string]interface{}) {
+			schema.AddRow(row)
+			if len(queryConfig.PostProcess) > 0 {
+				rows = append(rows, row)
+				return
+			}
+			processRow(row, labels)
+		})
+		if err == nil {
+			for _, row := range queryConfig.PostProcessRows(rows) {
+				processRow(row, labels)
 			}
 		}
+		return queryResult, err
 	}
 
-	probeLogger.Debug("building prometheus metrics")
-	for _, metricName := range metricList.GetMetricNames() {
-		metricLabelNames := metricList.GetMetricLabelNames(metricName)
+	for _, cloudSubscriptions := range groupSubscriptionsByCloud(subscriptions) {
+		cloudName := cloudSubscriptions.Cloud.Name
+		cloudLabels := prometheus.Labels{}
+		cloudLogger := contextLogger
+		if isMultiCloud() {
+			cloudLabels[AzureCloudLabel] = cloudName
+			cloudLogger = contextLogger.WithField("cloud", cloudName)
+		}
 
-		gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: metricName,
-			Help: metricName,
-		}, metricLabelNames)
-		registry.MustRegister(gaugeVec)
+		if queryConfig.PerSubscription {
+			// execute query per subscription, failures are isolated to the subscription
+			for _, subscriptionId := range cloudSubscriptions.Subscriptions {
+				labels := prometheus.Labels{
+					SubscriptionFanOutLabelID:   subscriptionId,
+					SubscriptionFanOutLabelName: getSubscriptionDisplayName(subscriptionId),
+				}
+				for labelName, labelValue := range cloudLabels {
+					labels[labelName] = labelValue
+				}
 
-		for _, metric := range metricList.GetMetricList(metricName) {
-			for _, labelName := range metricLabelNames {
-				if _, ok := metric.Labels[labelName]; !ok {
-					metric.Labels[labelName] = ""
+				request := p.newResourceGraphRequest(queryConfig, query, cloudName, []string{subscriptionId})
+				queryResult, err := executeRequest(request, labels)
+				if err != nil {
+					logRateLimiter.Error(cloudLogger.WithField("subscriptionID", subscriptionId), err.Error())
+					if !p.DryRun {
+						prometheusQueryErrors.With(metricLabels).Inc()
+					}
+					debugInfo.Warn("subscription \"%v\" failed: %v", subscriptionId, err)
+					continue
 				}
+				processQueryResult(queryResult, labels)
 			}
-
-			if metric.Value != nil {
-				gaugeVec.With(metric.Labels).Set(*metric.Value)
+		} else {
+			request := p.newResourceGraphRequest(queryConfig, query, cloudName, cloudSubscriptions.Subscriptions)
+			queryResult, err := executeRequest(request, cloudLabels)
+			if err != nil {
+				logRateLimiter.Error(cloudLogger, err.Error())
+				if !p.DryRun {
+					prometheusQueryErrors.With(metricLabels).Inc()
+				}
+				debugInfo.Finish(queryConfig, queryMetricList, err)
+				return nil, err
 			}
+			processQueryResult(queryResult, cloudLabels)
+		}
+	}
+	contextLogger.Debug("metrics parsed")
+
+	if len(resultSkew) > 0 {
+		if opts.Azure.Pagination.RetryOnSkew && !retried {
+			contextLogger.Warnf("results changed while paginating (%v), retrying query", strings.Join(resultSkew, ", "))
+			return p.executeQueryAttempt(ctx, client, queryConfig, dependencyResults, true)
+		}
+		logRateLimiter.Warn(contextLogger, fmt.Sprintf("results changed while paginating (%v), metrics might be inconsistent", strings.Join(resultSkew, ", ")))
+		debugInfo.Warn("results changed while paginating (%v), metrics might be inconsistent", strings.Join(resultSkew, ", "))
+	}
+
+	// schema drift (eg. after Azure API changes) would otherwise only show up as vanished series
+	columns := schema.Columns()
+	if !p.DryRun {
+		added, removed := updateQuerySchema(p.Module, queryConfig.GetName(), queryConfig.Query, columns)
+		if len(added) > 0 || len(removed) > 0 {
+			message := fmt.Sprintf("result columns changed since last execution (added: [%v], removed: [%v])", strings.Join(added, ", "), strings.Join(removed, ", "))
+			logRateLimiter.Warn(contextLogger.WithField("columns", columns), message)
+			debugInfo.Warn("%v", message)
+			prometheusQuerySchemaChanges.With(metricLabels).Inc()
+		}
+	}
+
+	if queryConfig.IsNormalizeLabelsEnabled() {
+		normalizeMetricListLabels(queryMetricList)
+	}
+	if queryConfig.IsStateSet() {
+		expandStateSetMetricList(queryMetricList, queryConfig)
+	}
+	applyPublishIfEmpty(queryMetricList, queryConfig, rowCount == 0)
+
+	// relabeling might create duplicates or change the labels used for sorting, so it's applied before dedup and topN
+	relabelMetricList(queryMetricList, queryConfig.RelabelConfigs)
+	relabelMetricList(queryMetricList, p.Config.RelabelConfigs)
+	sanitizeMetricList(queryMetricList)
+
+	dedupStrategy := queryConfig.GetDedupStrategy()
+	if dedupStrategy == config.DedupStrategyNone {
+		dedupStrategy = opts.Probe.DedupStrategy
+	}
+	for _, duplicate := range dedupMetricList(queryMetricList, dedupStrategy) {
+		logRateLimiter.Warn(
+			contextLogger.WithFields(log.Fields{
+				"query":    query,
+				"series":   duplicate.MetricName,
+				"labels":   duplicate.Labels,
+				"values":   duplicate.FormatValues(),
+				"strategy": dedupStrategy,
+			}),
+			fmt.Sprintf("found %v rows with identical labels for series \"%v\", merged using strategy \"%v\"", len(duplicate.Values), duplicate.MetricName, dedupStrategy),
+		)
+		if !p.DryRun {
+			prometheusQueryDuplicateSeries.With(metricLabels).Add(float64(len(duplicate.Values) - 1))
+		}
+		debugInfo.Warn("found %v rows with identical labels for series \"%v\" (%v), merged using strategy \"%v\"", len(duplicate.Values), duplicate.MetricName, duplicate.Labels, dedupStrategy)
+	}
+	topNMetricList(queryMetricList, queryConfig.TopN, queryConfig.GetSortBy(), queryConfig.IsTopNOtherEnabled())
+
+	debugInfo.TotalRecords = resultTotalRecords
+	debugInfo.Finish(queryConfig, queryMetricList, nil)
+	result.Debug = debugInfo
+
+	if exportRows {
+		queryExporter.Enqueue(QueryExport{
+			Module:       p.Module,
+			Query:        queryConfig.GetName(),
+			Metric:       queryConfig.Metric,
+			Profile:      p.ProfileName,
+			Params:       p.Params,
+			Time:         startTime,
+			TotalRecords: resultTotalRecords,
+			RowCount:     rowCount,
+			Rows:         exportedRows,
+		})
+	}
+
+	elapsedTime := time.Since(startTime)
+	contextLogger.WithField("results", resultTotalRecords).Debugf("fetched %v results", resultTotalRecords)
+	if !p.DryRun {
+		prometheusQueryTime.With(metricLabels).Observe(elapsedTime.Seconds())
+		prometheusQueryResults.With(metricLabels).Set(float64(resultTotalRecords))
+		prometheusQuerySeries.With(metricLabels).Set(float64(countMetricListSeries(queryMetricList)))
+		if len(columns) > 0 {
+			prometheusQueryColumns.With(metricLabels).Set(float64(len(columns)))
+		}
+		if queryConfig.Canary {
+			prometheusQueryCanary.With(metricLabels).Set(1)
+		} else {
+			prometheusQueryCanary.With(metricLabels).Set(0)
+		}
+		if len(resultSkew) > 0 {
+			prometheusQueryInconsistent.With(metricLabels).Set(1)
+		} else {
+			prometheusQueryInconsistent.With(metricLabels).Set(0)
+		}
+	}
+
+	return result, nil
+}
+
+// countMetricListSeries returns the number of series of all metrics
+func countMetricListSeries(metricList *kusto.MetricList) (count int) {
+	for _, metric := range metricList.List {
+		count += len(metric)
+	}
+	return
+}
+
+// newResourceGraphRequest builds the ResourceGraph request for the query
+func (p *Probe) newResourceGraphRequest(queryConfig config.ConfigQuery, query, cloud string, subscriptions []string) ResourceGraphRequest {
+	request := ResourceGraphRequest{
+		Module:          p.Module,
+		QueryName:       queryConfig.GetName(),
+		Cloud:           cloud,
+		Params:          map[string]string{},
+		Query:           query,
+		Subscriptions:   subscriptions,
+		PerSubscription: queryConfig.PerSubscription,
+		Identity:        queryConfig.Identity,
+		Caller:          p.Caller,
+		ResultFormat:    queryConfig.GetResultFormat(),
+		SplitKey:        queryConfig.GetSplitKey(),
+		ApiVersion:      queryConfig.ResourceGraphApiVersion,
+		Facets:          newResourceGraphFacetRequests(queryConfig.Facets),
+	}
+
+	// only params used by the query are part of the request
+	for _, param := range queryConfig.Params {
+		if value, ok := p.Params[param.Name]; ok {
+			request.Params[param.Name] = value
 		}
 	}
-	probeLogger.WithField("duration", time.Since(requestTime).String()).Debug("finished request")
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	return request
 }
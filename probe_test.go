@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoundProbeScrapeInterval(t *testing.T) {
+	testCases := []struct {
+		interval time.Duration
+		expected time.Duration
+		err      string
+	}{
+		{interval: time.Minute, expected: time.Minute},
+		{interval: 5 * time.Minute, expected: 5 * time.Minute},
+		{interval: 5*time.Minute + 1*time.Second, expected: 5 * time.Minute},
+		{interval: 5*time.Minute + 30*time.Second, expected: 6 * time.Minute},
+		{interval: 299999 * time.Millisecond, expected: 5 * time.Minute},
+		{interval: time.Second, expected: time.Minute},
+		{interval: time.Nanosecond, expected: time.Minute},
+		{interval: time.Hour, expected: time.Hour},
+		{interval: 48 * time.Hour, expected: time.Hour},
+		{interval: 0, err: `invalid interval "0s", must be positive`},
+		{interval: -time.Minute, err: `invalid interval "-1m0s", must be positive`},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := roundProbeScrapeInterval(testCase.interval, time.Minute)
+		switch {
+		case testCase.err != "" && (err == nil || err.Error() != testCase.err):
+			t.Errorf("%v: expected error %q, got %v", testCase.interval, testCase.err, err)
+		case testCase.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", testCase.interval, err)
+		case actual != testCase.expected:
+			t.Errorf("%v: expected %v, got %v", testCase.interval, testCase.expected, actual)
+		}
+	}
+
+	// all intervals map to a bounded set of cache keys
+	intervals := map[time.Duration]bool{}
+	for interval := time.Millisecond; interval < 100*time.Hour; interval += 7 * time.Second {
+		rounded, _ := roundProbeScrapeInterval(interval, time.Minute)
+		intervals[rounded] = true
+	}
+	if len(intervals) != ProbeScrapeIntervalMaxFactor {
+		t.Errorf("expected %v different intervals, got %v", ProbeScrapeIntervalMaxFactor, len(intervals))
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	// QueryDebugInfo contains details of the last execution of a query
+	QueryDebugInfo struct {
+		Module       string                   `json:"module"`
+		Name         string                   `json:"name"`
+		Metric       string                   `json:"metric"`
+		Profile      string                   `json:"profile"`
+		Time         time.Time                `json:"time"`
+		Duration     string                   `json:"duration"`
+		Query        string                   `json:"query"`
+		TotalRecords int64                    `json:"totalRecords"`
+		RowCount     int                      `json:"rowCount"`
+		Rows         []map[string]interface{} `json:"rows"`
+		SeriesCount  int                      `json:"seriesCount"`
+		Warnings     []string                 `json:"warnings"`
+		Error        string                   `json:"error,omitempty"`
+
+		columns map[string]bool
+		store   bool
+		mutex   sync.Mutex
+	}
+)
+
+var (
+	// last execution per module and query name
+	queryDebugInfos      = map[string]*QueryDebugInfo{}
+	queryDebugInfosMutex sync.RWMutex
+)
+
+func newQueryDebugInfo(p *Probe, queryConfig config.ConfigQuery) *QueryDebugInfo {
+	return &QueryDebugInfo{
+		Module:   p.Module,
+		Name:     queryConfig.GetName(),
+		Metric:   queryConfig.Metric,
+		Profile:  p.ProfileName,
+		Time:     time.Now(),
+		Rows:     []map[string]interface{}{},
+		Warnings: []string{},
+		columns:  map[string]bool{},
+		store:    !p.DryRun,
+	}
+}
+
+// AddRow counts the row, keeps the first rows and collects the column names
+func (d *QueryDebugInfo) AddRow(row map[string]interface{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.RowCount++
+	if len(d.Rows) < opts.Api.DebugRows {
+		d.Rows = append(d.Rows, row)
+	}
+	for column := range row {
+		d.columns[column] = true
+	}
+}
+
+// Warn adds a mapping warning
+func (d *QueryDebugInfo) Warn(format string, args ...interface{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.Warnings = append(d.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Finish stores the result of the execution as last execution of the query
+func (d *QueryDebugInfo) Finish(queryConfig config.ConfigQuery, metricList *kusto.MetricList, err error) {
+	d.Duration = time.Since(d.Time).String()
+
+	if err != nil {
+		d.Error = err.Error()
+	} else {
+		d.checkMapping(queryConfig, metricList)
+	}
+
+	if !d.store {
+		return
+	}
+
+	queryDebugInfosMutex.Lock()
+	defer queryDebugInfosMutex.Unlock()
+	queryDebugInfos[d.Module+"/"+d.Name] = d
+}
+
+// checkMapping detects configured fields which are missing in the result and rows without series
+func (d *QueryDebugInfo) checkMapping(queryConfig config.ConfigQuery, metricList *kusto.MetricList) {
+	for _, metricName := range metricList.GetMetricNames() {
+		d.SeriesCount += len(metricList.GetMetricList(metricName))
+	}
+
+	if d.RowCount == 0 {
+		d.Warn("query returned no rows")
+		return
+	}
+
+	for _, field := range queryConfig.MetricConfig.Fields {
+		if !d.columns[field.Name] {
+			d.Warn("field \"%v\" is configured but not part of the result (columns: %v)", field.Name, strings.Join(d.columnNames(), ", "))
+		}
+	}
+
+	if d.SeriesCount == 0 {
+		d.Warn("%v rows returned but no series generated (check value field, publish and relabel configs)", d.RowCount)
+	}
+}
+
+func (d *QueryDebugInfo) columnNames() []string {
+	names := []string{}
+	for name := range d.columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleApiQueryDebug serves /api/query/{name}/debug with the last executions of the query (all modules or ?module=)
+func handleApiQueryDebug(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/query/")
+	if !strings.HasSuffix(path, "/debug") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimSuffix(path, "/debug")
+
+	module, filterModule := r.URL.Query()["module"]
+
+	queryDebugInfosMutex.RLock()
+	ret := []*QueryDebugInfo{}
+	for _, info := range queryDebugInfos {
+		if info.Name != name {
+			continue
+		}
+		if filterModule && info.Module != module[0] {
+			continue
+		}
+		ret = append(ret, info)
+	}
+	queryDebugInfosMutex.RUnlock()
+
+	if len(ret) == 0 {
+		http.Error(w, fmt.Sprintf("no execution of query \"%v\" found", name), http.StatusNotFound)
+		return
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Module < ret[j].Module
+	})
+
+	writeApiJson(w, ret)
+}
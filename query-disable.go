@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrQueryDisabled is returned for queries disabled via /api/query/{name}/disable
+	ErrQueryDisabled = errors.New("query is disabled")
+
+	disabledQueries      = map[string]DisabledQuery{}
+	disabledQueriesMutex sync.RWMutex
+)
+
+type (
+	// DisabledQuery is a query switched off at runtime
+	DisabledQuery struct {
+		Query  string    `json:"query"`
+		Reason string    `json:"reason,omitempty"`
+		Caller string    `json:"caller,omitempty"`
+		Time   time.Time `json:"time"`
+	}
+)
+
+// initQueryDisable loads the persisted disabled queries (--api.query.disabled-file)
+func initQueryDisable() error {
+	if opts.Api.Query.DisabledFile == "" {
+		return nil
+	}
+
+	/*  #nosec G304 */
+	content, err := ioutil.ReadFile(opts.Api.Query.DisabledFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read disabled queries \"%v\" of --api.query.disabled-file: %w", opts.Api.Query.DisabledFile, err)
+	}
+
+	list := []DisabledQuery{}
+	if err := json.Unmarshal(content, &list); err != nil {
+		return fmt.Errorf("unable to parse disabled queries \"%v\" of --api.query.disabled-file: %w", opts.Api.Query.DisabledFile, err)
+	}
+
+	disabledQueriesMutex.Lock()
+	defer disabledQueriesMutex.Unlock()
+	for _, disabledQuery := range list {
+		disabledQueries[disabledQuery.Query] = disabledQuery
+		prometheusQueryDisabled.WithLabelValues(disabledQuery.Query).Set(1)
+		log.WithField("query", disabledQuery.Query).Warnf("query is disabled since %v (%v)", disabledQuery.Time.Format(time.RFC3339), disabledQuery.Reason)
+	}
+	return nil
+}
+
+// isQueryDisabled checks if the query was disabled at runtime
+func isQueryDisabled(name string) bool {
+	disabledQueriesMutex.RLock()
+	defer disabledQueriesMutex.RUnlock()
+	_, ok := disabledQueries[name]
+	return ok
+}
+
+// getDisabledQueries returns all disabled queries sorted by name
+func getDisabledQueries() []DisabledQuery {
+	disabledQueriesMutex.RLock()
+	defer disabledQueriesMutex.RUnlock()
+
+	ret := []DisabledQuery{}
+	for _, disabledQuery := range disabledQueries {
+		ret = append(ret, disabledQuery)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Query < ret[j].Query
+	})
+	return ret
+}
+
+// setQueryDisabled disables or enables the query and persists the disabled queries (if enabled)
+func setQueryDisabled(name string, disabled bool, reason, caller string) error {
+	disabledQueriesMutex.Lock()
+	if disabled {
+		disabledQueries[name] = DisabledQuery{Query: name, Reason: reason, Caller: caller, Time: time.Now()}
+		prometheusQueryDisabled.WithLabelValues(name).Set(1)
+	} else {
+		delete(disabledQueries, name)
+		prometheusQueryDisabled.DeleteLabelValues(name)
+	}
+	disabledQueriesMutex.Unlock()
+
+	return persistDisabledQueries()
+}
+
+func persistDisabledQueries() error {
+	if opts.Api.Query.DisabledFile == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(getDisabledQueries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to temp file first, a crash must not leave a partial file
+	tmpFile := opts.Api.Query.DisabledFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return fmt.Errorf("unable to persist disabled queries: %w", err)
+	}
+	if err := os.Rename(tmpFile, opts.Api.Query.DisabledFile); err != nil {
+		return fmt.Errorf("unable to persist disabled queries: %w", err)
+	}
+	return nil
+}
+
+// handleApiQueryDisable serves POST /api/query/{name}/disable (optional ?reason=) and POST /api/query/{name}/enable
+func handleApiQueryDisable(w http.ResponseWriter, r *http.Request, name string, disabled bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queries := getConfig().GetDependentQueries(name)
+	if len(queries) == 0 && !isQueryDisabled(name) {
+		http.Error(w, fmt.Sprintf("query \"%v\" not found", name), http.StatusNotFound)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if err := setQueryDisabled(name, disabled, reason, r.RemoteAddr); err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// cached probe results of the affected modules still contain (or miss) the metrics of the query
+	if len(queries) > 0 {
+		queryMatches := cacheQueryMatcher(queries)
+		invalidateCacheEntries("api", findCacheEntries(func(key string, info ProbeCacheKey) bool {
+			return queryMatches(info)
+		}))
+	}
+
+	contextLogger := log.WithFields(log.Fields{"query": name, "caller": r.RemoteAddr})
+	if disabled {
+		contextLogger.Warnf("api: query disabled (reason: %v)", reason)
+	} else {
+		contextLogger.Infof("api: query enabled")
+	}
+
+	writeApiJson(w, getDisabledQueries())
+}
+
+// handleApiQuery routes /api/query/{name}/{debug,disable,enable}
+func handleApiQuery(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/query/")
+	switch {
+	case strings.HasSuffix(path, "/disable"):
+		handleApiQueryDisable(w, r, strings.TrimSuffix(path, "/disable"), true)
+	case strings.HasSuffix(path, "/enable"):
+		handleApiQueryDisable(w, r, strings.TrimSuffix(path, "/enable"), false)
+	default:
+		handleApiQueryDebug(w, r)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	QueryPreviewMaxBodySize = 1024 * 1024
+)
+
+type (
+	// ApiQueryPreviewResponse contains the series a query would generate (dry run)
+	ApiQueryPreviewResponse struct {
+		*QueryDebugInfo
+		Series []ApiQueryPreviewSeries `json:"series"`
+	}
+
+	ApiQueryPreviewSeries struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+		Value  *float64          `json:"value"`
+	}
+)
+
+// handleApiQueryPreview executes the posted query (yaml, same format as in the config file) as dry run
+// and returns the generated series, supports the probe params profile, interval and param.*
+func handleApiQueryPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !isAzureReady() {
+		http.Error(w, ErrAzureNotReady.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, QueryPreviewMaxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	queryConfig, err := getConfig().ParseAdhocQuery(content, adhocQueryPolicy())
+	if err != nil {
+		if config.IsQueryPolicyError(err) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	// the module of the request is defined by the query
+	query := r.URL.Query()
+	query.Set("module", queryConfig.Module)
+	r.URL.RawQuery = query.Encode()
+
+	probe, err := newProbeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	probe.DryRun = true
+	probe.results = map[*config.ConfigQuery]*ProbeQueryResult{}
+
+	client := newResourceGraphClient()
+
+	dependencyResults := map[string]config.QueryResult{}
+	for _, dependency := range queryConfig.DependsOn {
+		dependencyConfig, err := probe.Config.GetQueryByName(dependency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dependencyResult, err := probe.executeQueryWithDependencies(r.Context(), client, dependencyConfig)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("dependency \"%v\" failed: %v", dependency, err), http.StatusBadGateway)
+			return
+		}
+		dependencyResults[dependency] = dependencyResult.Rows
+	}
+
+	result, err := probe.executeQuery(r.Context(), client, queryConfig, dependencyResults)
+	if err != nil {
+		if config.IsQueryPolicyError(err) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	response := ApiQueryPreviewResponse{
+		QueryDebugInfo: result.Debug,
+		Series:         []ApiQueryPreviewSeries{},
+	}
+	for _, metricName := range result.MetricList.GetMetricNames() {
+		for _, metric := range result.MetricList.GetMetricList(metricName) {
+			response.Series = append(response.Series, ApiQueryPreviewSeries{
+				Name:   metricName,
+				Labels: metric.Labels,
+				Value:  metric.Value,
+			})
+		}
+	}
+	sort.SliceStable(response.Series, func(i, j int) bool {
+		if response.Series[i].Name != response.Series[j].Name {
+			return response.Series[i].Name < response.Series[j].Name
+		}
+		return fmt.Sprint(response.Series[i].Labels) < fmt.Sprint(response.Series[j].Labels)
+	})
+
+	writeApiJson(w, response)
+}
+
+// adhocQueryPolicy returns the table allowlist and operator denylist for ad-hoc queries
+func adhocQueryPolicy() *config.QueryPolicy {
+	return &config.QueryPolicy{
+		AllowedTables:   opts.Api.Query.AllowedTables,
+		DeniedOperators: opts.Api.Query.DeniedOperators,
+	}
+}
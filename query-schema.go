@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// querySchema collects the columns of a query result (table format columns and keys of the result rows)
+	querySchema struct {
+		columns map[string]bool
+	}
+)
+
+var (
+	// column set of the last execution per module and query, the query text is part of the key
+	// so changed queries (eg. after config reloads) are not reported as drift
+	querySchemas      = map[string][]string{}
+	querySchemasMutex sync.Mutex
+)
+
+func newQuerySchema() *querySchema {
+	return &querySchema{columns: map[string]bool{}}
+}
+
+// AddColumns adds the columns of a table format result
+func (s *querySchema) AddColumns(columns []ResourceGraphColumn) {
+	for _, column := range columns {
+		s.columns[column.Name] = true
+	}
+}
+
+// AddRow adds the keys of a result row
+func (s *querySchema) AddRow(row map[string]interface{}) {
+	for name := range row {
+		s.columns[name] = true
+	}
+}
+
+// Columns returns the sorted column names
+func (s *querySchema) Columns() []string {
+	columns := make([]string, 0, len(s.columns))
+	for name := range s.columns {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// updateQuerySchema stores the column set of the query and returns the columns added and removed since the
+// last execution, empty results (no rows and columns) don't change the stored column set
+func updateQuerySchema(module, queryName, query string, columns []string) (added, removed []string) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	key := strings.Join([]string{module, queryName, query}, "\x00")
+
+	querySchemasMutex.Lock()
+	previous, exists := querySchemas[key]
+	querySchemas[key] = columns
+	querySchemasMutex.Unlock()
+
+	if !exists {
+		return nil, nil
+	}
+	return diffQuerySchemaColumns(previous, columns)
+}
+
+// diffQuerySchemaColumns compares two sorted column lists
+func diffQuerySchemaColumns(previous, current []string) (added, removed []string) {
+	previousColumns := map[string]bool{}
+	for _, name := range previous {
+		previousColumns[name] = true
+	}
+
+	currentColumns := map[string]bool{}
+	for _, name := range current {
+		currentColumns[name] = true
+		if !previousColumns[name] {
+			added = append(added, name)
+		}
+	}
+
+	for _, name := range previous {
+		if !currentColumns[name] {
+			removed = append(removed, name)
+		}
+	}
+	return
+}
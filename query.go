@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	ProbeQueryParamPrefix = "param."
+)
+
+// parseProbeQueryParams extracts query params (param.<name>=<value>) from the probe request
+func parseProbeQueryParams(values url.Values) map[string]string {
+	ret := map[string]string{}
+	for name, value := range values {
+		if strings.HasPrefix(name, ProbeQueryParamPrefix) && len(value) > 0 {
+			ret[strings.TrimPrefix(name, ProbeQueryParamPrefix)] = value[0]
+		}
+	}
+	return ret
+}
+
+// buildProbeQueryParamsCacheKey builds a stable cache key suffix for the query params
+func buildProbeQueryParamsCacheKey(params map[string]string) string {
+	keys := []string{}
+	for name := range params {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, name := range keys {
+		parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(params[name]))
+	}
+	return strings.Join(parts, "&")
+}
+
+// buildQuery renders the query template with the (typed) query params, time helpers and dependency results
+func buildQuery(queryConfig config.ConfigQuery, requestParams map[string]string, now time.Time, scrapeInterval time.Duration, results map[string]config.QueryResult) (string, error) {
+	data := config.NewQueryTemplateData(now, scrapeInterval)
+	for _, dependency := range queryConfig.DependsOn {
+		data.Results[dependency] = results[dependency]
+	}
+
+	for _, param := range queryConfig.Params {
+		var value string
+		if v, ok := requestParams[param.Name]; ok {
+			value = v
+		} else if param.Default != nil {
+			value = *param.Default
+		} else {
+			return "", fmt.Errorf("param \"%v\" is required", param.Name)
+		}
+
+		kustoValue, err := param.KustoValue(value)
+		if err != nil {
+			return "", fmt.Errorf("param \"%v\": %w", param.Name, err)
+		}
+		data.Params[param.Name] = kustoValue
+	}
+
+	tmpl, err := queryConfig.ParseQueryTemplate(now)
+	if err != nil {
+		return "", err
+	}
+
+	query := strings.Builder{}
+	if err := tmpl.Execute(&query, data); err != nil {
+		return "", err
+	}
+
+	return query.String(), nil
+}
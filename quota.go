@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-07-01/compute"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	ComputeQuotaLimitMetric = "azure_compute_quota_limit"
+	ComputeQuotaUsageMetric = "azure_compute_quota_usage"
+)
+
+type (
+	// computeQuota is one quota (eg. cores, standardDSv3Family) of a subscription in a location
+	computeQuota struct {
+		Name          string
+		LocalizedName string
+		Usage         float64
+		Limit         float64
+	}
+)
+
+// isComputeQuotaEnabled checks if compute quotas are exported in the built-in module compute,
+// quotas are fetched from the Azure API and not available in mock and replay mode
+func isComputeQuotaEnabled() bool {
+	return opts.Metrics.Builtin.Quota && !opts.Metrics.Builtin.Disable && opts.Azure.Mock == "" && opts.Azure.Replay == ""
+}
+
+// collectComputeQuotas adds the compute quota limits and usages of all subscription/location pairs
+// found in azure_compute_instances, errors are logged as the ResourceGraph metrics are still valid
+func (p *Probe) collectComputeQuotas(ctx context.Context, metricList *kusto.MetricList) {
+	scopes := map[string]map[string]bool{}
+	for _, row := range metricList.GetMetricList(config.BuiltinComputeInstancesMetric) {
+		subscriptionId := strings.ToLower(row.Labels["subscriptionID"])
+		location := strings.ToLower(row.Labels["location"])
+		if subscriptionId == "" || location == "" {
+			continue
+		}
+
+		if _, exists := scopes[subscriptionId]; !exists {
+			scopes[subscriptionId] = map[string]bool{}
+		}
+		scopes[subscriptionId][location] = true
+	}
+
+	for subscriptionId, locations := range scopes {
+		for location := range locations {
+			quotas, err := fetchComputeQuotas(ctx, subscriptionId, location)
+			if err != nil {
+				logRateLimiter.Warn(p.Logger.WithField("subscriptionID", subscriptionId), fmt.Sprintf("unable to fetch compute quotas for location \"%v\": %v", location, err))
+				continue
+			}
+
+			for _, quota := range quotas {
+				labels := func() prometheus.Labels {
+					return prometheus.Labels{
+						"subscriptionID": subscriptionId,
+						"location":       location,
+						"quota":          quota.Name,
+						"quotaName":      quota.LocalizedName,
+					}
+				}
+
+				usage, limit := quota.Usage, quota.Limit
+				metricList.Add(ComputeQuotaUsageMetric, kusto.MetricRow{Labels: labels(), Value: &usage})
+				metricList.Add(ComputeQuotaLimitMetric, kusto.MetricRow{Labels: labels(), Value: &limit})
+			}
+		}
+	}
+}
+
+// fetchComputeQuotas returns the compute quotas (Compute Usages API) of the subscription in the location (cached)
+func fetchComputeQuotas(ctx context.Context, subscriptionId, location string) ([]computeQuota, error) {
+	cacheKey := "quota:compute:" + subscriptionId + ":" + location
+	if cached, ok := metricCache.Get(cacheKey); ok {
+		if quotas, ok := cached.([]computeQuota); ok {
+			return quotas, nil
+		}
+	}
+
+	cloud := getAzureCloud(AzureSubscriptionClouds[subscriptionId])
+	client := compute.NewUsageClientWithBaseURI(cloud.Environment.ResourceManagerEndpoint, subscriptionId)
+	decorateAzureAutoRest(&client.Client, cloud.Authorizer)
+
+	result, err := client.ListComplete(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	quotas := []computeQuota{}
+	for result.NotDone() {
+		usage := result.Value()
+		if usage.Name != nil && usage.Name.Value != nil && usage.CurrentValue != nil && usage.Limit != nil {
+			quota := computeQuota{
+				Name:  *usage.Name.Value,
+				Usage: float64(*usage.CurrentValue),
+				Limit: float64(*usage.Limit),
+			}
+			if usage.Name.LocalizedValue != nil {
+				quota.LocalizedName = *usage.Name.LocalizedValue
+			}
+			quotas = append(quotas, quota)
+		}
+
+		if err := result.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	metricCache.Set(cacheKey, quotas, opts.Metrics.Builtin.QuotaCache)
+	return quotas, nil
+}
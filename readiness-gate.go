@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+var (
+	ErrConfigNotLoaded = errors.New("config is not loaded yet")
+
+	// set once all critical queries succeeded, readiness is not gated by them afterwards (eg. after config reloads)
+	criticalQueriesReady int32
+
+	// critical queries which succeeded at least once (or can't be executed with the default profile)
+	criticalQueriesSucceeded      = map[string]bool{}
+	criticalQueriesSucceededMutex sync.Mutex
+)
+
+func healthCheckConfig() error {
+	if getConfig() == nil {
+		return ErrConfigNotLoaded
+	}
+	return nil
+}
+
+// healthCheckCriticalQueries fails until every critical query (critical: true) was executed successfully once
+func healthCheckCriticalQueries() error {
+	if atomic.LoadInt32(&criticalQueriesReady) == 1 {
+		return nil
+	}
+
+	if pending := getPendingCriticalQueries(); len(pending) > 0 {
+		return fmt.Errorf("waiting for first successful execution of critical queries: %v", strings.Join(pending, ", "))
+	}
+
+	atomic.StoreInt32(&criticalQueriesReady, 1)
+	return nil
+}
+
+// getPendingCriticalQueries returns the names of the critical queries without successful execution (disabled queries are ignored)
+func getPendingCriticalQueries() (pending []string) {
+	cfg := getConfig()
+	if cfg == nil {
+		return nil
+	}
+
+	criticalQueriesSucceededMutex.Lock()
+	defer criticalQueriesSucceededMutex.Unlock()
+
+	for _, queryConfig := range cfg.Queries {
+		name := queryConfig.GetName()
+		if queryConfig.Critical && !criticalQueriesSucceeded[name] && !isQueryDisabled(name) {
+			pending = append(pending, name)
+		}
+	}
+	return
+}
+
+// markCriticalQuerySucceeded records the successful execution of a critical query
+func markCriticalQuerySucceeded(name string) {
+	criticalQueriesSucceededMutex.Lock()
+	defer criticalQueriesSucceededMutex.Unlock()
+	criticalQueriesSucceeded[name] = true
+}
+
+// startCriticalQueries executes the critical queries (with the default profile) in background until each one succeeded once,
+// they are also marked by successful probes
+func startCriticalQueries() {
+	if len(getPendingCriticalQueries()) == 0 {
+		return
+	}
+
+	go func() {
+		for attempt := 1; ; attempt++ {
+			for _, name := range getPendingCriticalQueries() {
+				if err := executeCriticalQuery(name); err != nil {
+					log.WithFields(log.Fields{"query": name, "attempt": attempt}).Warnf("critical query failed, not ready: %v", err)
+				}
+			}
+
+			if len(getPendingCriticalQueries()) == 0 {
+				log.Infof("all critical queries succeeded after %v attempt(s)", attempt)
+				return
+			}
+
+			select {
+			case <-time.After(opts.Readiness.RetryInterval):
+			case <-lifecycleQuit:
+				return
+			}
+		}
+	}()
+}
+
+// executeCriticalQuery runs the query (and its dependencies) in a probe of its module
+func executeCriticalQuery(name string) error {
+	cfg := getConfig()
+	queryConfig, err := cfg.GetQueryByName(name)
+	if err != nil {
+		return err
+	}
+
+	probe, err := newProbe(queryConfig.Module, opts.Config.Profile)
+	if errors.Is(err, ErrModuleNotEnabled) {
+		// the query can't be executed, it must not block the readiness forever
+		log.WithField("query", name).Warnf("critical query ignored for readiness: %v", err)
+		markCriticalQuerySucceeded(name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	probe.Caller = AuditCallerReadiness
+	probe.results = map[*config.ConfigQuery]*ProbeQueryResult{}
+
+	// executeQueryWithDependencies marks the query as succeeded
+	_, err = probe.executeQueryWithDependencies(context.Background(), newResourceGraphClient(), queryConfig)
+	return err
+}
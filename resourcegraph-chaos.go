@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	"github.com/Azure/go-autorest/autorest"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Retry-After of injected throttling responses
+	ChaosThrottleRetryAfter = 5 * time.Second
+)
+
+type (
+	// chaosResourceGraphClient injects latency, throttling (429) and server errors (500) into ResourceGraph requests
+	// (--chaos.*, hidden flags for rehearsing alerting in staging)
+	chaosResourceGraphClient struct {
+		client ResourceGraphClient
+	}
+)
+
+// isChaosEnabled checks if any fault is injected
+func isChaosEnabled() bool {
+	return opts.Chaos.Latency > 0 || opts.Chaos.LatencyJitter > 0 || opts.Chaos.ThrottleRatio > 0 || opts.Chaos.ErrorRatio > 0
+}
+
+// isChaosQuery checks if faults are injected into the requests of the query (all queries if --chaos.queries is empty)
+func isChaosQuery(queryName string) bool {
+	if len(opts.Chaos.Queries) == 0 {
+		return true
+	}
+	for _, name := range opts.Chaos.Queries {
+		if name == "*" || name == queryName {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *chaosResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	if !isChaosQuery(request.QueryName) {
+		return c.client.Query(ctx, request)
+	}
+
+	contextLogger := log.WithFields(log.Fields{
+		"module": request.Module,
+		"query":  request.QueryName,
+		"skip":   request.Skip,
+	})
+
+	latency := opts.Chaos.Latency
+	if opts.Chaos.LatencyJitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(opts.Chaos.LatencyJitter))) // #nosec G404 -- no security context
+	}
+	if latency > 0 {
+		contextLogger.Debugf("chaos: delaying ResourceGraph request by %v", latency)
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return resourcegraph.QueryResponse{}, ctx.Err()
+		}
+	}
+
+	// #nosec G404 -- no security context
+	switch chance := rand.Float64(); {
+	case chance < opts.Chaos.ThrottleRatio:
+		contextLogger.Debug("chaos: injecting throttled ResourceGraph response")
+		return newChaosResourceGraphError(http.StatusTooManyRequests, "RateLimiting", "chaos: injected throttling, please retry after "+ChaosThrottleRetryAfter.String())
+	case chance < opts.Chaos.ThrottleRatio+opts.Chaos.ErrorRatio:
+		contextLogger.Debug("chaos: injecting failed ResourceGraph response")
+		return newChaosResourceGraphError(http.StatusInternalServerError, "InternalServerError", "chaos: injected server error")
+	}
+
+	return c.client.Query(ctx, request)
+}
+
+// newChaosResourceGraphError builds an error like a failed response of the ResourceGraph API
+func newChaosResourceGraphError(statusCode int, code, message string) (resourcegraph.QueryResponse, error) {
+	resp := &http.Response{
+		StatusCode: statusCode,
+		Status:     strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		Header:     http.Header{},
+	}
+	if statusCode == http.StatusTooManyRequests {
+		resp.Header.Set("Retry-After", strconv.Itoa(int(ChaosThrottleRetryAfter.Seconds())))
+	}
+
+	err := autorest.NewErrorWithError(errors.New(message), "resourcegraph.BaseClient", "Resources", resp, "Failure responding to request")
+	err.ServiceError = []byte(`{"error":{"code":"` + code + `","message":"` + message + `"}}`)
+	return resourcegraph.QueryResponse{Response: autorest.Response{Response: resp}}, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+)
+
+// decodeResourceGraphResponse decodes a ResourceGraph response body token by token and passes every row of
+// the data array (objectArray format) or table (table format, rows converted into objects) to the callback while reading. Unlike the generated unmarshaler
+// (body buffer, raw message map and decoded data) only the decoded rows are kept in memory.
+// Facets are small and decoded completely.
+func decodeResourceGraphResponse(body io.Reader, callback func(row interface{})) (resourcegraph.QueryResponse, error) {
+	result := resourcegraph.QueryResponse{}
+	decoder := json.NewDecoder(body)
+
+	if err := expectJsonDelim(decoder, '{'); err != nil {
+		return result, err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return result, err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return result, fmt.Errorf("unexpected json token %v, expected object key", token)
+		}
+
+		switch key {
+		case "totalRecords":
+			err = decoder.Decode(&result.TotalRecords)
+		case "count":
+			err = decoder.Decode(&result.Count)
+		case "resultTruncated":
+			err = decoder.Decode(&result.ResultTruncated)
+		case "$skipToken":
+			err = decoder.Decode(&result.SkipToken)
+		case "data":
+			result.Data, err = decodeResourceGraphRows(decoder, callback)
+		case "facets":
+			facets := ResourceGraphFacets{}
+			if err = decoder.Decode(&facets); err == nil {
+				list := []resourcegraph.BasicFacet(facets)
+				result.Facets = &list
+			}
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return result, fmt.Errorf("unable to decode ResourceGraph response field \"%v\": %w", key, err)
+		}
+	}
+
+	return result, expectJsonDelim(decoder, '}')
+}
+
+// decodeResourceGraphRows decodes the data array (objectArray) or table row by row,
+// the columns of table format responses are returned as *ResourceGraphTable (without rows)
+func decodeResourceGraphRows(decoder *json.Decoder, callback func(row interface{})) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case nil:
+		return nil, nil
+	case json.Delim('['):
+	case json.Delim('{'):
+		return decodeResourceGraphTable(decoder, callback)
+	default:
+		return nil, fmt.Errorf("unexpected json token %v, expected array (objectArray) or object (table)", token)
+	}
+
+	for decoder.More() {
+		var row interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return nil, err
+		}
+		callback(row)
+	}
+
+	return nil, expectJsonDelim(decoder, ']')
+}
+
+// expectJsonDelim reads the next token and fails if it is not the expected delimiter
+func expectJsonDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("unexpected json token %v, expected %v", token, delim)
+	}
+
+	return nil
+}
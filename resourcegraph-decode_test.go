@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+)
+
+// newTestResourceGraphResponse builds an objectArray response body with the given number of rows
+func newTestResourceGraphResponse(rowCount int) []byte {
+	rows := make([]map[string]interface{}, 0, rowCount)
+	for i := 0; i < rowCount; i++ {
+		rows = append(rows, map[string]interface{}{
+			"id":             fmt.Sprintf("/subscriptions/00000000-0000-0000-0000-%012d/resourceGroups/rg-%d/providers/Microsoft.Compute/virtualMachines/vm-%d", i%50, i%200, i),
+			"name":           fmt.Sprintf("vm-%d", i),
+			"type":           "microsoft.compute/virtualmachines",
+			"location":       []string{"westeurope", "northeurope", "eastus"}[i%3],
+			"subscriptionId": fmt.Sprintf("00000000-0000-0000-0000-%012d", i%50),
+			"properties": map[string]interface{}{
+				"provisioningState": "Succeeded",
+				"hardwareProfile":   map[string]interface{}{"vmSize": "Standard_D2s_v3"},
+				"storageProfile":    map[string]interface{}{"osDisk": map[string]interface{}{"diskSizeGB": 128, "osType": "Linux"}},
+			},
+			"tags": map[string]interface{}{"env": "prod", "team": fmt.Sprintf("team-%d", i%10)},
+		})
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"totalRecords":    rowCount,
+		"count":           rowCount,
+		"resultTruncated": "false",
+		"data":            rows,
+		"facets":          []interface{}{},
+	})
+	return body
+}
+
+// decodeResourceGraphResponseSDK decodes the whole body like the generated SDK responder
+func decodeResourceGraphResponseSDK(body []byte) (resourcegraph.QueryResponse, error) {
+	result := resourcegraph.QueryResponse{}
+	content, err := ioutil.ReadAll(bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(content, &result)
+	return result, err
+}
+
+func TestDecodeResourceGraphResponseMatchesSDK(t *testing.T) {
+	body := newTestResourceGraphResponse(100)
+
+	expected, err := decodeResourceGraphResponseSDK(body)
+	if err != nil {
+		t.Fatalf("unable to decode response with SDK: %v", err)
+	}
+
+	rows := []interface{}{}
+	actual, err := decodeResourceGraphResponse(bytes.NewReader(body), func(row interface{}) {
+		rows = append(rows, row)
+	})
+	if err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+
+	if !reflect.DeepEqual(rows, expected.Data) {
+		t.Errorf("decoded rows differ from SDK rows")
+	}
+	if *actual.TotalRecords != *expected.TotalRecords || *actual.Count != *expected.Count || actual.ResultTruncated != expected.ResultTruncated {
+		t.Errorf("decoded fields differ from SDK fields: %v/%v/%v, expected %v/%v/%v", *actual.TotalRecords, *actual.Count, actual.ResultTruncated, *expected.TotalRecords, *expected.Count, expected.ResultTruncated)
+	}
+}
+
+func TestDecodeResourceGraphResponseTable(t *testing.T) {
+	body := `{"totalRecords": 2, "count": 2, "data": {"columns": [{"name": "name", "type": "string"}, {"name": "count", "type": "integer"}], "rows": [["a", 1], ["b", 2]]}}`
+
+	rows := []interface{}{}
+	result, err := decodeResourceGraphResponse(bytes.NewReader([]byte(body)), func(row interface{}) {
+		rows = append(rows, row)
+	})
+	if err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+
+	table, ok := result.Data.(*ResourceGraphTable)
+	if !ok || len(table.Columns) != 2 || len(table.Rows) != 0 {
+		t.Fatalf("expected table with 2 columns and without rows, got %#v", result.Data)
+	}
+	if len(rows) != 2 || rows[1].(map[string]interface{})["name"] != "b" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func BenchmarkDecodeResourceGraphResponse(b *testing.B) {
+	body := newTestResourceGraphResponse(20000)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rowCount := 0
+		if _, err := decodeResourceGraphResponse(bytes.NewReader(body), func(row interface{}) {
+			rowCount++
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeResourceGraphResponseSDK(b *testing.B) {
+	body := newTestResourceGraphResponse(20000)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeResourceGraphResponseSDK(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
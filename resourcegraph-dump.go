@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	// dumpResourceGraphClient logs the requests and responses of the queries of --debug.dump-api
+	dumpResourceGraphClient struct {
+		client ResourceGraphClient
+	}
+
+	// resourceGraphDumpRequest is the request body as sent to the ResourceGraph api
+	resourceGraphDumpRequest struct {
+		Subscriptions []string                     `json:"subscriptions"`
+		Query         string                       `json:"query"`
+		Options       resourceGraphDumpRequestOpts `json:"options"`
+		Facets        []resourcegraph.FacetRequest `json:"facets,omitempty"`
+	}
+
+	resourceGraphDumpRequestOpts struct {
+		ResultFormat string `json:"resultFormat"`
+		Top          int32  `json:"$top"`
+		Skip         int32  `json:"$skip"`
+	}
+)
+
+// isResourceGraphDumpEnabled checks if requests of the query are dumped
+func isResourceGraphDumpEnabled(queryName string) bool {
+	for _, name := range opts.Logger.DumpApi {
+		if name == "*" || name == queryName {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *dumpResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	if !isResourceGraphDumpEnabled(request.QueryName) {
+		return c.client.Query(ctx, request)
+	}
+
+	contextLogger := log.WithFields(log.Fields{
+		"module": request.Module,
+		"query":  request.QueryName,
+		"cloud":  request.Cloud,
+		"skip":   request.Skip,
+	})
+
+	requestBody, _ := json.Marshal(resourceGraphDumpRequest{
+		Subscriptions: request.Subscriptions,
+		Query:         request.Query,
+		Options: resourceGraphDumpRequestOpts{
+			ResultFormat: request.GetResultFormat(),
+			Top:          request.Top,
+			Skip:         request.Skip,
+		},
+		Facets: request.Facets,
+	})
+	contextLogger.WithField("body", truncateDump(config.RedactString(string(requestBody)))).Info("dump: ResourceGraph request")
+
+	withRows := teeResourceGraphRows(&request)
+	startTime := time.Now()
+	result, err := c.client.Query(ctx, request)
+	contextLogger = contextLogger.WithField("duration", time.Since(startTime).String())
+	if err != nil {
+		contextLogger.WithField("error", err.Error()).Info("dump: ResourceGraph response")
+		return result, err
+	}
+
+	responseBody, _ := json.Marshal(newResourceGraphRecordingResult(withRows(result)))
+	contextLogger.WithField("body", truncateDump(config.RedactString(string(responseBody)))).Info("dump: ResourceGraph response")
+
+	return result, err
+}
+
+// truncateDump truncates the body to --debug.dump-api.max-bytes
+func truncateDump(body string) string {
+	if maxBytes := opts.Logger.DumpApiMaxBytes; maxBytes > 0 && len(body) > maxBytes {
+		return fmt.Sprintf("%s... (truncated, %d bytes)", body[:maxBytes], len(body))
+	}
+	return body
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-prometheus-common/kusto"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	// column of the facet rows containing the number of rows per facet value
+	ResourceGraphFacetCountColumn = "count"
+
+	// default number of facet values of the ResourceGraph API
+	ResourceGraphFacetDefaultTop = 10
+)
+
+type (
+	// ResourceGraphFacets are the facets of a response (FacetResult or FacetError),
+	// unlike []resourcegraph.BasicFacet they can be unmarshalled (recordings)
+	ResourceGraphFacets []resourcegraph.BasicFacet
+
+	resourceGraphFacetJson struct {
+		Expression   *string                       `json:"expression"`
+		ResultType   resourcegraph.ResultType      `json:"resultType"`
+		TotalRecords *int64                        `json:"totalRecords"`
+		Count        *int32                        `json:"count"`
+		Data         interface{}                   `json:"data"`
+		Errors       *[]resourcegraph.ErrorDetails `json:"errors"`
+	}
+)
+
+func (f *ResourceGraphFacets) UnmarshalJSON(body []byte) error {
+	list := []resourceGraphFacetJson{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return err
+	}
+
+	*f = ResourceGraphFacets{}
+	for _, facet := range list {
+		switch facet.ResultType {
+		case resourcegraph.ResultTypeFacetError:
+			*f = append(*f, resourcegraph.FacetError{Expression: facet.Expression, Errors: facet.Errors, ResultType: facet.ResultType})
+		default:
+			*f = append(*f, resourcegraph.FacetResult{Expression: facet.Expression, TotalRecords: facet.TotalRecords, Count: facet.Count, Data: facet.Data, ResultType: resourcegraph.ResultTypeFacetResult})
+		}
+	}
+	return nil
+}
+
+// newResourceGraphFacetRequests converts the facets of the query into ResourceGraph facet requests
+func newResourceGraphFacetRequests(facets []config.ConfigQueryFacet) []resourcegraph.FacetRequest {
+	if len(facets) == 0 {
+		return nil
+	}
+
+	ret := make([]resourcegraph.FacetRequest, 0, len(facets))
+	for _, facet := range facets {
+		expression := facet.Expression
+		request := resourcegraph.FacetRequest{
+			Expression: &expression,
+			Options:    &resourcegraph.FacetRequestOptions{},
+		}
+		if facet.Top > 0 {
+			top := facet.Top
+			request.Options.Top = &top
+		}
+		if sortOrder := facet.GetSortOrder(); sortOrder != "" {
+			request.Options.SortOrder = resourcegraph.FacetSortOrder(sortOrder)
+		}
+		if facet.Filter != "" {
+			filter := facet.Filter
+			request.Options.Filter = &filter
+		}
+		ret = append(ret, request)
+	}
+	return ret
+}
+
+// buildFacetMetricList adds one metric per facet to the metric list (one series per facet value, value = count),
+// failed facets are returned as errors
+func buildFacetMetricList(metricList *kusto.MetricList, queryConfig config.ConfigQuery, facets []resourcegraph.BasicFacet, labels prometheus.Labels) (errs []error) {
+	for _, basicFacet := range facets {
+		if facetError, ok := basicFacet.AsFacetError(); ok {
+			errs = append(errs, fmt.Errorf("facet \"%v\" failed: %v", stringPtrValue(facetError.Expression), formatFacetErrors(facetError.Errors)))
+			continue
+		}
+
+		facetResult, ok := basicFacet.AsFacetResult()
+		if !ok || facetResult.Expression == nil {
+			continue
+		}
+
+		facetConfig := findQueryFacet(queryConfig, *facetResult.Expression)
+		if facetConfig == nil {
+			continue
+		}
+
+		rows := getResourceGraphFacetRows(facetResult.Data)
+		metricName := facetConfig.GetMetric(queryConfig.Metric)
+		labelName := facetConfig.GetLabel()
+		for _, v := range rows {
+			row, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			count, ok := row[ResourceGraphFacetCountColumn].(float64)
+			if !ok {
+				continue
+			}
+
+			metricLabels := prometheus.Labels{labelName: formatFacetValue(facetRowValue(row, facetConfig.Expression))}
+			for name, value := range labels {
+				metricLabels[name] = value
+			}
+			metricList.Add(metricName, kusto.MetricRow{Labels: metricLabels, Value: &count})
+		}
+	}
+	return
+}
+
+// getResourceGraphFacetRows returns the rows of the facet, table format rows are converted into objects
+func getResourceGraphFacetRows(data interface{}) []interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		table := struct {
+			Columns []ResourceGraphColumn `json:"columns"`
+			Rows    [][]interface{}       `json:"rows"`
+		}{}
+		// facets are small, convert the decoded table by a json roundtrip
+		content, err := json.Marshal(v)
+		if err != nil || json.Unmarshal(content, &table) != nil {
+			return nil
+		}
+
+		rows := make([]interface{}, 0, len(table.Rows))
+		for _, values := range table.Rows {
+			if len(values) == len(table.Columns) {
+				rows = append(rows, newResourceGraphTableRow(table.Columns, values))
+			}
+		}
+		return rows
+	}
+	return nil
+}
+
+// findQueryFacet returns the facet of the query with the expression
+func findQueryFacet(queryConfig config.ConfigQuery, expression string) *config.ConfigQueryFacet {
+	for i := range queryConfig.Facets {
+		if queryConfig.Facets[i].Expression == expression {
+			return &queryConfig.Facets[i]
+		}
+	}
+	return nil
+}
+
+// facetRowValue returns the facet value of the row, the value column is named like the expression
+func facetRowValue(row map[string]interface{}, expression string) interface{} {
+	if value, ok := row[expression]; ok {
+		return value
+	}
+	for column, value := range row {
+		if column != ResourceGraphFacetCountColumn {
+			return value
+		}
+	}
+	return nil
+}
+
+func formatFacetValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func formatFacetErrors(errors *[]resourcegraph.ErrorDetails) string {
+	if errors == nil {
+		return "unknown error"
+	}
+
+	messages := []string{}
+	for _, detail := range *errors {
+		messages = append(messages, fmt.Sprintf("%v: %v", stringPtrValue(detail.Code), stringPtrValue(detail.Message)))
+	}
+	return strings.Join(messages, ", ")
+}
+
+func stringPtrValue(val *string) string {
+	if val == nil {
+		return ""
+	}
+	return *val
+}
+
+// mockResourceGraphFacets calculates the facets from the rows (filters are not supported in mock mode)
+func mockResourceGraphFacets(rows []interface{}, requests []resourcegraph.FacetRequest) ResourceGraphFacets {
+	ret := ResourceGraphFacets{}
+	for _, request := range requests {
+		expression := stringPtrValue(request.Expression)
+
+		counts := map[string]float64{}
+		values := map[string]interface{}{}
+		for _, v := range rows {
+			row, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			value := lookupRowPath(row, expression)
+			key := formatFacetValue(value)
+			counts[key]++
+			values[key] = value
+		}
+
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		ascending := request.Options != nil && request.Options.SortOrder == resourcegraph.Asc
+		sort.Slice(keys, func(i, j int) bool {
+			if counts[keys[i]] != counts[keys[j]] {
+				return (counts[keys[i]] < counts[keys[j]]) == ascending
+			}
+			return keys[i] < keys[j]
+		})
+
+		totalRecords := int64(len(keys))
+		top := ResourceGraphFacetDefaultTop
+		if request.Options != nil && request.Options.Top != nil {
+			top = int(*request.Options.Top)
+		}
+		if len(keys) > top {
+			keys = keys[:top]
+		}
+
+		data := []interface{}{}
+		for _, key := range keys {
+			data = append(data, map[string]interface{}{expression: values[key], ResourceGraphFacetCountColumn: counts[key]})
+		}
+		count := int32(len(data))
+
+		ret = append(ret, resourcegraph.FacetResult{
+			Expression:   &expression,
+			TotalRecords: &totalRecords,
+			Count:        &count,
+			Data:         data,
+			ResultType:   resourcegraph.ResultTypeFacetResult,
+		})
+	}
+	return ret
+}
+
+// lookupRowPath returns the value of a column or a property path (eg. properties.storageProfile.osDisk.osType)
+func lookupRowPath(row map[string]interface{}, path string) interface{} {
+	if value, ok := row[path]; ok {
+		return value
+	}
+
+	var current interface{} = row
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	// mockResourceGraphClient serves canned result rows from fixture files:
+	// <dir>/<module>/<query name>.json (module specific) or <dir>/<query name>.json,
+	// columns of table format requests are inferred from the values
+	mockResourceGraphClient struct {
+		path string
+	}
+)
+
+func (c *mockResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	result := resourcegraph.QueryResponse{}
+
+	rows, err := c.loadFixture(request)
+	if err != nil {
+		return result, err
+	}
+
+	// paginate fixture rows like the ResourceGraph API
+	totalRecords := int64(len(rows))
+	start := int64(request.Skip)
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + int64(request.Top)
+	if end > totalRecords {
+		end = totalRecords
+	}
+	page := rows[start:end]
+	count := int64(len(page))
+
+	result.TotalRecords = &totalRecords
+	result.Count = &count
+	result.Data = page
+	if request.GetResultFormat() == config.ResultFormatTable {
+		result.Data = &ResourceGraphTable{Columns: inferResourceGraphColumns(rows), Rows: page}
+	}
+	if len(request.Facets) > 0 {
+		facets := []resourcegraph.BasicFacet(mockResourceGraphFacets(rows, request.Facets))
+		result.Facets = &facets
+	}
+	return result, nil
+}
+
+func (c *mockResourceGraphClient) loadFixture(request ResourceGraphRequest) ([]interface{}, error) {
+	filenames := []string{
+		filepath.Join(c.path, request.Module, request.QueryName+".json"),
+		filepath.Join(c.path, request.QueryName+".json"),
+	}
+
+	for _, filename := range filenames {
+		/*  #nosec G304 */
+		content, err := ioutil.ReadFile(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		rows := []interface{}{}
+		if err := json.Unmarshal(content, &rows); err != nil {
+			return nil, fmt.Errorf("unable to parse fixture \"%v\": %w", filename, err)
+		}
+		return rows, nil
+	}
+
+	return nil, fmt.Errorf("no fixture found for query \"%v\" (module \"%v\"), expected %v", request.QueryName, request.Module, filenames[len(filenames)-1])
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/resources/mgmt/subscriptions"
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RecordingSubscriptionsFile = "subscriptions.json"
+)
+
+var (
+	recordingFilenameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+)
+
+type (
+	// ResourceGraphRecording is one recorded ResourceGraph response
+	ResourceGraphRecording struct {
+		Request  ResourceGraphRequest         `json:"request"`
+		Response ResourceGraphRecordingResult `json:"response"`
+	}
+
+	ResourceGraphRecordingResult struct {
+		TotalRecords *int64                `json:"totalRecords"`
+		Count        *int64                `json:"count"`
+		Data         interface{}           `json:"data"`
+		Columns      []ResourceGraphColumn `json:"columns,omitempty"`
+		Facets       ResourceGraphFacets   `json:"facets,omitempty"`
+	}
+
+	recordingResourceGraphClient struct {
+		client ResourceGraphClient
+		path   string
+	}
+
+	replayResourceGraphClient struct {
+		path string
+	}
+
+	// RecordedSubscription contains the subscription fields used in replay mode
+	// (subscriptions.Subscription doesn't marshal its read-only fields)
+	RecordedSubscription struct {
+		SubscriptionID *string `json:"subscriptionId"`
+		DisplayName    *string `json:"displayName"`
+		TenantID       *string `json:"tenantId"`
+		Cloud          string  `json:"cloud,omitempty"`
+	}
+)
+
+// recordingFilename builds a stable filename for the request, the query text is not part of the name
+// so time based templates can be replayed
+func recordingFilename(request ResourceGraphRequest) string {
+	key := struct {
+		Module        string
+		QueryName     string
+		Cloud         string `json:",omitempty"`
+		Params        map[string]string
+		Subscriptions []string
+		Skip          int32
+		Split         string `json:",omitempty"`
+		ApiVersion    string `json:",omitempty"`
+	}{
+		Module:     request.Module,
+		QueryName:  request.QueryName,
+		Cloud:      request.Cloud,
+		Params:     request.Params,
+		Skip:       request.Skip,
+		Split:      request.Split,
+		ApiVersion: request.ApiVersion,
+	}
+
+	// only per subscription requests are recorded by subscription
+	if request.PerSubscription {
+		key.Subscriptions = request.Subscriptions
+	}
+
+	keyJson, _ := json.Marshal(key) // #nosec G104 -- marshalling of strings
+	hash := sha256.Sum256(keyJson)
+
+	name := recordingFilenameRegexp.ReplaceAllString(request.Module+"_"+request.QueryName, "_")
+	return fmt.Sprintf("%s_%s.json", name, hex.EncodeToString(hash[:])[:16])
+}
+
+func (c *recordingResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	withRows := teeResourceGraphRows(&request)
+	result, err := c.client.Query(ctx, request)
+	if err != nil {
+		return result, err
+	}
+
+	recording := ResourceGraphRecording{
+		Request:  request,
+		Response: newResourceGraphRecordingResult(withRows(result)),
+	}
+
+	filename := filepath.Join(c.path, recordingFilename(request))
+	if err := writeJsonFile(filename, recording); err != nil {
+		log.WithField("file", filename).Errorf("unable to record ResourceGraph response: %v", err)
+	}
+
+	return result, nil
+}
+
+func (c *replayResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	result := resourcegraph.QueryResponse{}
+	filename := filepath.Join(c.path, recordingFilename(request))
+
+	/*  #nosec G304 */
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return result, fmt.Errorf("no recording found for query \"%v\" (module \"%v\"): %w", request.QueryName, request.Module, err)
+	}
+
+	recording := ResourceGraphRecording{}
+	if err := json.Unmarshal(content, &recording); err != nil {
+		return result, fmt.Errorf("unable to parse recording \"%v\": %w", filename, err)
+	}
+
+	result.TotalRecords = recording.Response.TotalRecords
+	result.Count = recording.Response.Count
+	result.Data = recording.Response.Data
+	if recording.Response.Columns != nil {
+		rows, _ := recording.Response.Data.([]interface{})
+		result.Data = &ResourceGraphTable{Columns: recording.Response.Columns, Rows: rows}
+	}
+	if recording.Response.Facets != nil {
+		facets := []resourcegraph.BasicFacet(recording.Response.Facets)
+		result.Facets = &facets
+	}
+	return result, nil
+}
+
+// newResourceGraphRecordingResult converts the response into its recorded form (table rows are recorded as objects)
+func newResourceGraphRecordingResult(result resourcegraph.QueryResponse) ResourceGraphRecordingResult {
+	ret := ResourceGraphRecordingResult{
+		TotalRecords: result.TotalRecords,
+		Count:        result.Count,
+		Data:         result.Data,
+	}
+	if table, ok := result.Data.(*ResourceGraphTable); ok {
+		ret.Data = table.Rows
+		ret.Columns = table.Columns
+	}
+	if result.Facets != nil {
+		ret.Facets = ResourceGraphFacets(*result.Facets)
+	}
+	return ret
+}
+
+// recordSubscriptions saves the discovered subscriptions for replay mode
+func recordSubscriptions() error {
+	subscriptionList := []RecordedSubscription{}
+	for _, subscription := range AzureSubscriptions {
+		recordedSubscription := RecordedSubscription{
+			SubscriptionID: subscription.SubscriptionID,
+			DisplayName:    subscription.DisplayName,
+			TenantID:       subscription.TenantID,
+		}
+		if subscription.SubscriptionID != nil {
+			recordedSubscription.Cloud = AzureSubscriptionClouds[strings.ToLower(*subscription.SubscriptionID)]
+		}
+		subscriptionList = append(subscriptionList, recordedSubscription)
+	}
+
+	return writeJsonFile(filepath.Join(opts.Azure.Record, RecordingSubscriptionsFile), subscriptionList)
+}
+
+// replaySubscriptions loads the recorded subscriptions from the directory (optional)
+func replaySubscriptions(path string) error {
+	AzureSubscriptions = []subscriptions.Subscription{}
+
+	/*  #nosec G304 */
+	content, err := ioutil.ReadFile(filepath.Join(path, RecordingSubscriptionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	subscriptionList := []RecordedSubscription{}
+	if err := json.Unmarshal(content, &subscriptionList); err != nil {
+		return fmt.Errorf("unable to parse recorded subscriptions: %w", err)
+	}
+
+	for _, row := range subscriptionList {
+		AzureSubscriptions = append(AzureSubscriptions, subscriptions.Subscription{
+			SubscriptionID: row.SubscriptionID,
+			DisplayName:    row.DisplayName,
+			TenantID:       row.TenantID,
+		})
+		if row.SubscriptionID != nil && row.Cloud != "" {
+			AzureSubscriptionClouds[strings.ToLower(*row.SubscriptionID)] = row.Cloud
+		}
+	}
+
+	return nil
+}
+
+// writeJsonFile writes the payload as indented json
+func writeJsonFile(filename string, payload interface{}) error {
+	content, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, content, 0600)
+}
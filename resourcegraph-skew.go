@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// column used to detect rows returned on more than one page
+	ResourceGraphSkewKey = "id"
+)
+
+type (
+	// resourceGraphSkewCheck detects results changing while a query is paginated (ResourceGraph pages are not
+	// snapshot consistent): the total record count changes, the number of rows doesn't match the total record count
+	// or the same id is returned on different pages
+	resourceGraphSkewCheck struct {
+		totalRecords int64
+		rows         int64
+		page         int
+
+		// total record count of the last page
+		pageTotalRecords int64
+
+		// page of the first occurrence of every id
+		ids map[string]int
+
+		// ids returned on more than one page, the first one is reported as example
+		duplicates int
+		duplicate  string
+
+		reasons []string
+	}
+)
+
+func newResourceGraphSkewCheck() *resourceGraphSkewCheck {
+	return &resourceGraphSkewCheck{ids: map[string]int{}}
+}
+
+// start sets the total record count of the first page
+func (c *resourceGraphSkewCheck) start(totalRecords int64) {
+	c.totalRecords = totalRecords
+	c.pageTotalRecords = totalRecords
+}
+
+// nextPage starts the next page
+func (c *resourceGraphSkewCheck) nextPage() {
+	c.page++
+}
+
+// checkTotalRecords checks the total record count of the current page
+func (c *resourceGraphSkewCheck) checkTotalRecords(totalRecords *int64) {
+	if totalRecords != nil && *totalRecords != c.pageTotalRecords {
+		c.addReason("total records changed from %v to %v on page %v", c.pageTotalRecords, *totalRecords, c.page+1)
+		c.pageTotalRecords = *totalRecords
+	}
+}
+
+// add checks the row of the current page, duplicates within the same page (eg. mv-expand) are expected
+func (c *resourceGraphSkewCheck) add(row map[string]interface{}) {
+	c.rows++
+
+	value, ok := row[ResourceGraphSkewKey]
+	if !ok || value == nil || value == "" {
+		return
+	}
+
+	id := fmt.Sprintf("%v", value)
+	if page, exists := c.ids[id]; !exists {
+		c.ids[id] = c.page
+	} else if page != c.page {
+		c.duplicates++
+		if c.duplicate == "" {
+			c.duplicate = fmt.Sprintf("%v \"%v\" on page %v and %v", ResourceGraphSkewKey, id, page+1, c.page+1)
+		}
+	}
+}
+
+// finish checks the number of processed rows and returns the detected inconsistencies
+func (c *resourceGraphSkewCheck) finish() []string {
+	if c.rows != c.totalRecords {
+		c.addReason("got %v rows, expected %v total records", c.rows, c.totalRecords)
+	}
+	if c.duplicates > 0 {
+		c.addReason("%v rows returned on more than one page (eg. %v)", c.duplicates, c.duplicate)
+	}
+	return c.reasons
+}
+
+func (c *resourceGraphSkewCheck) addReason(format string, args ...interface{}) {
+	c.reasons = append(c.reasons, fmt.Sprintf(format, args...))
+}
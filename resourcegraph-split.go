@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	// error code of ResourceGraph responses exceeding the size limit (16 MB)
+	ResourceGraphPayloadTooLargeCode = "ResponsePayloadTooLarge"
+)
+
+type (
+	// resourceGraphSplitJoin rejoins the rows of the column chunks by the key column (in order of appearance)
+	resourceGraphSplitJoin struct {
+		key   string
+		rows  map[string]map[string]interface{}
+		order []string
+
+		// rows of the current chunk without key value (can't be joined)
+		dropped int
+	}
+)
+
+// isResourceGraphPayloadTooLarge checks if the request failed because the response exceeds the size limit
+func isResourceGraphPayloadTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), ResourceGraphPayloadTooLargeCode)
+}
+
+// executeResourceGraphSplitQuery executes a query ending with a wide project operator in column chunks: the columns are
+// split in halves (recursively while the responses are still too large), every chunk projects the key column and the rows
+// are rejoined by the key. Columns missing in a joined row (no row in one of the chunks) are set to null.
+func executeResourceGraphSplitQuery(ctx context.Context, client ResourceGraphClient, request ResourceGraphRequest, onRequest func(), callback func(row map[string]interface{}), cause error) (ResourceGraphQueryResult, error) {
+	base, columns, ok := config.ParseProjectQuery(request.Query)
+	if !ok {
+		return ResourceGraphQueryResult{}, fmt.Errorf("%w (reduce the result size or end the query with a project operator including the column \"%v\" to split the columns across requests)", cause, request.SplitKey)
+	}
+
+	keyColumn := ""
+	otherColumns := []string{}
+	columnNames := []string{}
+	for _, column := range columns {
+		name := config.ProjectColumnName(column)
+		if name == request.SplitKey && keyColumn == "" {
+			keyColumn = column
+			continue
+		}
+		otherColumns = append(otherColumns, column)
+		if name != "" {
+			columnNames = append(columnNames, name)
+		}
+	}
+	if keyColumn == "" {
+		return ResourceGraphQueryResult{}, fmt.Errorf("%w (add the column \"%v\" to the project operator to split the columns across requests)", cause, request.SplitKey)
+	}
+	if len(otherColumns) < 2 {
+		return ResourceGraphQueryResult{}, cause
+	}
+
+	log.WithFields(log.Fields{"module": request.Module, "query": request.QueryName}).Warnf("ResourceGraph response too large, splitting %v columns across requests joined by \"%v\"", len(columns), request.SplitKey)
+
+	join := &resourceGraphSplitJoin{key: request.SplitKey, rows: map[string]map[string]interface{}{}}
+	result := ResourceGraphQueryResult{}
+	dropped := 0
+
+	var executeChunk func(chunk []string, path string) error
+	executeChunk = func(chunk []string, path string) error {
+		chunkRequest := request
+		chunkRequest.Query = config.BuildProjectQuery(base, append([]string{keyColumn}, chunk...))
+		chunkRequest.Split = path
+		if len(result.Facets) > 0 {
+			// facets are not affected by the projected columns and only requested once
+			chunkRequest.Facets = nil
+		}
+
+		join.dropped = 0
+		chunkResult, err := executeResourceGraphPages(ctx, client, chunkRequest, onRequest, join.add)
+		// joining is idempotent, rows of a partially processed chunk are merged again
+		if isResourceGraphPayloadTooLarge(err) && len(chunk) > 1 {
+			half := len(chunk) / 2
+			if err := executeChunk(chunk[:half], path+".1"); err != nil {
+				return err
+			}
+			return executeChunk(chunk[half:], path+".2")
+		} else if err != nil {
+			return err
+		}
+
+		if chunkResult.TotalRecords > result.TotalRecords {
+			result.TotalRecords = chunkResult.TotalRecords
+		}
+		if result.Facets == nil {
+			result.Facets = chunkResult.Facets
+		}
+		result.Columns = mergeResourceGraphColumns(result.Columns, chunkResult.Columns)
+		result.Skew = append(result.Skew, chunkResult.Skew...)
+		if join.dropped > dropped {
+			dropped = join.dropped
+		}
+		return nil
+	}
+
+	half := len(otherColumns) / 2
+	if err := executeChunk(otherColumns[:half], "1"); err != nil {
+		return result, err
+	}
+	if err := executeChunk(otherColumns[half:], "2"); err != nil {
+		return result, err
+	}
+
+	if dropped > 0 {
+		log.WithFields(log.Fields{"module": request.Module, "query": request.QueryName}).Warnf("dropped %v rows without value in key column \"%v\" while joining split query", dropped, request.SplitKey)
+	}
+
+	for _, key := range join.order {
+		row := join.rows[key]
+		for _, name := range columnNames {
+			if _, exists := row[name]; !exists {
+				row[name] = nil
+			}
+		}
+		callback(row)
+	}
+
+	return result, nil
+}
+
+// add merges the columns of the row into the joined row with the same key
+func (j *resourceGraphSplitJoin) add(row map[string]interface{}) {
+	value, ok := row[j.key]
+	if !ok || value == nil || value == "" {
+		j.dropped++
+		return
+	}
+
+	key := fmt.Sprintf("%v", value)
+	if joined, exists := j.rows[key]; exists {
+		for name, value := range row {
+			joined[name] = value
+		}
+		return
+	}
+
+	j.rows[key] = row
+	j.order = append(j.order, key)
+}
+
+// mergeResourceGraphColumns appends the columns not yet known (table format)
+func mergeResourceGraphColumns(columns, additional []ResourceGraphColumn) []ResourceGraphColumn {
+	for _, column := range additional {
+		exists := false
+		for _, existing := range columns {
+			if existing.Name == column.Name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+type (
+	// ResourceGraphColumn is a column of a table format response
+	ResourceGraphColumn struct {
+		Name string                       `json:"name"`
+		Type resourcegraph.ColumnDataType `json:"type"`
+	}
+
+	// ResourceGraphTable is the decoded data of a table format response, the rows are converted into
+	// objects (like objectArray) with values typed by their column
+	ResourceGraphTable struct {
+		Columns []ResourceGraphColumn
+		Rows    []interface{}
+	}
+)
+
+// getResourceGraphRows returns the rows of the response (objectArray or table format) and the columns (table format only)
+func getResourceGraphRows(result resourcegraph.QueryResponse) ([]interface{}, []ResourceGraphColumn) {
+	switch data := result.Data.(type) {
+	case []interface{}:
+		return data, nil
+	case *ResourceGraphTable:
+		return data.Rows, data.Columns
+	}
+	return nil, nil
+}
+
+// decodeResourceGraphTable decodes the table format ({"columns": [...], "rows": [[...]]}) row by row,
+// every row is converted into an object using the columns (which must precede the rows)
+func decodeResourceGraphTable(decoder *json.Decoder, callback func(row interface{})) (*ResourceGraphTable, error) {
+	table := &ResourceGraphTable{}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return table, err
+		}
+
+		switch token {
+		case "columns":
+			err = decoder.Decode(&table.Columns)
+		case "rows":
+			if table.Columns == nil {
+				return table, errors.New("table rows without preceding columns")
+			}
+			err = decodeResourceGraphTableRows(decoder, table.Columns, callback)
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return table, fmt.Errorf("unable to decode table field \"%v\": %w", token, err)
+		}
+	}
+
+	return table, expectJsonDelim(decoder, '}')
+}
+
+func decodeResourceGraphTableRows(decoder *json.Decoder, columns []ResourceGraphColumn, callback func(row interface{})) error {
+	if err := expectJsonDelim(decoder, '['); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		values := []interface{}{}
+		if err := decoder.Decode(&values); err != nil {
+			return err
+		}
+		if len(values) != len(columns) {
+			return fmt.Errorf("table row has %v values, expected %v columns", len(values), len(columns))
+		}
+		callback(newResourceGraphTableRow(columns, values))
+	}
+
+	return expectJsonDelim(decoder, ']')
+}
+
+// newResourceGraphTableRow converts the values of a table row into an object
+func newResourceGraphTableRow(columns []ResourceGraphColumn, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		row[column.Name] = convertResourceGraphColumnValue(values[i], column.Type)
+	}
+	return row
+}
+
+// convertResourceGraphColumnValue converts the value to the type of the column (eg. numbers serialized as strings),
+// values which can't be converted are kept unchanged
+func convertResourceGraphColumnValue(value interface{}, columnType resourcegraph.ColumnDataType) interface{} {
+	str, isString := value.(string)
+	switch columnType {
+	case resourcegraph.Integer, resourcegraph.Number:
+		if isString {
+			if v, err := strconv.ParseFloat(str, 64); err == nil {
+				return v
+			}
+		}
+	case resourcegraph.Boolean:
+		if isString {
+			if v, err := strconv.ParseBool(str); err == nil {
+				return v
+			}
+		}
+	case resourcegraph.String:
+		switch v := value.(type) {
+		case float64, bool:
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return value
+}
+
+// inferResourceGraphColumns builds the columns of objectArray rows (mock mode) from the values of the rows
+func inferResourceGraphColumns(rows []interface{}) []ResourceGraphColumn {
+	types := map[string]resourcegraph.ColumnDataType{}
+	for _, v := range rows {
+		row, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, value := range row {
+			if _, exists := types[name]; exists && value == nil {
+				continue
+			}
+			switch value.(type) {
+			case float64:
+				types[name] = resourcegraph.Number
+			case bool:
+				types[name] = resourcegraph.Boolean
+			case string, nil:
+				types[name] = resourcegraph.String
+			default:
+				types[name] = resourcegraph.Object
+			}
+		}
+	}
+
+	columns := make([]ResourceGraphColumn, 0, len(types))
+	for name, columnType := range types {
+		columns = append(columns, ResourceGraphColumn{Name: name, Type: columnType})
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].Name < columns[j].Name
+	})
+	return columns
+}
+
+// validateResourceGraphColumns checks the field mapping of the query against the column types of the result
+func validateResourceGraphColumns(queryConfig config.ConfigQuery, columns []ResourceGraphColumn) (errs []error) {
+	columnTypes := map[string]resourcegraph.ColumnDataType{}
+	columnNames := make([]string, 0, len(columns))
+	for _, column := range columns {
+		columnTypes[column.Name] = column.Type
+		columnNames = append(columnNames, column.Name)
+	}
+
+	for _, field := range queryConfig.MetricConfig.Fields {
+		if field.IsTypeIgnore() {
+			continue
+		}
+
+		name := field.GetSourceField()
+		columnType, ok := columnTypes[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("field \"%v\" not found in result columns (%v)", name, strings.Join(columnNames, ", ")))
+		case field.IsExpand() && columnType != resourcegraph.Object:
+			errs = append(errs, fmt.Errorf("field \"%v\" is expanded but column has type %v, expected object", name, columnType))
+		case field.IsTypeValue() && columnType != resourcegraph.Integer && columnType != resourcegraph.Number && columnType != resourcegraph.Boolean:
+			errs = append(errs, fmt.Errorf("field \"%v\" is mapped as value but column has type %v, expected integer, number or boolean (use todouble() in the query)", name, columnType))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	RESOURCEGRAPH_QUERY_OPTIONS_TOP = 1000
+)
+
+type (
+	// ResourceGraphRequest is one (paged) ResourceGraph query request
+	ResourceGraphRequest struct {
+		Module          string
+		QueryName       string
+		Cloud           string
+		Params          map[string]string
+		Query           string
+		Subscriptions   []string
+		PerSubscription bool
+		Top             int32
+		Skip            int32
+		ResultFormat    string `json:",omitempty"`
+
+		// ResourceGraph API version (empty = version of the SDK)
+		ApiVersion string `json:",omitempty"`
+
+		// facets are only requested with the first page
+		Facets []resourcegraph.FacetRequest `json:",omitempty"`
+
+		// key column to split the projected columns across requests if the response is too large (empty = disabled)
+		SplitKey string `json:"-"`
+
+		// column chunk of a split query (eg. 1.2 is the second half of the first half)
+		Split string `json:",omitempty"`
+
+		// name of the identity of the query (empty for the identity of the cloud)
+		Identity string `json:"-"`
+
+		// client which triggered the probe (audit log only)
+		Caller string `json:"-"`
+
+		// rows are passed to OnRow while the response is decoded instead of being returned in the data,
+		// clients without streaming support (replay, mock) return the rows in the data
+		OnRow func(row interface{}) `json:"-"`
+	}
+
+	// ResourceGraphClient executes ResourceGraph requests (Azure, recording, replay, mock)
+	ResourceGraphClient interface {
+		Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error)
+	}
+
+	// ResourceGraphQueryResult is the result of a (paged) query, the rows are passed to the callback
+	ResourceGraphQueryResult struct {
+		TotalRecords int64
+
+		// facets and columns (table format only) of the first page
+		Facets  []resourcegraph.BasicFacet
+		Columns []ResourceGraphColumn
+
+		// inconsistencies detected while paginating (results changed between the pages)
+		Skew []string
+	}
+
+	// resourceGraphPage is the result of one paged ResourceGraph request
+	resourceGraphPage struct {
+		response resourcegraph.QueryResponse
+		err      error
+	}
+
+	// azureResourceGraphClient sends the requests to the ResourceGraph endpoint of the cloud of the request
+	azureResourceGraphClient struct {
+		clients map[string]resourcegraph.BaseClient
+
+		// clients of the identities of the config per cloud and identity, created on first use
+		identityClients map[string]resourcegraph.BaseClient
+		identityMutex   sync.Mutex
+	}
+)
+
+// newResourceGraphClient creates the ResourceGraph client, all calls are written to the audit log and dumped (if enabled),
+// injected faults (--chaos.*) are logged like failed requests
+func newResourceGraphClient() ResourceGraphClient {
+	client := newResourceGraphBackendClient()
+	if isChaosEnabled() {
+		client = &chaosResourceGraphClient{client: client}
+	}
+	if auditLogger != nil {
+		client = &auditResourceGraphClient{client: client}
+	}
+	if len(opts.Logger.DumpApi) > 0 {
+		client = &dumpResourceGraphClient{client: client}
+	}
+	return client
+}
+
+// newResourceGraphBackendClient creates the ResourceGraph client based on the mode (Azure, record, replay or mock)
+func newResourceGraphBackendClient() ResourceGraphClient {
+	if opts.Azure.Mock != "" {
+		return &mockResourceGraphClient{path: opts.Azure.Mock}
+	}
+
+	if opts.Azure.Replay != "" {
+		return &replayResourceGraphClient{path: opts.Azure.Replay}
+	}
+
+	// Create and authorize a ResourceGraph client per cloud
+	azureClient := &azureResourceGraphClient{
+		clients:         map[string]resourcegraph.BaseClient{},
+		identityClients: map[string]resourcegraph.BaseClient{},
+	}
+	for _, cloud := range AzureClouds {
+		client := resourcegraph.NewWithBaseURI(cloud.Environment.ResourceManagerEndpoint)
+		decorateAzureAutoRest(&client.Client, cloud.Authorizer)
+		azureClient.clients[cloud.Name] = client
+	}
+
+	var ret ResourceGraphClient = azureClient
+	if opts.Azure.Record != "" {
+		ret = &recordingResourceGraphClient{client: ret, path: opts.Azure.Record}
+	}
+
+	return ret
+}
+
+func (c *azureResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	top := request.Top
+	skip := request.Skip
+
+	client, err := c.getClient(request)
+	if err != nil {
+		return resourcegraph.QueryResponse{}, err
+	}
+
+	queryRequest := resourcegraph.QueryRequest{
+		Subscriptions: &request.Subscriptions,
+		Query:         &request.Query,
+		Options: &resourcegraph.QueryRequestOptions{
+			ResultFormat: resourcegraph.ResultFormat(request.GetResultFormat()),
+			Top:          &top,
+			Skip:         &skip,
+		},
+	}
+	if len(request.Facets) > 0 {
+		queryRequest.Facets = &request.Facets
+	}
+
+	req, err := client.ResourcesPreparer(ctx, queryRequest)
+	if err != nil {
+		return resourcegraph.QueryResponse{}, autorest.NewErrorWithError(err, "resourcegraph.BaseClient", "Resources", nil, "Failure preparing request")
+	}
+
+	// the SDK sends its own api version, newer (eg. preview) versions accept the same request
+	if request.ApiVersion != "" {
+		queryParams := req.URL.Query()
+		queryParams.Set("api-version", request.ApiVersion)
+		req.URL.RawQuery = queryParams.Encode()
+	}
+
+	resp, err := client.ResourcesSender(req)
+	if err != nil {
+		return resourcegraph.QueryResponse{Response: autorest.Response{Response: resp}}, autorest.NewErrorWithError(err, "resourcegraph.BaseClient", "Resources", resp, "Failure sending request")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if err := autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK)); err != nil {
+		return resourcegraph.QueryResponse{Response: autorest.Response{Response: resp}}, autorest.NewErrorWithError(err, "resourcegraph.BaseClient", "Resources", resp, "Failure responding to request")
+	}
+
+	// decode rows while reading the body instead of buffering the whole response,
+	// rows are only collected if the request doesn't stream them
+	rows := []interface{}{}
+	onRow := request.OnRow
+	if onRow == nil {
+		onRow = func(row interface{}) {
+			rows = append(rows, row)
+		}
+	}
+	result, err := decodeResourceGraphResponse(resp.Body, onRow)
+	result.Response = autorest.Response{Response: resp}
+	if err != nil {
+		return result, autorest.NewErrorWithError(err, "resourcegraph.BaseClient", "Resources", resp, "Failure responding to request")
+	}
+	if request.OnRow != nil {
+		return result, nil
+	}
+	if table, ok := result.Data.(*ResourceGraphTable); ok {
+		table.Rows = rows
+	} else {
+		result.Data = rows
+	}
+
+	return result, nil
+}
+
+// GetResultFormat returns the result format of the request (default: objectArray)
+func (r *ResourceGraphRequest) GetResultFormat() string {
+	if r.ResultFormat != "" {
+		return r.ResultFormat
+	}
+	return config.ResultFormatObjectArray
+}
+
+// executeResourceGraphQuery runs the query (incl. pagination) and calls the callback for every result row,
+// onRequest is called before each (paged) request and might be called concurrently.
+// Queries exceeding the response size limit are split into column chunks (see executeResourceGraphSplitQuery).
+func executeResourceGraphQuery(ctx context.Context, client ResourceGraphClient, request ResourceGraphRequest, onRequest func(), callback func(row map[string]interface{})) (ResourceGraphQueryResult, error) {
+	emitted := false
+	result, err := executeResourceGraphPages(ctx, client, request, onRequest, func(row map[string]interface{}) {
+		emitted = true
+		callback(row)
+	})
+
+	// rows of a failed later page were already processed and can't be rejoined
+	if request.SplitKey == "" || emitted || !isResourceGraphPayloadTooLarge(err) {
+		return result, err
+	}
+	return executeResourceGraphSplitQuery(ctx, client, request, onRequest, callback, err)
+}
+
+// executeResourceGraphPages runs the query page by page, facets and columns (table format) are returned from the first page.
+// The first page provides the total record count, the remaining pages are fetched concurrently
+// (--azure.pagination.concurrency) while the rows are passed to the callback in page order.
+// Rows are streamed to the callback while the responses are decoded, a page is only decoded once all previous pages are processed.
+func executeResourceGraphPages(ctx context.Context, client ResourceGraphClient, request ResourceGraphRequest, onRequest func(), callback func(row map[string]interface{})) (ResourceGraphQueryResult, error) {
+	request.Top = int32(RESOURCEGRAPH_QUERY_OPTIONS_TOP)
+	request.Skip = int32(0)
+
+	// the results might change while paginating, consistency is checked across the pages
+	// (total records are known after the first page, skew is only reported for paginated queries)
+	skewCheck := newResourceGraphSkewCheck()
+	pageRows := 0
+	onRow := func(row interface{}) {
+		if resultRow, ok := row.(map[string]interface{}); ok {
+			pageRows++
+			skewCheck.add(resultRow)
+			callback(resultRow)
+		}
+	}
+
+	if onRequest != nil {
+		onRequest()
+	}
+
+	firstRequest := request
+	firstRequest.OnRow = onRow
+	results, err := client.Query(ctx, firstRequest)
+	if err != nil {
+		return ResourceGraphQueryResult{}, err
+	}
+	processResourceGraphPage(results, onRow)
+
+	queryResult := ResourceGraphQueryResult{}
+	if results.Facets != nil {
+		queryResult.Facets = *results.Facets
+	}
+	_, queryResult.Columns = getResourceGraphRows(results)
+
+	if results.TotalRecords != nil {
+		queryResult.TotalRecords = *results.TotalRecords
+	}
+
+	// remaining pages after the first one
+	pageCount := int((queryResult.TotalRecords - 1) / int64(request.Top))
+
+	if pageRows == 0 || pageCount <= 0 {
+		// got invalid, empty or no further data
+		return queryResult, nil
+	}
+	skewCheck.start(queryResult.TotalRecords)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every page gets its own buffered channel so workers never block, the worker of a page streams its rows
+	// to the callback once it's the page's turn (all previous pages are processed), the semaphore is released
+	// when a page is processed which limits the pages requested at the same time
+	pages := make([]chan resourceGraphPage, pageCount)
+	turns := make([]chan struct{}, pageCount)
+	for i := range pages {
+		pages[i] = make(chan resourceGraphPage, 1)
+		turns[i] = make(chan struct{})
+	}
+	semaphore := make(chan struct{}, opts.Azure.Pagination.Concurrency)
+
+	go func() {
+		for i := range pages {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				// pages not requested anymore are failed
+				for _, page := range pages[i:] {
+					page <- resourceGraphPage{err: ctx.Err()}
+				}
+				return
+			}
+
+			pageRequest := request
+			pageRequest.Skip = request.Top * int32(i+1)
+			pageRequest.Facets = nil
+			pageRequest.OnRow = func(turn <-chan struct{}) func(row interface{}) {
+				return func(row interface{}) {
+					// rows of cancelled queries are dropped
+					select {
+					case <-turn:
+						if ctx.Err() == nil {
+							onRow(row)
+						}
+					case <-ctx.Done():
+					}
+				}
+			}(turns[i])
+			go func(page chan<- resourceGraphPage) {
+				if onRequest != nil {
+					onRequest()
+				}
+				response, err := client.Query(ctx, pageRequest)
+				page <- resourceGraphPage{response: response, err: err}
+			}(pages[i])
+		}
+	}()
+
+	for i := range pages {
+		skewCheck.nextPage()
+		pageRows = 0
+
+		// the worker of the page is always waited for, it might be streaming rows to the callback
+		close(turns[i])
+		page := <-pages[i]
+		if page.err != nil {
+			return queryResult, page.err
+		}
+		if err := ctx.Err(); err != nil {
+			// rows streamed after the cancellation were dropped
+			return queryResult, err
+		}
+		<-semaphore
+
+		skewCheck.checkTotalRecords(page.response.TotalRecords)
+		if page.response.TotalRecords != nil {
+			queryResult.TotalRecords = *page.response.TotalRecords
+		}
+
+		processResourceGraphPage(page.response, onRow)
+		if pageRows == 0 {
+			// got invalid or empty data, skipping
+			break
+		}
+	}
+
+	queryResult.Skew = skewCheck.finish()
+	return queryResult, nil
+}
+
+// teeResourceGraphRows keeps a copy of the rows streamed to OnRow of the request (if set),
+// the returned function adds them to the data of the response (eg. for recordings)
+func teeResourceGraphRows(request *ResourceGraphRequest) func(result resourcegraph.QueryResponse) resourcegraph.QueryResponse {
+	onRow := request.OnRow
+	if onRow == nil {
+		return func(result resourcegraph.QueryResponse) resourcegraph.QueryResponse {
+			return result
+		}
+	}
+
+	rows := []interface{}{}
+	request.OnRow = func(row interface{}) {
+		rows = append(rows, row)
+		onRow(row)
+	}
+	return func(result resourcegraph.QueryResponse) resourcegraph.QueryResponse {
+		if table, ok := result.Data.(*ResourceGraphTable); ok {
+			result.Data = &ResourceGraphTable{Columns: table.Columns, Rows: rows}
+		} else {
+			result.Data = rows
+		}
+		return result
+	}
+}
+
+// processResourceGraphPage passes the rows returned in the data of the page to the callback (clients without streaming support)
+func processResourceGraphPage(results resourcegraph.QueryResponse, onRow func(row interface{})) {
+	resultList, _ := getResourceGraphRows(results)
+	for _, row := range resultList {
+		onRow(row)
+	}
+}
+
+// getClient returns the client of the cloud, authorized with the identity of the request (if set)
+func (c *azureResourceGraphClient) getClient(request ResourceGraphRequest) (resourcegraph.BaseClient, error) {
+	client, ok := c.clients[request.Cloud]
+	if !ok {
+		return client, fmt.Errorf("unknown cloud \"%v\"", request.Cloud)
+	}
+
+	if request.Identity == "" {
+		return client, nil
+	}
+
+	c.identityMutex.Lock()
+	defer c.identityMutex.Unlock()
+
+	key := request.Cloud + "/" + request.Identity
+	if identityClient, exists := c.identityClients[key]; exists {
+		return identityClient, nil
+	}
+
+	identity, ok := getConfig().Identities[request.Identity]
+	if !ok {
+		return client, fmt.Errorf("unknown identity \"%v\"", request.Identity)
+	}
+
+	cloud := getAzureCloud(request.Cloud)
+	authorizer, err := newAzureIdentityAuthorizer(cloud, request.Identity, identity)
+	if err != nil {
+		return client, fmt.Errorf("identity \"%v\": %w", request.Identity, err)
+	}
+
+	identityClient := resourcegraph.NewWithBaseURI(cloud.Environment.ResourceManagerEndpoint)
+	decorateAzureAutoRest(&identityClient.Client, authorizer)
+	c.identityClients[key] = identityClient
+	return identityClient, nil
+}
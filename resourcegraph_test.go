@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	resourcegraph "github.com/Azure/azure-sdk-for-go/services/resourcegraph/mgmt/2019-04-01/resourcegraph"
+)
+
+type (
+	// streamingTestResourceGraphClient serves numbered rows and streams them to OnRow (if set),
+	// later pages respond faster to provoke out of order responses
+	streamingTestResourceGraphClient struct {
+		totalRecords int64
+	}
+)
+
+func (c *streamingTestResourceGraphClient) Query(ctx context.Context, request ResourceGraphRequest) (resourcegraph.QueryResponse, error) {
+	time.Sleep(time.Duration(c.totalRecords-int64(request.Skip)) * time.Microsecond)
+
+	rows := []interface{}{}
+	for i := int64(request.Skip); i < c.totalRecords && i < int64(request.Skip+request.Top); i++ {
+		rows = append(rows, map[string]interface{}{"id": i})
+	}
+
+	count := int64(len(rows))
+	result := resourcegraph.QueryResponse{TotalRecords: &c.totalRecords, Count: &count}
+	if request.OnRow == nil {
+		result.Data = rows
+		return result, nil
+	}
+
+	for _, row := range rows {
+		request.OnRow(row)
+	}
+	return result, nil
+}
+
+func TestExecuteResourceGraphPagesOrder(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		opts.Azure.Pagination.Concurrency = concurrency
+
+		client := &streamingTestResourceGraphClient{totalRecords: 5500}
+		ids := []int64{}
+		result, err := executeResourceGraphPages(context.Background(), client, ResourceGraphRequest{}, nil, func(row map[string]interface{}) {
+			ids = append(ids, row["id"].(int64))
+		})
+		if err != nil {
+			t.Fatalf("concurrency %v: unexpected error: %v", concurrency, err)
+		}
+
+		if len(ids) != 5500 {
+			t.Fatalf("concurrency %v: expected 5500 rows, got %v", concurrency, len(ids))
+		}
+		for i, id := range ids {
+			if id != int64(i) {
+				t.Fatalf("concurrency %v: expected row %v at position %v, got %v", concurrency, i, i, id)
+			}
+		}
+		if result.TotalRecords != 5500 || len(result.Skew) != 0 {
+			t.Errorf("concurrency %v: unexpected result %+v", concurrency, result)
+		}
+	}
+}
+
+func TestExecuteResourceGraphPagesCancel(t *testing.T) {
+	opts.Azure.Pagination.Concurrency = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &streamingTestResourceGraphClient{totalRecords: 10000}
+	rowCount := 0
+	_, err := executeResourceGraphPages(ctx, client, ResourceGraphRequest{}, nil, func(row map[string]interface{}) {
+		rowCount++
+		if rowCount == 1500 {
+			cancel()
+		}
+	})
+	if err == nil {
+		t.Fatalf("expected error of cancelled query")
+	}
+	if rowCount >= 10000 {
+		t.Errorf("expected rows of cancelled pages to be dropped, got %v rows", rowCount)
+	}
+}
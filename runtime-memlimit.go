@@ -0,0 +1,14 @@
+//go:build go1.19
+// +build go1.19
+
+package main
+
+import (
+	"runtime/debug"
+)
+
+// setRuntimeMemoryLimit sets the soft memory limit of the Go runtime (GOMEMLIMIT)
+func setRuntimeMemoryLimit(limit int64) bool {
+	debug.SetMemoryLimit(limit)
+	return true
+}
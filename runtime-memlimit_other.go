@@ -0,0 +1,9 @@
+//go:build !go1.19
+// +build !go1.19
+
+package main
+
+// setRuntimeMemoryLimit is not supported before go1.19 (no soft memory limit)
+func setRuntimeMemoryLimit(limit int64) bool {
+	return false
+}
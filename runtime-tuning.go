@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RuntimeMemLimitOff = "off"
+
+	// cgroup v1 reports "no limit" as a huge page aligned value instead of "max"
+	cgroupUnlimitedThreshold = int64(1) << 62
+)
+
+var (
+	// cgroup v2 (unified) and v1 files of the container limits
+	cgroupCpuMaxFiles    = []string{"/sys/fs/cgroup/cpu.max"}
+	cgroupCpuQuotaFiles  = []string{"/sys/fs/cgroup/cpu/cpu.cfs_quota_us", "/sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us"}
+	cgroupCpuPeriodFiles = []string{"/sys/fs/cgroup/cpu/cpu.cfs_period_us", "/sys/fs/cgroup/cpu,cpuacct/cpu.cfs_period_us"}
+	cgroupMemoryFiles    = []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"}
+
+	// units of GOMEMLIMIT
+	memorySizeUnits = []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"TiB", 1 << 40},
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	}
+)
+
+// initRuntimeTuning aligns GOMAXPROCS and the soft memory limit of the Go runtime with the cgroup limits of the container
+// (eg. Kubernetes resource limits), explicit flags and the GOMAXPROCS/GOMEMLIMIT env variables take precedence
+func initRuntimeTuning() {
+	initRuntimeMaxProcs()
+	initRuntimeMemLimit()
+}
+
+func initRuntimeMaxProcs() {
+	procs, source := 0, ""
+	switch {
+	case opts.Runtime.MaxProcs > 0:
+		procs, source = opts.Runtime.MaxProcs, "--runtime.gomaxprocs"
+	case opts.Runtime.MaxProcs < 0:
+		return
+	case os.Getenv("GOMAXPROCS") != "":
+		log.Infof("runtime: GOMAXPROCS=%v (env GOMAXPROCS)", runtime.GOMAXPROCS(0))
+		return
+	default:
+		quota, ok := getCgroupCpuLimit()
+		if !ok {
+			log.Debugf("runtime: no cgroup CPU limit found, GOMAXPROCS=%v", runtime.GOMAXPROCS(0))
+			return
+		}
+		// like automaxprocs the limit is rounded down, throttling is worse than an idle fraction of a CPU
+		procs = int(math.Floor(quota))
+		if procs < 1 {
+			procs = 1
+		}
+		if procs > runtime.NumCPU() {
+			procs = runtime.NumCPU()
+		}
+		source = fmt.Sprintf("cgroup CPU limit %v", strconv.FormatFloat(quota, 'f', -1, 64))
+	}
+
+	runtime.GOMAXPROCS(procs)
+	log.Infof("runtime: GOMAXPROCS=%v (%v)", procs, source)
+}
+
+func initRuntimeMemLimit() {
+	limit, source := int64(0), ""
+	switch {
+	case strings.EqualFold(opts.Runtime.MemLimit, RuntimeMemLimitOff):
+		return
+	case opts.Runtime.MemLimit != "":
+		var err error
+		if limit, err = parseMemorySize(opts.Runtime.MemLimit); err != nil {
+			// reported by the startup validation
+			return
+		}
+		source = "--runtime.gomemlimit"
+	case os.Getenv("GOMEMLIMIT") != "":
+		log.Infof("runtime: GOMEMLIMIT=%v (env GOMEMLIMIT)", os.Getenv("GOMEMLIMIT"))
+		return
+	default:
+		memory, ok := getCgroupMemoryLimit()
+		if opts.Runtime.MemLimitRatio <= 0 || opts.Runtime.MemLimitRatio > 1 {
+			// reported by the startup validation
+			return
+		} else if !ok {
+			log.Debug("runtime: no cgroup memory limit found, GOMEMLIMIT not set")
+			return
+		}
+		limit = int64(float64(memory) * opts.Runtime.MemLimitRatio)
+		source = fmt.Sprintf("%v of cgroup memory limit %v", opts.Runtime.MemLimitRatio, memory)
+	}
+
+	if !setRuntimeMemoryLimit(limit) {
+		log.Warnf("runtime: GOMEMLIMIT is not supported by %v (requires go1.19), ignoring %v", runtime.Version(), source)
+		return
+	}
+	log.Infof("runtime: GOMEMLIMIT=%v (%v)", limit, source)
+}
+
+// getCgroupCpuLimit returns the CPU limit (quota / period) of the cgroup
+func getCgroupCpuLimit() (float64, bool) {
+	// cgroup v2: "<quota> <period>" or "max <period>"
+	if content, ok := readCgroupFile(cgroupCpuMaxFiles); ok {
+		fields := strings.Fields(content)
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return parseCgroupCpuLimit(fields[0], fields[1])
+	}
+
+	// cgroup v1: quota -1 is unlimited
+	quota, ok := readCgroupFile(cgroupCpuQuotaFiles)
+	if !ok {
+		return 0, false
+	}
+	period, ok := readCgroupFile(cgroupCpuPeriodFiles)
+	if !ok {
+		return 0, false
+	}
+	return parseCgroupCpuLimit(quota, period)
+}
+
+func parseCgroupCpuLimit(quota, period string) (float64, bool) {
+	quotaValue, err := strconv.ParseFloat(quota, 64)
+	if err != nil || quotaValue <= 0 {
+		return 0, false
+	}
+	periodValue, err := strconv.ParseFloat(period, 64)
+	if err != nil || periodValue <= 0 {
+		return 0, false
+	}
+	return quotaValue / periodValue, true
+}
+
+// getCgroupMemoryLimit returns the memory limit of the cgroup in bytes
+func getCgroupMemoryLimit() (int64, bool) {
+	content, ok := readCgroupFile(cgroupMemoryFiles)
+	if !ok || content == "max" {
+		return 0, false
+	}
+
+	limit, err := strconv.ParseInt(content, 10, 64)
+	if err != nil || limit <= 0 || limit >= cgroupUnlimitedThreshold {
+		return 0, false
+	}
+	return limit, true
+}
+
+// readCgroupFile returns the trimmed content of the first existing file
+func readCgroupFile(paths []string) (string, bool) {
+	for _, path := range paths {
+		/*  #nosec G304 */
+		if content, err := ioutil.ReadFile(path); err == nil {
+			return strings.TrimSpace(string(content)), true
+		}
+	}
+	return "", false
+}
+
+// parseMemorySize parses a size in bytes with optional unit like GOMEMLIMIT (B, KiB, MiB, GiB, TiB)
+func parseMemorySize(value string) (int64, error) {
+	number, multiplier := strings.TrimSpace(value), int64(1)
+	for _, unit := range memorySizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(number, unit.suffix), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid memory size \"%v\" (eg. 512MiB)", value)
+	}
+	if size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("memory size \"%v\" is too large", value)
+	}
+	return size * multiplier, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	ServiceActionInstall   = "install"
+	ServiceActionUninstall = "uninstall"
+	ServiceActionRun       = "run"
+
+	ServiceDisplayName = "Azure ResourceGraph exporter"
+	ServiceDescription = "Prometheus exporter for Azure ResourceGraph queries"
+)
+
+// serviceArguments returns the command line arguments for the installed service (without the service action)
+func serviceArguments(args []string) []string {
+	ret := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--service":
+			// skip action value
+			i++
+			continue
+		case strings.HasPrefix(arg, "--service="):
+			continue
+		}
+		ret = append(ret, arg)
+	}
+	return append(ret, "--service="+ServiceActionRun)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+)
+
+// handleServiceAction is only supported on windows, use systemd (Type=notify) on linux
+func handleServiceAction(run func()) error {
+	return errors.New("service management is only supported on windows (use systemd with Type=notify on linux)")
+}
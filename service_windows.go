@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+type (
+	windowsService struct {
+		run func()
+	}
+)
+
+// handleServiceAction installs, uninstalls or runs the exporter as windows service
+func handleServiceAction(run func()) error {
+	switch opts.Service.Action {
+	case ServiceActionInstall:
+		return installService()
+	case ServiceActionUninstall:
+		return uninstallService()
+	case ServiceActionRun:
+		return runService(run)
+	}
+	return fmt.Errorf("unknown service action \"%v\"", opts.Service.Action)
+}
+
+func installService() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect() // nolint: errcheck
+
+	if service, err := manager.OpenService(opts.Service.Name); err == nil {
+		service.Close() // nolint: errcheck
+		return fmt.Errorf("service \"%v\" already exists", opts.Service.Name)
+	}
+
+	service, err := manager.CreateService(
+		opts.Service.Name,
+		exePath,
+		mgr.Config{
+			DisplayName: ServiceDisplayName,
+			Description: ServiceDescription,
+			StartType:   mgr.StartAutomatic,
+		},
+		serviceArguments(os.Args[1:])...,
+	)
+	if err != nil {
+		return err
+	}
+	defer service.Close() // nolint: errcheck
+
+	log.Infof("service \"%v\" installed", opts.Service.Name)
+	return nil
+}
+
+func uninstallService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect() // nolint: errcheck
+
+	service, err := manager.OpenService(opts.Service.Name)
+	if err != nil {
+		return fmt.Errorf("service \"%v\" not found: %w", opts.Service.Name, err)
+	}
+	defer service.Close() // nolint: errcheck
+
+	if err := service.Delete(); err != nil {
+		return err
+	}
+
+	log.Infof("service \"%v\" uninstalled", opts.Service.Name)
+	return nil
+}
+
+func runService(run func()) error {
+	// services are started in the system directory, relative paths (eg. templates) are relative to the executable
+	if exePath, err := os.Executable(); err == nil {
+		if err := os.Chdir(filepath.Dir(exePath)); err != nil {
+			return err
+		}
+	}
+
+	return svc.Run(opts.Service.Name, &windowsService{run: run})
+}
+
+// Execute implements svc.Handler
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	finished := make(chan struct{})
+	go func() {
+		s.run()
+		close(finished)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				requestShutdown()
+				<-finished
+				return false, 0
+			}
+		case <-finished:
+			return false, 0
+		}
+	}
+}
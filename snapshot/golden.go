@@ -0,0 +1,225 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ApiPath is the path of the snapshot endpoint of the exporter
+	ApiPath = "/api/snapshot"
+
+	// UpdateGoldenEnv (set to 1 or true) rewrites the golden files with the current snapshot instead of comparing
+	UpdateGoldenEnv = "SNAPSHOT_UPDATE_GOLDEN"
+)
+
+type (
+	// TestingT is the subset of testing.TB used by the golden file helpers
+	TestingT interface {
+		Helper()
+		Fatalf(format string, args ...interface{})
+	}
+)
+
+// Fetch fetches the snapshot of a running exporter, filtered by the query params (eg. module=compute)
+func Fetch(ctx context.Context, exporterUrl, token string, params url.Values) (*Snapshot, error) {
+	apiUrl, err := url.Parse(exporterUrl)
+	if err != nil {
+		return nil, err
+	}
+	apiUrl.Path = strings.TrimSuffix(apiUrl.Path, "/") + ApiPath
+	apiUrl.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // #nosec G307
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%v returned %v: %v", apiUrl.String(), resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return Decode(resp.Body)
+}
+
+// Decode reads a snapshot (json)
+func Decode(r io.Reader) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("unable to decode snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// ReadFile reads a snapshot file (eg. a golden file)
+func ReadFile(path string) (*Snapshot, error) {
+	/*  #nosec G304 */
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(bytes.NewReader(content))
+}
+
+// WriteFile writes the normalized snapshot as indented json
+func WriteFile(path string, snapshot *Snapshot) error {
+	content, err := Encode(snapshot.Normalize())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { // #nosec G301
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0o644) // #nosec G306
+}
+
+// Encode returns the snapshot as indented json (stable output for golden files)
+func Encode(snapshot *Snapshot) ([]byte, error) {
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// Diff compares the normalized snapshots and returns the differences, one line per added (+), removed (-) or
+// changed (~) module, metric or series
+func Diff(expected, actual *Snapshot) []string {
+	expected, actual = expected.Normalize(), actual.Normalize()
+
+	diff := []string{}
+	expectedModules := map[string]Module{}
+	for _, module := range expected.Modules {
+		expectedModules[module.key()] = module
+	}
+	actualModules := map[string]Module{}
+	for _, module := range actual.Modules {
+		actualModules[module.key()] = module
+	}
+
+	for _, module := range expected.Modules {
+		if _, exists := actualModules[module.key()]; !exists {
+			diff = append(diff, fmt.Sprintf("- %v", module.name()))
+		}
+	}
+
+	for _, module := range actual.Modules {
+		expectedModule, exists := expectedModules[module.key()]
+		if !exists {
+			diff = append(diff, fmt.Sprintf("+ %v", module.name()))
+			continue
+		}
+		diff = append(diff, diffModule(expectedModule, module)...)
+	}
+
+	return diff
+}
+
+func diffModule(expected, actual Module) []string {
+	diff := []string{}
+
+	for _, metric := range expected.Metrics {
+		if actual.GetMetric(metric.Name) == nil {
+			diff = append(diff, fmt.Sprintf("- %v %v (%v series)", actual.name(), metric.Name, len(metric.Series)))
+		}
+	}
+
+	for _, metric := range actual.Metrics {
+		expectedMetric := expected.GetMetric(metric.Name)
+		if expectedMetric == nil {
+			diff = append(diff, fmt.Sprintf("+ %v %v (%v series)", actual.name(), metric.Name, len(metric.Series)))
+			continue
+		}
+
+		if expectedMetric.Type != metric.Type || expectedMetric.Help != metric.Help {
+			diff = append(diff, fmt.Sprintf("~ %v %v: type %q -> %q, help %q -> %q", actual.name(), metric.Name, expectedMetric.Type, metric.Type, expectedMetric.Help, metric.Help))
+		}
+
+		expectedSeries := map[string]Series{}
+		for _, series := range expectedMetric.Series {
+			expectedSeries[series.Key()] = series
+		}
+		actualSeries := map[string]Series{}
+		for _, series := range metric.Series {
+			actualSeries[series.Key()] = series
+		}
+
+		for _, series := range expectedMetric.Series {
+			if _, exists := actualSeries[series.Key()]; !exists {
+				diff = append(diff, fmt.Sprintf("- %v %v%v %v", actual.name(), metric.Name, series.Key(), series.Value))
+			}
+		}
+		for _, series := range metric.Series {
+			previous, exists := expectedSeries[series.Key()]
+			switch {
+			case !exists:
+				diff = append(diff, fmt.Sprintf("+ %v %v%v %v", actual.name(), metric.Name, series.Key(), series.Value))
+			case previous.Value != series.Value:
+				diff = append(diff, fmt.Sprintf("~ %v %v%v %v -> %v", actual.name(), metric.Name, series.Key(), previous.Value, series.Value))
+			}
+		}
+	}
+
+	return diff
+}
+
+// name returns the module name for diffs, eg. module "compute" (profile "default", params {...})
+func (m *Module) name() string {
+	ret := fmt.Sprintf("module %q (profile %q", m.Module, m.Profile)
+	if len(m.Params) > 0 {
+		ret += ", params " + formatLabels(m.Params)
+	}
+	return ret + ")"
+}
+
+// AssertGolden compares the normalized snapshot with the golden file and fails the test on differences,
+// with SNAPSHOT_UPDATE_GOLDEN=1 the golden file is written instead
+func AssertGolden(t TestingT, path string, actual *Snapshot) {
+	t.Helper()
+
+	if isUpdateGolden() {
+		if err := WriteFile(path, actual); err != nil {
+			t.Fatalf("unable to update golden file %v: %v", path, err)
+		}
+		return
+	}
+
+	expected, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file %v (set %v=1 to create it): %v", path, UpdateGoldenEnv, err)
+		return
+	}
+
+	if diff := Diff(expected, actual); len(diff) > 0 {
+		t.Fatalf("snapshot differs from golden file %v (set %v=1 to update it):\n%v", path, UpdateGoldenEnv, strings.Join(diff, "\n"))
+	}
+}
+
+func isUpdateGolden() bool {
+	switch strings.ToLower(os.Getenv(UpdateGoldenEnv)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	// recordingT records the failures of the golden file helpers instead of failing the test
+	recordingT struct {
+		failures []string
+	}
+)
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func newTestSnapshot() *Snapshot {
+	return &Snapshot{
+		Time:    "2026-01-01T00:00:00Z",
+		Version: "1.0.0",
+		Modules: []Module{
+			{
+				Profile:       "default",
+				Module:        "summary",
+				Interval:      "1m0s",
+				Subscriptions: "abc",
+				Expires:       "2026-01-01T00:05:00Z",
+				Metrics: []Metric{
+					{
+						Name: "azure_resources",
+						Help: "azure_resources",
+						Type: MetricTypeGauge,
+						Series: []Series{
+							{Labels: map[string]string{"id": "b", "location": "westeurope"}, Value: "2", Timestamp: 1700000000},
+							{Labels: map[string]string{"id": "a", "location": "westeurope"}, Value: "1"},
+						},
+					},
+				},
+			},
+			{
+				Profile: "default",
+				Module:  "",
+				Metrics: []Metric{
+					{Name: "azure_resources_total", Help: "azure_resources_total", Type: MetricTypeGauge, Series: []Series{
+						{Labels: map[string]string{"type": "vm"}, Value: "3"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	snapshot := newTestSnapshot()
+	normalized := snapshot.Normalize()
+
+	if normalized.Time != "" || normalized.Version != "" {
+		t.Errorf("expected time and version to be removed, got %q and %q", normalized.Time, normalized.Version)
+	}
+	if len(normalized.Modules) != 2 || normalized.Modules[0].Module != "" || normalized.Modules[1].Module != "summary" {
+		t.Fatalf("expected modules sorted by name, got %+v", normalized.Modules)
+	}
+
+	module := normalized.Modules[1]
+	if module.Interval != "" || module.Subscriptions != "" || module.Expires != "" {
+		t.Errorf("expected volatile module fields to be removed, got %+v", module)
+	}
+
+	series := module.Metrics[0].Series
+	if series[0].Labels["id"] != "a" || series[1].Labels["id"] != "b" {
+		t.Errorf("expected series sorted by labels, got %+v", series)
+	}
+	if series[1].Timestamp != 0 {
+		t.Errorf("expected timestamp to be removed, got %v", series[1].Timestamp)
+	}
+
+	// the original snapshot is not modified
+	if snapshot.Modules[0].Module != "summary" || snapshot.Modules[0].Metrics[0].Series[0].Timestamp != 1700000000 {
+		t.Errorf("original snapshot was modified: %+v", snapshot.Modules[0])
+	}
+}
+
+func TestWithoutLabels(t *testing.T) {
+	snapshot := newTestSnapshot().WithoutLabels("id")
+
+	series := snapshot.GetModule("summary").GetMetric("azure_resources").Series
+	if len(series) != 1 {
+		t.Fatalf("expected series without id to be merged, got %+v", series)
+	}
+	if series[0].Key() != `{location="westeurope"}` || series[0].Value != "2" {
+		t.Errorf("expected last series to win, got %v %v", series[0].Key(), series[0].Value)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := newTestSnapshot()
+	actual := newTestSnapshot()
+
+	if diff := Diff(expected, actual); len(diff) != 0 {
+		t.Fatalf("expected no differences, got %v", diff)
+	}
+
+	summary := &actual.Modules[0]
+	summary.Metrics[0].Series[0].Value = "5"
+	summary.Metrics[0].Series[1].Labels["location"] = "eastus"
+	summary.Metrics = append(summary.Metrics, Metric{Name: "azure_new", Help: "azure_new", Type: MetricTypeGauge, Series: []Series{{Labels: map[string]string{}, Value: "1"}}})
+	actual.Modules = append(actual.Modules[:1], Module{Profile: "default", Module: "compute", Params: map[string]string{"location": "westeurope"}})
+
+	expectedDiff := []string{
+		`- module "" (profile "default")`,
+		`+ module "compute" (profile "default", params {location="westeurope"})`,
+		`+ module "summary" (profile "default") azure_new (1 series)`,
+		`- module "summary" (profile "default") azure_resources{id="a",location="westeurope"} 1`,
+		`+ module "summary" (profile "default") azure_resources{id="a",location="eastus"} 1`,
+		`~ module "summary" (profile "default") azure_resources{id="b",location="westeurope"} 2 -> 5`,
+	}
+	if diff := Diff(expected, actual); !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("unexpected diff\nexpected:\n%v\nactual:\n%v", strings.Join(expectedDiff, "\n"), strings.Join(diff, "\n"))
+	}
+}
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "summary.golden.json")
+
+	// golden file is missing
+	t.Setenv(UpdateGoldenEnv, "")
+	recorder := &recordingT{}
+	AssertGolden(recorder, path, newTestSnapshot())
+	if len(recorder.failures) != 1 || !strings.Contains(recorder.failures[0], UpdateGoldenEnv+"=1") {
+		t.Fatalf("expected failure about the missing golden file, got %v", recorder.failures)
+	}
+
+	// golden file is written (incl. directory)
+	t.Setenv(UpdateGoldenEnv, "1")
+	recorder = &recordingT{}
+	AssertGolden(recorder, path, newTestSnapshot())
+	if len(recorder.failures) != 0 {
+		t.Fatalf("unexpected failures while updating the golden file: %v", recorder.failures)
+	}
+
+	golden, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read written golden file: %v", err)
+	}
+	if !reflect.DeepEqual(golden, newTestSnapshot().Normalize()) {
+		t.Errorf("expected normalized snapshot in golden file, got %+v", golden)
+	}
+
+	// volatile fields don't cause differences
+	t.Setenv(UpdateGoldenEnv, "")
+	actual := newTestSnapshot()
+	actual.Time = "2026-02-01T00:00:00Z"
+	actual.Modules[0].Expires = "2026-02-01T00:05:00Z"
+	recorder = &recordingT{}
+	AssertGolden(recorder, path, actual)
+	if len(recorder.failures) != 0 {
+		t.Fatalf("unexpected failures comparing with golden file: %v", recorder.failures)
+	}
+
+	// changed values fail with the diff
+	actual.Modules[1].Metrics[0].Series[0].Value = "4"
+	recorder = &recordingT{}
+	AssertGolden(recorder, path, actual)
+	if len(recorder.failures) != 1 || !strings.Contains(recorder.failures[0], `~ module "" (profile "default") azure_resources_total{type="vm"} 3 -> 4`) {
+		t.Errorf("expected failure with diff, got %v", recorder.failures)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prefix"+ApiPath || r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("module") != "summary" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		content, _ := Encode(newTestSnapshot())
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	snapshot, err := Fetch(context.Background(), server.URL+"/prefix/", "secret", url.Values{"module": []string{"summary"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(snapshot, newTestSnapshot()) {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	if _, err := Fetch(context.Background(), server.URL, "wrong", nil); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected error with status, got %v", err)
+	}
+}
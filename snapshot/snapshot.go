@@ -0,0 +1,194 @@
+// Package snapshot contains the format of the /api/snapshot endpoint of the exporter and helpers for golden file
+// tests of query configs (eg. run the exporter in mock mode, scrape the modules and compare the snapshot with a
+// golden file).
+package snapshot
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// MetricTypeGauge is the type of all query metrics
+	MetricTypeGauge = "gauge"
+)
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+type (
+	// Snapshot contains the materialized metrics (cached probe results) of the exporter
+	Snapshot struct {
+		Time    string   `json:"time,omitempty"`
+		Version string   `json:"version,omitempty"`
+		Modules []Module `json:"modules"`
+	}
+
+	// Module is a cached probe result of a module
+	Module struct {
+		Profile       string            `json:"profile"`
+		Module        string            `json:"module"`
+		Params        map[string]string `json:"params,omitempty"`
+		Interval      string            `json:"interval,omitempty"`
+		Subscriptions string            `json:"subscriptions,omitempty"`
+		Expires       string            `json:"expires,omitempty"`
+		Metrics       []Metric          `json:"metrics"`
+	}
+
+	// Metric contains the series of a metric as exposed by /probe
+	Metric struct {
+		Name   string   `json:"name"`
+		Help   string   `json:"help"`
+		Type   string   `json:"type"`
+		Series []Series `json:"series"`
+	}
+
+	// Series is one series of a metric, the value is formatted as in the Prometheus text format
+	// (NaN and Inf can't be encoded as json numbers)
+	Series struct {
+		Labels    map[string]string `json:"labels"`
+		Value     string            `json:"value"`
+		Timestamp int64             `json:"timestamp,omitempty"`
+	}
+)
+
+// Sort sorts the modules (profile, module, params), metrics (name) and series (labels)
+func (s *Snapshot) Sort() {
+	sort.SliceStable(s.Modules, func(i, j int) bool {
+		return s.Modules[i].key() < s.Modules[j].key()
+	})
+
+	for m := range s.Modules {
+		metrics := s.Modules[m].Metrics
+		sort.SliceStable(metrics, func(i, j int) bool {
+			return metrics[i].Name < metrics[j].Name
+		})
+
+		for i := range metrics {
+			series := metrics[i].Series
+			sort.SliceStable(series, func(a, b int) bool {
+				return series[a].Key() < series[b].Key()
+			})
+		}
+	}
+}
+
+// Normalize returns a sorted copy without volatile fields (snapshot time, version, cache expiry, scrape interval,
+// subscription scope and series timestamps), which is stable between test runs
+func (s *Snapshot) Normalize() *Snapshot {
+	ret := &Snapshot{Modules: []Module{}}
+	for _, module := range s.Modules {
+		normalized := Module{
+			Profile: module.Profile,
+			Module:  module.Module,
+			Metrics: []Metric{},
+		}
+		if len(module.Params) > 0 {
+			normalized.Params = copyLabels(module.Params)
+		}
+		for _, metric := range module.Metrics {
+			normalizedMetric := Metric{Name: metric.Name, Help: metric.Help, Type: metric.Type, Series: []Series{}}
+			for _, series := range metric.Series {
+				normalizedMetric.Series = append(normalizedMetric.Series, Series{Labels: copyLabels(series.Labels), Value: series.Value})
+			}
+			normalized.Metrics = append(normalized.Metrics, normalizedMetric)
+		}
+		ret.Modules = append(ret.Modules, normalized)
+	}
+	ret.Sort()
+	return ret
+}
+
+// WithoutLabels returns a normalized copy without the labels (eg. ids or labels with timestamps),
+// series which are identical without these labels are merged
+func (s *Snapshot) WithoutLabels(labelNames ...string) *Snapshot {
+	ret := s.Normalize()
+	for m := range ret.Modules {
+		for i, metric := range ret.Modules[m].Metrics {
+			series := []Series{}
+			index := map[string]int{}
+			for _, row := range metric.Series {
+				for _, labelName := range labelNames {
+					delete(row.Labels, labelName)
+				}
+				if n, exists := index[row.Key()]; exists {
+					// duplicate series, the following one wins (same as /probe)
+					series[n] = row
+					continue
+				}
+				index[row.Key()] = len(series)
+				series = append(series, row)
+			}
+			ret.Modules[m].Metrics[i].Series = series
+		}
+	}
+	ret.Sort()
+	return ret
+}
+
+// WithoutValues returns a normalized copy with empty values, only the series are compared
+// (eg. for metrics of resources which change over time)
+func (s *Snapshot) WithoutValues() *Snapshot {
+	ret := s.Normalize()
+	for m := range ret.Modules {
+		for i := range ret.Modules[m].Metrics {
+			for n := range ret.Modules[m].Metrics[i].Series {
+				ret.Modules[m].Metrics[i].Series[n].Value = ""
+			}
+		}
+	}
+	return ret
+}
+
+// GetModule returns the first cached result of the module (any profile and params), nil if not found
+func (s *Snapshot) GetModule(module string) *Module {
+	for i := range s.Modules {
+		if s.Modules[i].Module == module {
+			return &s.Modules[i]
+		}
+	}
+	return nil
+}
+
+// GetMetric returns the metric, nil if not found
+func (m *Module) GetMetric(name string) *Metric {
+	for i := range m.Metrics {
+		if m.Metrics[i].Name == name {
+			return &m.Metrics[i]
+		}
+	}
+	return nil
+}
+
+// key identifies the module result (profile, module and params)
+func (m *Module) key() string {
+	return m.Profile + "\x00" + m.Module + "\x00" + formatLabels(m.Params)
+}
+
+// Key returns the labels in Prometheus format (sorted by label name), eg. {location="westeurope",type="vm"}
+func (s *Series) Key() string {
+	return formatLabels(s.Labels)
+}
+
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+`="`+labelValueEscaper.Replace(labels[name])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	ret := make(map[string]string, len(labels))
+	for name, value := range labels {
+		ret[name] = value
+	}
+	return ret
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	flags "github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	OptionSourceFlag       = "flag"
+	OptionSourceEnv        = "env"
+	OptionSourceDefault    = "default"
+	OptionSourceConfigFile = "config file"
+)
+
+// logStartupOptions logs all effective options as yaml including the source of each value
+func logStartupOptions() {
+	lines := []string{"options:"}
+	for _, option := range argparserOptions(argparser.Group) {
+		switch option.LongName {
+		case "", "help", "version":
+			continue
+		}
+
+		value, source := describeOption(option)
+		lines = append(lines, fmt.Sprintf("  %s: %s  # %s", option.LongNameWithNamespace(), value, source))
+	}
+	logYaml("effective options", lines)
+}
+
+// logStartupConfig logs the settings loaded from the config file
+func logStartupConfig(cfg *config.Config) {
+	source := fmt.Sprintf("%s %s", OptionSourceConfigFile, opts.Config.Path)
+	if opts.Config.Path == "" {
+		source = "no config file"
+	}
+
+	profiles := []string{}
+	for name := range cfg.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	querySources := []string{}
+	for _, querySource := range cfg.GetSources() {
+		querySources = append(querySources, fmt.Sprintf("%s (%d)", querySource.Source, querySource.Queries))
+	}
+
+	lines := []string{
+		"config:",
+		fmt.Sprintf("  apiVersion: %s  # %s", formatOptionValue(cfg.ApiVersion), source),
+		fmt.Sprintf("  profiles: %s  # %s", formatOptionValue(profiles), source),
+		fmt.Sprintf("  modules: %s  # %s", formatOptionValue(cfg.GetModules()), source),
+		fmt.Sprintf("  queries: %d  # %s", len(cfg.Queries), source),
+		fmt.Sprintf("  querySources: %s  # merged", formatOptionValue(querySources)),
+		fmt.Sprintf("  relabelConfigs: %d  # %s", len(cfg.RelabelConfigs), source),
+		fmt.Sprintf("  derivedMetrics: %d  # %s", len(cfg.DerivedMetrics), source),
+	}
+	logYaml("effective config", lines)
+}
+
+// logYaml logs a yaml document, as field for json logging or as raw block for text logging
+func logYaml(message string, lines []string) {
+	document := strings.Join(lines, "\n")
+	if opts.Logger.LogJson {
+		log.WithField("yaml", document).Info(message)
+		return
+	}
+
+	log.Info(message)
+	if _, err := fmt.Fprintln(log.StandardLogger().Out, document); err != nil {
+		log.Error(err)
+	}
+}
+
+// argparserOptions returns all options of the group and its subgroups
+func argparserOptions(group *flags.Group) []*flags.Option {
+	options := group.Options()
+	for _, subGroup := range group.Groups() {
+		options = append(options, argparserOptions(subGroup)...)
+	}
+	return options
+}
+
+// describeOption returns the redacted value of the option and its source (flag, env or default)
+func describeOption(option *flags.Option) (value string, source string) {
+	if option.Field().Tag.Get("secret") == "true" {
+		value = formatOptionValue(config.RedactedValue)
+		if reflect.ValueOf(option.Value()).IsZero() {
+			value = formatOptionValue("")
+		}
+	} else {
+		value = formatOptionValue(option.Value())
+	}
+
+	envKey := option.EnvKeyWithNamespace()
+	_, envIsSet := os.LookupEnv(envKey)
+
+	switch {
+	case option.IsSet() && !option.IsSetDefault():
+		source = OptionSourceFlag
+	case envKey != "" && envIsSet:
+		source = fmt.Sprintf("%s %s", OptionSourceEnv, envKey)
+	default:
+		source = OptionSourceDefault
+	}
+
+	return
+}
+
+// formatOptionValue formats values as yaml scalars or flow sequences (maps as sorted key=value pairs)
+func formatOptionValue(val interface{}) string {
+	switch v := val.(type) {
+	case *string:
+		if v == nil {
+			return "null"
+		}
+		return formatOptionValue(*v)
+	case string:
+		return strconv.Quote(config.RedactString(v))
+	case []string:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = formatOptionValue(item)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = key + "=" + v[key]
+		}
+		return formatOptionValue(values)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SystemdNotifyReady     = "READY=1"
+	SystemdNotifyReloading = "RELOADING=1"
+	SystemdNotifyStopping  = "STOPPING=1"
+)
+
+// systemdNotify sends a state notification to systemd (Type=notify), noop if not started by systemd
+func systemdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		log.Warnf("unable to connect to systemd notify socket: %v", err)
+		return
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Warnf("unable to send systemd notification: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/webdevops/azure-resourcegraph-exporter/config"
+)
+
+const (
+	ExitCodeOk     = 0
+	ExitCodeFlags  = 1
+	ExitCodeConfig = 2
+	ExitCodeAzure  = 3
+)
+
+var (
+	metricNameReplacementRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]*$`)
+)
+
+type (
+	StartupValidation struct {
+		Problems []StartupProblem
+	}
+
+	StartupProblem struct {
+		Phase    string
+		ExitCode int
+		Err      error
+	}
+)
+
+// Check records all errors for the validation phase
+func (v *StartupValidation) Check(phase string, exitCode int, errs ...error) {
+	for _, err := range errs {
+		if err != nil {
+			v.Problems = append(v.Problems, StartupProblem{Phase: phase, ExitCode: exitCode, Err: err})
+		}
+	}
+}
+
+// ExitCode returns the exit code of the most fundamental problem (flags before config before azure)
+func (v *StartupValidation) ExitCode() int {
+	exitCode := ExitCodeOk
+	for _, problem := range v.Problems {
+		if exitCode == ExitCodeOk || problem.ExitCode < exitCode {
+			exitCode = problem.ExitCode
+		}
+	}
+	return exitCode
+}
+
+// Finish logs the validation report and exits if any problem was found
+func (v *StartupValidation) Finish() {
+	if len(v.Problems) == 0 {
+		return
+	}
+
+	log.Errorf("startup validation failed with %v problem(s):", len(v.Problems))
+	for _, problem := range v.Problems {
+		log.WithField("phase", problem.Phase).Error(problem.Err.Error())
+	}
+	os.Exit(v.ExitCode())
+}
+
+// validateFlags checks flag combinations and values which cannot be checked by the argparser
+func validateFlags() (errs []error) {
+	if !isConfigSet() {
+		errs = append(errs, errors.New("config path or query files are required (--config, --config.queries, --config.kubernetes.selector)"))
+	}
+
+	if opts.Validation.SkipAzureCheck && !opts.Validation.Validate {
+		errs = append(errs, errors.New("--skip-azure-check requires --validate"))
+	}
+
+	backendModes := 0
+	for _, dir := range []string{opts.Azure.Record, opts.Azure.Replay, opts.Azure.Mock} {
+		if dir != "" {
+			backendModes++
+		}
+	}
+	if backendModes > 1 {
+		errs = append(errs, errors.New("--azure.record, --azure.replay and --azure.mock cannot be used together"))
+	}
+
+	for _, flag := range []struct {
+		name string
+		dir  string
+	}{
+		{"--azure.record", opts.Azure.Record},
+		{"--azure.replay", opts.Azure.Replay},
+		{"--azure.mock", opts.Azure.Mock},
+	} {
+		if dir := flag.dir; dir != "" {
+			if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+				errs = append(errs, fmt.Errorf("directory \"%v\" for %v does not exist", dir, flag.name))
+			}
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(opts.ServerBind); err != nil {
+		errs = append(errs, fmt.Errorf("invalid address \"%v\" for --bind: %w", opts.ServerBind, err))
+	}
+
+	if _, err := azure.EnvironmentFromName(*opts.Azure.Environment); err != nil {
+		errs = append(errs, fmt.Errorf("invalid Azure environment \"%v\" for --azure-environment: %w", *opts.Azure.Environment, err))
+	}
+
+	if opts.Azure.Identity.ClientID != "" && opts.Azure.Identity.ResourceID != "" {
+		errs = append(errs, errors.New("--azure.identity.client-id and --azure.identity.resource-id are mutually exclusive"))
+	}
+
+	if err := validateFlagUrl("--azure.authority-host", opts.Azure.AuthorityHost); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateFlagUrl("--azure.imds-endpoint", opts.Azure.ImdsEndpoint); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, validateAzureHttpFlags()...)
+	errs = append(errs, validateQueryExportFlags()...)
+	errs = append(errs, validateOtlpExportFlags()...)
+	errs = append(errs, validateBridgeExportFlags()...)
+
+	if !metricNameReplacementRegexp.MatchString(opts.Metrics.Sanitize.Replacement) {
+		errs = append(errs, fmt.Errorf("invalid --metrics.sanitize.replacement \"%v\", only [a-zA-Z0-9_] allowed", opts.Metrics.Sanitize.Replacement))
+	}
+
+	if opts.Azure.Pagination.Concurrency < 1 {
+		errs = append(errs, errors.New("--azure.pagination.concurrency must be at least 1"))
+	}
+
+	if opts.Cache.Refresh.Jitter < 0 || opts.Cache.Refresh.Jitter > 0.5 {
+		errs = append(errs, errors.New("--cache.refresh.jitter must be between 0 and 0.5"))
+	}
+
+	if opts.Probe.ScrapeInterval <= 0 {
+		errs = append(errs, errors.New("--probe.scrape-interval must be positive"))
+	}
+
+	if opts.Probe.TimeoutOffset < 0 {
+		errs = append(errs, errors.New("--probe.timeout-offset must not be negative"))
+	}
+
+	if opts.Probe.MaxSeries < 0 {
+		errs = append(errs, errors.New("--probe.max-series must not be negative"))
+	}
+
+	if opts.Probe.MaxBytes < 0 {
+		errs = append(errs, errors.New("--probe.max-bytes must not be negative"))
+	}
+
+	if opts.Api.DebugRows < 0 {
+		errs = append(errs, errors.New("--api.debug.rows must not be negative"))
+	}
+
+	if opts.Runtime.MaxProcs < -1 {
+		errs = append(errs, errors.New("--runtime.gomaxprocs must be -1 (Go default), 0 (cgroup limit) or positive"))
+	}
+
+	if opts.Runtime.MemLimit != "" && !strings.EqualFold(opts.Runtime.MemLimit, RuntimeMemLimitOff) {
+		if _, err := parseMemorySize(opts.Runtime.MemLimit); err != nil {
+			errs = append(errs, fmt.Errorf("--runtime.gomemlimit: %w", err))
+		}
+	}
+
+	if opts.Runtime.MemLimitRatio <= 0 || opts.Runtime.MemLimitRatio > 1 {
+		errs = append(errs, errors.New("--runtime.gomemlimit.ratio must be between 0 and 1"))
+	}
+
+	if opts.Chaos.ThrottleRatio < 0 || opts.Chaos.ErrorRatio < 0 || opts.Chaos.ThrottleRatio+opts.Chaos.ErrorRatio > 1 {
+		errs = append(errs, errors.New("--chaos.throttle-ratio and --chaos.error-ratio must be between 0 and 1 (in sum)"))
+	}
+
+	if opts.Readiness.RetryInterval <= 0 {
+		errs = append(errs, errors.New("--readiness.retry-interval must be positive"))
+	}
+
+	if opts.Api.Load.Window <= 0 {
+		errs = append(errs, errors.New("--api.load.window must be positive"))
+	}
+
+	for _, operator := range opts.Api.Query.DeniedOperators {
+		if !config.IsKustoTabularOperator(operator) {
+			errs = append(errs, fmt.Errorf("unknown tabular operator \"%v\" for --api.query.denied-operators", operator))
+		}
+	}
+
+	for _, flag := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"--web.read-header-timeout", opts.Web.ReadHeaderTimeout},
+		{"--web.read-timeout", opts.Web.ReadTimeout},
+		{"--web.write-timeout", opts.Web.WriteTimeout},
+		{"--web.idle-timeout", opts.Web.IdleTimeout},
+	} {
+		if flag.timeout < 0 {
+			errs = append(errs, fmt.Errorf("%v must not be negative", flag.name))
+		}
+	}
+
+	if opts.Web.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("--web.max-header-bytes must be positive"))
+	}
+
+	if _, cidrErrs := parseWebAllowCidr(opts.Web.AllowCidr); len(cidrErrs) > 0 {
+		errs = append(errs, cidrErrs...)
+	}
+
+	errs = append(errs, validateWebConfig()...)
+
+	if opts.Config.Kubernetes.Interval <= 0 {
+		errs = append(errs, errors.New("--config.kubernetes.interval must be positive"))
+	}
+
+	if opts.Config.Kubernetes.CrdInterval <= 0 {
+		errs = append(errs, errors.New("--config.kubernetes.crd.interval must be positive"))
+	}
+
+	if opts.Azure.LazyInit.RetryInterval <= 0 {
+		errs = append(errs, errors.New("--azure.lazy-init.retry-interval must be positive"))
+	}
+
+	if opts.Metrics.Timestamps.MaxAge <= 0 {
+		errs = append(errs, errors.New("--metrics.timestamps.max-age must be positive"))
+	}
+
+	if opts.Metrics.Sanitize.MaxLength < 0 {
+		errs = append(errs, errors.New("--metrics.sanitize.max-length must not be negative"))
+	}
+
+	for _, subId := range opts.Azure.Subscription {
+		if subId == "" {
+			errs = append(errs, errors.New("empty Azure subscription ID for --azure-subscription"))
+		}
+	}
+
+	return
+}
+
+// validateFlagUrl checks if the flag value is an absolute url (empty values are valid)
+func validateFlagUrl(name, val string) error {
+	if val == "" {
+		return nil
+	}
+
+	if parsedUrl, err := url.Parse(val); err != nil || parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+		return fmt.Errorf("invalid url \"%v\" for %v", val, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	webAllowCidrNetworks []*net.IPNet
+)
+
+// parseWebAllowCidr parses the --web.allow-cidr networks, plain ip addresses are treated as single host networks
+func parseWebAllowCidr(values []string) (networks []*net.IPNet, errs []error) {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				errs = append(errs, fmt.Errorf("invalid --web.allow-cidr \"%v\"", value))
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid --web.allow-cidr \"%v\": %w", value, err))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// initWebAllowCidr parses the allowed client networks (all clients are allowed if none are configured)
+func initWebAllowCidr() {
+	networks, errs := parseWebAllowCidr(opts.Web.AllowCidr)
+	if len(errs) > 0 {
+		log.Fatal(errs[0])
+	}
+	webAllowCidrNetworks = networks
+
+	if len(networks) > 0 {
+		log.Infof("restricting scrape, api and lifecycle endpoints to %v", strings.Join(opts.Web.AllowCidr, ", "))
+	}
+}
+
+// isWebClientAllowed checks if the client address of the request is inside one of the allowed networks
+func isWebClientAllowed(r *http.Request) bool {
+	if len(webAllowCidrNetworks) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range webAllowCidrNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// webAllowCidr rejects requests of clients outside of --web.allow-cidr
+func webAllowCidr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebClientAllowed(r) {
+			log.WithField("client", r.RemoteAddr).Debugf("rejected request for %v, client not in --web.allow-cidr", r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
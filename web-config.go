@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// webToolkitLogger passes the log messages of the exporter-toolkit (go-kit key value pairs) to logrus
+	webToolkitLogger struct{}
+)
+
+// newWebFlagConfig returns the exporter-toolkit flags (--bind and --web.config.file)
+func newWebFlagConfig() *web.FlagConfig {
+	systemdSocket := false
+	return &web.FlagConfig{
+		WebListenAddresses: &[]string{opts.ServerBind},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &opts.Web.ConfigFile,
+	}
+}
+
+// validateWebConfig reads and validates --web.config.file incl. the certificates, the exporter-toolkit reads
+// the file again for every request and tls handshake (changes are active without reload)
+func validateWebConfig() []error {
+	if err := web.Validate(opts.Web.ConfigFile); err != nil {
+		return []error{fmt.Errorf("invalid web config \"%v\": %w", opts.Web.ConfigFile, err)}
+	}
+	return nil
+}
+
+func (webToolkitLogger) Log(keyvals ...interface{}) error {
+	level := log.InfoLevel
+	message := ""
+	fields := log.Fields{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch key := fmt.Sprintf("%v", keyvals[i]); key {
+		case "level":
+			if parsedLevel, err := log.ParseLevel(fmt.Sprintf("%v", keyvals[i+1])); err == nil {
+				level = parsedLevel
+			}
+		case "msg":
+			message = fmt.Sprintf("%v", keyvals[i+1])
+		default:
+			fields[key] = keyvals[i+1]
+		}
+	}
+
+	log.WithFields(fields).Log(level, message)
+	return nil
+}